@@ -0,0 +1,192 @@
+package acme
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/odacremolbap/xfon/pkg/acme"
+	"github.com/odacremolbap/xfon/pkg/ca"
+	"github.com/odacremolbap/xfon/pkg/passphrase"
+	"github.com/spf13/cobra"
+)
+
+const (
+	defaultListen = ":14000"
+	// accountsName is the default accounts file at the CA directory
+	accountsName = "acme-accounts.json"
+)
+
+var (
+	caDir        string
+	listen       string
+	baseURL      string
+	tlsCert      string
+	tlsKey       string
+	profileName  string
+	accountsFile string
+	httpPort     string
+	dnsResolver  string
+	acceptAll    bool
+	caPass       passphrase.Source
+
+	// RootCmd contains ACME commands
+	RootCmd = &cobra.Command{
+		Use:   "acme",
+		Short: "acme serves an RFC 8555 ACME directory backed by a local CA",
+		Run:   runHelp,
+	}
+
+	// ServeCmd runs the ACME server
+	ServeCmd = &cobra.Command{
+		Use:   "serve",
+		Short: "serves an ACME directory issuing certificates from a CA directory",
+		Long: `Serves an ACME directory that issues certificates from a CA directory
+created with "xfon ca init". Accounts, orders and http-01 and dns-01
+challenges are supported for DNS identifiers, wildcards only accept
+dns-01. Certificates are recorded at the CA index and can be revoked
+through ACME or with "xfon ca revoke".
+
+Accounts are stored at the CA directory, orders only live while the
+server runs. Other commands must not modify the CA directory while
+the server is running.
+
+The directory URL is printed on start. For local testing, challenges
+can be accepted without validation using --accept-all-challenges.`,
+		Run:  serveRun,
+		Args: serveVal,
+	}
+)
+
+func runHelp(cmd *cobra.Command, args []string) {
+	cmd.Help()
+}
+
+func init() {
+	ServeCmd.Flags().StringVar(&caDir, "ca-dir", "", "CA directory issuing the certificates")
+	ServeCmd.Flags().StringVar(&listen, "listen", defaultListen, "address to listen at")
+	ServeCmd.Flags().StringVar(&baseURL, "base-url", "", "external URL of the server, as reached by clients, derived from --listen if not informed")
+	ServeCmd.Flags().StringVar(&tlsCert, "tls-cert", "", "certificate to serve ACME over HTTPS, requires --tls-key")
+	ServeCmd.Flags().StringVar(&tlsKey, "tls-key", "", "unencrypted key for the HTTPS certificate")
+	ServeCmd.Flags().StringVar(&profileName, "profile", "", "issuance profile, the CA default profile if not informed")
+	ServeCmd.Flags().StringVar(&accountsFile, "accounts-file", "", "file storing ACME accounts, "+accountsName+" at the CA directory if not informed")
+	ServeCmd.Flags().StringVar(&httpPort, "http-port", "80", "port where http-01 challenges are fetched from")
+	ServeCmd.Flags().StringVar(&dnsResolver, "dns-resolver", "", "DNS server as host:port queried for dns-01 challenges, the system resolver if not informed")
+	ServeCmd.Flags().BoolVar(&acceptAll, "accept-all-challenges", false, "accept challenges without validating them, only for testing")
+	ServeCmd.Flags().StringVar(&caPass.Env, "ca-key-passphrase-env", "", "environment variable containing the passphrase for an encrypted CA key")
+	ServeCmd.Flags().StringVar(&caPass.File, "ca-key-passphrase-file", "", "file containing the passphrase for an encrypted CA key")
+	RootCmd.AddCommand(ServeCmd)
+}
+
+// serveVal validates parameters for the serve command
+func serveVal(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("unexpected arguments: %v", args)
+	}
+	if caDir == "" {
+		return fmt.Errorf("--ca-dir must be informed")
+	}
+	if (tlsCert == "") != (tlsKey == "") {
+		return fmt.Errorf("--tls-cert and --tls-key must be informed together")
+	}
+	if acceptAll && dnsResolver != "" {
+		return fmt.Errorf("--dns-resolver cannot be used with --accept-all-challenges")
+	}
+	if dnsResolver != "" {
+		if _, _, err := net.SplitHostPort(dnsResolver); err != nil {
+			return fmt.Errorf("--dns-resolver must be host:port: %s", err.Error())
+		}
+	}
+	if baseURL == "" {
+		host, port, err := net.SplitHostPort(listen)
+		if err != nil {
+			return fmt.Errorf("invalid --listen address: %s", err.Error())
+		}
+		if host == "" || host == "0.0.0.0" || host == "::" {
+			host = "localhost"
+		}
+		scheme := "http"
+		if tlsCert != "" {
+			scheme = "https"
+		}
+		baseURL = fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(host, port))
+	}
+	if !strings.HasPrefix(baseURL, "http://") && !strings.HasPrefix(baseURL, "https://") {
+		return fmt.Errorf("--base-url must be an http or https URL")
+	}
+	if accountsFile == "" {
+		accountsFile = filepath.Join(caDir, accountsName)
+	}
+	return nil
+}
+
+// serveRun runs the ACME server until it fails
+func serveRun(cmd *cobra.Command, args []string) {
+	authority, err := ca.Open(caDir)
+	if err != nil {
+		log.Printf("%v", err.Error())
+		os.Exit(-1)
+	}
+	signer, err := authority.Signer(&caPass)
+	if err != nil {
+		log.Printf("%v", err.Error())
+		os.Exit(-1)
+	}
+
+	var v acme.Validator
+	if acceptAll {
+		log.Printf("WARNING: challenges are accepted without validation")
+		v = acme.ValidatorFunc(func(ctx context.Context, challengeType, domain, token, keyAuthorization string) error {
+			return nil
+		})
+	} else {
+		nv := &acme.NetValidator{
+			HTTPClient: &http.Client{Timeout: 10 * time.Second},
+			HTTPPort:   httpPort,
+		}
+		if dnsResolver != "" {
+			r := &net.Resolver{
+				PreferGo: true,
+				Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+					d := net.Dialer{}
+					return d.DialContext(ctx, network, dnsResolver)
+				},
+			}
+			nv.LookupTXT = r.LookupTXT
+		}
+		v = nv
+	}
+
+	s, err := acme.NewServer(&acme.Options{
+		BaseURL:      baseURL,
+		CA:           authority,
+		Signer:       signer,
+		Profile:      profileName,
+		Validator:    v,
+		AccountsFile: accountsFile,
+	})
+	if err != nil {
+		log.Printf("%v", err.Error())
+		os.Exit(-1)
+	}
+
+	fmt.Printf("ACME directory at %s\n", s.DirectoryURL())
+	srv := &http.Server{
+		Addr:              listen,
+		Handler:           s,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	if tlsCert != "" {
+		err = srv.ListenAndServeTLS(tlsCert, tlsKey)
+	} else {
+		err = srv.ListenAndServe()
+	}
+	log.Printf("%v", err.Error())
+	os.Exit(-1)
+}
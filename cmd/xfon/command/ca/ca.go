@@ -0,0 +1,600 @@
+package ca
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/odacremolbap/xfon/cmd/xfon/command/flags"
+	"github.com/odacremolbap/xfon/pkg/ca"
+	"github.com/odacremolbap/xfon/pkg/cert"
+	"github.com/odacremolbap/xfon/pkg/filesystem"
+	"github.com/odacremolbap/xfon/pkg/key"
+	"github.com/odacremolbap/xfon/pkg/passphrase"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	// subject
+	subjectFlags flags.Subject
+	subject      *cert.Subject
+
+	// init
+	keyType        string
+	bits           int
+	curve          string
+	days           int
+	certIn         string
+	encryptKey     bool
+	newPass        passphrase.Source
+	defaultProfile string
+	profileFile    string
+	crlValidity    string
+
+	// issue
+	profileName    string
+	dnsAddressList string
+	ipAddressList  string
+	uriSANList     string
+	emailSANList   string
+	csrIn          string
+	copyExtensions string
+	certOut        string
+
+	certEncodingFlag flags.CertEncoding
+	certEncoding     cert.Encoding
+
+	// revoke
+	reason    string
+	revokedAt string
+	reasonNum int
+	at        time.Time
+
+	// list
+	status string
+	output string
+
+	// crl
+	crlOut string
+
+	// distribution URLs, stored at the configuration by init
+	// and overriding it at issue
+	distributionFlags flags.Distribution
+
+	keyIn   string
+	keyPass passphrase.Source
+	caPass  passphrase.Source
+
+	// RootCmd contains local CA commands
+	RootCmd = &cobra.Command{
+		Use:   "ca",
+		Short: "ca manages a local CA directory that records the certificates it issues",
+		Run:   runHelp,
+	}
+
+	// InitCmd creates a CA directory
+	InitCmd = &cobra.Command{
+		Use:   "init <dir>",
+		Short: "creates a CA directory with a new or existing CA certificate",
+		Long: `Creates a CA directory containing the CA certificate and key, the
+configuration, serial and CRL number counters, and a JSON index of
+issued certificates.
+
+A self signed CA is generated using the root-ca profile unless an
+existing CA certificate and key are informed with --cert and --key-in.`,
+		Run:  initRun,
+		Args: initVal,
+	}
+
+	// IssueCmd issues a certificate from the CA directory
+	IssueCmd = &cobra.Command{
+		Use:   "issue <dir>",
+		Short: "issues a certificate for a key or a certificate signing request",
+		Long: `Issues a certificate for a key or a certificate signing request,
+using the next serial number and recording it at the index. A copy of
+the certificate is stored under the certs directory and its serial
+number is printed.
+
+Validity and usages come from the informed profile, or the CA
+default profile.`,
+		Run:  issueRun,
+		Args: issueVal,
+	}
+
+	// ListCmd prints the certificates issued by the CA
+	ListCmd = &cobra.Command{
+		Use:   "list <dir>",
+		Short: "prints the certificates issued by the CA",
+		Run:   listRun,
+		Args:  listVal,
+	}
+
+	// RevokeCmd marks a certificate as revoked
+	RevokeCmd = &cobra.Command{
+		Use:   "revoke <dir> <serial>",
+		Short: "marks a certificate as revoked, to be included at the next CRL",
+		Run:   revokeRun,
+		Args:  revokeVal,
+	}
+
+	// CRLCmd generates the CA CRL
+	CRLCmd = &cobra.Command{
+		Use:   "crl <dir>",
+		Short: "generates a CRL with the revoked certificates",
+		Long: `Generates a CRL with the revoked certificates at the index, using
+the next CRL number and the configured validity. The CRL is stored
+as crl.pem at the CA directory.`,
+		Run:  crlRun,
+		Args: cobra.ExactArgs(1),
+	}
+)
+
+func runHelp(cmd *cobra.Command, args []string) {
+	cmd.Help()
+}
+
+func init() {
+	flags.AddSubjectFlags(InitCmd, &subjectFlags)
+	InitCmd.Flags().StringVar(&keyType, "type", string(key.RSA), "[rsa|ecdsa|ed25519] generated CA key type")
+	InitCmd.Flags().IntVar(&bits, "bits", 4096, "key size, only for RSA keys")
+	InitCmd.Flags().StringVar(&curve, "curve", "P-256", "[P-256|P-384|P-521] elliptic curve, only for ECDSA keys")
+	InitCmd.Flags().IntVar(&days, "days", 0, "number of validity days for the generated CA certificate, as at the root-ca profile if not informed")
+	InitCmd.Flags().StringVar(&certIn, "cert", "", "path to an existing CA certificate, requires --key-in")
+	InitCmd.Flags().StringVar(&keyIn, "key-in", "", "path to the existing CA key")
+	InitCmd.Flags().StringVar(&keyPass.Env, "key-passphrase-env", "", "environment variable containing the passphrase for an encrypted existing CA key")
+	InitCmd.Flags().StringVar(&keyPass.File, "key-passphrase-file", "", "file containing the passphrase for an encrypted existing CA key")
+	InitCmd.Flags().BoolVar(&encryptKey, "encrypt-key", false, "protect the stored CA key with a passphrase")
+	InitCmd.Flags().StringVar(&newPass.Env, "passphrase-env", "", "environment variable containing the passphrase for the stored CA key, prompted if no source is informed")
+	InitCmd.Flags().StringVar(&newPass.File, "passphrase-file", "", "file containing the passphrase for the stored CA key, prompted if no source is informed")
+	InitCmd.Flags().StringVar(&defaultProfile, "profile", ca.DefaultConfig().Profile, "default issuance profile")
+	InitCmd.Flags().StringVar(&profileFile, "profile-file", "", "YAML or JSON file containing issuance profiles, relative to the CA directory")
+	InitCmd.Flags().StringVar(&crlValidity, "crl-validity", ca.DefaultConfig().CRLValidity, "time between CRL updates, as in 7d or 12h")
+	flags.AddDistributionFlags(InitCmd, &distributionFlags, "added to every issued certificate")
+	RootCmd.AddCommand(InitCmd)
+
+	flags.AddSubjectFlags(IssueCmd, &subjectFlags)
+	IssueCmd.Flags().StringVar(&profileName, "profile", "", "issuance profile, the CA default profile if not informed")
+	IssueCmd.Flags().IntVar(&days, "days", 0, "number of validity days, as at the profile if not informed")
+	IssueCmd.Flags().StringVar(&dnsAddressList, "dns-addresses", "", "comma separated list of name addresses")
+	IssueCmd.Flags().StringVar(&ipAddressList, "ip-addresses", "", "comma separated list of ip addresses")
+	IssueCmd.Flags().StringVar(&uriSANList, "uri-sans", "", "comma separated list of URI subject alternative names, such as SPIFFE IDs")
+	IssueCmd.Flags().StringVar(&emailSANList, "email-sans", "", "comma separated list of email subject alternative names")
+	IssueCmd.Flags().StringVar(&keyIn, "key-in", "", "path to the certificate key, use either this or --csr-in")
+	IssueCmd.Flags().StringVar(&keyPass.Env, "key-passphrase-env", "", "environment variable containing the passphrase for an encrypted key")
+	IssueCmd.Flags().StringVar(&keyPass.File, "key-passphrase-file", "", "file containing the passphrase for an encrypted key")
+	IssueCmd.Flags().StringVar(&csrIn, "csr-in", "", "path to certificate signing request, use either this or --key-in")
+	IssueCmd.Flags().StringVar(&copyExtensions, "copy-extensions", string(cert.CopySANs), "[none|sans|all] requested extensions copied into the certificate")
+	flags.AddDistributionFlags(IssueCmd, &distributionFlags, "instead of the configured ones")
+	IssueCmd.Flags().StringVar(&certOut, "cert-out", "", "generated certificate file path, besides the copy at the CA directory")
+	flags.AddCertEncodingFlag(IssueCmd, &certEncodingFlag)
+	IssueCmd.Flags().StringVar(&caPass.Env, "ca-key-passphrase-env", "", "environment variable containing the passphrase for an encrypted CA key")
+	IssueCmd.Flags().StringVar(&caPass.File, "ca-key-passphrase-file", "", "file containing the passphrase for an encrypted CA key")
+	RootCmd.AddCommand(IssueCmd)
+
+	ListCmd.Flags().StringVar(&status, "status", "", "[valid|revoked|expired] only list certificates with this status")
+	ListCmd.Flags().StringVarP(&output, "output", "o", "text", "[text|json|yaml] output format")
+	RootCmd.AddCommand(ListCmd)
+
+	RevokeCmd.Flags().StringVar(&reason, "reason", "unspecified", "revocation reason, such as keyCompromise or superseded")
+	RevokeCmd.Flags().StringVar(&revokedAt, "time", "", "RFC3339 revocation time, now if not informed")
+	RootCmd.AddCommand(RevokeCmd)
+
+	CRLCmd.Flags().StringVar(&crlOut, "crl-out", "", "CRL file path, besides the copy at the CA directory")
+	CRLCmd.Flags().StringVar(&caPass.Env, "ca-key-passphrase-env", "", "environment variable containing the passphrase for an encrypted CA key")
+	CRLCmd.Flags().StringVar(&caPass.File, "ca-key-passphrase-file", "", "file containing the passphrase for an encrypted CA key")
+	RootCmd.AddCommand(CRLCmd)
+}
+
+// initVal validates parameters for the init command
+func initVal(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("CA directory must be informed")
+	}
+	if (certIn == "") != (keyIn == "") {
+		return fmt.Errorf("--cert and --key-in must be informed together")
+	}
+	if certIn == "" {
+		t, ok := key.TypeChoices[keyType]
+		if !ok {
+			return fmt.Errorf("unknown key type: %s", keyType)
+		}
+		if t == key.ECDSA {
+			if _, ok := key.CurveChoices[curve]; !ok {
+				return fmt.Errorf("unknown curve: %s", curve)
+			}
+		}
+		if err := parseSubject(); err != nil {
+			return err
+		}
+		if subject.Name().String() == "" {
+			return fmt.Errorf("CA subject must be informed with --subject or the subject field flags")
+		}
+	}
+	if days < 0 {
+		return fmt.Errorf("validity days must not be negative")
+	}
+	return distributionFlags.Parse()
+}
+
+// initRun runs the init command
+func initRun(cmd *cobra.Command, args []string) {
+	var (
+		c   *x509.Certificate
+		k   crypto.Signer
+		err error
+	)
+	if certIn != "" {
+		c, k = readExistingCA()
+	} else {
+		c, k = generateCA()
+	}
+
+	var pass []byte
+	if encryptKey {
+		pass, err = newPass.Read("passphrase for CA key: ", true)
+		if err != nil {
+			log.Printf("error reading passphrase: %v", err.Error())
+			os.Exit(-1)
+		}
+	}
+
+	cfg := ca.DefaultConfig()
+	cfg.Profile = defaultProfile
+	cfg.ProfileFile = profileFile
+	cfg.CRLValidity = crlValidity
+	cfg.OCSPServers = distributionFlags.OCSPServers
+	cfg.IssuingCertificateURLs = distributionFlags.IssuerURLs
+	cfg.CRLDistributionPoints = distributionFlags.CRLDistPoints
+
+	if _, err = ca.Init(args[0], cfg, c, k, pass); err != nil {
+		log.Printf("error creating CA directory: %v", err.Error())
+		os.Exit(-1)
+	}
+}
+
+// readExistingCA reads the CA certificate and key to import
+func readExistingCA() (*x509.Certificate, crypto.Signer) {
+	b, err := filesystem.ReadContentsFromFile(certIn)
+	if err != nil {
+		log.Printf("error reading CA certificate %q: %v", certIn, err.Error())
+		os.Exit(-1)
+	}
+	c, err := cert.ReadCertificate(b)
+	if err != nil {
+		log.Printf("no cert found at %q: %v", certIn, err.Error())
+		os.Exit(-1)
+	}
+	k, err := key.ReadPEMFile(keyIn, &keyPass)
+	if err != nil {
+		log.Printf("no key found at %q: %v", keyIn, err.Error())
+		os.Exit(-1)
+	}
+	return c, k
+}
+
+// generateCA creates a self signed CA using the root-ca profile
+func generateCA() (*x509.Certificate, crypto.Signer) {
+	k, err := key.GenerateKey(&key.Options{
+		Type:  key.TypeChoices[keyType],
+		Bits:  bits,
+		Curve: curve,
+	})
+	if err != nil {
+		log.Printf("error generating %s key: %v", keyType, err.Error())
+		os.Exit(-1)
+	}
+
+	p := cert.BuiltinProfiles["root-ca"]
+	usage, _ := p.KeyUsage()
+	if days == 0 {
+		days = p.Days
+	}
+
+	tb := time.Now().UTC()
+	b, err := cert.GenerateX509SelfSignedCertificate(&cert.X509Simplified{
+		Subject:   subject,
+		NotBefore: tb,
+		NotAfter:  tb.AddDate(0, 0, days).UTC(),
+		IsCA:      true,
+		KeyUsage:  usage,
+	}, k)
+	if err != nil {
+		log.Printf("error generating CA certificate: %v", err.Error())
+		os.Exit(-1)
+	}
+	c, err := x509.ParseCertificate(b)
+	if err != nil {
+		log.Printf("error parsing CA certificate: %v", err.Error())
+		os.Exit(-1)
+	}
+	return c, k
+}
+
+// issueVal validates parameters for the issue command
+func issueVal(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("CA directory must be informed")
+	}
+	if (keyIn == "") == (csrIn == "") {
+		return fmt.Errorf("either --key-in or --csr-in must be informed")
+	}
+	if _, ok := cert.ExtensionPolicyChoices[copyExtensions]; !ok {
+		return fmt.Errorf("unknown extension copy policy: %s", copyExtensions)
+	}
+	if days < 0 {
+		return fmt.Errorf("validity days must not be negative")
+	}
+	if err := distributionFlags.Parse(); err != nil {
+		return err
+	}
+	var err error
+	if certEncoding, err = certEncodingFlag.Parse(); err != nil {
+		return err
+	}
+	return parseSubject()
+}
+
+// issueRun runs the issue command
+func issueRun(cmd *cobra.Command, args []string) {
+	authority := openCA(args[0])
+
+	name := profileName
+	if name == "" {
+		name = authority.Config.Profile
+	}
+	p, err := authority.Profile(name)
+	if err != nil {
+		log.Printf("%v", err.Error())
+		os.Exit(-1)
+	}
+
+	ipList, err := cert.StringToIPAddressList(ipAddressList)
+	if err != nil {
+		log.Printf("error parsing IP addresses: %v", err.Error())
+		os.Exit(-1)
+	}
+	uriList, err := cert.StringToURIList(uriSANList)
+	if err != nil {
+		log.Printf("error parsing URI SANs: %v", err.Error())
+		os.Exit(-1)
+	}
+	emailList, err := cert.StringToEmailList(emailSANList)
+	if err != nil {
+		log.Printf("error parsing email SANs: %v", err.Error())
+		os.Exit(-1)
+	}
+
+	x := p.Template(time.Now())
+	if days != 0 {
+		x.NotAfter = x.NotBefore.AddDate(0, 0, days)
+	}
+	x.Subject.Override(subject)
+	x.DNSNames = cert.StringToDNSAddressList(dnsAddressList)
+	x.IPAddresses = ipList
+	x.URIs = uriList
+	x.EmailAddresses = emailList
+	x.OCSPServer = distributionFlags.OCSPServers
+	x.IssuingCertificateURL = distributionFlags.IssuerURLs
+	x.CRLDistributionPoints = distributionFlags.CRLDistPoints
+
+	signer := caSigner(authority)
+
+	var c *x509.Certificate
+	if csrIn != "" {
+		csr := readCSR(csrIn)
+		if x.Subject.Name().String() == "" {
+			x.Subject = nil
+		}
+		c, err = authority.IssueCSR(x, csr, signer, cert.ExtensionPolicyChoices[copyExtensions], name, "")
+	} else {
+		k, kerr := key.ReadPEMFile(keyIn, &keyPass)
+		if kerr != nil {
+			log.Printf("no key found at %q: %v", keyIn, kerr.Error())
+			os.Exit(-1)
+		}
+		c, err = authority.Issue(x, k.Public(), signer, name)
+	}
+	if err != nil {
+		log.Printf("error generating certificate: %v", err.Error())
+		os.Exit(-1)
+	}
+
+	if certOut != "" {
+		out, err := cert.WriteCertificates([]*x509.Certificate{c}, certEncoding)
+		if err != nil {
+			log.Printf("error encoding certificate: %v", err.Error())
+			os.Exit(-1)
+		}
+		if err = filesystem.WriteContentsToFile(certOut, string(out)); err != nil {
+			log.Printf("error writing certificate to file: %v", err.Error())
+			os.Exit(-1)
+		}
+	}
+
+	fmt.Println(cert.FormatHex(c.SerialNumber.Bytes()))
+}
+
+// listVal validates parameters for the list command
+func listVal(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("CA directory must be informed")
+	}
+	if _, ok := ca.StatusChoices[status]; status != "" && !ok {
+		return fmt.Errorf("unknown status: %s", status)
+	}
+	switch output {
+	case "text", "json", "yaml":
+	default:
+		return fmt.Errorf("unknown output format: %s", output)
+	}
+	return nil
+}
+
+// listRun runs the list command
+func listRun(cmd *cobra.Command, args []string) {
+	authority := openCA(args[0])
+
+	now := time.Now()
+	records := []*ca.Record{}
+	for _, r := range authority.Index.Certificates {
+		current := *r
+		current.Status = r.CurrentStatus(now)
+		if status != "" && current.Status != ca.StatusChoices[status] {
+			continue
+		}
+		records = append(records, &current)
+	}
+
+	var (
+		out []byte
+		err error
+	)
+	switch output {
+	case "json":
+		out, err = json.MarshalIndent(records, "", "  ")
+		out = append(out, '\n')
+	case "yaml":
+		out, err = yaml.Marshal(records)
+	default:
+		out = []byte(formatRecords(records))
+	}
+	if err != nil {
+		log.Printf("error serializing CA index: %v", err.Error())
+		os.Exit(-1)
+	}
+
+	os.Stdout.Write(out)
+}
+
+// formatRecords renders index records as a table
+func formatRecords(records []*ca.Record) string {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SERIAL\tSTATUS\tNOT AFTER\tSUBJECT\tSANS")
+	for _, r := range records {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+			r.Serial,
+			r.Status,
+			r.NotAfter.Format(time.RFC3339),
+			r.Subject,
+			strings.Join(r.SANs, ","))
+	}
+	w.Flush()
+	return b.String()
+}
+
+// revokeVal validates parameters for the revoke command
+func revokeVal(cmd *cobra.Command, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("CA directory and serial number must be informed")
+	}
+
+	var err error
+	reasonNum, err = cert.ParseRevocationReason(reason)
+	if err != nil {
+		return err
+	}
+
+	at = time.Now()
+	if revokedAt != "" {
+		at, err = time.Parse(time.RFC3339, revokedAt)
+		if err != nil {
+			return fmt.Errorf("invalid revocation time %q: %s", revokedAt, err.Error())
+		}
+	}
+	return nil
+}
+
+// revokeRun runs the revoke command
+func revokeRun(cmd *cobra.Command, args []string) {
+	authority := openCA(args[0])
+
+	serial, err := cert.ParseSerial(args[1])
+	if err != nil {
+		log.Printf("%v", err.Error())
+		os.Exit(-1)
+	}
+
+	if err := authority.Revoke(serial, reasonNum, at); err != nil {
+		log.Printf("error revoking certificate: %v", err.Error())
+		os.Exit(-1)
+	}
+}
+
+// crlRun runs the crl command
+func crlRun(cmd *cobra.Command, args []string) {
+	authority := openCA(args[0])
+	signer := caSigner(authority)
+
+	b, err := authority.CRL(signer, time.Now())
+	if err != nil {
+		log.Printf("error generating CRL: %v", err.Error())
+		os.Exit(-1)
+	}
+
+	if crlOut == "" {
+		return
+	}
+	pem, err := cert.WriteCRLPEM(b)
+	if err != nil {
+		log.Printf("error encoding CRL: %v", err.Error())
+		os.Exit(-1)
+	}
+	if err = filesystem.WriteContentsToFile(crlOut, pem); err != nil {
+		log.Printf("error writing CRL to file: %v", err.Error())
+		os.Exit(-1)
+	}
+}
+
+// parseSubject builds the subject from the subject
+// string, with the individual fields taking precedence
+func parseSubject() error {
+	var err error
+	subject, err = subjectFlags.Build()
+	if err != nil {
+		return fmt.Errorf("error parsing subject: %+v", err)
+	}
+	return nil
+}
+
+// readCSR reads a PEM certificate request or exits
+func readCSR(path string) *x509.CertificateRequest {
+	b, err := filesystem.ReadContentsFromFile(path)
+	if err != nil {
+		log.Printf("error reading certificate request %q: %v", path, err.Error())
+		os.Exit(-1)
+	}
+	csr, err := cert.ReadCSRPEM(b)
+	if err != nil {
+		log.Printf("no certificate request found at %q: %v", path, err.Error())
+		os.Exit(-1)
+	}
+	return csr
+}
+
+// openCA opens the CA directory or exits
+func openCA(dir string) *ca.CA {
+	authority, err := ca.Open(dir)
+	if err != nil {
+		log.Printf("%v", err.Error())
+		os.Exit(-1)
+	}
+	return authority
+}
+
+// caSigner reads the CA key or exits
+func caSigner(authority *ca.CA) crypto.Signer {
+	signer, err := authority.Signer(&caPass)
+	if err != nil {
+		log.Printf("%v", err.Error())
+		os.Exit(-1)
+	}
+	return signer
+}
@@ -1,25 +1,40 @@
 package cert
 
 import (
+	"crypto"
 	"crypto/x509"
 	"fmt"
 	"log"
 	"math/big"
 	"net"
+	"net/url"
 	"os"
 	"time"
 
+	"github.com/odacremolbap/xfon/cmd/xfon/command/flags"
 	"github.com/odacremolbap/xfon/pkg/cert"
 	"github.com/odacremolbap/xfon/pkg/filesystem"
-	"github.com/odacremolbap/xfon/pkg/rsa"
+	"github.com/odacremolbap/xfon/pkg/key"
+	"github.com/odacremolbap/xfon/pkg/passphrase"
 	"github.com/spf13/cobra"
 )
 
 var (
-	// simplified subject fields
-	commonName         string
-	organization       string
-	organizationalUnit string
+	// subject
+	subjectFlags flags.Subject
+	subject      *cert.Subject
+
+	// serial numbers
+	serialNumber   string
+	serialRegistry string
+	serial         *big.Int
+
+	// key identifiers
+	skiMethod   string
+	skiComputed cert.SKIMethod
+
+	// authority information access and CRL distribution points
+	distributionFlags flags.Distribution
 
 	// features
 	validityDays int
@@ -32,15 +47,31 @@ var (
 	// addresses
 	dnsAddressList string
 	ipAddressList  string
+	uriSANList     string
+	emailSANList   string
+	otherNameSANs  []string
 	dnsList        []string
 	ipList         []net.IP
+	uriList        []*url.URL
+	emailList      []string
+	otherNameList  []cert.OtherName
 
 	// in and out
 	keyIn      string
 	certOut    string
+	chainOut   string
 	signingKey string
 	parentCert string
 
+	// certificate signing requests
+	csrIn          string
+	copyExtensions string
+	copyPolicy     cert.ExtensionPolicy
+
+	// passphrases for encrypted keys
+	keyPass     passphrase.Source
+	signingPass passphrase.Source
+
 	// RootCmd contains certificate management commands
 	RootCmd = &cobra.Command{
 		Use:   "x509",
@@ -63,6 +94,14 @@ var (
 		Run:   signedRun,
 		Args:  signedVal,
 	}
+
+	// SignCSRCmd issues a certificate from a certificate signing request
+	SignCSRCmd = &cobra.Command{
+		Use:   "sign-csr",
+		Short: "issues a certificate from a certificate signing request",
+		Run:   signCSRRun,
+		Args:  signCSRVal,
+	}
 )
 
 func runHelp(cmd *cobra.Command, args []string) {
@@ -74,13 +113,15 @@ func init() {
 	// Params for NewCmd
 
 	// subject
-	NewCmd.Flags().StringVar(&commonName, "common-name", "", "CN for certificate")
-	NewCmd.Flags().StringVar(&organization, "organization", "", "O for certificate")
-	NewCmd.Flags().StringVar(&organizationalUnit, "organizational-unit", "", "OU for certificate")
+	flags.AddSubjectFlags(NewCmd, &subjectFlags)
 
 	// features
+	NewCmd.Flags().StringVar(&serialNumber, "serial", "", "certificate serial number as decimal, 0x prefixed or colon separated hex, random if empty")
+	NewCmd.Flags().StringVar(&serialRegistry, "serial-registry", "", "path to a serial registry file that rejects serials already issued by the CA")
+	NewCmd.Flags().StringVar(&skiMethod, "ski-method", string(cert.SKIRFC5280Method1), "[rfc5280-1|rfc5280-2|rfc7093-1|rfc7093-2|rfc7093-3|rfc7093-4] subject key identifier method")
+	addProfileFlags(NewCmd)
+	addConstraintFlags(NewCmd)
 	NewCmd.Flags().IntVar(&validityDays, "days", 0, "number of validity days for the generated certificate")
-	NewCmd.MarkFlagRequired("days")
 	NewCmd.Flags().BoolVar(&isCA, "ca", false, "[true|false] wether the certificate is a CA")
 	NewCmd.Flags().StringVar(&keyUsages, "usages", "", "comma separated key usages for the certificate")
 	NewCmd.Flags().StringVar(&extKeyUsages, "ext-usages", "", "comma separated extended key usages for the certificate")
@@ -88,42 +129,90 @@ func init() {
 	// addresses
 	NewCmd.PersistentFlags().StringVar(&dnsAddressList, "dns-addresses", "", "comma separated list of name addresses")
 	NewCmd.PersistentFlags().StringVar(&ipAddressList, "ip-addresses", "", "comma separated list of ip addresses")
+	NewCmd.PersistentFlags().StringVar(&uriSANList, "uri-sans", "", "comma separated list of URI subject alternative names, such as SPIFFE IDs")
+	NewCmd.PersistentFlags().StringVar(&emailSANList, "email-sans", "", "comma separated list of email subject alternative names")
+	NewCmd.PersistentFlags().StringArrayVar(&otherNameSANs, "other-name-sans", nil, "otherName subject alternative name as <OID|UPN>;UTF8:<value>, can be repeated")
 
 	// in and out
 	NewCmd.Flags().StringVar(&keyIn, "key-in", "", "path to key")
 	NewCmd.MarkFlagRequired("key-in")
-	NewCmd.Flags().StringVar(&certOut, "cert-out", "", "generated certificate file path")
-	NewCmd.MarkFlagRequired("cert-out")
+	NewCmd.Flags().StringVar(&keyPass.Env, "key-passphrase-env", "", "environment variable containing the passphrase for an encrypted key")
+	NewCmd.Flags().StringVar(&keyPass.File, "key-passphrase-file", "", "file containing the passphrase for an encrypted key")
+	NewCmd.Flags().StringVar(&certOut, "cert-out", "", "generated certificate file path, required unless --secret-name is informed")
+	flags.AddCertEncodingFlag(NewCmd, &certEncodingFlag)
+	addSecretFlags(NewCmd)
 
 	// Params for SignCmd
 
 	// subject
-	SignCmd.Flags().StringVar(&commonName, "common-name", "", "CN for certificate")
-	SignCmd.Flags().StringVar(&organization, "organization", "", "O for certificate")
-	SignCmd.Flags().StringVar(&organizationalUnit, "organizational-unit", "", "OU for certificate")
+	flags.AddSubjectFlags(SignCmd, &subjectFlags)
 
 	// features
+	SignCmd.Flags().StringVar(&serialNumber, "serial", "", "certificate serial number as decimal, 0x prefixed or colon separated hex, random if empty")
+	SignCmd.Flags().StringVar(&serialRegistry, "serial-registry", "", "path to a serial registry file that rejects serials already issued by the CA")
+	SignCmd.Flags().StringVar(&skiMethod, "ski-method", string(cert.SKIRFC5280Method1), "[rfc5280-1|rfc5280-2|rfc7093-1|rfc7093-2|rfc7093-3|rfc7093-4] subject key identifier method")
+	addProfileFlags(SignCmd)
+	addConstraintFlags(SignCmd)
+	flags.AddDistributionFlags(SignCmd, &distributionFlags, "")
 	SignCmd.Flags().IntVar(&validityDays, "days", 0, "number of validity days for the generated certificate")
-	SignCmd.MarkFlagRequired("days")
 	SignCmd.Flags().StringVar(&keyUsages, "usages", "", "comma separated key usages for the certificate")
 	SignCmd.Flags().StringVar(&extKeyUsages, "ext-usages", "", "comma separated extended key usages for the certificate")
 
 	// addresses
 	SignCmd.PersistentFlags().StringVar(&dnsAddressList, "dns-addresses", "", "comma separated list of name addresses")
 	SignCmd.PersistentFlags().StringVar(&ipAddressList, "ip-addresses", "", "comma separated list of ip addresses")
+	SignCmd.PersistentFlags().StringVar(&uriSANList, "uri-sans", "", "comma separated list of URI subject alternative names, such as SPIFFE IDs")
+	SignCmd.PersistentFlags().StringVar(&emailSANList, "email-sans", "", "comma separated list of email subject alternative names")
+	SignCmd.PersistentFlags().StringArrayVar(&otherNameSANs, "other-name-sans", nil, "otherName subject alternative name as <OID|UPN>;UTF8:<value>, can be repeated")
 
 	// in and out
 	SignCmd.Flags().StringVar(&keyIn, "key-in", "", "path to key")
 	SignCmd.MarkFlagRequired("key-in")
-	SignCmd.Flags().StringVar(&certOut, "cert-out", "", "generated certificate file path")
-	SignCmd.MarkFlagRequired("cert-out")
+	SignCmd.Flags().StringVar(&keyPass.Env, "key-passphrase-env", "", "environment variable containing the passphrase for an encrypted key")
+	SignCmd.Flags().StringVar(&keyPass.File, "key-passphrase-file", "", "file containing the passphrase for an encrypted key")
+	SignCmd.Flags().StringVar(&certOut, "cert-out", "", "generated certificate file path, required unless --secret-name is informed")
+	flags.AddCertEncodingFlag(SignCmd, &certEncodingFlag)
+	addSecretFlags(SignCmd)
 	SignCmd.Flags().StringVar(&signingKey, "signing-key", "", "path to key used for signing")
 	SignCmd.MarkFlagRequired("signing-key")
-	SignCmd.Flags().StringVar(&parentCert, "parent-cert", "", "path to parent cert")
+	SignCmd.Flags().StringVar(&signingPass.Env, "signing-key-passphrase-env", "", "environment variable containing the passphrase for an encrypted signing key")
+	SignCmd.Flags().StringVar(&signingPass.File, "signing-key-passphrase-file", "", "file containing the passphrase for an encrypted signing key")
+	SignCmd.Flags().StringVar(&parentCert, "parent-cert", "", "path to parent cert, followed by its own chain if a bundle")
 	SignCmd.MarkFlagRequired("parent-cert")
+	SignCmd.Flags().StringVar(&chainOut, "chain-out", "", "file path for the generated certificate followed by the certificates at the parent cert file")
+
+	// Params for SignCSRCmd
+
+	// features
+	SignCSRCmd.Flags().StringVar(&serialNumber, "serial", "", "certificate serial number as decimal, 0x prefixed or colon separated hex, random if empty")
+	SignCSRCmd.Flags().StringVar(&serialRegistry, "serial-registry", "", "path to a serial registry file that rejects serials already issued by the CA")
+	SignCSRCmd.Flags().StringVar(&skiMethod, "ski-method", string(cert.SKIRFC5280Method1), "[rfc5280-1|rfc5280-2|rfc7093-1|rfc7093-2|rfc7093-3|rfc7093-4] subject key identifier method")
+	addProfileFlags(SignCSRCmd)
+	addConstraintFlags(SignCSRCmd)
+	flags.AddDistributionFlags(SignCSRCmd, &distributionFlags, "")
+	SignCSRCmd.Flags().IntVar(&validityDays, "days", 0, "number of validity days for the generated certificate")
+	SignCSRCmd.Flags().BoolVar(&isCA, "ca", false, "[true|false] wether the certificate is a CA")
+	SignCSRCmd.Flags().StringVar(&keyUsages, "usages", "", "comma separated key usages for the certificate")
+	SignCSRCmd.Flags().StringVar(&extKeyUsages, "ext-usages", "", "comma separated extended key usages for the certificate")
+	SignCSRCmd.Flags().StringVar(&copyExtensions, "copy-extensions", string(cert.CopySANs), "[none|sans|all] requested extensions copied into the certificate")
+
+	// in and out
+	SignCSRCmd.Flags().StringVar(&csrIn, "csr-in", "", "path to certificate signing request")
+	SignCSRCmd.MarkFlagRequired("csr-in")
+	SignCSRCmd.Flags().StringVar(&certOut, "cert-out", "", "generated certificate file path")
+	flags.AddCertEncodingFlag(SignCSRCmd, &certEncodingFlag)
+	SignCSRCmd.MarkFlagRequired("cert-out")
+	SignCSRCmd.Flags().StringVar(&signingKey, "signing-key", "", "path to key used for signing")
+	SignCSRCmd.MarkFlagRequired("signing-key")
+	SignCSRCmd.Flags().StringVar(&signingPass.Env, "signing-key-passphrase-env", "", "environment variable containing the passphrase for an encrypted signing key")
+	SignCSRCmd.Flags().StringVar(&signingPass.File, "signing-key-passphrase-file", "", "file containing the passphrase for an encrypted signing key")
+	SignCSRCmd.Flags().StringVar(&parentCert, "parent-cert", "", "path to parent cert, followed by its own chain if a bundle")
+	SignCSRCmd.MarkFlagRequired("parent-cert")
+	SignCSRCmd.Flags().StringVar(&chainOut, "chain-out", "", "file path for the generated certificate followed by the certificates at the parent cert file")
 
 	RootCmd.AddCommand(NewCmd)
 	RootCmd.AddCommand(SignCmd)
+	RootCmd.AddCommand(SignCSRCmd)
 }
 
 // newVal validates parameters for the new self signed certificate command
@@ -147,18 +236,49 @@ func newVal(cmd *cobra.Command, args []string) error {
 
 	dnsList = cert.StringToDNSAddressList(dnsAddressList)
 
-	return nil
-}
+	uriList, err = cert.StringToURIList(uriSANList)
+	if err != nil {
+		return fmt.Errorf("error parsing URI SANs: %+v", err)
+	}
 
-// newRun runs the new self signed certificate command
-func newRun(cmd *cobra.Command, args []string) {
-	ki, err := filesystem.ReadContentsFromFile(keyIn)
+	emailList, err = cert.StringToEmailList(emailSANList)
 	if err != nil {
-		log.Printf("error reading key: %v", err.Error())
-		os.Exit(-1)
+		return fmt.Errorf("error parsing email SANs: %+v", err)
 	}
 
-	key, err := rsa.ReadPEM(ki)
+	otherNameList = nil
+	for _, o := range otherNameSANs {
+		on, err := cert.ParseOtherName(o)
+		if err != nil {
+			return fmt.Errorf("error parsing otherName SANs: %+v", err)
+		}
+		otherNameList = append(otherNameList, on)
+	}
+
+	subject, err = subjectFlags.Build()
+	if err != nil {
+		return fmt.Errorf("error parsing subject: %+v", err)
+	}
+
+	if err = applyProfile(cmd, true); err != nil {
+		return err
+	}
+	if err = parseConstraintFlags(); err != nil {
+		return err
+	}
+	if err = parseSecretFlags(); err != nil {
+		return err
+	}
+	if err = parseEncodingFlags(); err != nil {
+		return err
+	}
+
+	return parseIssuanceFlags()
+}
+
+// newRun runs the new self signed certificate command
+func newRun(cmd *cobra.Command, args []string) {
+	k, err := key.ReadPEMFile(keyIn, &keyPass)
 	if err != nil {
 		log.Printf("no key found at %q: %v", keyIn, err.Error())
 		os.Exit(-1)
@@ -168,34 +288,39 @@ func newRun(cmd *cobra.Command, args []string) {
 	ta := tb.AddDate(0, 0, validityDays).UTC()
 
 	x := &cert.X509Simplified{
-		Subject: &cert.Subject{
-			CommonName:         commonName,
-			Organization:       organization,
-			OrganizationalUnit: organizationalUnit,
-		},
-		DNSNames:    dnsList,
-		IPAddresses: ipList,
-		Serial:      new(big.Int).SetInt64(0),
-		NotBefore:   tb,
-		NotAfter:    ta,
-		IsCA:        isCA,
-		KeyUsage:    usage,
-		ExtKeyUsage: extUsage,
-	}
-
-	b, err := cert.GenerateX509SelfSignedCertificate(x, key)
+		Subject:            subject,
+		DNSNames:           dnsList,
+		IPAddresses:        ipList,
+		URIs:               uriList,
+		EmailAddresses:     emailList,
+		OtherNames:         otherNameList,
+		Serial:             serial,
+		NotBefore:          tb,
+		NotAfter:           ta,
+		IsCA:               isCA,
+		MaxPathLen:         maxPathLen,
+		MaxPathLenZero:     maxPathLenZero,
+		NameConstraints:    nameConstraints,
+		KeyUsage:           usage,
+		ExtKeyUsage:        extUsage,
+		SubjectKeyIDMethod: skiComputed,
+	}
+
+	registry, err := registerSerial(x, k.Public())
 	if err != nil {
-		log.Printf("error generating certificate: %v", err.Error())
+		log.Printf("error assigning serial number: %v", err.Error())
 		os.Exit(-1)
 	}
 
-	pem, err := cert.WritePEM(b)
+	b, err := cert.GenerateX509SelfSignedCertificate(x, k)
 	if err != nil {
-		log.Printf("error encoding certificate: %v", err.Error())
+		log.Printf("error generating certificate: %v", err.Error())
 		os.Exit(-1)
 	}
 
-	filesystem.WriteContentsToFile(certOut, pem)
+	writeCertificate(b)
+	writeSecret(b, nil, k)
+	saveRegistry(registry)
 }
 
 // signedVal validates the signed certificate command
@@ -219,18 +344,52 @@ func signedVal(cmd *cobra.Command, args []string) error {
 
 	dnsList = cert.StringToDNSAddressList(dnsAddressList)
 
-	return nil
-}
+	uriList, err = cert.StringToURIList(uriSANList)
+	if err != nil {
+		return fmt.Errorf("error parsing URI SANs: %+v", err)
+	}
 
-// signedRun runs the signed certificate command
-func signedRun(cmd *cobra.Command, args []string) {
-	ki, err := filesystem.ReadContentsFromFile(keyIn)
+	emailList, err = cert.StringToEmailList(emailSANList)
 	if err != nil {
-		log.Printf("error reading key %q: %v", keyIn, err.Error())
-		os.Exit(-1)
+		return fmt.Errorf("error parsing email SANs: %+v", err)
+	}
+
+	otherNameList = nil
+	for _, o := range otherNameSANs {
+		on, err := cert.ParseOtherName(o)
+		if err != nil {
+			return fmt.Errorf("error parsing otherName SANs: %+v", err)
+		}
+		otherNameList = append(otherNameList, on)
+	}
+
+	subject, err = subjectFlags.Build()
+	if err != nil {
+		return fmt.Errorf("error parsing subject: %+v", err)
 	}
 
-	key, err := rsa.ReadPEM(ki)
+	if err = applyProfile(cmd, true); err != nil {
+		return err
+	}
+	if err = parseConstraintFlags(); err != nil {
+		return err
+	}
+	if err = distributionFlags.Parse(); err != nil {
+		return err
+	}
+	if err = parseSecretFlags(); err != nil {
+		return err
+	}
+	if err = parseEncodingFlags(); err != nil {
+		return err
+	}
+
+	return parseIssuanceFlags()
+}
+
+// signedRun runs the signed certificate command
+func signedRun(cmd *cobra.Command, args []string) {
+	k, err := key.ReadPEMFile(keyIn, &keyPass)
 	if err != nil {
 		log.Printf("no key found at %q: %v", keyIn, err.Error())
 		os.Exit(-1)
@@ -242,19 +401,127 @@ func signedRun(cmd *cobra.Command, args []string) {
 		os.Exit(-1)
 	}
 
-	parent, err := cert.ReadPEM(pc)
+	parents, err := cert.ReadCertificates(pc)
 	if err != nil {
 		log.Printf("no cert found at %q: %v", parentCert, err.Error())
 		os.Exit(-1)
 	}
+	parent := parents[0]
 
-	sk, err := filesystem.ReadContentsFromFile(signingKey)
+	signing, err := key.ReadPEMFile(signingKey, &signingPass)
 	if err != nil {
-		log.Printf("error reading signing key %q: %v", signingKey, err.Error())
+		log.Printf("no key found at %q: %v", signingKey, err.Error())
 		os.Exit(-1)
 	}
 
-	signing, err := rsa.ReadPEM(sk)
+	tb := time.Now().UTC()
+	ta := tb.AddDate(0, 0, validityDays).UTC()
+
+	x := &cert.X509Simplified{
+		Subject:               subject,
+		DNSNames:              dnsList,
+		IPAddresses:           ipList,
+		URIs:                  uriList,
+		EmailAddresses:        emailList,
+		OtherNames:            otherNameList,
+		Serial:                serial,
+		NotBefore:             tb,
+		NotAfter:              ta,
+		IsCA:                  isCA,
+		MaxPathLen:            maxPathLen,
+		MaxPathLenZero:        maxPathLenZero,
+		NameConstraints:       nameConstraints,
+		KeyUsage:              usage,
+		ExtKeyUsage:           extUsage,
+		OCSPServer:            distributionFlags.OCSPServers,
+		IssuingCertificateURL: distributionFlags.IssuerURLs,
+		CRLDistributionPoints: distributionFlags.CRLDistPoints,
+		SubjectKeyIDMethod:    skiComputed,
+	}
+
+	registry, err := registerSerial(x, signing.Public())
+	if err != nil {
+		log.Printf("error assigning serial number: %v", err.Error())
+		os.Exit(-1)
+	}
+
+	// b, err := cert.GenerateX509SelfSignedCertificate(x, k)
+	b, err := cert.GenerateX509Certificate(x, parent, k.Public(), signing)
+	if err != nil {
+		log.Printf("error generating certificate: %v", err.Error())
+		os.Exit(-1)
+	}
+
+	writeCertificate(b)
+	writeChain(b, parents)
+	writeSecret(b, parents, k)
+	saveRegistry(registry)
+}
+
+// signCSRVal validates the sign certificate request command
+func signCSRVal(cmd *cobra.Command, args []string) error {
+
+	var err error
+	usage, err = cert.StringToKeyUsage(keyUsages)
+	if err != nil {
+		return fmt.Errorf("error parsing key usage: %+v", err)
+	}
+
+	extUsage, err = cert.StringToExtKeyUsage(extKeyUsages)
+	if err != nil {
+		return fmt.Errorf("error parsing extended key usage: %+v", err)
+	}
+
+	var ok bool
+	copyPolicy, ok = cert.ExtensionPolicyChoices[copyExtensions]
+	if !ok {
+		return fmt.Errorf("unknown extension copy policy: %s", copyExtensions)
+	}
+
+	if err = applyProfile(cmd, false); err != nil {
+		return err
+	}
+	if err = parseConstraintFlags(); err != nil {
+		return err
+	}
+	if err = distributionFlags.Parse(); err != nil {
+		return err
+	}
+	if err = parseEncodingFlags(); err != nil {
+		return err
+	}
+
+	return parseIssuanceFlags()
+}
+
+// signCSRRun runs the sign certificate request command
+func signCSRRun(cmd *cobra.Command, args []string) {
+	ci, err := filesystem.ReadContentsFromFile(csrIn)
+	if err != nil {
+		log.Printf("error reading certificate request %q: %v", csrIn, err.Error())
+		os.Exit(-1)
+	}
+
+	csr, err := cert.ReadCSRPEM(ci)
+	if err != nil {
+		log.Printf("no certificate request found at %q: %v", csrIn, err.Error())
+		os.Exit(-1)
+	}
+
+	pc, err := filesystem.ReadContentsFromFile(parentCert)
+	if err != nil {
+		log.Printf("error reading parent cert %q: %v", parentCert, err.Error())
+		os.Exit(-1)
+	}
+
+	parents, err := cert.ReadCertificates(pc)
+	if err != nil {
+		log.Printf("no cert found at %q: %v", parentCert, err.Error())
+		os.Exit(-1)
+	}
+	parent := parents[0]
+
+	signing, err := key.ReadPEMFile(signingKey, &signingPass)
 	if err != nil {
 		log.Printf("no key found at %q: %v", signingKey, err.Error())
 		os.Exit(-1)
@@ -264,33 +531,108 @@ func signedRun(cmd *cobra.Command, args []string) {
 	ta := tb.AddDate(0, 0, validityDays).UTC()
 
 	x := &cert.X509Simplified{
-		Subject: &cert.Subject{
-			CommonName:         commonName,
-			Organization:       organization,
-			OrganizationalUnit: organizationalUnit,
-		},
-		DNSNames:    dnsList,
-		IPAddresses: ipList,
-		Serial:      new(big.Int).SetInt64(0),
-		NotBefore:   tb,
-		NotAfter:    ta,
-		IsCA:        isCA,
-		KeyUsage:    usage,
-		ExtKeyUsage: extUsage,
-	}
-
-	// b, err := cert.GenerateX509SelfSignedCertificate(x, key)
-	b, err := cert.GenerateX509Certificate(x, parent, key, signing)
+		Serial:                serial,
+		NotBefore:             tb,
+		NotAfter:              ta,
+		IsCA:                  isCA,
+		MaxPathLen:            maxPathLen,
+		MaxPathLenZero:        maxPathLenZero,
+		NameConstraints:       nameConstraints,
+		KeyUsage:              usage,
+		ExtKeyUsage:           extUsage,
+		OCSPServer:            distributionFlags.OCSPServers,
+		IssuingCertificateURL: distributionFlags.IssuerURLs,
+		CRLDistributionPoints: distributionFlags.CRLDistPoints,
+		SubjectKeyIDMethod:    skiComputed,
+	}
+
+	registry, err := registerSerial(x, signing.Public())
+	if err != nil {
+		log.Printf("error assigning serial number: %v", err.Error())
+		os.Exit(-1)
+	}
+
+	b, err := cert.SignCSR(x, csr, parent, signing, copyPolicy)
 	if err != nil {
 		log.Printf("error generating certificate: %v", err.Error())
 		os.Exit(-1)
 	}
 
-	pem, err := cert.WritePEM(b)
+	writeCertificate(b)
+	writeChain(b, parents)
+	saveRegistry(registry)
+}
+
+// writeChain writes the generated certificate followed by the
+// certificates at the parent file, if a chain file is informed
+func writeChain(leaf []byte, parents []*x509.Certificate) {
+	if chainOut == "" {
+		return
+	}
+
+	c, err := x509.ParseCertificate(leaf)
+	if err != nil {
+		log.Printf("error parsing generated certificate: %v", err.Error())
+		os.Exit(-1)
+	}
+	p, err := cert.WritePEMBundle(append([]*x509.Certificate{c}, parents...))
 	if err != nil {
-		log.Printf("error encoding certificate: %v", err.Error())
+		log.Printf("error encoding certificate chain: %v", err.Error())
 		os.Exit(-1)
 	}
+	if err = filesystem.WriteContentsToFile(chainOut, p); err != nil {
+		log.Printf("error writing certificate chain to file: %v", err.Error())
+		os.Exit(-1)
+	}
+}
 
-	filesystem.WriteContentsToFile(certOut, pem)
+// parseIssuanceFlags reads the serial number and subject key identifier flags
+func parseIssuanceFlags() error {
+	var ok bool
+	skiComputed, ok = cert.SKIMethodChoices[skiMethod]
+	if !ok {
+		return fmt.Errorf("unknown subject key identifier method: %s", skiMethod)
+	}
+
+	serial = nil
+	if serialNumber == "" {
+		return nil
+	}
+
+	var err error
+	serial, err = cert.ParseSerial(serialNumber)
+	return err
+}
+
+// registerSerial checks the certificate serial against the serial
+// registry, if configured, assigning a random unused one when the
+// certificate has none. The registry is returned to be saved once
+// the certificate is written
+func registerSerial(x *cert.X509Simplified, issuer crypto.PublicKey) (*cert.SerialRegistry, error) {
+	if serialRegistry == "" {
+		return nil, nil
+	}
+
+	r, err := cert.OpenSerialRegistry(serialRegistry)
+	if err != nil {
+		return nil, err
+	}
+
+	if x.Serial == nil {
+		x.Serial, err = r.NewRegisteredSerial(issuer)
+		return r, err
+	}
+
+	return r, r.Add(issuer, x.Serial)
+}
+
+// saveRegistry writes the serial registry, if any
+func saveRegistry(r *cert.SerialRegistry) {
+	if r == nil {
+		return
+	}
+	if err := r.Save(); err != nil {
+		log.Printf("error saving serial registry: %v", err.Error())
+		os.Exit(-1)
+	}
 }
@@ -0,0 +1,74 @@
+package cert
+
+import (
+	"fmt"
+
+	"github.com/odacremolbap/xfon/pkg/cert"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// basic constraints path length
+	pathLen        int
+	maxPathLen     int
+	maxPathLenZero bool
+
+	// name constraints
+	permittedDNSDomains     string
+	excludedDNSDomains      string
+	permittedIPRanges       string
+	excludedIPRanges        string
+	permittedEmailAddresses string
+	excludedEmailAddresses  string
+	permittedURIDomains     string
+	excludedURIDomains      string
+	nameConstraints         *cert.NameConstraints
+)
+
+// addConstraintFlags registers the CA path length and name constraints flags at the command
+func addConstraintFlags(cmd *cobra.Command) {
+	cmd.Flags().IntVar(&pathLen, "max-path-len", -1, "maximum number of intermediate CAs under a CA certificate, unlimited if negative")
+	cmd.Flags().StringVar(&permittedDNSDomains, "permitted-dns-domains", "", "comma separated list of DNS domains the CA can issue for, .example.com for subdomains only")
+	cmd.Flags().StringVar(&excludedDNSDomains, "excluded-dns-domains", "", "comma separated list of DNS domains the CA cannot issue for")
+	cmd.Flags().StringVar(&permittedIPRanges, "permitted-ip-ranges", "", "comma separated list of CIDR ranges the CA can issue for")
+	cmd.Flags().StringVar(&excludedIPRanges, "excluded-ip-ranges", "", "comma separated list of CIDR ranges the CA cannot issue for")
+	cmd.Flags().StringVar(&permittedEmailAddresses, "permitted-email-addresses", "", "comma separated list of mailboxes or mail domains the CA can issue for")
+	cmd.Flags().StringVar(&excludedEmailAddresses, "excluded-email-addresses", "", "comma separated list of mailboxes or mail domains the CA cannot issue for")
+	cmd.Flags().StringVar(&permittedURIDomains, "permitted-uri-domains", "", "comma separated list of URI host domains the CA can issue for")
+	cmd.Flags().StringVar(&excludedURIDomains, "excluded-uri-domains", "", "comma separated list of URI host domains the CA cannot issue for")
+}
+
+// parseConstraintFlags reads the path length and name constraints flags
+func parseConstraintFlags() error {
+	maxPathLen, maxPathLenZero = 0, false
+	if pathLen >= 0 {
+		maxPathLen = pathLen
+		maxPathLenZero = pathLen == 0
+	}
+
+	nc := &cert.NameConstraints{
+		PermittedDNSDomains:     cert.StringToDNSAddressList(permittedDNSDomains),
+		ExcludedDNSDomains:      cert.StringToDNSAddressList(excludedDNSDomains),
+		PermittedEmailAddresses: cert.StringToDNSAddressList(permittedEmailAddresses),
+		ExcludedEmailAddresses:  cert.StringToDNSAddressList(excludedEmailAddresses),
+		PermittedURIDomains:     cert.StringToDNSAddressList(permittedURIDomains),
+		ExcludedURIDomains:      cert.StringToDNSAddressList(excludedURIDomains),
+	}
+
+	var err error
+	nc.PermittedIPRanges, err = cert.StringToIPNetList(permittedIPRanges)
+	if err != nil {
+		return fmt.Errorf("error parsing permitted ip ranges: %+v", err)
+	}
+	nc.ExcludedIPRanges, err = cert.StringToIPNetList(excludedIPRanges)
+	if err != nil {
+		return fmt.Errorf("error parsing excluded ip ranges: %+v", err)
+	}
+
+	nameConstraints = nil
+	if !nc.IsEmpty() {
+		nameConstraints = nc
+	}
+
+	return nil
+}
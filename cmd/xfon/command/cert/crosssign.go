@@ -0,0 +1,138 @@
+package cert
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/odacremolbap/xfon/cmd/xfon/command/flags"
+	"github.com/odacremolbap/xfon/pkg/cert"
+	"github.com/odacremolbap/xfon/pkg/filesystem"
+	"github.com/odacremolbap/xfon/pkg/key"
+	"github.com/spf13/cobra"
+)
+
+var (
+	crossSignCert string
+
+	// CrossSignCmd issues an existing certificate under a different issuer
+	CrossSignCmd = &cobra.Command{
+		Use:   "cross-sign",
+		Short: "issues a copy of an existing certificate signed by a different CA",
+		Long: `issues a certificate with the subject, public key, subject key
+identifier and extensions of an existing one, signed by a different CA.
+Certificates issued by the existing certificate chain to either of them,
+which is used to introduce a new root next to an established one.
+
+The validity of the existing certificate is kept unless --days is
+informed, and a new serial is assigned. The OCSP, issuer and CRL
+locations refer to the previous issuer and are replaced by the ones
+informed with flags.`,
+		Run:  crossSignRun,
+		Args: crossSignVal,
+	}
+)
+
+func init() {
+	CrossSignCmd.Flags().StringVar(&crossSignCert, "cert", "", "path to the certificate to cross-sign")
+	CrossSignCmd.MarkFlagRequired("cert")
+	CrossSignCmd.Flags().IntVar(&validityDays, "days", 0, "number of validity days from now, as the existing certificate if not informed")
+	CrossSignCmd.Flags().StringVar(&serialNumber, "serial", "", "certificate serial number as decimal, 0x prefixed or colon separated hex, random if empty")
+	CrossSignCmd.Flags().StringVar(&serialRegistry, "serial-registry", "", "path to a serial registry file that rejects serials already issued by the CA")
+	flags.AddDistributionFlags(CrossSignCmd, &distributionFlags, "")
+
+	// in and out
+	CrossSignCmd.Flags().StringVar(&certOut, "cert-out", "", "cross-signed certificate file path")
+	CrossSignCmd.MarkFlagRequired("cert-out")
+	flags.AddCertEncodingFlag(CrossSignCmd, &certEncodingFlag)
+	CrossSignCmd.Flags().StringVar(&chainOut, "chain-out", "", "file path for the cross-signed certificate followed by the certificates at the parent cert file")
+	CrossSignCmd.Flags().StringVar(&signingKey, "signing-key", "", "path to the key of the new issuer")
+	CrossSignCmd.MarkFlagRequired("signing-key")
+	CrossSignCmd.Flags().StringVar(&signingPass.Env, "signing-key-passphrase-env", "", "environment variable containing the passphrase for an encrypted signing key")
+	CrossSignCmd.Flags().StringVar(&signingPass.File, "signing-key-passphrase-file", "", "file containing the passphrase for an encrypted signing key")
+	CrossSignCmd.Flags().StringVar(&parentCert, "parent-cert", "", "path to the certificate of the new issuer")
+	CrossSignCmd.MarkFlagRequired("parent-cert")
+	RootCmd.AddCommand(CrossSignCmd)
+}
+
+// crossSignVal validates the cross-sign command
+func crossSignVal(cmd *cobra.Command, args []string) error {
+	if validityDays < 0 {
+		return fmt.Errorf("validity days must not be negative")
+	}
+
+	serial = nil
+	if serialNumber != "" {
+		var err error
+		if serial, err = cert.ParseSerial(serialNumber); err != nil {
+			return err
+		}
+	}
+
+	if err := parseEncodingFlags(); err != nil {
+		return err
+	}
+
+	return distributionFlags.Parse()
+}
+
+// crossSignRun runs the cross-sign command
+func crossSignRun(cmd *cobra.Command, args []string) {
+	existing, err := readCertificate(crossSignCert)
+	if err != nil {
+		log.Printf("%v", err.Error())
+		os.Exit(-1)
+	}
+
+	b, err := filesystem.ReadContentsFromFile(parentCert)
+	if err != nil {
+		log.Printf("error reading parent certificate %q: %v", parentCert, err.Error())
+		os.Exit(-1)
+	}
+	parents, err := cert.ReadCertificates(b)
+	if err != nil {
+		log.Printf("error parsing parent certificate %q: %v", parentCert, err.Error())
+		os.Exit(-1)
+	}
+	parent := parents[0]
+
+	signing, err := key.ReadPEMFile(signingKey, &signingPass)
+	if err != nil {
+		log.Printf("no key found at %q: %v", signingKey, err.Error())
+		os.Exit(-1)
+	}
+
+	x, err := cert.CrossSignTemplate(existing)
+	if err != nil {
+		log.Printf("error reading certificate %q: %v", crossSignCert, err.Error())
+		os.Exit(-1)
+	}
+	if validityDays > 0 {
+		x.NotBefore = time.Now().UTC()
+		x.NotAfter = x.NotBefore.AddDate(0, 0, validityDays)
+	}
+	if x.NotAfter.After(parent.NotAfter) {
+		log.Printf("warning: the certificate expires after the parent certificate, at %s", parent.NotAfter.UTC().Format(time.RFC3339))
+	}
+	x.Serial = serial
+	x.OCSPServer = distributionFlags.OCSPServers
+	x.IssuingCertificateURL = distributionFlags.IssuerURLs
+	x.CRLDistributionPoints = distributionFlags.CRLDistPoints
+
+	registry, err := registerSerial(x, signing.Public())
+	if err != nil {
+		log.Printf("error assigning serial number: %v", err.Error())
+		os.Exit(-1)
+	}
+
+	b, err = cert.GenerateX509Certificate(x, parent, existing.PublicKey, signing)
+	if err != nil {
+		log.Printf("error generating certificate: %v", err.Error())
+		os.Exit(-1)
+	}
+
+	writeCertificate(b)
+	writeChain(b, parents)
+	saveRegistry(registry)
+}
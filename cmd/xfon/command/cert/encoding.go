@@ -0,0 +1,46 @@
+package cert
+
+import (
+	"crypto/x509"
+	"log"
+	"os"
+
+	"github.com/odacremolbap/xfon/cmd/xfon/command/flags"
+	"github.com/odacremolbap/xfon/pkg/cert"
+	"github.com/odacremolbap/xfon/pkg/filesystem"
+)
+
+var (
+	certEncodingFlag flags.CertEncoding
+	certEncoding     cert.Encoding
+)
+
+// parseEncodingFlags reads the certificate encoding flag
+func parseEncodingFlags() error {
+	var err error
+	certEncoding, err = certEncodingFlag.Parse()
+	return err
+}
+
+// writeCertificate writes the generated certificate to the
+// --cert-out file, if informed, with the informed encoding
+func writeCertificate(b []byte) {
+	if certOut == "" {
+		return
+	}
+
+	c, err := x509.ParseCertificate(b)
+	if err != nil {
+		log.Printf("error parsing generated certificate: %v", err.Error())
+		os.Exit(-1)
+	}
+	out, err := cert.WriteCertificates([]*x509.Certificate{c}, certEncoding)
+	if err != nil {
+		log.Printf("error encoding certificate: %v", err.Error())
+		os.Exit(-1)
+	}
+	if err = filesystem.WriteContentsToFile(certOut, string(out)); err != nil {
+		log.Printf("error writing certificate to file: %v", err.Error())
+		os.Exit(-1)
+	}
+}
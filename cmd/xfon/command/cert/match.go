@@ -0,0 +1,138 @@
+package cert
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/odacremolbap/xfon/pkg/key"
+	"github.com/odacremolbap/xfon/pkg/scan"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	matchCert   string
+	matchKey    string
+	matchOutput string
+
+	// MatchCmd checks that certificates and keys belong together
+	MatchCmd = &cobra.Command{
+		Use:   "match [paths...]",
+		Short: "checks that a certificate and a key match, or finds matching pairs",
+		Long: `checks that the certificate informed with --cert was issued for the key
+informed with --key, comparing their public keys.
+
+When paths are informed instead, files and directories are walked
+matching every PEM or DER certificate with the unencrypted PEM private
+keys found, and keys without certificate are listed. Encrypted keys are
+reported and skipped.
+
+Exit codes:
+  0   the certificate and key match, or the paths were scanned
+  1   the certificate and key do not match
+  255 wrong parameters or input files`,
+		Run:  matchRun,
+		Args: matchVal,
+	}
+)
+
+func init() {
+	MatchCmd.Flags().StringVar(&matchCert, "cert", "", "path to the certificate to check")
+	MatchCmd.Flags().StringVar(&matchKey, "key", "", "path to the key to check")
+	MatchCmd.Flags().StringVar(&keyPass.Env, "key-passphrase-env", "", "environment variable containing the passphrase for an encrypted key")
+	MatchCmd.Flags().StringVar(&keyPass.File, "key-passphrase-file", "", "file containing the passphrase for an encrypted key")
+	MatchCmd.Flags().StringVarP(&matchOutput, "output", "o", "table", "[table|json|yaml] output format for scans")
+	RootCmd.AddCommand(MatchCmd)
+}
+
+// matchVal validates the match command
+func matchVal(cmd *cobra.Command, args []string) error {
+	if (matchCert == "") != (matchKey == "") {
+		return fmt.Errorf("--cert and --key must be informed together")
+	}
+	if matchCert != "" && len(args) != 0 {
+		return fmt.Errorf("paths cannot be informed along with --cert and --key")
+	}
+	if matchCert == "" && len(args) == 0 {
+		return fmt.Errorf("either --cert and --key or at least one path must be informed")
+	}
+
+	switch matchOutput {
+	case "table", "json", "yaml":
+	default:
+		return fmt.Errorf("unknown output format: %s", matchOutput)
+	}
+
+	return nil
+}
+
+// matchRun runs the match command
+func matchRun(cmd *cobra.Command, args []string) {
+	if matchCert == "" {
+		scanPairs(args)
+		return
+	}
+
+	c, err := readCertificate(matchCert)
+	if err != nil {
+		log.Printf("%v", err.Error())
+		os.Exit(-1)
+	}
+	k, err := key.ReadPEMFile(matchKey, &keyPass)
+	if err != nil {
+		log.Printf("no key found at %q: %v", matchKey, err.Error())
+		os.Exit(-1)
+	}
+
+	if !key.Matches(k.Public(), c.PublicKey) {
+		fmt.Println("certificate and key do not match")
+		os.Exit(1)
+	}
+	pin, err := key.SPKIPin(c.PublicKey)
+	if err != nil {
+		log.Printf("%v", err.Error())
+		os.Exit(-1)
+	}
+	fmt.Printf("certificate and key match, SPKI pin %s\n", pin)
+}
+
+// scanPairs reports the certificate and key pairs found at the paths
+func scanPairs(paths []string) {
+	r := scan.FindPairs(paths)
+
+	var err error
+	switch matchOutput {
+	case "json":
+		var out []byte
+		out, err = json.MarshalIndent(r, "", "  ")
+		if err == nil {
+			_, err = os.Stdout.Write(append(out, '\n'))
+		}
+	case "yaml":
+		var out []byte
+		out, err = yaml.Marshal(r)
+		if err == nil {
+			_, err = os.Stdout.Write(out)
+		}
+	default:
+		for _, e := range r.Errors {
+			log.Printf("%v", e)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "CERTIFICATE\t#\tSUBJECT\tKEY")
+		for _, p := range r.Pairs {
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", p.Certificate, p.Position, p.Subject, p.Key)
+		}
+		for _, k := range r.UnmatchedKeys {
+			fmt.Fprintf(w, "-\t-\t-\t%s\n", k)
+		}
+		err = w.Flush()
+	}
+	if err != nil {
+		log.Printf("error writing match report: %v", err.Error())
+		os.Exit(-1)
+	}
+}
@@ -0,0 +1,68 @@
+package cert
+
+import (
+	"fmt"
+
+	"github.com/odacremolbap/xfon/pkg/cert"
+	"github.com/spf13/cobra"
+)
+
+var (
+	profileName string
+	profileFile string
+)
+
+// addProfileFlags registers the profile flags at the command
+func addProfileFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&profileName, "profile", "", "issuance profile name, built-in profiles are server, client, ocsp-responder, intermediate-ca and root-ca")
+	cmd.Flags().StringVar(&profileFile, "profile-file", "", "YAML or JSON file containing issuance profiles")
+}
+
+// applyProfile sets the profile defaults for every flag not informed
+// at the command line, and checks the validity days were set. The
+// profile subject is only applied when withSubject is true
+func applyProfile(cmd *cobra.Command, withSubject bool) error {
+	if profileName == "" {
+		if profileFile != "" {
+			return fmt.Errorf("--profile-file requires --profile")
+		}
+		return checkValidity()
+	}
+
+	p, err := cert.LoadProfile(profileName, profileFile)
+	if err != nil {
+		return err
+	}
+
+	if !cmd.Flags().Changed("days") {
+		validityDays = p.Days
+	}
+	if !cmd.Flags().Changed("usages") {
+		usage, _ = p.KeyUsage()
+	}
+	if !cmd.Flags().Changed("ext-usages") {
+		extUsage, _ = p.ExtKeyUsage()
+	}
+	if !cmd.Flags().Changed("ca") {
+		isCA = p.IsCA
+	}
+	if !cmd.Flags().Changed("max-path-len") && isCA && p.MaxPathLen != nil {
+		pathLen = *p.MaxPathLen
+	}
+
+	if withSubject {
+		s, _ := p.ParsedSubject()
+		s.Override(subject)
+		subject = s
+	}
+
+	return checkValidity()
+}
+
+// checkValidity fails when no validity days were informed
+func checkValidity() error {
+	if validityDays <= 0 {
+		return fmt.Errorf("validity days must be informed with --days or a profile")
+	}
+	return nil
+}
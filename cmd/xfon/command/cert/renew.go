@@ -0,0 +1,164 @@
+package cert
+
+import (
+	"crypto"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/odacremolbap/xfon/cmd/xfon/command/flags"
+	"github.com/odacremolbap/xfon/pkg/cert"
+	"github.com/odacremolbap/xfon/pkg/filesystem"
+	"github.com/odacremolbap/xfon/pkg/key"
+	"github.com/spf13/cobra"
+)
+
+var (
+	renewCert string
+	newKeyOut string
+
+	// RenewCmd issues a new certificate with the identity of an existing one
+	RenewCmd = &cobra.Command{
+		Use:   "renew",
+		Short: "renews a certificate keeping its identity",
+		Long: `renews a certificate, issuing a new one with a fresh serial and
+validity that keeps the subject, subject alternative names, usages,
+constraints and extensions of the existing certificate.
+
+The validity lasts as the existing certificate's unless --days is
+informed. The certificate key is reused by default, use --key-in to
+rotate to an existing key or --new-key-out to generate a new one of the
+same type and size. The subject key identifier is kept unless the key
+rotates. Self signed certificates are renewed informing them as
+--parent-cert.`,
+		Run:  renewRun,
+		Args: renewVal,
+	}
+)
+
+func init() {
+	RenewCmd.Flags().StringVar(&renewCert, "cert", "", "path to the certificate to renew")
+	RenewCmd.MarkFlagRequired("cert")
+	RenewCmd.Flags().IntVar(&validityDays, "days", 0, "number of validity days, as the existing certificate if not informed")
+	RenewCmd.Flags().StringVar(&serialNumber, "serial", "", "certificate serial number as decimal, 0x prefixed or colon separated hex, random if empty")
+	RenewCmd.Flags().StringVar(&serialRegistry, "serial-registry", "", "path to a serial registry file that rejects serials already issued by the CA")
+	RenewCmd.Flags().StringVar(&skiMethod, "ski-method", string(cert.SKIRFC5280Method1), "[rfc5280-1|rfc5280-2|rfc7093-1|rfc7093-2|rfc7093-3|rfc7093-4] subject key identifier method when the key rotates")
+
+	// in and out
+	RenewCmd.Flags().StringVar(&keyIn, "key-in", "", "path to a key replacing the certificate key, the existing key is reused if empty")
+	RenewCmd.Flags().StringVar(&keyPass.Env, "key-passphrase-env", "", "environment variable containing the passphrase for an encrypted key")
+	RenewCmd.Flags().StringVar(&keyPass.File, "key-passphrase-file", "", "file containing the passphrase for an encrypted key")
+	RenewCmd.Flags().StringVar(&newKeyOut, "new-key-out", "", "path where a new unencrypted key replacing the certificate key is written")
+	RenewCmd.Flags().StringVar(&certOut, "cert-out", "", "renewed certificate file path")
+	RenewCmd.MarkFlagRequired("cert-out")
+	flags.AddCertEncodingFlag(RenewCmd, &certEncodingFlag)
+	RenewCmd.Flags().StringVar(&signingKey, "signing-key", "", "path to key used for signing")
+	RenewCmd.MarkFlagRequired("signing-key")
+	RenewCmd.Flags().StringVar(&signingPass.Env, "signing-key-passphrase-env", "", "environment variable containing the passphrase for an encrypted signing key")
+	RenewCmd.Flags().StringVar(&signingPass.File, "signing-key-passphrase-file", "", "file containing the passphrase for an encrypted signing key")
+	RenewCmd.Flags().StringVar(&parentCert, "parent-cert", "", "path to parent cert")
+	RenewCmd.MarkFlagRequired("parent-cert")
+	RootCmd.AddCommand(RenewCmd)
+}
+
+// renewVal validates the renew command
+func renewVal(cmd *cobra.Command, args []string) error {
+	if keyIn != "" && newKeyOut != "" {
+		return fmt.Errorf("--key-in and --new-key-out cannot be used together")
+	}
+	if validityDays < 0 {
+		return fmt.Errorf("validity days must not be negative")
+	}
+	if err := parseEncodingFlags(); err != nil {
+		return err
+	}
+
+	return parseIssuanceFlags()
+}
+
+// renewRun runs the renew command
+func renewRun(cmd *cobra.Command, args []string) {
+	old, err := readCertificate(renewCert)
+	if err != nil {
+		log.Printf("%v", err.Error())
+		os.Exit(-1)
+	}
+
+	parent, err := readCertificate(parentCert)
+	if err != nil {
+		log.Printf("%v", err.Error())
+		os.Exit(-1)
+	}
+
+	signing, err := key.ReadPEMFile(signingKey, &signingPass)
+	if err != nil {
+		log.Printf("no key found at %q: %v", signingKey, err.Error())
+		os.Exit(-1)
+	}
+
+	var (
+		pub    = old.PublicKey
+		newKey crypto.Signer
+	)
+	switch {
+	case keyIn != "":
+		k, err := key.ReadPEMFile(keyIn, &keyPass)
+		if err != nil {
+			log.Printf("no key found at %q: %v", keyIn, err.Error())
+			os.Exit(-1)
+		}
+		pub = k.Public()
+	case newKeyOut != "":
+		o, err := key.OptionsFromPublicKey(old.PublicKey)
+		if err != nil {
+			log.Printf("error generating key: %v", err.Error())
+			os.Exit(-1)
+		}
+		newKey, err = key.GenerateKey(o)
+		if err != nil {
+			log.Printf("error generating key: %v", err.Error())
+			os.Exit(-1)
+		}
+		pub = newKey.Public()
+	}
+
+	x, err := cert.RenewalTemplate(old, time.Now().UTC(), validityDays)
+	if err != nil {
+		log.Printf("error reading certificate %q: %v", renewCert, err.Error())
+		os.Exit(-1)
+	}
+	x.Serial = serial
+	x.SubjectKeyIDMethod = skiComputed
+	// the subject key identifier is only recomputed when the key rotates,
+	// so that the authority key identifiers of issued certificates match
+	if key.Matches(pub, old.PublicKey) {
+		x.SubjectKeyID = append([]byte{}, old.SubjectKeyId...)
+	}
+
+	registry, err := registerSerial(x, signing.Public())
+	if err != nil {
+		log.Printf("error assigning serial number: %v", err.Error())
+		os.Exit(-1)
+	}
+
+	b, err := cert.GenerateX509Certificate(x, parent, pub, signing)
+	if err != nil {
+		log.Printf("error generating certificate: %v", err.Error())
+		os.Exit(-1)
+	}
+
+	if newKey != nil {
+		kp, err := key.WritePEM(newKey)
+		if err != nil {
+			log.Printf("error serializing key into PEM: %v", err.Error())
+			os.Exit(-1)
+		}
+		if err = filesystem.WriteContentsToFile(newKeyOut, kp); err != nil {
+			log.Printf("error writing key to file: %v", err.Error())
+			os.Exit(-1)
+		}
+	}
+	writeCertificate(b)
+	saveRegistry(registry)
+}
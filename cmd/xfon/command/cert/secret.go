@@ -0,0 +1,87 @@
+package cert
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/odacremolbap/xfon/cmd/xfon/command/flags"
+	"github.com/odacremolbap/xfon/pkg/cert"
+	"github.com/odacremolbap/xfon/pkg/key"
+	"github.com/odacremolbap/xfon/pkg/kubernetes"
+	"github.com/spf13/cobra"
+)
+
+// secretFlags holds the Kubernetes secret output flags
+var secretFlags flags.Secret
+
+// addSecretFlags registers the Kubernetes secret output flags at the command
+func addSecretFlags(cmd *cobra.Command) {
+	flags.AddSecretFlags(cmd, &secretFlags, "name of a kubernetes.io/tls secret manifest written with the certificate and the unencrypted key")
+}
+
+// parseSecretFlags validates the Kubernetes secret output flags. Either
+// the certificate file or the secret manifest must be written
+func parseSecretFlags() error {
+	if err := secretFlags.Validate(); err != nil {
+		return err
+	}
+	if secretFlags.Name == "" && certOut == "" {
+		return fmt.Errorf("either --cert-out or --secret-name must be informed")
+	}
+	return nil
+}
+
+// writeSecret writes the secret manifest, if requested. The certificate is
+// followed by the parents that are not self signed, and the CA certificate
+// is the last parent, or the certificate itself when self signed
+func writeSecret(leaf []byte, parents []*x509.Certificate, k crypto.Signer) {
+	if secretFlags.Name == "" {
+		return
+	}
+
+	c, err := x509.ParseCertificate(leaf)
+	if err != nil {
+		log.Printf("error parsing generated certificate: %v", err.Error())
+		os.Exit(-1)
+	}
+	chain := []*x509.Certificate{c}
+	for _, p := range parents {
+		if !bytes.Equal(p.RawIssuer, p.RawSubject) {
+			chain = append(chain, p)
+		}
+	}
+	ca := c
+	if len(parents) != 0 {
+		ca = parents[len(parents)-1]
+	}
+
+	crt, err := cert.WritePEMBundle(chain)
+	if err != nil {
+		log.Printf("error encoding certificate chain: %v", err.Error())
+		os.Exit(-1)
+	}
+	caPEM, err := cert.WritePEM(ca.Raw)
+	if err != nil {
+		log.Printf("error encoding CA certificate: %v", err.Error())
+		os.Exit(-1)
+	}
+	kp, err := key.WritePEM(k)
+	if err != nil {
+		log.Printf("error serializing key into PEM: %v", err.Error())
+		os.Exit(-1)
+	}
+
+	s, err := kubernetes.NewTLSSecret(secretFlags.Meta(), []byte(crt), []byte(kp), []byte(caPEM))
+	if err != nil {
+		log.Printf("%v", err.Error())
+		os.Exit(-1)
+	}
+	if err = secretFlags.Write(s); err != nil {
+		log.Printf("%v", err.Error())
+		os.Exit(-1)
+	}
+}
@@ -0,0 +1,118 @@
+package cert
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/odacremolbap/xfon/pkg/cert"
+	"github.com/odacremolbap/xfon/pkg/filesystem"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	output string
+
+	// ShowCmd prints certificate information
+	ShowCmd = &cobra.Command{
+		Use:   "show <file>",
+		Short: "prints certificate information",
+		Run:   showRun,
+		Args:  showVal,
+	}
+)
+
+func init() {
+	ShowCmd.Flags().StringVarP(&output, "output", "o", "text", "[text|json|yaml] output format")
+	RootCmd.AddCommand(ShowCmd)
+}
+
+// showVal validates the show certificate command
+func showVal(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("expected one certificate file, got %d", len(args))
+	}
+
+	switch output {
+	case "text", "json", "yaml":
+	default:
+		return fmt.Errorf("unknown output format: %s", output)
+	}
+
+	return nil
+}
+
+// showRun runs the show certificate command
+func showRun(cmd *cobra.Command, args []string) {
+	b, err := filesystem.ReadContentsFromFile(args[0])
+	if err != nil {
+		log.Printf("error reading certificate %q: %v", args[0], err.Error())
+		os.Exit(-1)
+	}
+
+	c, err := cert.ReadCertificate(b)
+	if err != nil {
+		log.Printf("no cert found at %q: %v", args[0], err.Error())
+		os.Exit(-1)
+	}
+
+	info := cert.NewInfo(c)
+
+	var out []byte
+	switch output {
+	case "json":
+		out, err = json.MarshalIndent(info, "", "  ")
+		out = append(out, '\n')
+	case "yaml":
+		out, err = yaml.Marshal(info)
+	default:
+		out = []byte(formatInfo(info))
+	}
+	if err != nil {
+		log.Printf("error serializing certificate information: %v", err.Error())
+		os.Exit(-1)
+	}
+
+	os.Stdout.Write(out)
+}
+
+// formatInfo renders certificate information for humans
+func formatInfo(i *cert.Info) string {
+	var b strings.Builder
+	line := func(name, value string) {
+		fmt.Fprintf(&b, "%-22s%s\n", name+":", value)
+	}
+	list := func(values []string) string {
+		if len(values) == 0 {
+			return "-"
+		}
+		return strings.Join(values, ", ")
+	}
+
+	line("Subject", i.Subject)
+	line("Issuer", i.Issuer)
+	line("Serial", i.Serial)
+	line("Not Before", i.NotBefore.Format(time.RFC3339))
+	line("Not After", i.NotAfter.Format(time.RFC3339))
+	line("CA", fmt.Sprintf("%t", i.IsCA))
+	line("DNS Names", list(i.DNSNames))
+	line("IP Addresses", list(i.IPAddresses))
+	line("URIs", list(i.URIs))
+	line("Email Addresses", list(i.EmailAddresses))
+	line("Other Names", list(i.OtherNames))
+	line("Key Usages", list(i.KeyUsages))
+	line("Ext Key Usages", list(i.ExtKeyUsages))
+	line("OCSP Servers", list(i.OCSPServers))
+	line("Issuing Cert URLs", list(i.IssuingCertificateURLs))
+	line("CRL Dist Points", list(i.CRLDistributionPoints))
+	line("Public Key Algorithm", i.PublicKeyAlgorithm)
+	line("Signature Algorithm", i.SignatureAlgorithm)
+	line("SHA-1 Fingerprint", i.Fingerprints.SHA1)
+	line("SHA-256 Fingerprint", i.Fingerprints.SHA256)
+
+	return b.String()
+}
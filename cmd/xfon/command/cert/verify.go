@@ -0,0 +1,155 @@
+package cert
+
+import (
+	"crypto/x509"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/odacremolbap/xfon/pkg/cert"
+	"github.com/odacremolbap/xfon/pkg/filesystem"
+	"github.com/spf13/cobra"
+)
+
+var (
+	verifyCert          string
+	verifyRoots         string
+	verifyIntermediates string
+	verifyName          string
+	verifyExtUsages     string
+	verifyAt            string
+
+	// VerifyCmd verifies a certificate chain
+	VerifyCmd = &cobra.Command{
+		Use:   "verify",
+		Short: "verifies a certificate chain",
+		Long: `verifies a certificate chain up to the informed roots.
+
+Exit codes:
+  0   the chain is valid
+  1   the chain is invalid for an unclassified reason
+  2   a certificate is expired or not yet valid
+  3   unknown authority, the chain does not lead to a root
+  4   the certificate is not valid for the informed name
+  5   the chain does not allow the informed extended usages
+  6   an issuer is not allowed to sign or violates its constraints
+  255 wrong parameters or input files`,
+		Run:  verifyRun,
+		Args: verifyVal,
+	}
+
+	verifyTime  time.Time
+	verifyUsage []x509.ExtKeyUsage
+)
+
+func init() {
+	VerifyCmd.Flags().StringVar(&verifyCert, "cert", "", "path to the certificate to verify")
+	VerifyCmd.MarkFlagRequired("cert")
+	VerifyCmd.Flags().StringVar(&verifyRoots, "roots", "", "comma separated paths to trusted root certificates, system roots if empty")
+	VerifyCmd.Flags().StringVar(&verifyIntermediates, "intermediates", "", "comma separated paths to intermediate certificates")
+	VerifyCmd.Flags().StringVar(&verifyName, "hostname", "", "hostname or IP address the certificate must be valid for")
+	VerifyCmd.Flags().StringVar(&verifyExtUsages, "ext-usages", "", "comma separated extended key usages the chain must allow, any if empty")
+	VerifyCmd.Flags().StringVar(&verifyAt, "at", "", "RFC3339 time to verify at, now if empty")
+	RootCmd.AddCommand(VerifyCmd)
+}
+
+// verifyVal validates the verify command
+func verifyVal(cmd *cobra.Command, args []string) error {
+	var err error
+	verifyUsage, err = cert.StringToExtKeyUsage(verifyExtUsages)
+	if err != nil {
+		return fmt.Errorf("error parsing extended key usage: %+v", err)
+	}
+
+	verifyTime = time.Time{}
+	if verifyAt != "" {
+		verifyTime, err = time.Parse(time.RFC3339, verifyAt)
+		if err != nil {
+			return fmt.Errorf("error parsing time: %+v", err)
+		}
+	}
+
+	return nil
+}
+
+// verifyRun runs the verify command
+func verifyRun(cmd *cobra.Command, args []string) {
+	c, err := readCertificate(verifyCert)
+	if err != nil {
+		log.Print(err.Error())
+		os.Exit(-1)
+	}
+
+	roots, err := readCertificateList(verifyRoots)
+	if err != nil {
+		log.Print(err.Error())
+		os.Exit(-1)
+	}
+
+	intermediates, err := readCertificateList(verifyIntermediates)
+	if err != nil {
+		log.Print(err.Error())
+		os.Exit(-1)
+	}
+
+	chains, err := cert.Verify(c, &cert.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		Name:          verifyName,
+		ExtKeyUsages:  verifyUsage,
+		At:            verifyTime,
+	})
+	if err != nil {
+		log.Printf("verification failed: %v", err.Error())
+		if ve, ok := err.(*cert.VerifyError); ok {
+			os.Exit(int(ve.Reason))
+		}
+		os.Exit(int(cert.FailureOther))
+	}
+
+	for i, chain := range chains {
+		fmt.Printf("chain %d:\n", i)
+		for _, cc := range chain {
+			fmt.Printf("  %s\n", cc.Subject)
+		}
+	}
+	fmt.Println("OK")
+}
+
+// readCertificate reads a PEM or DER certificate from a file
+func readCertificate(path string) (*x509.Certificate, error) {
+	b, err := filesystem.ReadContentsFromFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading cert %q: %v", path, err.Error())
+	}
+
+	c, err := cert.ReadCertificate(b)
+	if err != nil {
+		return nil, fmt.Errorf("no cert found at %q: %v", path, err.Error())
+	}
+
+	return c, nil
+}
+
+// readCertificateList reads every certificate from a comma
+// separated list of PEM, PEM bundle or DER files
+func readCertificateList(paths string) ([]*x509.Certificate, error) {
+	certs := []*x509.Certificate{}
+	for _, p := range strings.Split(paths, ",") {
+		if p == "" {
+			continue
+		}
+		b, err := filesystem.ReadContentsFromFile(p)
+		if err != nil {
+			return nil, fmt.Errorf("error reading cert %q: %v", p, err.Error())
+		}
+		found, err := cert.ReadCertificates(b)
+		if err != nil {
+			return nil, fmt.Errorf("no cert found at %q: %v", p, err.Error())
+		}
+		certs = append(certs, found...)
+	}
+	return certs, nil
+}
@@ -3,8 +3,18 @@ package command
 import (
 	"os"
 
+	"github.com/odacremolbap/xfon/cmd/xfon/command/acme"
+	"github.com/odacremolbap/xfon/cmd/xfon/command/ca"
 	"github.com/odacremolbap/xfon/cmd/xfon/command/cert"
+	"github.com/odacremolbap/xfon/cmd/xfon/command/crl"
+	"github.com/odacremolbap/xfon/cmd/xfon/command/csr"
+	"github.com/odacremolbap/xfon/cmd/xfon/command/key"
+	"github.com/odacremolbap/xfon/cmd/xfon/command/ocsp"
+	"github.com/odacremolbap/xfon/cmd/xfon/command/pkcs12"
+	"github.com/odacremolbap/xfon/cmd/xfon/command/pki"
 	"github.com/odacremolbap/xfon/cmd/xfon/command/rsa"
+	"github.com/odacremolbap/xfon/cmd/xfon/command/scan"
+	"github.com/odacremolbap/xfon/cmd/xfon/command/truststore"
 
 	"github.com/spf13/cobra"
 )
@@ -22,6 +32,16 @@ func init() {
 	XfonCmd.PersistentFlags().IntP("v", "v", 1, "verbosity level")
 	XfonCmd.AddCommand(cert.RootCmd)
 	XfonCmd.AddCommand(rsa.RootCmd)
+	XfonCmd.AddCommand(key.RootCmd)
+	XfonCmd.AddCommand(csr.RootCmd)
+	XfonCmd.AddCommand(crl.RootCmd)
+	XfonCmd.AddCommand(pkcs12.RootCmd)
+	XfonCmd.AddCommand(truststore.RootCmd)
+	XfonCmd.AddCommand(ca.RootCmd)
+	XfonCmd.AddCommand(acme.RootCmd)
+	XfonCmd.AddCommand(ocsp.RootCmd)
+	XfonCmd.AddCommand(scan.RootCmd)
+	XfonCmd.AddCommand(pki.RootCmd)
 }
 
 // Execute base command
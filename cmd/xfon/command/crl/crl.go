@@ -0,0 +1,265 @@
+package crl
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/odacremolbap/xfon/pkg/cert"
+	"github.com/odacremolbap/xfon/pkg/filesystem"
+	"github.com/odacremolbap/xfon/pkg/key"
+	"github.com/odacremolbap/xfon/pkg/passphrase"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	// issuer
+	caCert string
+	caKey  string
+	caPass passphrase.Source
+
+	// contents
+	revokedIn  string
+	nextUpdate string
+	crlNumber  string
+	validity   time.Duration
+	number     *big.Int
+
+	// in and out
+	crlOut string
+	output string
+
+	// RootCmd contains certificate revocation list commands
+	RootCmd = &cobra.Command{
+		Use:   "crl",
+		Short: "crl manages certificate revocation lists",
+		Run:   runHelp,
+	}
+
+	// NewCmd creates a certificate revocation list
+	NewCmd = &cobra.Command{
+		Use:   "new",
+		Short: "creates a CRL signed by a CA",
+		Long: `Creates a v2 CRL signed by a CA, including the CRL number and
+authority key identifier extensions.
+
+The revoked list file contains one certificate per line as
+
+  <serial> [reason] [RFC3339 revocation time]
+
+Serials are decimal, 0x prefixed hex or colon separated hex. Reasons are
+unspecified, keyCompromise, cACompromise, affiliationChanged, superseded,
+cessationOfOperation, certificateHold, removeFromCRL, privilegeWithdrawn
+or aACompromise. Entries without time are revoked now. Empty lines and
+lines starting with # are ignored.`,
+		Run:  newRun,
+		Args: newVal,
+	}
+
+	// ShowCmd prints CRL information
+	ShowCmd = &cobra.Command{
+		Use:   "show <file>",
+		Short: "prints CRL information and revoked entries",
+		Run:   showRun,
+		Args:  showVal,
+	}
+)
+
+func runHelp(cmd *cobra.Command, args []string) {
+	cmd.Help()
+}
+
+func init() {
+	NewCmd.Flags().StringVar(&caCert, "ca-cert", "", "path to the issuing CA certificate")
+	NewCmd.MarkFlagRequired("ca-cert")
+	NewCmd.Flags().StringVar(&caKey, "ca-key", "", "path to the issuing CA key")
+	NewCmd.MarkFlagRequired("ca-key")
+	NewCmd.Flags().StringVar(&caPass.Env, "ca-key-passphrase-env", "", "environment variable containing the passphrase for an encrypted CA key")
+	NewCmd.Flags().StringVar(&caPass.File, "ca-key-passphrase-file", "", "file containing the passphrase for an encrypted CA key")
+	NewCmd.Flags().StringVar(&revokedIn, "revoked", "", "path to the revoked certificates list, empty CRL if not informed")
+	NewCmd.Flags().StringVar(&nextUpdate, "next-update", "7d", "time until the next CRL update, as 7d or 12h")
+	NewCmd.Flags().StringVar(&crlNumber, "crl-number", "", "CRL number, defaults to the current unix time")
+	NewCmd.Flags().StringVar(&crlOut, "crl-out", "", "generated CRL file path")
+	NewCmd.MarkFlagRequired("crl-out")
+	RootCmd.AddCommand(NewCmd)
+
+	ShowCmd.Flags().StringVarP(&output, "output", "o", "text", "[text|json|yaml] output format")
+	ShowCmd.Flags().StringVar(&caCert, "ca-cert", "", "path to the issuing CA certificate, checks the CRL signature when informed")
+	RootCmd.AddCommand(ShowCmd)
+}
+
+// newVal validates parameters for the new CRL command
+func newVal(cmd *cobra.Command, args []string) error {
+	var err error
+	validity, err = cert.ParseDuration(nextUpdate)
+	if err != nil {
+		return fmt.Errorf("error parsing next update: %+v", err)
+	}
+	if validity <= 0 {
+		return fmt.Errorf("next update must be in the future")
+	}
+
+	if crlNumber == "" {
+		number = big.NewInt(time.Now().Unix())
+		return nil
+	}
+	number, err = cert.ParseSerial(crlNumber)
+	if err != nil {
+		return fmt.Errorf("error parsing CRL number: %+v", err)
+	}
+
+	return nil
+}
+
+// newRun runs the new CRL command
+func newRun(cmd *cobra.Command, args []string) {
+	b, err := filesystem.ReadContentsFromFile(caCert)
+	if err != nil {
+		log.Printf("error reading CA certificate %q: %v", caCert, err.Error())
+		os.Exit(-1)
+	}
+	issuer, err := cert.ReadCertificate(b)
+	if err != nil {
+		log.Printf("no cert found at %q: %v", caCert, err.Error())
+		os.Exit(-1)
+	}
+
+	signing, err := key.ReadPEMFile(caKey, &caPass)
+	if err != nil {
+		log.Printf("no key found at %q: %v", caKey, err.Error())
+		os.Exit(-1)
+	}
+
+	now := time.Now().UTC()
+	c := &cert.CRLSimplified{
+		Number:     number,
+		ThisUpdate: now,
+		NextUpdate: now.Add(validity),
+	}
+
+	if revokedIn != "" {
+		b, err = filesystem.ReadContentsFromFile(revokedIn)
+		if err != nil {
+			log.Printf("error reading revoked list %q: %v", revokedIn, err.Error())
+			os.Exit(-1)
+		}
+		c.Revoked, err = cert.ParseRevokedList(b, now)
+		if err != nil {
+			log.Printf("error parsing revoked list %q: %v", revokedIn, err.Error())
+			os.Exit(-1)
+		}
+	}
+
+	crl, err := cert.GenerateCRL(c, issuer, signing)
+	if err != nil {
+		log.Printf("error generating CRL: %v", err.Error())
+		os.Exit(-1)
+	}
+
+	pem, err := cert.WriteCRLPEM(crl)
+	if err != nil {
+		log.Printf("error encoding CRL: %v", err.Error())
+		os.Exit(-1)
+	}
+
+	err = filesystem.WriteContentsToFile(crlOut, pem)
+	if err != nil {
+		log.Printf("error writing CRL to file: %v", err.Error())
+		os.Exit(-1)
+	}
+}
+
+// showVal validates the show CRL command
+func showVal(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("expected one CRL file, got %d", len(args))
+	}
+
+	switch output {
+	case "text", "json", "yaml":
+	default:
+		return fmt.Errorf("unknown output format: %s", output)
+	}
+
+	return nil
+}
+
+// showRun runs the show CRL command
+func showRun(cmd *cobra.Command, args []string) {
+	b, err := filesystem.ReadContentsFromFile(args[0])
+	if err != nil {
+		log.Printf("error reading CRL %q: %v", args[0], err.Error())
+		os.Exit(-1)
+	}
+
+	crl, err := cert.ReadCRL(b)
+	if err != nil {
+		log.Printf("no CRL found at %q: %v", args[0], err.Error())
+		os.Exit(-1)
+	}
+
+	if caCert != "" {
+		b, err := filesystem.ReadContentsFromFile(caCert)
+		if err != nil {
+			log.Printf("error reading CA certificate %q: %v", caCert, err.Error())
+			os.Exit(-1)
+		}
+		issuer, err := cert.ReadCertificate(b)
+		if err != nil {
+			log.Printf("no cert found at %q: %v", caCert, err.Error())
+			os.Exit(-1)
+		}
+		if err := cert.VerifyCRL(crl, issuer); err != nil {
+			log.Printf("CRL %q was not issued by %q: %v", args[0], caCert, err.Error())
+			os.Exit(-1)
+		}
+	}
+
+	info := cert.NewCRLInfo(crl)
+
+	var out []byte
+	switch output {
+	case "json":
+		out, err = json.MarshalIndent(info, "", "  ")
+		out = append(out, '\n')
+	case "yaml":
+		out, err = yaml.Marshal(info)
+	default:
+		out = []byte(formatInfo(info))
+	}
+	if err != nil {
+		log.Printf("error serializing CRL information: %v", err.Error())
+		os.Exit(-1)
+	}
+
+	os.Stdout.Write(out)
+}
+
+// formatInfo renders CRL information for humans
+func formatInfo(i *cert.CRLInfo) string {
+	var b strings.Builder
+	line := func(name, value string) {
+		fmt.Fprintf(&b, "%-22s%s\n", name+":", value)
+	}
+
+	line("Issuer", i.Issuer)
+	line("CRL Number", i.Number)
+	line("This Update", i.ThisUpdate.Format(time.RFC3339))
+	line("Next Update", i.NextUpdate.Format(time.RFC3339))
+	line("Authority Key ID", i.AuthorityKeyID)
+	line("Signature Algorithm", i.SignatureAlgorithm)
+	line("Revoked", fmt.Sprintf("%d", len(i.Revoked)))
+	for _, r := range i.Revoked {
+		fmt.Fprintf(&b, "  %s\n    %-20s%s\n    %-20s%s\n",
+			r.Serial,
+			"Revoked At:", r.RevokedAt.Format(time.RFC3339),
+			"Reason:", r.Reason)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,153 @@
+package csr
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+
+	"github.com/odacremolbap/xfon/cmd/xfon/command/flags"
+	"github.com/odacremolbap/xfon/pkg/cert"
+	"github.com/odacremolbap/xfon/pkg/filesystem"
+	"github.com/odacremolbap/xfon/pkg/key"
+	"github.com/odacremolbap/xfon/pkg/passphrase"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// subject
+	subjectFlags flags.Subject
+	subject      *cert.Subject
+
+	// addresses
+	dnsAddressList string
+	ipAddressList  string
+	uriSANList     string
+	emailSANList   string
+	otherNameSANs  []string
+	dnsList        []string
+	ipList         []net.IP
+	uriList        []*url.URL
+	emailList      []string
+	otherNameList  []cert.OtherName
+
+	// in and out
+	keyIn   string
+	keyPass passphrase.Source
+	csrOut  string
+
+	// RootCmd contains certificate signing request commands
+	RootCmd = &cobra.Command{
+		Use:   "csr",
+		Short: "csr manages certificate signing requests",
+		Run:   runHelp,
+	}
+
+	// NewCmd creates a certificate signing request
+	NewCmd = &cobra.Command{
+		Use:   "new",
+		Short: "creates a PKCS#10 certificate signing request",
+		Run:   newRun,
+		Args:  newVal,
+	}
+)
+
+func runHelp(cmd *cobra.Command, args []string) {
+	cmd.Help()
+}
+
+func init() {
+	// subject
+	flags.AddSubjectFlags(NewCmd, &subjectFlags)
+
+	// addresses
+	NewCmd.Flags().StringVar(&dnsAddressList, "dns-addresses", "", "comma separated list of name addresses")
+	NewCmd.Flags().StringVar(&ipAddressList, "ip-addresses", "", "comma separated list of ip addresses")
+	NewCmd.Flags().StringVar(&uriSANList, "uri-sans", "", "comma separated list of URI subject alternative names, such as SPIFFE IDs")
+	NewCmd.Flags().StringVar(&emailSANList, "email-sans", "", "comma separated list of email subject alternative names")
+	NewCmd.Flags().StringArrayVar(&otherNameSANs, "other-name-sans", nil, "otherName subject alternative name as <OID|UPN>;UTF8:<value>, can be repeated")
+
+	// in and out
+	NewCmd.Flags().StringVar(&keyIn, "key-in", "", "path to key")
+	NewCmd.MarkFlagRequired("key-in")
+	NewCmd.Flags().StringVar(&keyPass.Env, "key-passphrase-env", "", "environment variable containing the passphrase for an encrypted key")
+	NewCmd.Flags().StringVar(&keyPass.File, "key-passphrase-file", "", "file containing the passphrase for an encrypted key")
+	NewCmd.Flags().StringVar(&csrOut, "csr-out", "", "generated certificate request file path")
+	NewCmd.MarkFlagRequired("csr-out")
+
+	RootCmd.AddCommand(NewCmd)
+}
+
+// newVal validates parameters for the new certificate request command
+func newVal(cmd *cobra.Command, args []string) error {
+	var err error
+	ipList, err = cert.StringToIPAddressList(ipAddressList)
+	if err != nil {
+		return fmt.Errorf("error parsing ip addresses: %+v", err)
+	}
+
+	dnsList = cert.StringToDNSAddressList(dnsAddressList)
+
+	uriList, err = cert.StringToURIList(uriSANList)
+	if err != nil {
+		return fmt.Errorf("error parsing URI SANs: %+v", err)
+	}
+
+	emailList, err = cert.StringToEmailList(emailSANList)
+	if err != nil {
+		return fmt.Errorf("error parsing email SANs: %+v", err)
+	}
+
+	otherNameList = nil
+	for _, o := range otherNameSANs {
+		on, err := cert.ParseOtherName(o)
+		if err != nil {
+			return fmt.Errorf("error parsing otherName SANs: %+v", err)
+		}
+		otherNameList = append(otherNameList, on)
+	}
+
+	subject, err = subjectFlags.Build()
+	if err != nil {
+		return fmt.Errorf("error parsing subject: %+v", err)
+	}
+
+	return nil
+}
+
+// newRun runs the new certificate request command
+func newRun(cmd *cobra.Command, args []string) {
+	k, err := key.ReadPEMFile(keyIn, &keyPass)
+	if err != nil {
+		log.Printf("no key found at %q: %v", keyIn, err.Error())
+		os.Exit(-1)
+	}
+
+	r := &cert.CSRSimplified{
+		Subject:        subject,
+		DNSNames:       dnsList,
+		IPAddresses:    ipList,
+		URIs:           uriList,
+		EmailAddresses: emailList,
+		OtherNames:     otherNameList,
+	}
+
+	b, err := cert.GenerateCSR(r, k)
+	if err != nil {
+		log.Printf("error generating certificate request: %v", err.Error())
+		os.Exit(-1)
+	}
+
+	pem, err := cert.WriteCSRPEM(b)
+	if err != nil {
+		log.Printf("error encoding certificate request: %v", err.Error())
+		os.Exit(-1)
+	}
+
+	err = filesystem.WriteContentsToFile(csrOut, pem)
+	if err != nil {
+		log.Printf("error writing certificate request to file: %v", err.Error())
+		os.Exit(-1)
+	}
+}
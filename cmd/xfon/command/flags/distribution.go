@@ -0,0 +1,46 @@
+package flags
+
+import (
+	"fmt"
+
+	"github.com/odacremolbap/xfon/pkg/cert"
+	"github.com/spf13/cobra"
+)
+
+// Distribution holds the values of the authority information
+// access and CRL distribution point flags
+type Distribution struct {
+	OCSPServerList   string
+	IssuerURLList    string
+	CRLDistPointList string
+
+	OCSPServers   []string
+	IssuerURLs    []string
+	CRLDistPoints []string
+}
+
+// AddDistributionFlags registers the OCSP, issuer and CRL location flags
+// at the command. The usage, when informed, is appended to their help
+func AddDistributionFlags(cmd *cobra.Command, d *Distribution, usage string) {
+	if usage != "" {
+		usage = ", " + usage
+	}
+	cmd.Flags().StringVar(&d.OCSPServerList, "ocsp-servers", "", "comma separated list of OCSP responder URLs"+usage)
+	cmd.Flags().StringVar(&d.IssuerURLList, "issuing-certificate-urls", "", "comma separated list of URLs where the issuer certificate is published"+usage)
+	cmd.Flags().StringVar(&d.CRLDistPointList, "crl-distribution-points", "", "comma separated list of URLs where the issuer CRL is published"+usage)
+}
+
+// Parse reads the informed OCSP, issuer and CRL location lists
+func (d *Distribution) Parse() error {
+	var err error
+	if d.OCSPServers, err = cert.StringToURLList(d.OCSPServerList); err != nil {
+		return fmt.Errorf("error parsing OCSP servers: %+v", err)
+	}
+	if d.IssuerURLs, err = cert.StringToURLList(d.IssuerURLList); err != nil {
+		return fmt.Errorf("error parsing issuing certificate URLs: %+v", err)
+	}
+	if d.CRLDistPoints, err = cert.StringToURLList(d.CRLDistPointList); err != nil {
+		return fmt.Errorf("error parsing CRL distribution points: %+v", err)
+	}
+	return nil
+}
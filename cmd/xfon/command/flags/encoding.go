@@ -0,0 +1,28 @@
+package flags
+
+import (
+	"fmt"
+
+	"github.com/odacremolbap/xfon/pkg/cert"
+	"github.com/spf13/cobra"
+)
+
+// CertEncoding holds the value of the certificate encoding flag
+type CertEncoding struct {
+	Value string
+}
+
+// AddCertEncodingFlag registers the encoding flag for the
+// certificate written to --cert-out at the command
+func AddCertEncodingFlag(cmd *cobra.Command, e *CertEncoding) {
+	cmd.Flags().StringVar(&e.Value, "cert-encoding", string(cert.PEMEncoding), "[pem|der] encoding of the certificate written to --cert-out")
+}
+
+// Parse returns the informed certificate encoding
+func (e *CertEncoding) Parse() (cert.Encoding, error) {
+	enc, ok := cert.EncodingChoices[e.Value]
+	if !ok {
+		return "", fmt.Errorf("unknown certificate encoding: %s", e.Value)
+	}
+	return enc, nil
+}
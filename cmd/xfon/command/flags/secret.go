@@ -0,0 +1,73 @@
+package flags
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/odacremolbap/xfon/pkg/filesystem"
+	"github.com/odacremolbap/xfon/pkg/kubernetes"
+	"github.com/spf13/cobra"
+)
+
+// Secret holds the values of the Kubernetes secret output flags
+type Secret struct {
+	Name      string
+	Namespace string
+	Labels    map[string]string
+	Format    string
+	Out       string
+}
+
+// AddSecretFlags registers the Kubernetes secret output flags at
+// the command, describing the written secret with nameUsage
+func AddSecretFlags(cmd *cobra.Command, s *Secret, nameUsage string) {
+	cmd.Flags().StringVar(&s.Name, "secret-name", "", nameUsage)
+	cmd.Flags().StringVar(&s.Namespace, "secret-namespace", "", "namespace of the secret manifest")
+	cmd.Flags().StringToStringVar(&s.Labels, "secret-labels", nil, "comma separated key=value labels of the secret manifest")
+	cmd.Flags().StringVar(&s.Format, "secret-format", string(kubernetes.YAML), "[yaml|json] secret manifest format")
+	cmd.Flags().StringVar(&s.Out, "secret-out", "", "secret manifest file path, standard output if empty")
+}
+
+// Validate checks the secret output flags. The rest of
+// them can only be informed along with the secret name
+func (s *Secret) Validate() error {
+	if s.Name == "" {
+		if s.Namespace != "" || len(s.Labels) != 0 || s.Out != "" {
+			return fmt.Errorf("--secret-name must be informed to write a secret manifest")
+		}
+		return nil
+	}
+
+	if _, ok := kubernetes.FormatChoices[s.Format]; !ok {
+		return fmt.Errorf("unknown secret manifest format: %s", s.Format)
+	}
+	meta := s.Meta()
+	return meta.Validate()
+}
+
+// Meta returns the secret metadata informed with flags
+func (s *Secret) Meta() kubernetes.ObjectMeta {
+	return kubernetes.ObjectMeta{
+		Name:      s.Name,
+		Namespace: s.Namespace,
+		Labels:    s.Labels,
+	}
+}
+
+// Write serializes the secret manifest using the informed format
+// and writes it to the output file, or standard output if empty
+func (s *Secret) Write(secret *kubernetes.Secret) error {
+	b, err := secret.Marshal(kubernetes.FormatChoices[s.Format])
+	if err != nil {
+		return fmt.Errorf("error serializing secret manifest: %s", err.Error())
+	}
+
+	if s.Out == "" {
+		_, err = os.Stdout.Write(b)
+		return err
+	}
+	if err = filesystem.WriteContentsToFile(s.Out, string(b)); err != nil {
+		return fmt.Errorf("error writing secret manifest to file: %s", err.Error())
+	}
+	return nil
+}
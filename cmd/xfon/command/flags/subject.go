@@ -0,0 +1,35 @@
+package flags
+
+import (
+	"github.com/odacremolbap/xfon/pkg/cert"
+	"github.com/spf13/cobra"
+)
+
+// Subject holds the values of the subject flags
+type Subject struct {
+	String     string
+	Attributes []string
+	Fields     cert.Subject
+}
+
+// AddSubjectFlags registers the subject flags at the command.
+// Individual fields take precedence over the subject string
+func AddSubjectFlags(cmd *cobra.Command, s *Subject) {
+	cmd.Flags().StringVar(&s.String, "subject", "", "subject as \"/C=ES/O=Acme/CN=foo\" or RFC 4514 \"CN=foo,O=Acme,C=ES\"")
+	cmd.Flags().StringArrayVar(&s.Attributes, "subject-attribute", nil, "extra subject attribute as OID=value, can be repeated")
+	cmd.Flags().StringVar(&s.Fields.CommonName, "common-name", "", "CN for certificate")
+	cmd.Flags().StringArrayVar(&s.Fields.Organization, "organization", nil, "O for certificate, can be repeated")
+	cmd.Flags().StringArrayVar(&s.Fields.OrganizationalUnit, "organizational-unit", nil, "OU for certificate, can be repeated")
+	cmd.Flags().StringArrayVar(&s.Fields.Country, "country", nil, "C for certificate, can be repeated")
+	cmd.Flags().StringArrayVar(&s.Fields.Province, "province", nil, "ST for certificate, can be repeated")
+	cmd.Flags().StringArrayVar(&s.Fields.Locality, "locality", nil, "L for certificate, can be repeated")
+	cmd.Flags().StringArrayVar(&s.Fields.StreetAddress, "street-address", nil, "street for certificate, can be repeated")
+	cmd.Flags().StringArrayVar(&s.Fields.PostalCode, "postal-code", nil, "postal code for certificate, can be repeated")
+	cmd.Flags().StringVar(&s.Fields.SerialNumber, "subject-serial-number", "", "serialNumber subject attribute for certificate")
+	cmd.Flags().StringArrayVar(&s.Fields.EmailAddress, "subject-email", nil, "emailAddress subject attribute for certificate, can be repeated")
+}
+
+// Build returns the subject informed with flags
+func (s *Subject) Build() (*cert.Subject, error) {
+	return cert.BuildSubject(s.String, s.Attributes, &s.Fields)
+}
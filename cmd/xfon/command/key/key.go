@@ -0,0 +1,124 @@
+package key
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/odacremolbap/xfon/pkg/filesystem"
+	"github.com/odacremolbap/xfon/pkg/key"
+	"github.com/odacremolbap/xfon/pkg/passphrase"
+	"github.com/spf13/cobra"
+)
+
+var (
+	keyType string
+	bits    int
+	curve   string
+	out     string
+	format  string
+
+	// encryption
+	encrypt bool
+	kdf     string
+	pass    passphrase.Source
+
+	// RootCmd manages private keys of any supported type
+	RootCmd = &cobra.Command{
+		Use:   "key",
+		Short: "manages RSA, ECDSA and Ed25519 private keys",
+		Run:   runHelp,
+	}
+
+	// NewCmd creates a new private key
+	NewCmd = &cobra.Command{
+		Use:   "new",
+		Short: "creates new private key",
+		Run:   newRun,
+		Args:  newVal,
+	}
+)
+
+func runHelp(cmd *cobra.Command, args []string) {
+	cmd.Help()
+}
+
+func init() {
+	NewCmd.Flags().StringVar(&keyType, "type", string(key.RSA), "[rsa|ecdsa|ed25519] key type")
+	NewCmd.Flags().IntVar(&bits, "bits", 4096, "key size, only for RSA keys")
+	NewCmd.Flags().StringVar(&curve, "curve", "P-256", "[P-256|P-384|P-521] elliptic curve, only for ECDSA keys")
+	NewCmd.Flags().StringVar(&out, "out", "", "key output file")
+	NewCmd.MarkFlagRequired("out")
+	NewCmd.Flags().StringVar(&format, "format", "", "[pkcs1|sec1|pkcs8] key encoding, defaults to pkcs1 for RSA, sec1 for ECDSA and pkcs8 for Ed25519")
+
+	// encryption
+	NewCmd.Flags().BoolVar(&encrypt, "encrypt", false, "protect the key with a passphrase, implies PKCS#8 format")
+	NewCmd.Flags().StringVar(&kdf, "kdf", string(key.PBKDF2), "[pbkdf2|scrypt] key derivation function for encrypted keys")
+	NewCmd.Flags().StringVar(&pass.Env, "passphrase-env", "", "environment variable containing the passphrase, prompted if no source is informed")
+	NewCmd.Flags().StringVar(&pass.File, "passphrase-file", "", "file containing the passphrase, prompted if no source is informed")
+	RootCmd.AddCommand(NewCmd)
+}
+
+// newVal validates parameters for the new key command
+func newVal(cmd *cobra.Command, args []string) error {
+	t, ok := key.TypeChoices[keyType]
+	if !ok {
+		return fmt.Errorf("unknown key type: %s", keyType)
+	}
+	if t == key.ECDSA {
+		if _, ok := key.CurveChoices[curve]; !ok {
+			return fmt.Errorf("unknown curve: %s", curve)
+		}
+	}
+	if format != "" {
+		f, ok := key.FormatChoices[format]
+		if !ok {
+			return fmt.Errorf("unknown key format: %s", format)
+		}
+		if encrypt && f != key.PKCS8 {
+			return fmt.Errorf("encrypted keys can only be written as %s", key.PKCS8)
+		}
+	}
+	if _, ok := key.KDFChoices[kdf]; !ok {
+		return fmt.Errorf("unknown key derivation function: %s", kdf)
+	}
+	return nil
+}
+
+// newRun runs the new key command
+func newRun(cmd *cobra.Command, args []string) {
+	k, err := key.GenerateKey(&key.Options{
+		Type:  key.TypeChoices[keyType],
+		Bits:  bits,
+		Curve: curve,
+	})
+	if err != nil {
+		log.Printf("error generating %s key: %v", keyType, err.Error())
+		os.Exit(-1)
+	}
+
+	var p string
+	switch {
+	case encrypt:
+		pp, perr := pass.Read("passphrase for new key: ", true)
+		if perr != nil {
+			log.Printf("error reading passphrase: %v", perr.Error())
+			os.Exit(-1)
+		}
+		p, err = key.WriteEncryptedPEM(k, pp, key.KDFChoices[kdf])
+	case format != "":
+		p, err = key.WritePEMFormat(k, key.FormatChoices[format])
+	default:
+		p, err = key.WritePEM(k)
+	}
+	if err != nil {
+		log.Printf("error serializing key into PEM: %v", err.Error())
+		os.Exit(-1)
+	}
+
+	err = filesystem.WriteContentsToFile(out, p)
+	if err != nil {
+		log.Printf("error writing key to file: %v", err.Error())
+		os.Exit(-1)
+	}
+}
@@ -0,0 +1,136 @@
+package key
+
+import (
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/odacremolbap/xfon/pkg/filesystem"
+	"github.com/odacremolbap/xfon/pkg/key"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	output    string
+	publicOut string
+
+	// ShowCmd prints key information
+	ShowCmd = &cobra.Command{
+		Use:   "show <file>",
+		Short: "prints key information",
+		Long: `prints the algorithm, size, public key fingerprint and SPKI pin of a
+private or public PEM key, without revealing any private material.
+
+The fingerprint and pin are the SHA-256 of the DER encoded subject
+public key info, as hex and base64. The pin is the value used by HTTP
+public key pinning and curl --pinnedpubkey sha256//<pin>, and is shared
+by every certificate issued for the key.`,
+		Run:  showRun,
+		Args: showVal,
+	}
+)
+
+func init() {
+	ShowCmd.Flags().StringVarP(&output, "output", "o", "text", "[text|json|yaml] output format")
+	ShowCmd.Flags().StringVar(&publicOut, "public-out", "", "file path where the PEM public key is written")
+	ShowCmd.Flags().StringVar(&pass.Env, "passphrase-env", "", "environment variable containing the passphrase for an encrypted key")
+	ShowCmd.Flags().StringVar(&pass.File, "passphrase-file", "", "file containing the passphrase for an encrypted key")
+	RootCmd.AddCommand(ShowCmd)
+}
+
+// showVal validates the show key command
+func showVal(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("expected one key file, got %d", len(args))
+	}
+
+	switch output {
+	case "text", "json", "yaml":
+	default:
+		return fmt.Errorf("unknown output format: %s", output)
+	}
+
+	return nil
+}
+
+// showRun runs the show key command
+func showRun(cmd *cobra.Command, args []string) {
+	b, err := filesystem.ReadContentsFromFile(args[0])
+	if err != nil {
+		log.Printf("error reading key %q: %v", args[0], err.Error())
+		os.Exit(-1)
+	}
+
+	var pub crypto.PublicKey
+	if strings.Contains(string(b), "PRIVATE KEY-----") {
+		k, err := key.ReadPEMFile(args[0], &pass)
+		if err != nil {
+			log.Printf("no key found at %q: %v", args[0], err.Error())
+			os.Exit(-1)
+		}
+		pub = k.Public()
+	} else if pub, err = key.ReadPublicPEM(b); err != nil {
+		log.Printf("no key found at %q: %v", args[0], err.Error())
+		os.Exit(-1)
+	}
+
+	info, err := key.NewInfo(pub)
+	if err != nil {
+		log.Printf("%v", err.Error())
+		os.Exit(-1)
+	}
+
+	var out []byte
+	switch output {
+	case "json":
+		out, err = json.MarshalIndent(info, "", "  ")
+		out = append(out, '\n')
+	case "yaml":
+		out, err = yaml.Marshal(info)
+	default:
+		out = []byte(formatInfo(info))
+	}
+	if err != nil {
+		log.Printf("error serializing key information: %v", err.Error())
+		os.Exit(-1)
+	}
+
+	if publicOut != "" {
+		p, err := key.WritePublicPEM(pub)
+		if err != nil {
+			log.Printf("%v", err.Error())
+			os.Exit(-1)
+		}
+		if err = filesystem.WriteContentsToFile(publicOut, p); err != nil {
+			log.Printf("error writing public key to file: %v", err.Error())
+			os.Exit(-1)
+		}
+	}
+
+	os.Stdout.Write(out)
+}
+
+// formatInfo renders key information for humans
+func formatInfo(i *key.Info) string {
+	var b strings.Builder
+	line := func(name, value string) {
+		fmt.Fprintf(&b, "%-22s%s\n", name+":", value)
+	}
+
+	line("Algorithm", i.Algorithm)
+	line("Size", fmt.Sprintf("%d bits", i.Size))
+	if i.Curve != "" {
+		line("Curve", i.Curve)
+	}
+	if i.Exponent != 0 {
+		line("Exponent", fmt.Sprintf("%d", i.Exponent))
+	}
+	line("SHA-256 Fingerprint", i.Fingerprint)
+	line("SPKI Pin", i.SPKIPin)
+
+	return b.String()
+}
@@ -0,0 +1,277 @@
+package ocsp
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/odacremolbap/xfon/pkg/ca"
+	"github.com/odacremolbap/xfon/pkg/cert"
+	"github.com/odacremolbap/xfon/pkg/filesystem"
+	"github.com/odacremolbap/xfon/pkg/key"
+	"github.com/odacremolbap/xfon/pkg/ocsp"
+	"github.com/odacremolbap/xfon/pkg/passphrase"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	// serve
+	caDir         string
+	listen        string
+	responderCert string
+	responderKey  string
+	validity      string
+	validityDur   time.Duration
+	responderPass passphrase.Source
+	caPass        passphrase.Source
+
+	// query
+	certIn      string
+	issuerIn    string
+	responder   string
+	method      string
+	hashName    string
+	output      string
+	timeoutSecs int
+
+	// RootCmd contains OCSP commands
+	RootCmd = &cobra.Command{
+		Use:   "ocsp",
+		Short: "ocsp answers and sends RFC 6960 certificate status requests",
+		Run:   runHelp,
+	}
+
+	// ServeCmd runs an OCSP responder
+	ServeCmd = &cobra.Command{
+		Use:   "serve",
+		Short: "answers OCSP requests from a CA directory index",
+		Long: `Answers OCSP requests, sent using GET or POST, with the status of
+certificates at the index of a CA directory created with "xfon ca
+init". The index is read on every request, so revocations made with
+"xfon ca revoke" are reported right away. Serials not at the index
+are reported as unknown.
+
+Responses are signed with the CA key, or with a delegated responder
+certificate issued by the CA with the OCSPSigning extended key usage,
+as the ocsp-responder profile does.`,
+		Run:  serveRun,
+		Args: serveVal,
+	}
+
+	// QueryCmd requests the status of a certificate
+	QueryCmd = &cobra.Command{
+		Use:   "query",
+		Short: "requests the status of a certificate to an OCSP responder",
+		Long: `Requests the status of a certificate to an OCSP responder, by default
+the first one at the certificate authority information access
+extension. The response signature is verified against the issuer.`,
+		Run:  queryRun,
+		Args: queryVal,
+	}
+)
+
+func runHelp(cmd *cobra.Command, args []string) {
+	cmd.Help()
+}
+
+func init() {
+	ServeCmd.Flags().StringVar(&caDir, "ca-dir", "", "CA directory whose index is used")
+	ServeCmd.Flags().StringVar(&listen, "listen", ":8080", "address to listen at")
+	ServeCmd.Flags().StringVar(&responderCert, "responder-cert", "", "delegated responder certificate, the CA signs responses if not informed")
+	ServeCmd.Flags().StringVar(&responderKey, "responder-key", "", "delegated responder key")
+	ServeCmd.Flags().StringVar(&responderPass.Env, "responder-key-passphrase-env", "", "environment variable containing the passphrase for an encrypted responder key")
+	ServeCmd.Flags().StringVar(&responderPass.File, "responder-key-passphrase-file", "", "file containing the passphrase for an encrypted responder key")
+	ServeCmd.Flags().StringVar(&caPass.Env, "ca-key-passphrase-env", "", "environment variable containing the passphrase for an encrypted CA key")
+	ServeCmd.Flags().StringVar(&caPass.File, "ca-key-passphrase-file", "", "file containing the passphrase for an encrypted CA key")
+	ServeCmd.Flags().StringVar(&validity, "validity", "1h", "time responses are valid for, as in 1h or 1d")
+	RootCmd.AddCommand(ServeCmd)
+
+	QueryCmd.Flags().StringVar(&certIn, "cert", "", "certificate to check")
+	QueryCmd.Flags().StringVar(&issuerIn, "issuer", "", "certificate of the CA that issued the certificate")
+	QueryCmd.Flags().StringVar(&responder, "url", "", "responder URL, the certificate OCSP server if not informed")
+	QueryCmd.Flags().StringVar(&method, "method", "post", "[get|post] HTTP method for the request")
+	QueryCmd.Flags().StringVar(&hashName, "hash", "sha1", "[sha1|sha256|sha384|sha512] hash identifying the certificate")
+	QueryCmd.Flags().IntVar(&timeoutSecs, "timeout", 10, "request timeout in seconds")
+	QueryCmd.Flags().StringVarP(&output, "output", "o", "text", "[text|json|yaml] output format")
+	RootCmd.AddCommand(QueryCmd)
+}
+
+// serveVal validates parameters for the serve command
+func serveVal(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("unexpected arguments: %v", args)
+	}
+	if caDir == "" {
+		return fmt.Errorf("--ca-dir must be informed")
+	}
+	if (responderCert == "") != (responderKey == "") {
+		return fmt.Errorf("--responder-cert and --responder-key must be informed together")
+	}
+
+	var err error
+	if validityDur, err = cert.ParseDuration(validity); err != nil || validityDur <= 0 {
+		return fmt.Errorf("invalid --validity %q", validity)
+	}
+	return nil
+}
+
+// serveRun runs the OCSP responder until it fails
+func serveRun(cmd *cobra.Command, args []string) {
+	authority, err := ca.Open(caDir)
+	if err != nil {
+		log.Printf("%v", err.Error())
+		os.Exit(-1)
+	}
+
+	var (
+		c      *x509.Certificate
+		signer crypto.Signer
+	)
+	if responderCert != "" {
+		c = readCert(responderCert)
+		signer, err = key.ReadPEMFile(responderKey, &responderPass)
+		if err != nil {
+			log.Printf("error reading responder key %q: %v", responderKey, err.Error())
+			os.Exit(-1)
+		}
+	} else {
+		signer, err = authority.Signer(&caPass)
+		if err != nil {
+			log.Printf("%v", err.Error())
+			os.Exit(-1)
+		}
+	}
+
+	r, err := ocsp.NewResponder(authority, c, signer, validityDur)
+	if err != nil {
+		log.Printf("%v", err.Error())
+		os.Exit(-1)
+	}
+
+	fmt.Printf("OCSP responder for %q at %s\n", authority.Certificate.Subject.String(), listen)
+	srv := &http.Server{
+		Addr:              listen,
+		Handler:           r,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	err = srv.ListenAndServe()
+	log.Printf("%v", err.Error())
+	os.Exit(-1)
+}
+
+// queryVal validates parameters for the query command
+func queryVal(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("unexpected arguments: %v", args)
+	}
+	if certIn == "" || issuerIn == "" {
+		return fmt.Errorf("--cert and --issuer must be informed")
+	}
+	if method != "get" && method != "post" {
+		return fmt.Errorf("unknown method: %s", method)
+	}
+	if _, ok := ocsp.HashChoices[hashName]; !ok {
+		return fmt.Errorf("unknown hash: %s", hashName)
+	}
+	if timeoutSecs <= 0 {
+		return fmt.Errorf("--timeout must be positive")
+	}
+
+	switch output {
+	case "text", "json", "yaml":
+	default:
+		return fmt.Errorf("unknown output format: %s", output)
+	}
+
+	return nil
+}
+
+// queryRun runs the query command
+func queryRun(cmd *cobra.Command, args []string) {
+	c := readCert(certIn)
+	issuer := readCert(issuerIn)
+
+	u := responder
+	if u == "" {
+		if len(c.OCSPServer) == 0 {
+			log.Printf("certificate %q has no OCSP server, use --url", certIn)
+			os.Exit(-1)
+		}
+		u = c.OCSPServer[0]
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeoutSecs)*time.Second)
+	defer cancel()
+	r, err := ocsp.Query(ctx, u, c, issuer, &ocsp.QueryOptions{
+		Get:  method == "get",
+		Hash: ocsp.HashChoices[hashName],
+	})
+	if err != nil {
+		log.Printf("%v", err.Error())
+		os.Exit(-1)
+	}
+
+	info := ocsp.NewResponseInfo(r)
+
+	var out []byte
+	switch output {
+	case "json":
+		out, err = json.MarshalIndent(info, "", "  ")
+		out = append(out, '\n')
+	case "yaml":
+		out, err = yaml.Marshal(info)
+	default:
+		out = []byte(formatInfo(info))
+	}
+	if err != nil {
+		log.Printf("error serializing OCSP response: %v", err.Error())
+		os.Exit(-1)
+	}
+
+	os.Stdout.Write(out)
+}
+
+// formatInfo renders an OCSP response for humans
+func formatInfo(i *ocsp.ResponseInfo) string {
+	var b strings.Builder
+	line := func(name, value string) {
+		fmt.Fprintf(&b, "%-22s%s\n", name+":", value)
+	}
+
+	line("Status", i.Status)
+	line("Serial", i.Serial)
+	line("This Update", i.ThisUpdate.Format(time.RFC3339))
+	line("Next Update", i.NextUpdate.Format(time.RFC3339))
+	if i.RevokedAt != nil {
+		line("Revoked At", i.RevokedAt.Format(time.RFC3339))
+		line("Reason", i.Reason)
+	}
+	if i.Responder != "" {
+		line("Responder", i.Responder)
+	}
+
+	return b.String()
+}
+
+// readCert reads a PEM or DER certificate or exits
+func readCert(path string) *x509.Certificate {
+	b, err := filesystem.ReadContentsFromFile(path)
+	if err != nil {
+		log.Printf("error reading certificate %q: %v", path, err.Error())
+		os.Exit(-1)
+	}
+	c, err := cert.ReadCertificate(b)
+	if err != nil {
+		log.Printf("no cert found at %q: %v", path, err.Error())
+		os.Exit(-1)
+	}
+	return c
+}
@@ -0,0 +1,217 @@
+package pkcs12
+
+import (
+	"crypto/x509"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/odacremolbap/xfon/pkg/cert"
+	"github.com/odacremolbap/xfon/pkg/filesystem"
+	"github.com/odacremolbap/xfon/pkg/key"
+	"github.com/odacremolbap/xfon/pkg/passphrase"
+	"github.com/odacremolbap/xfon/pkg/pkcs12"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// export
+	certIn     string
+	keyIn      string
+	keyPass    passphrase.Source
+	chainIn    string
+	bundleOut  string
+	encryption string
+
+	// import
+	bundleIn string
+	certOut  string
+	keyOut   string
+	chainOut string
+
+	password passphrase.Source
+
+	// RootCmd contains PKCS#12 commands
+	RootCmd = &cobra.Command{
+		Use:   "pkcs12",
+		Short: "pkcs12 manages PKCS#12 / PFX bundles",
+		Run:   runHelp,
+	}
+
+	// ExportCmd creates a PKCS#12 bundle
+	ExportCmd = &cobra.Command{
+		Use:   "export",
+		Short: "bundles a certificate, its key and CA chain into a PKCS#12 file",
+		Run:   exportRun,
+		Args:  exportVal,
+	}
+
+	// ImportCmd splits a PKCS#12 bundle into PEM files
+	ImportCmd = &cobra.Command{
+		Use:   "import",
+		Short: "splits a PKCS#12 file into PEM certificate, key and CA chain",
+		Run:   importRun,
+	}
+)
+
+func runHelp(cmd *cobra.Command, args []string) {
+	cmd.Help()
+}
+
+func init() {
+	ExportCmd.Flags().StringVar(&certIn, "cert", "", "path to certificate")
+	ExportCmd.MarkFlagRequired("cert")
+	ExportCmd.Flags().StringVar(&keyIn, "key", "", "path to the certificate key")
+	ExportCmd.MarkFlagRequired("key")
+	ExportCmd.Flags().StringVar(&keyPass.Env, "key-passphrase-env", "", "environment variable containing the passphrase for an encrypted key")
+	ExportCmd.Flags().StringVar(&keyPass.File, "key-passphrase-file", "", "file containing the passphrase for an encrypted key")
+	ExportCmd.Flags().StringVar(&chainIn, "chain", "", "comma separated list of CA certificate files, PEM bundles add every certificate")
+	ExportCmd.Flags().StringVar(&bundleOut, "out", "", "generated PKCS#12 file path")
+	ExportCmd.MarkFlagRequired("out")
+	ExportCmd.Flags().StringVar(&encryption, "encryption", string(pkcs12.Modern), "[modern|legacy|legacy-des] modern is AES-256 with PBKDF2, legacy RC2 and 3DES for older Java and Windows")
+	ExportCmd.Flags().StringVar(&password.Env, "password-env", "", "environment variable containing the bundle password, prompted if no source is informed")
+	ExportCmd.Flags().StringVar(&password.File, "password-file", "", "file containing the bundle password, prompted if no source is informed")
+	RootCmd.AddCommand(ExportCmd)
+
+	ImportCmd.Flags().StringVar(&bundleIn, "in", "", "path to PKCS#12 file")
+	ImportCmd.MarkFlagRequired("in")
+	ImportCmd.Flags().StringVar(&certOut, "cert-out", "", "certificate file path")
+	ImportCmd.MarkFlagRequired("cert-out")
+	ImportCmd.Flags().StringVar(&keyOut, "key-out", "", "unencrypted key file path")
+	ImportCmd.MarkFlagRequired("key-out")
+	ImportCmd.Flags().StringVar(&chainOut, "chain-out", "", "CA chain file path, chain is discarded if not informed")
+	ImportCmd.Flags().StringVar(&password.Env, "password-env", "", "environment variable containing the bundle password, prompted if no source is informed")
+	ImportCmd.Flags().StringVar(&password.File, "password-file", "", "file containing the bundle password, prompted if no source is informed")
+	RootCmd.AddCommand(ImportCmd)
+}
+
+// exportVal validates parameters for the export command
+func exportVal(cmd *cobra.Command, args []string) error {
+	if _, ok := pkcs12.EncryptionChoices[encryption]; !ok {
+		return fmt.Errorf("unknown PKCS#12 encryption: %s", encryption)
+	}
+	return nil
+}
+
+// exportRun runs the export command
+func exportRun(cmd *cobra.Command, args []string) {
+	c, err := readCertificate(certIn)
+	if err != nil {
+		log.Printf("%v", err.Error())
+		os.Exit(-1)
+	}
+
+	k, err := key.ReadPEMFile(keyIn, &keyPass)
+	if err != nil {
+		log.Printf("no key found at %q: %v", keyIn, err.Error())
+		os.Exit(-1)
+	}
+
+	var chain []*x509.Certificate
+	for _, p := range strings.Split(chainIn, ",") {
+		if p == "" {
+			continue
+		}
+		cas, err := readCertificates(p)
+		if err != nil {
+			log.Printf("%v", err.Error())
+			os.Exit(-1)
+		}
+		chain = append(chain, cas...)
+	}
+
+	pw, err := password.Read("password for PKCS#12 bundle: ", true)
+	if err != nil {
+		log.Printf("error reading password: %v", err.Error())
+		os.Exit(-1)
+	}
+
+	b, err := pkcs12.Encode(k, c, chain, string(pw), pkcs12.EncryptionChoices[encryption])
+	if err != nil {
+		log.Printf("error generating PKCS#12 bundle: %v", err.Error())
+		os.Exit(-1)
+	}
+
+	err = filesystem.WriteContentsToFile(bundleOut, string(b))
+	if err != nil {
+		log.Printf("error writing PKCS#12 bundle to file: %v", err.Error())
+		os.Exit(-1)
+	}
+}
+
+// importRun runs the import command
+func importRun(cmd *cobra.Command, args []string) {
+	b, err := filesystem.ReadContentsFromFile(bundleIn)
+	if err != nil {
+		log.Printf("error reading PKCS#12 bundle %q: %v", bundleIn, err.Error())
+		os.Exit(-1)
+	}
+
+	pw, err := password.Read("password for PKCS#12 bundle: ", false)
+	if err != nil {
+		log.Printf("error reading password: %v", err.Error())
+		os.Exit(-1)
+	}
+
+	k, c, chain, err := pkcs12.Decode(b, string(pw))
+	if err != nil {
+		log.Printf("%v", err.Error())
+		os.Exit(-1)
+	}
+
+	kp, err := key.WritePEM(k)
+	if err != nil {
+		log.Printf("error serializing key into PEM: %v", err.Error())
+		os.Exit(-1)
+	}
+	if err = filesystem.WriteContentsToFile(keyOut, kp); err != nil {
+		log.Printf("error writing key to file: %v", err.Error())
+		os.Exit(-1)
+	}
+
+	cp, err := cert.WritePEM(c.Raw)
+	if err != nil {
+		log.Printf("error encoding certificate: %v", err.Error())
+		os.Exit(-1)
+	}
+	if err = filesystem.WriteContentsToFile(certOut, cp); err != nil {
+		log.Printf("error writing certificate to file: %v", err.Error())
+		os.Exit(-1)
+	}
+
+	if chainOut == "" {
+		return
+	}
+	chainPEM, err := cert.WritePEMBundle(chain)
+	if err != nil {
+		log.Printf("error encoding CA certificate: %v", err.Error())
+		os.Exit(-1)
+	}
+	if err = filesystem.WriteContentsToFile(chainOut, chainPEM); err != nil {
+		log.Printf("error writing CA chain to file: %v", err.Error())
+		os.Exit(-1)
+	}
+}
+
+// readCertificate reads the first PEM or DER certificate from a file
+func readCertificate(path string) (*x509.Certificate, error) {
+	certs, err := readCertificates(path)
+	if err != nil {
+		return nil, err
+	}
+	return certs[0], nil
+}
+
+// readCertificates reads every PEM or DER certificate from a file
+func readCertificates(path string) ([]*x509.Certificate, error) {
+	b, err := filesystem.ReadContentsFromFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading certificate %q: %s", path, err.Error())
+	}
+	certs, err := cert.ReadCertificates(b)
+	if err != nil {
+		return nil, fmt.Errorf("no cert found at %q: %s", path, err.Error())
+	}
+	return certs, nil
+}
@@ -0,0 +1,150 @@
+package pki
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/odacremolbap/xfon/pkg/filesystem"
+	"github.com/odacremolbap/xfon/pkg/pki"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	dir    string
+	output string
+
+	spec *pki.Spec
+
+	// RootCmd contains PKI spec commands
+	RootCmd = &cobra.Command{
+		Use:   "pki",
+		Short: "pki manages keys and certificate hierarchies described at spec files",
+		Run:   runHelp,
+	}
+
+	// ApplyCmd creates the keys and certificates of a spec
+	ApplyCmd = &cobra.Command{
+		Use:   "apply <spec>",
+		Short: "creates the keys and certificates described at a spec file",
+		Long: `Creates the keys and certificates described at a YAML or JSON spec file,
+issuing every certificate after its issuer. Keys are written unencrypted
+as <name>.key and certificates as <name>.crt at the spec dir, which is
+relative to the spec file and defaults to its directory.
+
+Applying a spec is idempotent. Existing keys are kept unless their type
+or size changed. Existing certificates are kept unless their subject,
+subject alternative names, usages, CA constraints, validity days, public
+key or issuer changed, or they expire within renewBefore, 30d by default.
+
+Certificates use the built-in profiles or the ones at the spec profiles
+section, and any field informed at the certificate replaces the profile
+one. Keys that are not declared are generated as 4096 bits RSA keys.
+
+  renewBefore: 15d
+  keys:
+  - name: root
+    type: ecdsa
+    curve: P-384
+  certificates:
+  - name: root
+    profile: root-ca
+    subject: CN=Test Root,O=Acme
+  - name: intermediate
+    issuer: root
+    profile: intermediate-ca
+    subject: CN=Test Intermediate,O=Acme
+  - name: www
+    issuer: intermediate
+    profile: server
+    days: 30
+    dnsNames: [www.example.com]`,
+		Run:  applyRun,
+		Args: applyVal,
+	}
+)
+
+func runHelp(cmd *cobra.Command, args []string) {
+	cmd.Help()
+}
+
+func init() {
+	ApplyCmd.Flags().StringVar(&dir, "dir", "", "output directory, replaces the spec dir")
+	ApplyCmd.Flags().StringVarP(&output, "output", "o", "table", "[table|json|yaml] output format")
+	RootCmd.AddCommand(ApplyCmd)
+}
+
+// applyVal validates parameters for the apply command
+func applyVal(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("a single spec file must be informed")
+	}
+	switch output {
+	case "table", "json", "yaml":
+	default:
+		return fmt.Errorf("unknown output format: %s", output)
+	}
+
+	b, err := filesystem.ReadContentsFromFile(args[0])
+	if err != nil {
+		return fmt.Errorf("error reading spec file %q: %s", args[0], err.Error())
+	}
+	if spec, err = pki.ReadSpec(b); err != nil {
+		return err
+	}
+
+	if dir == "" {
+		dir = spec.Dir
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(filepath.Dir(args[0]), dir)
+		}
+	}
+	return nil
+}
+
+// applyRun runs the apply command
+func applyRun(cmd *cobra.Command, args []string) {
+	results, applyErr := pki.Apply(spec, dir, time.Now())
+
+	var err error
+	switch output {
+	case "json":
+		var out []byte
+		out, err = json.MarshalIndent(results, "", "  ")
+		if err == nil {
+			_, err = os.Stdout.Write(append(out, '\n'))
+		}
+	case "yaml":
+		var out []byte
+		out, err = yaml.Marshal(results)
+		if err == nil {
+			_, err = os.Stdout.Write(out)
+		}
+	default:
+		err = writeTable(results)
+	}
+	if err != nil {
+		log.Printf("error writing results: %v", err.Error())
+		os.Exit(-1)
+	}
+
+	if applyErr != nil {
+		log.Printf("%v", applyErr.Error())
+		os.Exit(-1)
+	}
+}
+
+// writeTable renders the apply results for humans
+func writeTable(results []*pki.Result) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KIND\tNAME\tACTION\tREASON\tPATH")
+	for _, r := range results {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.Kind, r.Name, r.Action, r.Reason, r.Path)
+	}
+	return w.Flush()
+}
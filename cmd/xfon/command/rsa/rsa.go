@@ -1,18 +1,32 @@
 package rsa
 
 import (
+	"fmt"
 	"log"
 	"os"
 
+	"github.com/odacremolbap/xfon/cmd/xfon/command/flags"
 	"github.com/odacremolbap/xfon/pkg/filesystem"
+	"github.com/odacremolbap/xfon/pkg/key"
+	"github.com/odacremolbap/xfon/pkg/kubernetes"
+	"github.com/odacremolbap/xfon/pkg/passphrase"
 
 	"github.com/odacremolbap/xfon/pkg/rsa"
 	"github.com/spf13/cobra"
 )
 
 var (
-	bits int
-	out  string
+	bits   int
+	out    string
+	format string
+
+	// encryption
+	encrypt bool
+	kdf     string
+	pass    passphrase.Source
+
+	// kubernetes secret output
+	secretFlags flags.Secret
 
 	// RootCmd manages private keys
 	RootCmd = &cobra.Command{
@@ -26,6 +40,7 @@ var (
 		Use:   "new",
 		Short: "creates new RSA key",
 		Run:   newFunc,
+		Args:  newVal,
 	}
 )
 
@@ -35,11 +50,45 @@ func runHelp(cmd *cobra.Command, args []string) {
 
 func init() {
 	NewCmd.Flags().IntVar(&bits, "bits", 4096, "key size")
-	NewCmd.Flags().StringVar(&out, "out", "", "RSA key output file")
-	NewCmd.MarkFlagRequired("out")
+	NewCmd.Flags().StringVar(&out, "out", "", "RSA key output file, required unless --secret-name is informed")
+	NewCmd.Flags().StringVar(&format, "format", string(key.PKCS1), "[pkcs1|pkcs8] key encoding")
+
+	// encryption
+	NewCmd.Flags().BoolVar(&encrypt, "encrypt", false, "protect the key with a passphrase, implies PKCS#8 format")
+	NewCmd.Flags().StringVar(&kdf, "kdf", string(key.PBKDF2), "[pbkdf2|scrypt] key derivation function for encrypted keys")
+	NewCmd.Flags().StringVar(&pass.Env, "passphrase-env", "", "environment variable containing the passphrase, prompted if no source is informed")
+	NewCmd.Flags().StringVar(&pass.File, "passphrase-file", "", "file containing the passphrase, prompted if no source is informed")
+
+	// kubernetes secret output
+	flags.AddSecretFlags(NewCmd, &secretFlags, "name of an Opaque secret manifest written with the unencrypted key at tls.key")
 	RootCmd.AddCommand(NewCmd)
 }
 
+// newVal validates parameters for the new RSA key command
+func newVal(cmd *cobra.Command, args []string) error {
+	f, ok := key.FormatChoices[format]
+	if !ok || f == key.SEC1 {
+		return fmt.Errorf("unknown RSA key format: %s", format)
+	}
+	if _, ok := key.KDFChoices[kdf]; !ok {
+		return fmt.Errorf("unknown key derivation function: %s", kdf)
+	}
+	if encrypt && f != key.PKCS8 && cmd.Flags().Changed("format") {
+		return fmt.Errorf("encrypted keys can only be written as %s", key.PKCS8)
+	}
+
+	if err := secretFlags.Validate(); err != nil {
+		return err
+	}
+	if secretFlags.Name == "" && out == "" {
+		return fmt.Errorf("either --out or --secret-name must be informed")
+	}
+	if secretFlags.Name != "" && encrypt {
+		return fmt.Errorf("secret manifests cannot contain encrypted keys")
+	}
+	return nil
+}
+
 // newFunc runs the new RSA command
 func newFunc(cmd *cobra.Command, args []string) {
 	k, err := rsa.GenerateKey(bits)
@@ -48,15 +97,43 @@ func newFunc(cmd *cobra.Command, args []string) {
 		os.Exit(-1)
 	}
 
-	p, err := rsa.WritePEM(k)
+	var p string
+	if encrypt {
+		pp, perr := pass.Read("passphrase for new key: ", true)
+		if perr != nil {
+			log.Printf("error reading passphrase: %v", perr.Error())
+			os.Exit(-1)
+		}
+		p, err = key.WriteEncryptedPEM(k, pp, key.KDFChoices[kdf])
+	} else {
+		p, err = key.WritePEMFormat(k, key.FormatChoices[format])
+	}
 	if err != nil {
 		log.Printf("error serializing RSA key into PEM: %v", err.Error())
 		os.Exit(-1)
 	}
 
-	err = filesystem.WriteContentsToFile(out, p)
+	if out != "" {
+		err = filesystem.WriteContentsToFile(out, p)
+		if err != nil {
+			log.Printf("error writing RSA key to file: %v", err.Error())
+			os.Exit(-1)
+		}
+	}
+	if secretFlags.Name != "" {
+		writeSecret(p)
+	}
+}
+
+// writeSecret writes the secret manifest for the PEM key
+func writeSecret(p string) {
+	s, err := kubernetes.NewOpaqueSecret(secretFlags.Meta(), map[string][]byte{kubernetes.TLSPrivateKeyKey: []byte(p)})
 	if err != nil {
-		log.Printf("error writing RSA key to file: %v", err.Error())
+		log.Printf("%v", err.Error())
+		os.Exit(-1)
+	}
+	if err = secretFlags.Write(s); err != nil {
+		log.Printf("%v", err.Error())
 		os.Exit(-1)
 	}
 }
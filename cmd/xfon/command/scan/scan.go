@@ -0,0 +1,131 @@
+package scan
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/odacremolbap/xfon/pkg/cert"
+	"github.com/odacremolbap/xfon/pkg/scan"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	warn    string
+	crit    string
+	output  string
+	warnDur time.Duration
+	critDur time.Duration
+
+	// exit codes for the most severe status found
+	exitCodes = map[scan.Status]int{
+		scan.StatusOK:       0,
+		scan.StatusWarning:  1,
+		scan.StatusCritical: 2,
+		scan.StatusExpired:  2,
+	}
+
+	// RootCmd scans paths for certificates about to expire
+	RootCmd = &cobra.Command{
+		Use:   "scan <paths...>",
+		Short: "scan reports the expiry of certificates found at files and directories",
+		Long: `Walks the informed files and directories reporting the expiry status of
+every PEM or DER certificate found, including every certificate at PEM
+bundles. Files that do not contain certificates are skipped, while files
+that cannot be read, or hold PEM certificates or have a .crt, .cer or
+.der extension but cannot be parsed, are reported without stopping the
+scan. Informed directories that are symbolic links are followed, but
+symbolic links to directories found while walking are not.
+
+The prometheus output is meant for the node exporter textfile collector.
+
+Exit codes:
+  0   every certificate expires after the warning threshold
+  1   a certificate expires within the warning threshold
+  2   a certificate expires within the critical threshold or is expired
+  255 wrong parameters`,
+		Run:  scanRun,
+		Args: scanVal,
+	}
+)
+
+func init() {
+	RootCmd.Flags().StringVar(&warn, "warn", "30d", "time before expiry for the warning status, as in 30d or 12h")
+	RootCmd.Flags().StringVar(&crit, "crit", "7d", "time before expiry for the critical status, as in 7d or 12h")
+	RootCmd.Flags().StringVarP(&output, "output", "o", "table", "[table|json|yaml|prometheus] output format")
+}
+
+// scanVal validates parameters for the scan command
+func scanVal(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("at least one path must be informed")
+	}
+
+	var err error
+	if warnDur, err = cert.ParseDuration(warn); err != nil || warnDur < 0 {
+		return fmt.Errorf("invalid --warn %q", warn)
+	}
+	if critDur, err = cert.ParseDuration(crit); err != nil || critDur < 0 {
+		return fmt.Errorf("invalid --crit %q", crit)
+	}
+	if critDur > warnDur {
+		return fmt.Errorf("--crit must not be longer than --warn")
+	}
+
+	switch output {
+	case "table", "json", "yaml", "prometheus":
+	default:
+		return fmt.Errorf("unknown output format: %s", output)
+	}
+
+	return nil
+}
+
+// scanRun runs the scan command
+func scanRun(cmd *cobra.Command, args []string) {
+	r := scan.Scan(args, &scan.Options{Warn: warnDur, Crit: critDur})
+
+	var err error
+	switch output {
+	case "json":
+		var out []byte
+		out, err = json.MarshalIndent(r, "", "  ")
+		if err == nil {
+			_, err = os.Stdout.Write(append(out, '\n'))
+		}
+	case "yaml":
+		var out []byte
+		out, err = yaml.Marshal(r)
+		if err == nil {
+			_, err = os.Stdout.Write(out)
+		}
+	case "prometheus":
+		err = r.WritePrometheus(os.Stdout)
+	default:
+		for _, e := range r.Errors {
+			log.Printf("%v", e)
+		}
+		err = writeTable(r)
+	}
+	if err != nil {
+		log.Printf("error writing scan report: %v", err.Error())
+		os.Exit(-1)
+	}
+
+	os.Exit(exitCodes[r.Status()])
+}
+
+// writeTable renders the scan report for humans
+func writeTable(r *scan.Report) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STATUS\tDAYS\tNOT AFTER\tSUBJECT\tPATH\t#")
+	for _, c := range r.Certificates {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%d\n",
+			c.Status, c.DaysLeft, c.NotAfter.Format(time.RFC3339), c.Subject, c.Path, c.Position)
+	}
+	return w.Flush()
+}
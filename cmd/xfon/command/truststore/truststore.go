@@ -0,0 +1,201 @@
+package truststore
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/odacremolbap/xfon/pkg/cert"
+	"github.com/odacremolbap/xfon/pkg/filesystem"
+	"github.com/odacremolbap/xfon/pkg/passphrase"
+	"github.com/odacremolbap/xfon/pkg/pkcs12"
+	"github.com/odacremolbap/xfon/pkg/truststore"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// build
+	certsIn    string
+	aliases    string
+	storeOut   string
+	encryption string
+
+	// list
+	storeIn string
+
+	format   string
+	password passphrase.Source
+
+	// RootCmd contains truststore commands
+	RootCmd = &cobra.Command{
+		Use:   "truststore",
+		Short: "truststore manages CA truststores for Java and other runtimes",
+		Run:   runHelp,
+	}
+
+	// BuildCmd creates a truststore
+	BuildCmd = &cobra.Command{
+		Use:   "build",
+		Short: "creates a JKS, PKCS#12 or PEM bundle truststore from CA certificates",
+		Long: `Creates a truststore from PEM CA certificates.
+
+Aliases are assigned in the same order as certificates. Certificates
+without an explicit alias get one derived from their common name, with
+a numeric suffix when repeated. Aliases are case insensitive.
+
+JKS truststores need a password of at least 6 characters. PEM bundles
+are not protected, each certificate is preceded by a comment line
+containing its alias.`,
+		Run:  buildRun,
+		Args: buildVal,
+	}
+
+	// ListCmd prints truststore entries
+	ListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "prints the aliases and certificates at a truststore",
+		Long: `Prints the aliases and certificates at a truststore.
+
+PKCS#12 truststores do not report aliases, the ones listed are derived
+from the certificates common name.`,
+		Run:  listRun,
+		Args: listVal,
+	}
+)
+
+func runHelp(cmd *cobra.Command, args []string) {
+	cmd.Help()
+}
+
+func init() {
+	BuildCmd.Flags().StringVar(&certsIn, "certs", "", "comma separated list of CA certificate files, PEM bundles add every certificate")
+	BuildCmd.MarkFlagRequired("certs")
+	BuildCmd.Flags().StringVar(&aliases, "aliases", "", "comma separated list of aliases for the certificates, derived from the subject if not informed")
+	BuildCmd.Flags().StringVar(&format, "format", string(truststore.JKS), "[jks|pkcs12|pem-bundle] truststore format")
+	BuildCmd.Flags().StringVar(&storeOut, "out", "", "generated truststore file path")
+	BuildCmd.MarkFlagRequired("out")
+	BuildCmd.Flags().StringVar(&encryption, "encryption", string(pkcs12.Modern), "[modern|legacy|legacy-des] PKCS#12 encryption, modern is AES-256 with PBKDF2, legacy RC2 and 3DES for older Java")
+	BuildCmd.Flags().StringVar(&password.Env, "password-env", "", "environment variable containing the truststore password, prompted if no source is informed")
+	BuildCmd.Flags().StringVar(&password.File, "password-file", "", "file containing the truststore password, prompted if no source is informed")
+	RootCmd.AddCommand(BuildCmd)
+
+	ListCmd.Flags().StringVar(&storeIn, "in", "", "path to truststore")
+	ListCmd.MarkFlagRequired("in")
+	ListCmd.Flags().StringVar(&format, "format", string(truststore.JKS), "[jks|pkcs12|pem-bundle] truststore format")
+	ListCmd.Flags().StringVar(&password.Env, "password-env", "", "environment variable containing the truststore password, prompted if no source is informed")
+	ListCmd.Flags().StringVar(&password.File, "password-file", "", "file containing the truststore password, prompted if no source is informed")
+	RootCmd.AddCommand(ListCmd)
+}
+
+// buildVal validates parameters for the build command
+func buildVal(cmd *cobra.Command, args []string) error {
+	if _, ok := truststore.FormatChoices[format]; !ok {
+		return fmt.Errorf("unknown truststore format: %s", format)
+	}
+	if _, ok := pkcs12.EncryptionChoices[encryption]; !ok {
+		return fmt.Errorf("unknown PKCS#12 encryption: %s", encryption)
+	}
+	return nil
+}
+
+// buildRun runs the build command
+func buildRun(cmd *cobra.Command, args []string) {
+	var certs []*x509.Certificate
+	for _, p := range strings.Split(certsIn, ",") {
+		if p == "" {
+			continue
+		}
+		b, err := filesystem.ReadContentsFromFile(p)
+		if err != nil {
+			log.Printf("error reading certificate %q: %v", p, err.Error())
+			os.Exit(-1)
+		}
+		found, err := cert.ReadCertificates(b)
+		if err != nil {
+			log.Printf("no cert found at %q: %v", p, err.Error())
+			os.Exit(-1)
+		}
+		certs = append(certs, found...)
+	}
+
+	var names []string
+	if aliases != "" {
+		names = strings.Split(aliases, ",")
+	}
+	entries, err := truststore.NewEntries(certs, names)
+	if err != nil {
+		log.Printf("%v", err.Error())
+		os.Exit(-1)
+	}
+
+	f := truststore.FormatChoices[format]
+	var pw []byte
+	if f != truststore.PEMBundle {
+		pw, err = password.Read("password for truststore: ", true)
+		if err != nil {
+			log.Printf("error reading password: %v", err.Error())
+			os.Exit(-1)
+		}
+	}
+
+	b, err := truststore.Encode(entries, f, string(pw), pkcs12.EncryptionChoices[encryption])
+	if err != nil {
+		log.Printf("error generating truststore: %v", err.Error())
+		os.Exit(-1)
+	}
+
+	err = filesystem.WriteContentsToFile(storeOut, string(b))
+	if err != nil {
+		log.Printf("error writing truststore to file: %v", err.Error())
+		os.Exit(-1)
+	}
+}
+
+// listVal validates parameters for the list command
+func listVal(cmd *cobra.Command, args []string) error {
+	if _, ok := truststore.FormatChoices[format]; !ok {
+		return fmt.Errorf("unknown truststore format: %s", format)
+	}
+	return nil
+}
+
+// listRun runs the list command
+func listRun(cmd *cobra.Command, args []string) {
+	b, err := filesystem.ReadContentsFromFile(storeIn)
+	if err != nil {
+		log.Printf("error reading truststore %q: %v", storeIn, err.Error())
+		os.Exit(-1)
+	}
+
+	f := truststore.FormatChoices[format]
+	var pw []byte
+	if f != truststore.PEMBundle {
+		pw, err = password.Read("password for truststore: ", false)
+		if err != nil {
+			log.Printf("error reading password: %v", err.Error())
+			os.Exit(-1)
+		}
+	}
+
+	entries, err := truststore.Decode(b, f, string(pw))
+	if err != nil {
+		log.Printf("%v", err.Error())
+		os.Exit(-1)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ALIAS\tSUBJECT\tNOT AFTER\tSHA-256 FINGERPRINT")
+	for _, e := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%X\n",
+			e.Alias,
+			e.Certificate.Subject.String(),
+			e.Certificate.NotAfter.Format(time.RFC3339),
+			sha256.Sum256(e.Certificate.Raw))
+	}
+	w.Flush()
+}
@@ -0,0 +1,48 @@
+package testutil
+
+import (
+	"crypto"
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/odacremolbap/xfon/pkg/cert"
+	"github.com/odacremolbap/xfon/pkg/key"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// NewCA creates a self signed ECDSA CA certificate and its key,
+// valid from an hour ago for 100 days
+func NewCA(t *testing.T, subject *cert.Subject) (*x509.Certificate, crypto.Signer) {
+	k, err := key.GenerateKey(&key.Options{Type: key.ECDSA, Curve: "P-256"})
+	assert.Nil(t, err)
+	b, err := cert.GenerateX509SelfSignedCertificate(&cert.X509Simplified{
+		Subject:   subject,
+		NotBefore: time.Now().Add(-time.Hour).UTC(),
+		NotAfter:  time.Now().AddDate(0, 0, 100).UTC(),
+		IsCA:      true,
+		KeyUsage:  x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}, k)
+	assert.Nil(t, err)
+	c, err := x509.ParseCertificate(b)
+	assert.Nil(t, err)
+	return c, k
+}
+
+// NewCertificate issues a leaf certificate from the parent
+// for a new key of the informed type
+func NewCertificate(t *testing.T, o *key.Options, cn string, parent *x509.Certificate, parentKey crypto.Signer) (*x509.Certificate, crypto.Signer) {
+	k, err := key.GenerateKey(o)
+	assert.Nil(t, err)
+	b, err := cert.GenerateX509Certificate(&cert.X509Simplified{
+		Subject:   &cert.Subject{CommonName: cn},
+		NotBefore: time.Now().Add(-time.Hour).UTC(),
+		NotAfter:  time.Now().AddDate(0, 0, 10).UTC(),
+		KeyUsage:  x509.KeyUsageDigitalSignature,
+	}, parent, k.Public(), parentKey)
+	assert.Nil(t, err)
+	c, err := x509.ParseCertificate(b)
+	assert.Nil(t, err)
+	return c, k
+}
@@ -0,0 +1,1044 @@
+package acme
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/odacremolbap/xfon/pkg/ca"
+	"github.com/odacremolbap/xfon/pkg/cert"
+	"github.com/odacremolbap/xfon/pkg/filesystem"
+)
+
+// resource paths, relative to the server base URL
+const (
+	pathDirectory     = "/directory"
+	pathNewNonce      = "/new-nonce"
+	pathNewAccount    = "/new-account"
+	pathNewOrder      = "/new-order"
+	pathRevokeCert    = "/revoke-cert"
+	pathAccount       = "/account/"
+	pathOrder         = "/order/"
+	pathAuthorization = "/authz/"
+	pathChallenge     = "/challenge/"
+	pathCertificate   = "/cert/"
+)
+
+// object statuses as defined at RFC 8555 section 7.1.6
+const (
+	statusPending     = "pending"
+	statusReady       = "ready"
+	statusProcessing  = "processing"
+	statusValid       = "valid"
+	statusInvalid     = "invalid"
+	statusExpired     = "expired"
+	statusDeactivated = "deactivated"
+)
+
+const (
+	// objectLifetime is the time orders and authorizations
+	// remain usable after being created
+	objectLifetime = 7 * 24 * time.Hour
+	// validationTimeout limits the time spent validating a challenge
+	validationTimeout = 30 * time.Second
+	// maxRequestSize limits the size of JWS requests
+	maxRequestSize = 1 << 20
+	// maxIdentifiers limits the identifiers at an order
+	maxIdentifiers = 100
+	// maxNonces is the number of outstanding nonces kept, the
+	// oldest ones are discarded when reached and clients retry
+	maxNonces = 10000
+)
+
+// Options configure an ACME server
+type Options struct {
+	// BaseURL is the external URL of the server, as seen by clients,
+	// without trailing slash
+	BaseURL string
+	// CA issuing the certificates, which are recorded at its index
+	CA *ca.CA
+	// Signer is the CA private key
+	Signer crypto.Signer
+	// Profile used for issued certificates, the CA default if empty.
+	// Validity and usages come from the profile, names from the order
+	Profile string
+	// Validator checks challenges
+	Validator Validator
+	// AccountsFile persists accounts across restarts when informed.
+	// Orders, authorizations and certificate URLs only live in memory
+	AccountsFile string
+}
+
+// Server is an RFC 8555 ACME server issuing certificates for DNS
+// identifiers with http-01 and dns-01 challenges. Wildcard
+// identifiers only offer dns-01 challenges
+type Server struct {
+	opts    Options
+	profile *cert.Profile
+	mux     *http.ServeMux
+
+	mu     sync.Mutex
+	nonces map[string]bool
+	// nonceOrder holds the nonces in issuance order, including
+	// consumed ones, for the oldest to be discarded first
+	nonceOrder []string
+	accounts   map[string]*Account
+	orders     map[string]*order
+	authzs     map[string]*authorization
+	challenges map[string]*challenge
+	certs      map[string]*issued
+}
+
+// Account is an ACME account, identified by its public key
+type Account struct {
+	ID        string          `json:"id"`
+	Key       json.RawMessage `json:"key"`
+	Status    string          `json:"status"`
+	Contact   []string        `json:"contact,omitempty"`
+	CreatedAt time.Time       `json:"createdAt"`
+
+	key        crypto.PublicKey
+	thumbprint string
+}
+
+// accountsFile is the contents of the accounts file
+type accountsFile struct {
+	Accounts []*Account `json:"accounts"`
+}
+
+// Identifier of an order or authorization
+type Identifier struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// Problem is an RFC 7807 problem document with an ACME error type
+type Problem struct {
+	Type   string `json:"type"`
+	Detail string `json:"detail"`
+	Status int    `json:"status"`
+}
+
+// Error returns the problem detail
+func (p *Problem) Error() string {
+	return fmt.Sprintf("%s: %s", p.Type, p.Detail)
+}
+
+// newProblem creates a problem for one of the ACME error types
+func newProblem(status int, typ, format string, a ...interface{}) *Problem {
+	return &Problem{
+		Type:   "urn:ietf:params:acme:error:" + typ,
+		Detail: fmt.Sprintf(format, a...),
+		Status: status,
+	}
+}
+
+type order struct {
+	id          string
+	accountID   string
+	status      string
+	expires     time.Time
+	identifiers []Identifier
+	authzIDs    []string
+	certID      string
+	err         *Problem
+}
+
+type authorization struct {
+	id         string
+	accountID  string
+	identifier Identifier
+	wildcard   bool
+	status     string
+	expires    time.Time
+	challenges []*challenge
+}
+
+type challenge struct {
+	id        string
+	authzID   string
+	typ       string
+	token     string
+	status    string
+	validated time.Time
+	err       *Problem
+}
+
+type issued struct {
+	id        string
+	accountID string
+	cert      *x509.Certificate
+}
+
+// request is an authenticated ACME request
+type request struct {
+	payload []byte
+	url     string
+	// account is nil for requests signed with a JWK
+	account *Account
+	key     crypto.PublicKey
+	jwk     json.RawMessage
+}
+
+// NewServer creates an ACME server, loading the accounts file if any
+func NewServer(o *Options) (*Server, error) {
+	if o.CA == nil || o.Signer == nil || o.Validator == nil {
+		return nil, fmt.Errorf("CA, signer and validator must be informed")
+	}
+	if err := cert.ValidateIssuer(o.CA.Certificate, o.Signer); err != nil {
+		return nil, err
+	}
+	p, err := o.CA.Profile(o.Profile)
+	if err != nil {
+		return nil, err
+	}
+	if p.IsCA {
+		return nil, fmt.Errorf("ACME certificates cannot be issued with a CA profile")
+	}
+
+	s := &Server{
+		opts:       *o,
+		profile:    p,
+		mux:        http.NewServeMux(),
+		nonces:     map[string]bool{},
+		accounts:   map[string]*Account{},
+		orders:     map[string]*order{},
+		authzs:     map[string]*authorization{},
+		challenges: map[string]*challenge{},
+		certs:      map[string]*issued{},
+	}
+	s.opts.BaseURL = strings.TrimSuffix(o.BaseURL, "/")
+	if s.opts.Profile == "" {
+		s.opts.Profile = o.CA.Config.Profile
+	}
+	if err := s.loadAccounts(); err != nil {
+		return nil, err
+	}
+
+	s.mux.HandleFunc(pathDirectory, s.handleDirectory)
+	s.mux.HandleFunc(pathNewNonce, s.handleNewNonce)
+	s.mux.HandleFunc(pathNewAccount, s.post(s.handleNewAccount))
+	s.mux.HandleFunc(pathNewOrder, s.post(s.handleNewOrder))
+	s.mux.HandleFunc(pathRevokeCert, s.post(s.handleRevokeCert))
+	s.mux.HandleFunc(pathAccount, s.post(s.handleAccount))
+	s.mux.HandleFunc(pathOrder, s.post(s.handleOrder))
+	s.mux.HandleFunc(pathAuthorization, s.post(s.handleAuthorization))
+	s.mux.HandleFunc(pathChallenge, s.post(s.handleChallenge))
+	s.mux.HandleFunc(pathCertificate, s.post(s.handleCertificate))
+
+	return s, nil
+}
+
+// DirectoryURL returns the URL clients are configured with
+func (s *Server) DirectoryURL() string {
+	return s.url(pathDirectory)
+}
+
+// ServeHTTP adds a fresh nonce and the directory link to every response
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Replay-Nonce", s.newNonce())
+	w.Header().Set("Link", fmt.Sprintf("<%s>;rel=\"index\"", s.DirectoryURL()))
+	w.Header().Set("Cache-Control", "no-store")
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) handleDirectory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeProblem(w, newProblem(http.StatusMethodNotAllowed, "malformed", "method %s not allowed", r.Method))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{
+		"newNonce":   s.url(pathNewNonce),
+		"newAccount": s.url(pathNewAccount),
+		"newOrder":   s.url(pathNewOrder),
+		"revokeCert": s.url(pathRevokeCert),
+	})
+}
+
+func (s *Server) handleNewNonce(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodHead:
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet:
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeProblem(w, newProblem(http.StatusMethodNotAllowed, "malformed", "method %s not allowed", r.Method))
+	}
+}
+
+// post authenticates JWS requests before calling the handler,
+// which runs holding the server lock
+func (s *Server) post(h func(w http.ResponseWriter, req *request) *Problem) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeProblem(w, newProblem(http.StatusMethodNotAllowed, "malformed", "method %s not allowed", r.Method))
+			return
+		}
+		if ct := r.Header.Get("Content-Type"); ct != "application/jose+json" {
+			writeProblem(w, newProblem(http.StatusUnsupportedMediaType, "malformed", "unsupported content type %q", ct))
+			return
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		req, p := s.authenticate(r)
+		if p == nil {
+			p = h(w, req)
+		}
+		if p != nil {
+			writeProblem(w, p)
+		}
+	}
+}
+
+// authenticate checks the JWS signature, nonce and URL of a
+// request, and finds the account for requests signed by one
+func (s *Server) authenticate(r *http.Request) (*request, *Problem) {
+	b, err := io.ReadAll(io.LimitReader(r.Body, maxRequestSize+1))
+	if err != nil || len(b) > maxRequestSize {
+		return nil, newProblem(http.StatusBadRequest, "malformed", "cannot read request body")
+	}
+
+	msg := &jwsMessage{}
+	if err := json.Unmarshal(b, msg); err != nil {
+		return nil, newProblem(http.StatusBadRequest, "malformed", "request is not a flattened JWS")
+	}
+	ph, err := base64.RawURLEncoding.DecodeString(msg.Protected)
+	if err != nil {
+		return nil, newProblem(http.StatusBadRequest, "malformed", "cannot decode protected header")
+	}
+	header := &jwsHeader{}
+	if err := json.Unmarshal(ph, header); err != nil {
+		return nil, newProblem(http.StatusBadRequest, "malformed", "cannot parse protected header")
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(msg.Signature)
+	if err != nil {
+		return nil, newProblem(http.StatusBadRequest, "malformed", "cannot decode signature")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(msg.Payload)
+	if err != nil {
+		return nil, newProblem(http.StatusBadRequest, "malformed", "cannot decode payload")
+	}
+
+	if _, ok := s.nonces[header.Nonce]; !ok {
+		return nil, newProblem(http.StatusBadRequest, "badNonce", "invalid or reused nonce")
+	}
+
+	req := &request{payload: payload, url: s.url(r.URL.Path)}
+	if header.URL != req.url {
+		return nil, newProblem(http.StatusUnauthorized, "unauthorized", "JWS url %q does not match the request URL", header.URL)
+	}
+
+	switch {
+	case header.KID != "" && len(header.JWK) == 0:
+		id := strings.TrimPrefix(header.KID, s.url(pathAccount))
+		req.account = s.accounts[id]
+		if req.account == nil || header.KID != s.url(pathAccount+id) {
+			return nil, newProblem(http.StatusBadRequest, "accountDoesNotExist", "unknown account %q", header.KID)
+		}
+		if req.account.Status != statusValid {
+			return nil, newProblem(http.StatusUnauthorized, "unauthorized", "account is %s", req.account.Status)
+		}
+		req.key = req.account.key
+	case header.KID == "" && len(header.JWK) != 0:
+		req.key, err = parseJWK(header.JWK)
+		if err != nil {
+			return nil, newProblem(http.StatusBadRequest, "badPublicKey", "%s", err.Error())
+		}
+		req.jwk = header.JWK
+	default:
+		return nil, newProblem(http.StatusBadRequest, "malformed", "exactly one of kid and jwk must be informed")
+	}
+
+	if err := verifyJWS(header.Alg, req.key, []byte(msg.Protected+"."+msg.Payload), sig); err != nil {
+		return nil, newProblem(http.StatusBadRequest, "badSignatureAlgorithm", "%s", err.Error())
+	}
+	// nonces are only consumed by signed requests, so that
+	// anybody else cannot invalidate them
+	delete(s.nonces, header.Nonce)
+
+	// only account creation and revocation accept JWK signed requests
+	if req.account == nil && r.URL.Path != pathNewAccount && r.URL.Path != pathRevokeCert {
+		return nil, newProblem(http.StatusBadRequest, "malformed", "requests must be signed with an account kid")
+	}
+	return req, nil
+}
+
+func (s *Server) handleNewAccount(w http.ResponseWriter, req *request) *Problem {
+	in := struct {
+		Contact            []string `json:"contact"`
+		TermsAgreed        bool     `json:"termsOfServiceAgreed"`
+		OnlyReturnExisting bool     `json:"onlyReturnExisting"`
+	}{}
+	if err := json.Unmarshal(req.payload, &in); err != nil {
+		return newProblem(http.StatusBadRequest, "malformed", "cannot parse account: %s", err.Error())
+	}
+
+	thumbprint, err := jwkThumbprint(req.key)
+	if err != nil {
+		return newProblem(http.StatusBadRequest, "badPublicKey", "%s", err.Error())
+	}
+	for _, a := range s.accounts {
+		if a.thumbprint == thumbprint {
+			w.Header().Set("Location", s.url(pathAccount+a.ID))
+			writeJSON(w, http.StatusOK, s.accountResource(a))
+			return nil
+		}
+	}
+	if in.OnlyReturnExisting {
+		return newProblem(http.StatusBadRequest, "accountDoesNotExist", "no account exists for the key")
+	}
+	if p := checkContact(in.Contact); p != nil {
+		return p
+	}
+
+	a := &Account{
+		ID:         newID(),
+		Key:        req.jwk,
+		Status:     statusValid,
+		Contact:    in.Contact,
+		CreatedAt:  time.Now().UTC(),
+		key:        req.key,
+		thumbprint: thumbprint,
+	}
+	s.accounts[a.ID] = a
+	if err := s.saveAccounts(); err != nil {
+		delete(s.accounts, a.ID)
+		return newProblem(http.StatusInternalServerError, "serverInternal", "%s", err.Error())
+	}
+
+	w.Header().Set("Location", s.url(pathAccount+a.ID))
+	writeJSON(w, http.StatusCreated, s.accountResource(a))
+	return nil
+}
+
+// handleAccount serves account updates and the list of account orders
+func (s *Server) handleAccount(w http.ResponseWriter, req *request) *Problem {
+	id := strings.TrimPrefix(req.url, s.url(pathAccount))
+	if strings.HasSuffix(id, "/orders") {
+		if strings.TrimSuffix(id, "/orders") != req.account.ID {
+			return newProblem(http.StatusForbidden, "unauthorized", "account mismatch")
+		}
+		urls := []string{}
+		for _, o := range s.sortedOrders() {
+			if o.accountID == req.account.ID {
+				urls = append(urls, s.url(pathOrder+o.id))
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string][]string{"orders": urls})
+		return nil
+	}
+	if id != req.account.ID {
+		return newProblem(http.StatusForbidden, "unauthorized", "account mismatch")
+	}
+
+	if len(req.payload) != 0 {
+		in := struct {
+			Contact []string `json:"contact"`
+			Status  string   `json:"status"`
+		}{}
+		if err := json.Unmarshal(req.payload, &in); err != nil {
+			return newProblem(http.StatusBadRequest, "malformed", "cannot parse account: %s", err.Error())
+		}
+		a := *req.account
+		switch in.Status {
+		case "":
+		case statusDeactivated:
+			a.Status = statusDeactivated
+		default:
+			return newProblem(http.StatusBadRequest, "malformed", "accounts can only be deactivated")
+		}
+		if in.Contact != nil {
+			if p := checkContact(in.Contact); p != nil {
+				return p
+			}
+			a.Contact = in.Contact
+		}
+		s.accounts[a.ID] = &a
+		if err := s.saveAccounts(); err != nil {
+			s.accounts[a.ID] = req.account
+			return newProblem(http.StatusInternalServerError, "serverInternal", "%s", err.Error())
+		}
+		req.account = &a
+	}
+
+	writeJSON(w, http.StatusOK, s.accountResource(req.account))
+	return nil
+}
+
+func (s *Server) handleNewOrder(w http.ResponseWriter, req *request) *Problem {
+	in := struct {
+		Identifiers []Identifier `json:"identifiers"`
+		NotBefore   string       `json:"notBefore"`
+		NotAfter    string       `json:"notAfter"`
+	}{}
+	if err := json.Unmarshal(req.payload, &in); err != nil {
+		return newProblem(http.StatusBadRequest, "malformed", "cannot parse order: %s", err.Error())
+	}
+	if in.NotBefore != "" || in.NotAfter != "" {
+		return newProblem(http.StatusBadRequest, "malformed", "notBefore and notAfter are set by the issuance profile")
+	}
+	if len(in.Identifiers) == 0 || len(in.Identifiers) > maxIdentifiers {
+		return newProblem(http.StatusBadRequest, "malformed", "orders must have between 1 and %d identifiers", maxIdentifiers)
+	}
+
+	now := time.Now().UTC()
+	o := &order{
+		id:        newID(),
+		accountID: req.account.ID,
+		status:    statusPending,
+		expires:   now.Add(objectLifetime),
+	}
+	seen := map[string]bool{}
+	for _, id := range in.Identifiers {
+		if id.Type != "dns" {
+			return newProblem(http.StatusBadRequest, "unsupportedIdentifier", "identifier type %q is not supported", id.Type)
+		}
+		id.Value = strings.ToLower(id.Value)
+		if err := checkDomain(id.Value); err != nil {
+			return newProblem(http.StatusBadRequest, "rejectedIdentifier", "%s", err.Error())
+		}
+		if seen[id.Value] {
+			continue
+		}
+		seen[id.Value] = true
+		o.identifiers = append(o.identifiers, id)
+	}
+	sort.Slice(o.identifiers, func(i, j int) bool { return o.identifiers[i].Value < o.identifiers[j].Value })
+
+	for _, id := range o.identifiers {
+		o.authzIDs = append(o.authzIDs, s.authorizationFor(req.account.ID, id, now).id)
+	}
+	s.orders[o.id] = o
+	s.refreshOrder(o, now)
+
+	w.Header().Set("Location", s.url(pathOrder+o.id))
+	writeJSON(w, http.StatusCreated, s.orderResource(o))
+	return nil
+}
+
+// authorizationFor reuses a pending or valid authorization of the
+// account for the identifier, or creates a new one
+func (s *Server) authorizationFor(accountID string, id Identifier, now time.Time) *authorization {
+	for _, a := range s.authzs {
+		s.refreshAuthorization(a, now)
+		if a.accountID == accountID && a.identifier.Value == strings.TrimPrefix(id.Value, "*.") &&
+			a.wildcard == strings.HasPrefix(id.Value, "*.") &&
+			(a.status == statusPending || a.status == statusValid) {
+			return a
+		}
+	}
+
+	a := &authorization{
+		id:         newID(),
+		accountID:  accountID,
+		identifier: Identifier{Type: id.Type, Value: strings.TrimPrefix(id.Value, "*.")},
+		wildcard:   strings.HasPrefix(id.Value, "*."),
+		status:     statusPending,
+		expires:    now.Add(objectLifetime),
+	}
+	types := []string{ChallengeHTTP01, ChallengeDNS01}
+	if a.wildcard {
+		types = []string{ChallengeDNS01}
+	}
+	for _, t := range types {
+		c := &challenge{
+			id:      newID(),
+			authzID: a.id,
+			typ:     t,
+			token:   newToken(),
+			status:  statusPending,
+		}
+		a.challenges = append(a.challenges, c)
+		s.challenges[c.id] = c
+	}
+	s.authzs[a.id] = a
+	return a
+}
+
+func (s *Server) handleOrder(w http.ResponseWriter, req *request) *Problem {
+	id := strings.TrimPrefix(req.url, s.url(pathOrder))
+	finalize := strings.HasSuffix(id, "/finalize")
+	o := s.orders[strings.TrimSuffix(id, "/finalize")]
+	if o == nil || o.accountID != req.account.ID {
+		return newProblem(http.StatusNotFound, "malformed", "order not found")
+	}
+
+	now := time.Now().UTC()
+	s.refreshOrder(o, now)
+	if finalize {
+		if p := s.finalize(o, req.payload, now); p != nil {
+			return p
+		}
+	}
+
+	w.Header().Set("Location", s.url(pathOrder+o.id))
+	writeJSON(w, http.StatusOK, s.orderResource(o))
+	return nil
+}
+
+// finalize issues the certificate for a ready order. The CSR
+// must request exactly the order identifiers
+func (s *Server) finalize(o *order, payload []byte, now time.Time) *Problem {
+	if o.status != statusReady {
+		return newProblem(http.StatusForbidden, "orderNotReady", "order is %s", o.status)
+	}
+
+	in := struct {
+		CSR string `json:"csr"`
+	}{}
+	if err := json.Unmarshal(payload, &in); err != nil {
+		return newProblem(http.StatusBadRequest, "malformed", "cannot parse finalize request: %s", err.Error())
+	}
+	der, err := base64.RawURLEncoding.DecodeString(in.CSR)
+	if err != nil {
+		return newProblem(http.StatusBadRequest, "badCSR", "cannot decode CSR")
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return newProblem(http.StatusBadRequest, "badCSR", "cannot parse CSR: %s", err.Error())
+	}
+	if err := cert.VerifyCSR(csr); err != nil {
+		return newProblem(http.StatusBadRequest, "badCSR", "%s", err.Error())
+	}
+	if len(csr.IPAddresses) != 0 || len(csr.URIs) != 0 || len(csr.EmailAddresses) != 0 {
+		return newProblem(http.StatusBadRequest, "badCSR", "only DNS names can be requested")
+	}
+
+	requested := map[string]bool{}
+	for _, n := range csr.DNSNames {
+		requested[strings.ToLower(n)] = true
+	}
+	if cn := csr.Subject.CommonName; cn != "" {
+		requested[strings.ToLower(cn)] = true
+	}
+	names := []string{}
+	for _, id := range o.identifiers {
+		if !requested[id.Value] {
+			return newProblem(http.StatusBadRequest, "badCSR", "CSR does not request %s", id.Value)
+		}
+		names = append(names, id.Value)
+	}
+	if len(requested) != len(names) {
+		return newProblem(http.StatusBadRequest, "badCSR", "CSR requests names not at the order")
+	}
+
+	x := s.profile.Template(now)
+	x.Subject.CommonName = strings.ToLower(csr.Subject.CommonName)
+	x.DNSNames = names
+
+	c, err := s.opts.CA.IssueCSR(x, csr, s.opts.Signer, cert.CopyNone, s.opts.Profile, s.url(pathAccount+o.accountID))
+	if err != nil {
+		o.status = statusInvalid
+		o.err = newProblem(http.StatusInternalServerError, "serverInternal", "error issuing certificate: %s", err.Error())
+		return nil
+	}
+
+	i := &issued{id: newID(), accountID: o.accountID, cert: c}
+	s.certs[i.id] = i
+	o.certID = i.id
+	o.status = statusValid
+	return nil
+}
+
+func (s *Server) handleAuthorization(w http.ResponseWriter, req *request) *Problem {
+	a := s.authzs[strings.TrimPrefix(req.url, s.url(pathAuthorization))]
+	if a == nil || a.accountID != req.account.ID {
+		return newProblem(http.StatusNotFound, "malformed", "authorization not found")
+	}
+
+	if len(req.payload) != 0 {
+		in := struct {
+			Status string `json:"status"`
+		}{}
+		if err := json.Unmarshal(req.payload, &in); err != nil || in.Status != statusDeactivated {
+			return newProblem(http.StatusBadRequest, "malformed", "authorizations can only be deactivated")
+		}
+		a.status = statusDeactivated
+	}
+
+	s.refreshAuthorization(a, time.Now().UTC())
+	writeJSON(w, http.StatusOK, s.authorizationResource(a))
+	return nil
+}
+
+// handleChallenge validates a challenge when the client posts an empty
+// object. Validation runs without holding the server lock
+func (s *Server) handleChallenge(w http.ResponseWriter, req *request) *Problem {
+	c := s.challenges[strings.TrimPrefix(req.url, s.url(pathChallenge))]
+	if c == nil {
+		return newProblem(http.StatusNotFound, "malformed", "challenge not found")
+	}
+	a := s.authzs[c.authzID]
+	if a.accountID != req.account.ID {
+		return newProblem(http.StatusNotFound, "malformed", "challenge not found")
+	}
+
+	s.refreshAuthorization(a, time.Now().UTC())
+	if len(req.payload) != 0 && c.status == statusPending && a.status == statusPending {
+		c.status = statusProcessing
+		domain := a.identifier.Value
+		keyAuthorization := c.token + "." + req.account.thumbprint
+
+		s.mu.Unlock()
+		ctx, cancel := context.WithTimeout(context.Background(), validationTimeout)
+		err := s.opts.Validator.Validate(ctx, c.typ, domain, c.token, keyAuthorization)
+		cancel()
+		s.mu.Lock()
+
+		if err != nil {
+			c.status = statusInvalid
+			c.err = newProblem(http.StatusForbidden, "incorrectResponse", "%s", err.Error())
+			a.status = statusInvalid
+		} else {
+			c.status = statusValid
+			c.validated = time.Now().UTC()
+			if a.status == statusPending {
+				a.status = statusValid
+			}
+		}
+	}
+
+	w.Header().Set("Link", fmt.Sprintf("<%s>;rel=\"up\"", s.url(pathAuthorization+a.id)))
+	writeJSON(w, http.StatusOK, s.challengeResource(c))
+	return nil
+}
+
+func (s *Server) handleCertificate(w http.ResponseWriter, req *request) *Problem {
+	i := s.certs[strings.TrimPrefix(req.url, s.url(pathCertificate))]
+	if i == nil || i.accountID != req.account.ID {
+		return newProblem(http.StatusNotFound, "malformed", "certificate not found")
+	}
+
+	chain, err := cert.WritePEMBundle([]*x509.Certificate{i.cert, s.opts.CA.Certificate})
+	if err != nil {
+		return newProblem(http.StatusInternalServerError, "serverInternal", "%s", err.Error())
+	}
+
+	w.Header().Set("Content-Type", "application/pem-certificate-chain")
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, chain)
+	return nil
+}
+
+// handleRevokeCert revokes certificates issued by the CA. Requests
+// must be signed by the account that ordered the certificate, or
+// by the certificate key
+func (s *Server) handleRevokeCert(w http.ResponseWriter, req *request) *Problem {
+	in := struct {
+		Certificate string `json:"certificate"`
+		Reason      int    `json:"reason"`
+	}{}
+	if err := json.Unmarshal(req.payload, &in); err != nil {
+		return newProblem(http.StatusBadRequest, "malformed", "cannot parse revocation request: %s", err.Error())
+	}
+	der, err := base64.RawURLEncoding.DecodeString(in.Certificate)
+	if err != nil {
+		return newProblem(http.StatusBadRequest, "malformed", "cannot decode certificate")
+	}
+	c, err := x509.ParseCertificate(der)
+	if err != nil {
+		return newProblem(http.StatusBadRequest, "malformed", "cannot parse certificate: %s", err.Error())
+	}
+	if err := c.CheckSignatureFrom(s.opts.CA.Certificate); err != nil {
+		return newProblem(http.StatusNotFound, "malformed", "certificate was not issued by this CA")
+	}
+	if !cert.ValidRevocationReason(in.Reason) {
+		return newProblem(http.StatusBadRequest, "badRevocationReason", "unknown revocation reason %d", in.Reason)
+	}
+
+	// the index is shared with other processes using the CA
+	if err := s.opts.CA.ReloadIndex(); err != nil {
+		return newProblem(http.StatusInternalServerError, "serverInternal", "%s", err.Error())
+	}
+	r := s.opts.CA.Index.Find(c.SerialNumber)
+	if r == nil {
+		return newProblem(http.StatusNotFound, "malformed", "certificate is not at the CA index")
+	}
+
+	authorized := false
+	if req.account != nil {
+		authorized = r.Requester == s.url(pathAccount+req.account.ID)
+	} else {
+		pub, ok := c.PublicKey.(interface {
+			Equal(crypto.PublicKey) bool
+		})
+		authorized = ok && pub.Equal(req.key)
+	}
+	if !authorized {
+		return newProblem(http.StatusForbidden, "unauthorized", "not authorized to revoke the certificate")
+	}
+	if r.Status == ca.StatusRevoked {
+		return newProblem(http.StatusBadRequest, "alreadyRevoked", "certificate is already revoked")
+	}
+	if err := s.opts.CA.Revoke(c.SerialNumber, in.Reason, time.Now()); err != nil {
+		return newProblem(http.StatusInternalServerError, "serverInternal", "%s", err.Error())
+	}
+
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// refreshOrder updates the order status from its authorizations
+func (s *Server) refreshOrder(o *order, now time.Time) {
+	if o.status != statusPending && o.status != statusReady {
+		return
+	}
+	if now.After(o.expires) {
+		o.status = statusInvalid
+		o.err = newProblem(http.StatusForbidden, "unauthorized", "order expired")
+		return
+	}
+
+	ready := true
+	for _, id := range o.authzIDs {
+		a := s.authzs[id]
+		s.refreshAuthorization(a, now)
+		switch a.status {
+		case statusValid:
+		case statusPending:
+			ready = false
+		default:
+			o.status = statusInvalid
+			o.err = newProblem(http.StatusForbidden, "unauthorized", "authorization for %s is %s", a.identifier.Value, a.status)
+			return
+		}
+	}
+	if ready {
+		o.status = statusReady
+	}
+}
+
+// refreshAuthorization expires authorizations past their lifetime
+func (s *Server) refreshAuthorization(a *authorization, now time.Time) {
+	if (a.status == statusPending || a.status == statusValid) && now.After(a.expires) {
+		a.status = statusExpired
+	}
+}
+
+func (s *Server) accountResource(a *Account) interface{} {
+	return struct {
+		Status  string   `json:"status"`
+		Contact []string `json:"contact,omitempty"`
+		Orders  string   `json:"orders"`
+	}{a.Status, a.Contact, s.url(pathAccount + a.ID + "/orders")}
+}
+
+func (s *Server) orderResource(o *order) interface{} {
+	r := struct {
+		Status         string       `json:"status"`
+		Expires        string       `json:"expires"`
+		Identifiers    []Identifier `json:"identifiers"`
+		Authorizations []string     `json:"authorizations"`
+		Finalize       string       `json:"finalize"`
+		Certificate    string       `json:"certificate,omitempty"`
+		Error          *Problem     `json:"error,omitempty"`
+	}{
+		Status:         o.status,
+		Expires:        o.expires.Format(time.RFC3339),
+		Identifiers:    o.identifiers,
+		Authorizations: []string{},
+		Finalize:       s.url(pathOrder + o.id + "/finalize"),
+		Error:          o.err,
+	}
+	for _, id := range o.authzIDs {
+		r.Authorizations = append(r.Authorizations, s.url(pathAuthorization+id))
+	}
+	if o.certID != "" {
+		r.Certificate = s.url(pathCertificate + o.certID)
+	}
+	return r
+}
+
+func (s *Server) authorizationResource(a *authorization) interface{} {
+	r := struct {
+		Status     string        `json:"status"`
+		Expires    string        `json:"expires"`
+		Identifier Identifier    `json:"identifier"`
+		Wildcard   bool          `json:"wildcard,omitempty"`
+		Challenges []interface{} `json:"challenges"`
+	}{
+		Status:     a.status,
+		Expires:    a.expires.Format(time.RFC3339),
+		Identifier: a.identifier,
+		Wildcard:   a.wildcard,
+		Challenges: []interface{}{},
+	}
+	for _, c := range a.challenges {
+		r.Challenges = append(r.Challenges, s.challengeResource(c))
+	}
+	return r
+}
+
+func (s *Server) challengeResource(c *challenge) interface{} {
+	r := struct {
+		Type      string   `json:"type"`
+		URL       string   `json:"url"`
+		Status    string   `json:"status"`
+		Token     string   `json:"token"`
+		Validated string   `json:"validated,omitempty"`
+		Error     *Problem `json:"error,omitempty"`
+	}{
+		Type:   c.typ,
+		URL:    s.url(pathChallenge + c.id),
+		Status: c.status,
+		Token:  c.token,
+		Error:  c.err,
+	}
+	if !c.validated.IsZero() {
+		r.Validated = c.validated.Format(time.RFC3339)
+	}
+	return r
+}
+
+// sortedOrders returns the orders sorted by expiration
+func (s *Server) sortedOrders() []*order {
+	orders := []*order{}
+	for _, o := range s.orders {
+		orders = append(orders, o)
+	}
+	sort.Slice(orders, func(i, j int) bool { return orders[i].expires.Before(orders[j].expires) })
+	return orders
+}
+
+// loadAccounts reads the accounts file, if configured and present
+func (s *Server) loadAccounts() error {
+	if s.opts.AccountsFile == "" {
+		return nil
+	}
+	b, err := filesystem.ReadContentsFromFile(s.opts.AccountsFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading ACME accounts: %s", err.Error())
+	}
+
+	f := &accountsFile{}
+	if err := json.Unmarshal(b, f); err != nil {
+		return fmt.Errorf("error parsing ACME accounts %q: %s", s.opts.AccountsFile, err.Error())
+	}
+	for _, a := range f.Accounts {
+		if a.key, err = parseJWK(a.Key); err != nil {
+			return fmt.Errorf("account %s: %s", a.ID, err.Error())
+		}
+		if a.thumbprint, err = jwkThumbprint(a.key); err != nil {
+			return fmt.Errorf("account %s: %s", a.ID, err.Error())
+		}
+		s.accounts[a.ID] = a
+	}
+	return nil
+}
+
+// saveAccounts writes the accounts file, if configured
+func (s *Server) saveAccounts() error {
+	if s.opts.AccountsFile == "" {
+		return nil
+	}
+
+	f := &accountsFile{Accounts: []*Account{}}
+	for _, a := range s.accounts {
+		f.Accounts = append(f.Accounts, a)
+	}
+	sort.Slice(f.Accounts, func(i, j int) bool { return f.Accounts[i].CreatedAt.Before(f.Accounts[j].CreatedAt) })
+
+	b, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := filesystem.WriteContentsToFile(s.opts.AccountsFile, string(b)+"\n"); err != nil {
+		return fmt.Errorf("error writing ACME accounts: %s", err.Error())
+	}
+	return nil
+}
+
+// newNonce creates a nonce accepted once
+func (s *Server) newNonce() string {
+	n := newToken()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for len(s.nonceOrder) >= maxNonces {
+		delete(s.nonces, s.nonceOrder[0])
+		s.nonceOrder = s.nonceOrder[1:]
+	}
+	s.nonces[n] = true
+	s.nonceOrder = append(s.nonceOrder, n)
+	return n
+}
+
+// url returns the absolute URL for a path
+func (s *Server) url(path string) string {
+	return s.opts.BaseURL + path
+}
+
+// checkContact accepts mailto contacts only
+func checkContact(contact []string) *Problem {
+	for _, c := range contact {
+		if !strings.HasPrefix(c, "mailto:") {
+			return newProblem(http.StatusBadRequest, "unsupportedContact", "unsupported contact %q, only mailto is supported", c)
+		}
+		if _, err := cert.StringToEmailList(strings.TrimPrefix(c, "mailto:")); err != nil {
+			return newProblem(http.StatusBadRequest, "invalidContact", "%s", err.Error())
+		}
+	}
+	return nil
+}
+
+// checkDomain accepts lowercase DNS names, with a wildcard
+// allowed as the leftmost label
+func checkDomain(d string) error {
+	name := strings.TrimPrefix(d, "*.")
+	labels := strings.Split(name, ".")
+	if len(name) > 253 || len(labels) < 2 {
+		return fmt.Errorf("%q is not a fully qualified domain name", d)
+	}
+	for _, l := range labels {
+		if l == "" || len(l) > 63 || strings.HasPrefix(l, "-") || strings.HasSuffix(l, "-") {
+			return fmt.Errorf("%q is not a valid domain name", d)
+		}
+		for _, r := range l {
+			if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' {
+				return fmt.Errorf("%q is not a valid domain name", d)
+			}
+		}
+	}
+	return nil
+}
+
+// newID returns a random identifier for server objects
+func newID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// newToken returns a random base64url token with 128 bits of entropy
+func newToken() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeProblem(w http.ResponseWriter, p *Problem) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
@@ -0,0 +1,331 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	xacme "golang.org/x/crypto/acme"
+
+	"github.com/odacremolbap/xfon/internal/testutil"
+	"github.com/odacremolbap/xfon/pkg/ca"
+	"github.com/odacremolbap/xfon/pkg/cert"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestServer starts an ACME server backed by a new
+// CA, using the validator for challenges
+func newTestServer(t *testing.T, v Validator) (*Server, *httptest.Server) {
+	c, k := testutil.NewCA(t, &cert.Subject{CommonName: "test CA"})
+	dir := t.TempDir()
+	authority, err := ca.Init(filepath.Join(dir, "ca"), ca.DefaultConfig(), c, k, nil)
+	assert.Nil(t, err)
+
+	ts := httptest.NewUnstartedServer(nil)
+	s, err := NewServer(&Options{
+		BaseURL:      "http://" + ts.Listener.Addr().String(),
+		CA:           authority,
+		Signer:       k,
+		Validator:    v,
+		AccountsFile: filepath.Join(dir, "accounts.json"),
+	})
+	assert.Nil(t, err)
+	ts.Config.Handler = s
+	ts.Start()
+	t.Cleanup(ts.Close)
+	return s, ts
+}
+
+// newTestClient registers an account at the server
+func newTestClient(t *testing.T, s *Server) *xacme.Client {
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	client := &xacme.Client{Key: k, DirectoryURL: s.DirectoryURL()}
+	_, err = client.Register(context.Background(), &xacme.Account{Contact: []string{"mailto:admin@example.com"}}, xacme.AcceptTOS)
+	assert.Nil(t, err)
+	return client
+}
+
+// authorize accepts the http-01 challenge of every authorization,
+// or the dns-01 one when http-01 is not offered, and returns the
+// types of the accepted challenges
+func authorize(ctx context.Context, client *xacme.Client, o *xacme.Order) ([]string, error) {
+	accepted := []string{}
+	for _, u := range o.AuthzURLs {
+		a, err := client.GetAuthorization(ctx, u)
+		if err != nil {
+			return nil, err
+		}
+		c := a.Challenges[0]
+		for _, ch := range a.Challenges {
+			if ch.Type == ChallengeHTTP01 {
+				c = ch
+			}
+		}
+		if _, err := client.Accept(ctx, c); err != nil {
+			return nil, err
+		}
+		if _, err := client.WaitAuthorization(ctx, u); err != nil {
+			return nil, err
+		}
+		accepted = append(accepted, c.Type)
+	}
+	return accepted, nil
+}
+
+func newTestCSR(t *testing.T, cn string, names ...string) ([]byte, crypto.Signer) {
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	b, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: cn},
+		DNSNames: names,
+	}, k)
+	assert.Nil(t, err)
+	return b, k
+}
+
+func TestIssuance(t *testing.T) {
+	validated := map[string]string{}
+	s, _ := newTestServer(t, ValidatorFunc(func(ctx context.Context, challengeType, domain, token, keyAuthorization string) error {
+		validated[domain] = challengeType
+		return nil
+	}))
+	client := newTestClient(t, s)
+	ctx := context.Background()
+
+	o, err := client.AuthorizeOrder(ctx, xacme.DomainIDs("www.example.com", "*.example.com"))
+	assert.Nil(t, err)
+	assert.Equal(t, xacme.StatusPending, o.Status)
+	assert.Equal(t, 2, len(o.AuthzURLs))
+
+	// wildcard identifiers only offer dns-01
+	accepted, err := authorize(ctx, client, o)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{ChallengeDNS01, ChallengeHTTP01}, accepted)
+	assert.Equal(t, map[string]string{"www.example.com": ChallengeHTTP01, "example.com": ChallengeDNS01}, validated)
+
+	o, err = client.WaitOrder(ctx, o.URI)
+	assert.Nil(t, err)
+	assert.Equal(t, xacme.StatusReady, o.Status)
+
+	csr, _ := newTestCSR(t, "other.example.com", "www.example.com", "*.example.com")
+	_, _, err = client.CreateOrderCert(ctx, o.FinalizeURL, csr, true)
+	assert.NotNil(t, err, "CSR names must match the order")
+
+	csr, k := newTestCSR(t, "www.example.com", "*.example.com")
+	chain, _, err := client.CreateOrderCert(ctx, o.FinalizeURL, csr, true)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(chain))
+
+	c, err := x509.ParseCertificate(chain[0])
+	assert.Nil(t, err)
+	assert.Equal(t, "www.example.com", c.Subject.CommonName)
+	assert.Equal(t, []string{"*.example.com", "www.example.com"}, c.DNSNames)
+	assert.Nil(t, c.CheckSignatureFrom(s.opts.CA.Certificate))
+	assert.Equal(t, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}, c.ExtKeyUsage)
+
+	a, err := client.GetReg(ctx, "")
+	assert.Nil(t, err)
+	r := s.opts.CA.Index.Find(c.SerialNumber)
+	assert.NotNil(t, r)
+	assert.Equal(t, "server", r.Profile)
+	assert.Equal(t, a.URI, r.Requester)
+
+	// other accounts cannot revoke the certificate
+	other := newTestClient(t, s)
+	assert.NotNil(t, other.RevokeCert(ctx, nil, chain[0], xacme.CRLReasonKeyCompromise))
+
+	// the certificate key can revoke it without an account
+	assert.Nil(t, client.RevokeCert(ctx, k, chain[0], xacme.CRLReasonKeyCompromise))
+	r = s.opts.CA.Index.Find(c.SerialNumber)
+	assert.Equal(t, ca.StatusRevoked, r.Status)
+	assert.Equal(t, "keyCompromise", r.Reason)
+}
+
+func TestSharedIndex(t *testing.T) {
+	s, _ := newTestServer(t, ValidatorFunc(func(ctx context.Context, challengeType, domain, token, keyAuthorization string) error {
+		return nil
+	}))
+	client := newTestClient(t, s)
+	ctx := context.Background()
+	issue := func(domain string) *x509.Certificate {
+		o, err := client.AuthorizeOrder(ctx, xacme.DomainIDs(domain))
+		assert.Nil(t, err)
+		_, err = authorize(ctx, client, o)
+		assert.Nil(t, err)
+		csr, _ := newTestCSR(t, domain)
+		chain, _, err := client.CreateOrderCert(ctx, o.FinalizeURL, csr, true)
+		assert.Nil(t, err)
+		c, err := x509.ParseCertificate(chain[0])
+		assert.Nil(t, err)
+		return c
+	}
+
+	www := issue("www.example.com")
+
+	// changes made by other processes using the CA are kept
+	other, err := ca.Open(s.opts.CA.Dir)
+	assert.Nil(t, err)
+	assert.Nil(t, other.Revoke(www.SerialNumber, cert.RevocationReasonChoices["superseded"], time.Now()))
+	api := issue("api.example.com")
+
+	reopened, err := ca.Open(s.opts.CA.Dir)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(reopened.Index.Certificates))
+	assert.Equal(t, ca.StatusRevoked, reopened.Index.Find(www.SerialNumber).Status)
+	assert.Equal(t, ca.StatusValid, reopened.Index.Find(api.SerialNumber).Status)
+
+	// the account revokes the certificates recorded for it at the index.
+	// Revoking again is reported as alreadyRevoked, which clients accept
+	assert.Nil(t, client.RevokeCert(ctx, nil, www.Raw, xacme.CRLReasonKeyCompromise))
+	assert.Nil(t, client.RevokeCert(ctx, nil, api.Raw, xacme.CRLReasonKeyCompromise))
+	assert.Nil(t, reopened.ReloadIndex())
+	assert.Equal(t, "superseded", reopened.Index.Find(www.SerialNumber).Reason)
+	assert.Equal(t, "keyCompromise", reopened.Index.Find(api.SerialNumber).Reason)
+}
+
+func TestNonces(t *testing.T) {
+	s, _ := newTestServer(t, ValidatorFunc(func(ctx context.Context, challengeType, domain, token, keyAuthorization string) error {
+		return nil
+	}))
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	encode := base64.RawURLEncoding.EncodeToString
+	jwkJSON, err := json.Marshal(&jwk{Kty: "EC", Crv: "P-256", X: encode(k.X.FillBytes(make([]byte, 32))), Y: encode(k.Y.FillBytes(make([]byte, 32)))})
+	assert.Nil(t, err)
+
+	// newRequest builds a JWS for the nonce, signed by the key when sign is set
+	newRequest := func(nonce string, sign bool) *http.Request {
+		protected, err := json.Marshal(&jwsHeader{Alg: "ES256", Nonce: nonce, URL: s.url(pathNewAccount), JWK: jwkJSON})
+		assert.Nil(t, err)
+		msg := &jwsMessage{Protected: encode(protected), Payload: encode([]byte("{}"))}
+		sig := make([]byte, 64)
+		if sign {
+			h := sha256.Sum256([]byte(msg.Protected + "." + msg.Payload))
+			r, ss, err := ecdsa.Sign(rand.Reader, k, h[:])
+			assert.Nil(t, err)
+			r.FillBytes(sig[:32])
+			ss.FillBytes(sig[32:])
+		}
+		msg.Signature = encode(sig)
+		b, err := json.Marshal(msg)
+		assert.Nil(t, err)
+		return httptest.NewRequest(http.MethodPost, pathNewAccount, bytes.NewReader(b))
+	}
+
+	// forged requests do not consume the nonce
+	nonce := s.newNonce()
+	_, p := s.authenticate(newRequest(nonce, false))
+	assert.NotNil(t, p)
+	_, p = s.authenticate(newRequest(nonce, true))
+	assert.Nil(t, p)
+	_, p = s.authenticate(newRequest(nonce, true))
+	if assert.NotNil(t, p) {
+		assert.Equal(t, "urn:ietf:params:acme:error:badNonce", p.Type)
+	}
+
+	// the oldest nonces are discarded first
+	first := s.newNonce()
+	second := s.newNonce()
+	for i := 0; i < maxNonces-1; i++ {
+		s.newNonce()
+	}
+	assert.False(t, s.nonces[first])
+	assert.True(t, s.nonces[second])
+	assert.Equal(t, maxNonces, len(s.nonces))
+}
+
+func TestChallengeFailure(t *testing.T) {
+	s, _ := newTestServer(t, ValidatorFunc(func(ctx context.Context, challengeType, domain, token, keyAuthorization string) error {
+		return errors.New("key authorization not found")
+	}))
+	client := newTestClient(t, s)
+	ctx := context.Background()
+
+	o, err := client.AuthorizeOrder(ctx, xacme.DomainIDs("www.example.com"))
+	assert.Nil(t, err)
+	_, err = authorize(ctx, client, o)
+	assert.NotNil(t, err)
+
+	o, err = client.GetOrder(ctx, o.URI)
+	assert.Nil(t, err)
+	assert.Equal(t, xacme.StatusInvalid, o.Status)
+
+	csr, _ := newTestCSR(t, "www.example.com")
+	_, _, err = client.CreateOrderCert(ctx, o.FinalizeURL, csr, true)
+	assert.NotNil(t, err)
+}
+
+func TestAccounts(t *testing.T) {
+	s, _ := newTestServer(t, ValidatorFunc(func(ctx context.Context, challengeType, domain, token, keyAuthorization string) error {
+		return nil
+	}))
+	client := newTestClient(t, s)
+	ctx := context.Background()
+
+	a, err := client.GetReg(ctx, "")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"mailto:admin@example.com"}, a.Contact)
+
+	_, err = client.Register(ctx, &xacme.Account{}, xacme.AcceptTOS)
+	assert.Equal(t, xacme.ErrAccountAlreadyExists, err)
+
+	// accounts are loaded from the accounts file
+	restarted, err := NewServer(&s.opts)
+	assert.Nil(t, err)
+	id := strings.TrimPrefix(a.URI, s.url(pathAccount))
+	assert.Equal(t, 1, len(restarted.accounts))
+	assert.NotNil(t, restarted.accounts[id])
+	assert.Equal(t, s.accounts[id].thumbprint, restarted.accounts[id].thumbprint)
+
+	_, err = client.AuthorizeOrder(ctx, []xacme.AuthzID{{Type: "ip", Value: "10.0.0.1"}})
+	assert.NotNil(t, err)
+
+	_, err = client.AuthorizeOrder(ctx, xacme.DomainIDs("no_valid.example.com"))
+	assert.NotNil(t, err)
+
+	assert.Nil(t, client.DeactivateReg(ctx))
+	_, err = client.AuthorizeOrder(ctx, xacme.DomainIDs("www.example.com"))
+	assert.NotNil(t, err, "deactivated accounts cannot order")
+}
+
+func TestCheckDomain(t *testing.T) {
+	var testData = []struct {
+		testName string
+		domain   string
+		errorRet bool
+	}{
+		{"fqdn", "www.example.com", false},
+		{"wildcard", "*.example.com", false},
+		{"single label", "localhost", true},
+		{"inner wildcard", "www.*.example.com", true},
+		{"empty label", "www..example.com", true},
+		{"leading hyphen", "-www.example.com", true},
+		{"uppercase", "WWW.example.com", true},
+	}
+
+	for _, td := range testData {
+		err := checkDomain(td.domain)
+		if td.errorRet {
+			assert.Errorf(t, err, "test: %s", td.testName)
+		} else {
+			assert.NoErrorf(t, err, "test: %s", td.testName)
+		}
+	}
+}
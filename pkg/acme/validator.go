@@ -0,0 +1,126 @@
+package acme
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// challenge types
+const (
+	// ChallengeHTTP01 is proven serving the key authorization at
+	// http://<domain>/.well-known/acme-challenge/<token>
+	ChallengeHTTP01 = "http-01"
+	// ChallengeDNS01 is proven publishing the key authorization
+	// digest as a TXT record at _acme-challenge.<domain>
+	ChallengeDNS01 = "dns-01"
+)
+
+// Validator checks that an account controls the domain of a challenge.
+// The key authorization is the challenge token followed by a dot and the
+// account key thumbprint
+type Validator interface {
+	Validate(ctx context.Context, challengeType, domain, token, keyAuthorization string) error
+}
+
+// ValidatorFunc adapts a function to the Validator interface
+type ValidatorFunc func(ctx context.Context, challengeType, domain, token, keyAuthorization string) error
+
+// Validate calls the function
+func (f ValidatorFunc) Validate(ctx context.Context, challengeType, domain, token, keyAuthorization string) error {
+	return f(ctx, challengeType, domain, token, keyAuthorization)
+}
+
+// NetValidator validates challenges over the network. The dns-01
+// lookup is pluggable so that records can be checked against a
+// specific DNS server, or any other source
+type NetValidator struct {
+	// HTTPClient used for http-01 challenges, http.DefaultClient if nil
+	HTTPClient *http.Client
+	// HTTPPort where http-01 challenges are served, 80 if empty
+	HTTPPort string
+	// LookupTXT returns the TXT records for a name, the
+	// system resolver is used if nil
+	LookupTXT func(ctx context.Context, name string) ([]string, error)
+}
+
+// maxKeyAuthorizationSize limits the http-01 response read
+const maxKeyAuthorizationSize = 1024
+
+// Validate checks http-01 and dns-01 challenges
+func (v *NetValidator) Validate(ctx context.Context, challengeType, domain, token, keyAuthorization string) error {
+	switch challengeType {
+	case ChallengeHTTP01:
+		return v.validateHTTP01(ctx, domain, token, keyAuthorization)
+	case ChallengeDNS01:
+		return v.validateDNS01(ctx, domain, keyAuthorization)
+	}
+	return fmt.Errorf("unsupported challenge type %q", challengeType)
+}
+
+// validateHTTP01 fetches the key authorization from the domain
+func (v *NetValidator) validateHTTP01(ctx context.Context, domain, token, keyAuthorization string) error {
+	host := domain
+	if v.HTTPPort != "" && v.HTTPPort != "80" {
+		host = net.JoinHostPort(domain, v.HTTPPort)
+	}
+	url := fmt.Sprintf("http://%s/.well-known/acme-challenge/%s", host, token)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	client := v.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error fetching %s: %s", url, err.Error())
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned status %d", url, res.StatusCode)
+	}
+	b, err := io.ReadAll(io.LimitReader(res.Body, maxKeyAuthorizationSize))
+	if err != nil {
+		return fmt.Errorf("error reading %s: %s", url, err.Error())
+	}
+	if strings.TrimSpace(string(b)) != keyAuthorization {
+		return fmt.Errorf("%s does not contain the expected key authorization", url)
+	}
+	return nil
+}
+
+// validateDNS01 looks for the key authorization digest at the TXT records
+func (v *NetValidator) validateDNS01(ctx context.Context, domain, keyAuthorization string) error {
+	lookup := v.LookupTXT
+	if lookup == nil {
+		lookup = net.DefaultResolver.LookupTXT
+	}
+
+	name := "_acme-challenge." + domain
+	records, err := lookup(ctx, name)
+	if err != nil {
+		return fmt.Errorf("error looking up TXT records for %s: %s", name, err.Error())
+	}
+	expected := DNS01Record(keyAuthorization)
+	for _, r := range records {
+		if r == expected {
+			return nil
+		}
+	}
+	return fmt.Errorf("no TXT record for %s contains the expected key authorization digest", name)
+}
+
+// DNS01Record returns the TXT record value for a dns-01 key authorization
+func DNS01Record(keyAuthorization string) string {
+	h := sha256.Sum256([]byte(keyAuthorization))
+	return base64.RawURLEncoding.EncodeToString(h[:])
+}
@@ -0,0 +1,80 @@
+package acme
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateHTTP01(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/.well-known/acme-challenge/token" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintln(w, "token.thumbprint")
+	}))
+	defer ts.Close()
+	_, port, err := net.SplitHostPort(ts.Listener.Addr().String())
+	assert.Nil(t, err)
+	v := &NetValidator{HTTPPort: port}
+
+	var testData = []struct {
+		testName         string
+		token            string
+		keyAuthorization string
+		errorRet         bool
+	}{
+		{"matching key authorization", "token", "token.thumbprint", false},
+		{"wrong key authorization", "token", "token.other", true},
+		{"missing token", "other", "other.thumbprint", true},
+	}
+
+	for _, td := range testData {
+		err := v.Validate(context.Background(), ChallengeHTTP01, "127.0.0.1", td.token, td.keyAuthorization)
+		if td.errorRet {
+			assert.Errorf(t, err, "test: %s", td.testName)
+		} else {
+			assert.NoErrorf(t, err, "test: %s", td.testName)
+		}
+	}
+}
+
+func TestValidateDNS01(t *testing.T) {
+	v := &NetValidator{
+		LookupTXT: func(ctx context.Context, name string) ([]string, error) {
+			if name != "_acme-challenge.example.com" {
+				return nil, errors.New("no such host")
+			}
+			return []string{"unrelated", DNS01Record("token.thumbprint")}, nil
+		},
+	}
+
+	var testData = []struct {
+		testName         string
+		domain           string
+		keyAuthorization string
+		errorRet         bool
+	}{
+		{"matching record", "example.com", "token.thumbprint", false},
+		{"wrong key authorization", "example.com", "token.other", true},
+		{"missing record", "www.example.com", "token.thumbprint", true},
+	}
+
+	for _, td := range testData {
+		err := v.Validate(context.Background(), ChallengeDNS01, td.domain, "token", td.keyAuthorization)
+		if td.errorRet {
+			assert.Errorf(t, err, "test: %s", td.testName)
+		} else {
+			assert.NoErrorf(t, err, "test: %s", td.testName)
+		}
+	}
+
+	assert.NotNil(t, v.Validate(context.Background(), "tls-alpn-01", "example.com", "token", "token.thumbprint"))
+}
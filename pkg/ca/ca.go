@@ -0,0 +1,396 @@
+package ca
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/odacremolbap/xfon/pkg/cert"
+	"github.com/odacremolbap/xfon/pkg/filesystem"
+	"github.com/odacremolbap/xfon/pkg/key"
+	"github.com/odacremolbap/xfon/pkg/passphrase"
+	"gopkg.in/yaml.v2"
+)
+
+// files and directories at a CA home
+const (
+	CertFile      = "ca.crt"
+	KeyFile       = "ca.key"
+	ConfigFile    = "config.yaml"
+	SerialFile    = "serial"
+	CRLNumberFile = "crlnumber"
+	IndexFile     = "index.json"
+	CertsDir      = "certs"
+	CRLFile       = "crl.pem"
+	LockFile      = ".lock"
+)
+
+// CA is a certificate authority stored at a directory, which contains
+//
+//	ca.crt       CA certificate
+//	ca.key       CA private key, optionally encrypted
+//	config.yaml  CA settings, see Config
+//	serial       next serial number, as hex
+//	crlnumber    next CRL number, as decimal
+//	index.json   issued certificates, see Index
+//	certs/       copy of each issued certificate, named by serial
+//	crl.pem      last generated CRL
+//	.lock        held while the index or counters are changed
+//
+// Operations changing the index or counters lock the CA home and
+// reload the index from disk first, so that concurrent processes
+// do not overwrite each other changes
+type CA struct {
+	Dir         string
+	Config      *Config
+	Certificate *x509.Certificate
+	Index       *Index
+}
+
+// Init creates a CA home at dir, which must not contain a CA already. The
+// key is stored as an encrypted PKCS#8 when a passphrase is informed. The
+// serial counter starts at a random 64 bits value so that serials do not
+// repeat when a CA is recreated
+func Init(dir string, cfg *Config, c *x509.Certificate, k crypto.Signer, pass []byte) (*CA, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if err := cert.ValidateIssuer(c, k); err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(filepath.Join(dir, CertFile)); err == nil {
+		return nil, fmt.Errorf("%q already contains a CA", dir)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, CertsDir), 0700); err != nil {
+		return nil, fmt.Errorf("error creating CA directory: %s", err.Error())
+	}
+
+	var (
+		kp  string
+		err error
+	)
+	if pass != nil {
+		kp, err = key.WriteEncryptedPEM(k, pass, key.PBKDF2)
+	} else {
+		kp, err = key.WritePEM(k)
+	}
+	if err != nil {
+		return nil, err
+	}
+	cp, err := cert.WritePEM(c.Raw)
+	if err != nil {
+		return nil, err
+	}
+	cfgb, err := yaml.Marshal(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("error serializing CA configuration: %s", err.Error())
+	}
+	s, err := cert.GenerateSerial()
+	if err != nil {
+		return nil, err
+	}
+	s.Rsh(s, 64).Add(s, big.NewInt(1))
+
+	ca := &CA{
+		Dir:         dir,
+		Config:      cfg,
+		Certificate: c,
+		Index:       &Index{Version: indexVersion, Certificates: []*Record{}},
+	}
+	files := []struct {
+		name     string
+		contents string
+	}{
+		{KeyFile, kp},
+		{CertFile, cp},
+		{ConfigFile, string(cfgb)},
+		{SerialFile, s.Text(16) + "\n"},
+		{CRLNumberFile, "1\n"},
+	}
+	for _, f := range files {
+		if err := filesystem.WriteContentsToFile(ca.path(f.name), f.contents); err != nil {
+			return nil, fmt.Errorf("error writing %s: %s", f.name, err.Error())
+		}
+	}
+	if err := ca.saveIndex(); err != nil {
+		return nil, err
+	}
+
+	return ca, nil
+}
+
+// Open reads the CA home at dir
+func Open(dir string) (*CA, error) {
+	ca := &CA{Dir: dir}
+
+	b, err := filesystem.ReadContentsFromFile(ca.path(CertFile))
+	if err != nil {
+		return nil, fmt.Errorf("no CA found at %q: %s", dir, err.Error())
+	}
+	if ca.Certificate, err = cert.ReadPEM(b); err != nil {
+		return nil, fmt.Errorf("no cert found at %q: %s", ca.path(CertFile), err.Error())
+	}
+
+	if b, err = filesystem.ReadContentsFromFile(ca.path(ConfigFile)); err != nil {
+		return nil, fmt.Errorf("error reading CA configuration: %s", err.Error())
+	}
+	if ca.Config, err = readConfig(b); err != nil {
+		return nil, err
+	}
+
+	if err := ca.ReloadIndex(); err != nil {
+		return nil, err
+	}
+
+	return ca, nil
+}
+
+// ReloadIndex reads the index again from disk, so that long running
+// processes see changes made by other commands
+func (ca *CA) ReloadIndex() error {
+	b, err := filesystem.ReadContentsFromFile(ca.path(IndexFile))
+	if err != nil {
+		return fmt.Errorf("error reading CA index: %s", err.Error())
+	}
+	i, err := readIndex(b)
+	if err != nil {
+		return err
+	}
+	ca.Index = i
+	return nil
+}
+
+// Signer reads the CA private key, using the passphrase
+// source when it is encrypted
+func (ca *CA) Signer(src *passphrase.Source) (crypto.Signer, error) {
+	k, err := key.ReadPEMFile(ca.path(KeyFile), src)
+	if err != nil {
+		return nil, fmt.Errorf("error reading CA key: %s", err.Error())
+	}
+	return k, nil
+}
+
+// Profile loads an issuance profile, the configured
+// default one when the name is empty
+func (ca *CA) Profile(name string) (*cert.Profile, error) {
+	if name == "" {
+		name = ca.Config.Profile
+	}
+	path := ca.Config.ProfileFile
+	if path != "" && !filepath.IsAbs(path) {
+		path = ca.path(path)
+	}
+	return cert.LoadProfile(name, path)
+}
+
+// Issue signs a certificate for the public key, assigning the next
+// serial number, and records it at the index. The profile name is
+// only informative
+func (ca *CA) Issue(x *cert.X509Simplified, publicKey crypto.PublicKey, signer crypto.Signer, profile string) (*x509.Certificate, error) {
+	return ca.issue(x, &Record{Profile: profile}, func(x *cert.X509Simplified) ([]byte, error) {
+		return cert.GenerateX509Certificate(x, ca.Certificate, publicKey, signer)
+	})
+}
+
+// IssueCSR signs a certificate for the certificate request as
+// cert.SignCSR does, assigning the next serial number, and
+// records it at the index along with who requested it. The
+// profile name is only informative
+func (ca *CA) IssueCSR(x *cert.X509Simplified, csr *x509.CertificateRequest, signer crypto.Signer, policy cert.ExtensionPolicy, profile, requester string) (*x509.Certificate, error) {
+	return ca.issue(x, &Record{Profile: profile, Requester: requester}, func(x *cert.X509Simplified) ([]byte, error) {
+		return cert.SignCSR(x, csr, ca.Certificate, signer, policy)
+	})
+}
+
+// issue reserves a serial, signs the certificate and records it with
+// the profile and requester at meta. The serial counter is saved before
+// signing so that a failure never leads to a serial being reused.
+// Distribution URLs not set at the certificate are taken from the
+// configuration
+func (ca *CA) issue(x *cert.X509Simplified, meta *Record, sign func(*cert.X509Simplified) ([]byte, error)) (*x509.Certificate, error) {
+	if x.Serial != nil {
+		return nil, fmt.Errorf("serial numbers are assigned by the CA")
+	}
+	if len(x.OCSPServer) == 0 {
+		x.OCSPServer = ca.Config.OCSPServers
+	}
+	if len(x.IssuingCertificateURL) == 0 {
+		x.IssuingCertificateURL = ca.Config.IssuingCertificateURLs
+	}
+	if len(x.CRLDistributionPoints) == 0 {
+		x.CRLDistributionPoints = ca.Config.CRLDistributionPoints
+	}
+
+	unlock, err := ca.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	if err := ca.ReloadIndex(); err != nil {
+		return nil, err
+	}
+
+	s, err := ca.nextSerial()
+	if err != nil {
+		return nil, err
+	}
+	x.Serial = s
+
+	b, err := sign(x)
+	if err != nil {
+		return nil, err
+	}
+	c, err := x509.ParseCertificate(b)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse issued certificate: %s", err.Error())
+	}
+
+	r, err := NewRecord(c, meta.Profile)
+	if err != nil {
+		return nil, err
+	}
+	r.Requester = meta.Requester
+	p, err := cert.WritePEM(b)
+	if err != nil {
+		return nil, err
+	}
+	name := strings.Replace(r.Serial, ":", "", -1) + ".pem"
+	if err := filesystem.WriteContentsToFile(filepath.Join(ca.Dir, CertsDir, name), p); err != nil {
+		return nil, fmt.Errorf("error storing issued certificate: %s", err.Error())
+	}
+
+	ca.Index.Certificates = append(ca.Index.Certificates, r)
+	if err := ca.saveIndex(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Revoke marks the certificate with the serial as revoked
+func (ca *CA) Revoke(serial *big.Int, reason int, at time.Time) error {
+	unlock, err := ca.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := ca.ReloadIndex(); err != nil {
+		return err
+	}
+
+	r := ca.Index.Find(serial)
+	if r == nil {
+		return fmt.Errorf("serial %s was not issued by this CA", cert.FormatHex(serial.Bytes()))
+	}
+	if r.Status == StatusRevoked {
+		return fmt.Errorf("serial %s is already revoked", r.Serial)
+	}
+
+	at = at.UTC().Truncate(time.Second)
+	r.Status = StatusRevoked
+	r.RevokedAt = &at
+	r.Reason = cert.RevocationReasonToString(reason)
+	return ca.saveIndex()
+}
+
+// CRL generates a CRL with the revoked certificates at the index, valid
+// for the configured time, using the next CRL number. The CRL is also
+// stored as PEM at the CA home
+func (ca *CA) CRL(signer crypto.Signer, now time.Time) ([]byte, error) {
+	validity, err := cert.ParseDuration(ca.Config.CRLValidity)
+	if err != nil {
+		return nil, err
+	}
+
+	unlock, err := ca.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	if err := ca.ReloadIndex(); err != nil {
+		return nil, err
+	}
+
+	revoked, err := ca.Index.Revoked()
+	if err != nil {
+		return nil, err
+	}
+	number, err := ca.nextCounter(CRLNumberFile, 10)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := cert.GenerateCRL(&cert.CRLSimplified{
+		Number:     number,
+		ThisUpdate: now.UTC(),
+		NextUpdate: now.Add(validity).UTC(),
+		Revoked:    revoked,
+	}, ca.Certificate, signer)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := cert.WriteCRLPEM(b)
+	if err != nil {
+		return nil, err
+	}
+	if err := filesystem.WriteContentsToFile(ca.path(CRLFile), p); err != nil {
+		return nil, fmt.Errorf("error storing CRL: %s", err.Error())
+	}
+	return b, nil
+}
+
+// nextSerial returns the serial counter value, skipping serials
+// already at the index, and saves the incremented counter
+func (ca *CA) nextSerial() (*big.Int, error) {
+	for {
+		s, err := ca.nextCounter(SerialFile, 16)
+		if err != nil {
+			return nil, err
+		}
+		if ca.Index.Find(s) == nil {
+			return s, nil
+		}
+	}
+}
+
+// nextCounter returns the value of a counter file
+// written in the informed base, and increments it
+func (ca *CA) nextCounter(name string, base int) (*big.Int, error) {
+	b, err := filesystem.ReadContentsFromFile(ca.path(name))
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %s", name, err.Error())
+	}
+	n, ok := new(big.Int).SetString(strings.TrimSpace(string(b)), base)
+	if !ok || n.Sign() <= 0 {
+		return nil, fmt.Errorf("invalid value at %s", name)
+	}
+
+	next := new(big.Int).Add(n, big.NewInt(1))
+	if err := filesystem.WriteContentsToFile(ca.path(name), next.Text(base)+"\n"); err != nil {
+		return nil, fmt.Errorf("error writing %s: %s", name, err.Error())
+	}
+	return n, nil
+}
+
+// saveIndex writes the index back to disk
+func (ca *CA) saveIndex() error {
+	b, err := json.MarshalIndent(ca.Index, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := filesystem.WriteContentsToFile(ca.path(IndexFile), string(b)+"\n"); err != nil {
+		return fmt.Errorf("error writing CA index: %s", err.Error())
+	}
+	return nil
+}
+
+// path returns the location of a file at the CA home
+func (ca *CA) path(name string) string {
+	return filepath.Join(ca.Dir, name)
+}
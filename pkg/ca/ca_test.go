@@ -0,0 +1,344 @@
+package ca
+
+import (
+	"crypto"
+	"crypto/x509"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/odacremolbap/xfon/internal/testutil"
+	"github.com/odacremolbap/xfon/pkg/cert"
+	"github.com/odacremolbap/xfon/pkg/key"
+	"github.com/odacremolbap/xfon/pkg/passphrase"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestCA creates a CA home at a temporary directory
+func newTestCA(t *testing.T, pass []byte) (*CA, crypto.Signer) {
+	c, k := testutil.NewCA(t, &cert.Subject{CommonName: "test CA"})
+	ca, err := Init(filepath.Join(t.TempDir(), "ca"), DefaultConfig(), c, k, pass)
+	assert.Nil(t, err)
+	return ca, k
+}
+
+// newLeaf returns a simplified leaf certificate definition
+func newLeaf(cn string, days int) *cert.X509Simplified {
+	return &cert.X509Simplified{
+		Subject:     &cert.Subject{CommonName: cn},
+		DNSNames:    []string{cn},
+		NotBefore:   time.Now().AddDate(0, 0, -1).UTC(),
+		NotAfter:    time.Now().AddDate(0, 0, days).UTC(),
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+}
+
+// newLeafKey returns a key for leaf certificates
+func newLeafKey(t *testing.T) crypto.Signer {
+	k, err := key.GenerateKey(&key.Options{Type: key.ECDSA, Curve: "P-256"})
+	assert.Nil(t, err)
+	return k
+}
+
+func TestInit(t *testing.T) {
+	c, k := testutil.NewCA(t, &cert.Subject{CommonName: "test CA"})
+	other := newLeafKey(t)
+	existing := filepath.Join(t.TempDir(), "ca")
+	_, err := Init(existing, DefaultConfig(), c, k, nil)
+	assert.Nil(t, err)
+	t.Setenv("XFON_TEST_CA_PASSPHRASE", "secret")
+
+	var testData = []struct {
+		testName string
+		dir      string
+		config   *Config
+		signer   crypto.Signer
+		pass     []byte
+		errorRet bool
+	}{
+		{testName: "unencrypted key", config: DefaultConfig(), signer: k},
+		{testName: "encrypted key", config: DefaultConfig(), signer: k, pass: []byte("secret")},
+		{testName: "existing directory", dir: existing, config: DefaultConfig(), signer: k, errorRet: true},
+		{testName: "key not matching the certificate", config: DefaultConfig(), signer: other, errorRet: true},
+		{testName: "invalid configuration", config: &Config{Profile: "server", CRLValidity: "soon"}, signer: k, errorRet: true},
+	}
+
+	for _, td := range testData {
+		dir := td.dir
+		if dir == "" {
+			dir = filepath.Join(t.TempDir(), "ca")
+		}
+		_, err := Init(dir, td.config, c, td.signer, td.pass)
+		if td.errorRet {
+			assert.Errorf(t, err, "test: %s", td.testName)
+			continue
+		}
+		assert.NoErrorf(t, err, "test: %s", td.testName)
+
+		for _, f := range []string{CertFile, KeyFile, ConfigFile, SerialFile, CRLNumberFile, IndexFile, CertsDir} {
+			_, err := os.Stat(filepath.Join(dir, f))
+			assert.NoErrorf(t, err, "test: %s %s", td.testName, f)
+		}
+
+		opened, err := Open(dir)
+		assert.NoErrorf(t, err, "test: %s", td.testName)
+		assert.Truef(t, c.Equal(opened.Certificate), "test: %s", td.testName)
+		assert.Equalf(t, td.config, opened.Config, "test: %s", td.testName)
+		assert.Equalf(t, 0, len(opened.Index.Certificates), "test: %s", td.testName)
+
+		signer, err := opened.Signer(&passphrase.Source{Env: "XFON_TEST_CA_PASSPHRASE"})
+		assert.NoErrorf(t, err, "test: %s", td.testName)
+		assert.NoErrorf(t, cert.ValidateIssuer(opened.Certificate, signer), "test: %s", td.testName)
+	}
+}
+
+func TestIssue(t *testing.T) {
+	ca, k := newTestCA(t, nil)
+	leafKey := newLeafKey(t)
+	fixed := newLeaf("fixed.example.com", 10)
+	fixed.Serial = big.NewInt(1)
+
+	var testData = []struct {
+		testName string
+		x509     *cert.X509Simplified
+		profile  string
+		status   Status
+		errorRet bool
+	}{
+		{testName: "valid", x509: newLeaf("www.example.com", 10), profile: "server", status: StatusValid},
+		{testName: "next serial", x509: newLeaf("api.example.com", 10), profile: "server", status: StatusValid},
+		{testName: "expired", x509: newLeaf("old.example.com", -1), status: StatusExpired},
+		{testName: "serial assigned by the CA", x509: fixed, errorRet: true},
+	}
+
+	var last *big.Int
+	for _, td := range testData {
+		c, err := ca.Issue(td.x509, leafKey.Public(), k, td.profile)
+		if td.errorRet {
+			assert.Errorf(t, err, "test: %s", td.testName)
+			continue
+		}
+		assert.NoErrorf(t, err, "test: %s", td.testName)
+		if last != nil {
+			assert.Equalf(t, int64(1), new(big.Int).Sub(c.SerialNumber, last).Int64(), "test: %s: serials are sequential", td.testName)
+		}
+		last = c.SerialNumber
+
+		_, err = os.Stat(filepath.Join(ca.Dir, CertsDir, strings.Replace(cert.FormatHex(c.SerialNumber.Bytes()), ":", "", -1)+".pem"))
+		assert.NoErrorf(t, err, "test: %s", td.testName)
+
+		// reopen to check the index was persisted
+		opened, err := Open(ca.Dir)
+		assert.NoErrorf(t, err, "test: %s", td.testName)
+		r := opened.Index.Find(c.SerialNumber)
+		if assert.NotNilf(t, r, "test: %s", td.testName) {
+			assert.Equalf(t, "CN="+td.x509.Subject.CommonName, r.Subject, "test: %s", td.testName)
+			assert.Equalf(t, []string{"DNS:" + td.x509.Subject.CommonName}, r.SANs, "test: %s", td.testName)
+			assert.Equalf(t, td.profile, r.Profile, "test: %s", td.testName)
+			assert.Equalf(t, td.status, r.CurrentStatus(time.Now()), "test: %s", td.testName)
+		}
+	}
+}
+
+func TestIssueCSR(t *testing.T) {
+	ca, k := newTestCA(t, nil)
+	leafKey := newLeafKey(t)
+	csrDER, err := cert.GenerateCSR(&cert.CSRSimplified{
+		Subject:  &cert.Subject{CommonName: "csr.example.com"},
+		DNSNames: []string{"csr.example.com"},
+	}, leafKey)
+	assert.Nil(t, err)
+	csr, err := x509.ParseCertificateRequest(csrDER)
+	assert.Nil(t, err)
+
+	var testData = []struct {
+		testName  string
+		policy    cert.ExtensionPolicy
+		requester string
+		dnsNames  []string
+		errorRet  bool
+	}{
+		{testName: "copy sans", policy: cert.CopySANs, dnsNames: []string{"csr.example.com"}},
+		{testName: "copy none", policy: cert.CopyNone},
+		{testName: "requester recorded", policy: cert.CopySANs, requester: "https://acme.example.com/account/1", dnsNames: []string{"csr.example.com"}},
+		{testName: "unknown policy", policy: "some", errorRet: true},
+	}
+
+	for _, td := range testData {
+		x := newLeaf("", 10)
+		x.Subject, x.DNSNames = nil, nil
+		c, err := ca.IssueCSR(x, csr, k, td.policy, "server", td.requester)
+		if td.errorRet {
+			assert.Errorf(t, err, "test: %s", td.testName)
+			continue
+		}
+		assert.NoErrorf(t, err, "test: %s", td.testName)
+		assert.Equalf(t, "csr.example.com", c.Subject.CommonName, "test: %s", td.testName)
+		assert.Equalf(t, td.dnsNames, c.DNSNames, "test: %s", td.testName)
+
+		r := ca.Index.Find(c.SerialNumber)
+		if assert.NotNilf(t, r, "test: %s", td.testName) {
+			assert.Equalf(t, td.requester, r.Requester, "test: %s", td.testName)
+		}
+	}
+}
+
+func TestRevoke(t *testing.T) {
+	ca, k := newTestCA(t, nil)
+	leafKey := newLeafKey(t)
+	www, err := ca.Issue(newLeaf("www.example.com", 10), leafKey.Public(), k, "server")
+	assert.Nil(t, err)
+
+	var testData = []struct {
+		testName string
+		serial   *big.Int
+		reason   string
+		errorRet bool
+	}{
+		{testName: "revoke", serial: www.SerialNumber, reason: "keyCompromise"},
+		{testName: "already revoked", serial: www.SerialNumber, reason: "superseded", errorRet: true},
+		{testName: "unknown serial", serial: big.NewInt(1), reason: "unspecified", errorRet: true},
+	}
+
+	for _, td := range testData {
+		err := ca.Revoke(td.serial, cert.RevocationReasonChoices[td.reason], time.Now())
+		if td.errorRet {
+			assert.Errorf(t, err, "test: %s", td.testName)
+			continue
+		}
+		assert.NoErrorf(t, err, "test: %s", td.testName)
+
+		// reopen to check the revocation was persisted
+		opened, err := Open(ca.Dir)
+		assert.NoErrorf(t, err, "test: %s", td.testName)
+		r := opened.Index.Find(td.serial)
+		if assert.NotNilf(t, r, "test: %s", td.testName) {
+			assert.Equalf(t, StatusRevoked, r.CurrentStatus(time.Now()), "test: %s", td.testName)
+			assert.Equalf(t, td.reason, r.Reason, "test: %s", td.testName)
+		}
+	}
+}
+
+func TestCRL(t *testing.T) {
+	ca, k := newTestCA(t, nil)
+	leafKey := newLeafKey(t)
+	_, err := ca.Issue(newLeaf("www.example.com", 10), leafKey.Public(), k, "server")
+	assert.Nil(t, err)
+	api, err := ca.Issue(newLeaf("api.example.com", 10), leafKey.Public(), k, "server")
+	assert.Nil(t, err)
+	assert.Nil(t, ca.Revoke(api.SerialNumber, cert.RevocationReasonChoices["keyCompromise"], time.Now()))
+
+	var testData = []struct {
+		testName string
+		number   int64
+	}{
+		{testName: "first CRL", number: 1},
+		{testName: "sequential number", number: 2},
+	}
+
+	for _, td := range testData {
+		now := time.Now()
+		b, err := ca.CRL(k, now)
+		assert.NoErrorf(t, err, "test: %s", td.testName)
+		crl, err := x509.ParseRevocationList(b)
+		assert.NoErrorf(t, err, "test: %s", td.testName)
+		assert.NoErrorf(t, cert.VerifyCRL(crl, ca.Certificate), "test: %s", td.testName)
+		assert.Equalf(t, td.number, crl.Number.Int64(), "test: %s", td.testName)
+		assert.Equalf(t, 7*24*time.Hour, crl.NextUpdate.Sub(crl.ThisUpdate), "test: %s", td.testName)
+		if assert.Equalf(t, 1, len(crl.RevokedCertificateEntries), "test: %s", td.testName) {
+			assert.Equalf(t, api.SerialNumber, crl.RevokedCertificateEntries[0].SerialNumber, "test: %s", td.testName)
+			assert.Equalf(t, 1, crl.RevokedCertificateEntries[0].ReasonCode, "test: %s", td.testName)
+		}
+
+		_, err = os.Stat(filepath.Join(ca.Dir, CRLFile))
+		assert.NoErrorf(t, err, "test: %s", td.testName)
+	}
+}
+
+func TestDistributionURLs(t *testing.T) {
+	ca, k := newTestCA(t, nil)
+	leafKey := newLeafKey(t)
+	ldap := []string{"ldap://ldap.example.com/cn=CA?certificateRevocationList"}
+
+	var testData = []struct {
+		testName    string
+		ocspServers []string
+		crlPoints   []string
+		expectedCRL []string
+		errorRet    bool
+	}{
+		{
+			testName:    "configured URLs",
+			ocspServers: []string{"http://ocsp.example.com"},
+			expectedCRL: []string{"http://pki.example.com/ca.crl"},
+		},
+		{
+			testName:    "informed URLs override the configuration",
+			ocspServers: []string{"http://ocsp.example.com"},
+			crlPoints:   ldap,
+			expectedCRL: ldap,
+		},
+		{
+			testName:    "invalid configured URL",
+			ocspServers: []string{"ocsp.example.com"},
+			errorRet:    true,
+		},
+	}
+
+	for _, td := range testData {
+		ca.Config.OCSPServers = td.ocspServers
+		ca.Config.IssuingCertificateURLs = []string{"http://pki.example.com/ca.crt"}
+		ca.Config.CRLDistributionPoints = []string{"http://pki.example.com/ca.crl"}
+		err := ca.Config.Validate()
+		if td.errorRet {
+			assert.Errorf(t, err, "test: %s", td.testName)
+			continue
+		}
+		assert.NoErrorf(t, err, "test: %s", td.testName)
+
+		x := newLeaf("www.example.com", 10)
+		x.CRLDistributionPoints = td.crlPoints
+		c, err := ca.Issue(x, leafKey.Public(), k, "server")
+		assert.NoErrorf(t, err, "test: %s", td.testName)
+		assert.Equalf(t, td.ocspServers, c.OCSPServer, "test: %s", td.testName)
+		assert.Equalf(t, ca.Config.IssuingCertificateURLs, c.IssuingCertificateURL, "test: %s", td.testName)
+		assert.Equalf(t, td.expectedCRL, c.CRLDistributionPoints, "test: %s", td.testName)
+	}
+}
+
+func TestProfile(t *testing.T) {
+	ca, _ := newTestCA(t, nil)
+	err := os.WriteFile(filepath.Join(ca.Dir, "profiles.yaml"), []byte("profiles:\n  web:\n    days: 30\n"), 0600)
+	assert.Nil(t, err)
+
+	var testData = []struct {
+		testName       string
+		profileFile    string
+		defaultProfile string
+		name           string
+		days           int
+		errorRet       bool
+	}{
+		{testName: "built-in default", defaultProfile: "server", days: cert.BuiltinProfiles["server"].Days},
+		{testName: "profile file default", profileFile: "profiles.yaml", defaultProfile: "web", days: 30},
+		{testName: "built-in by name", profileFile: "profiles.yaml", defaultProfile: "web", name: "client", days: cert.BuiltinProfiles["client"].Days},
+		{testName: "unknown profile", defaultProfile: "server", name: "unknown", errorRet: true},
+	}
+
+	for _, td := range testData {
+		ca.Config.ProfileFile = td.profileFile
+		ca.Config.Profile = td.defaultProfile
+		p, err := ca.Profile(td.name)
+		if td.errorRet {
+			assert.Errorf(t, err, "test: %s", td.testName)
+			continue
+		}
+		assert.NoErrorf(t, err, "test: %s", td.testName)
+		assert.Equalf(t, td.days, p.Days, "test: %s", td.testName)
+	}
+}
@@ -0,0 +1,68 @@
+package ca
+
+import (
+	"fmt"
+
+	"github.com/odacremolbap/xfon/pkg/cert"
+	"gopkg.in/yaml.v2"
+)
+
+// Config holds the CA settings stored at the CA directory
+type Config struct {
+	// Profile used when issuing without an explicit one
+	Profile string `json:"profile" yaml:"profile"`
+	// ProfileFile with custom issuance profiles, relative
+	// paths are resolved from the CA directory
+	ProfileFile string `json:"profileFile,omitempty" yaml:"profileFile,omitempty"`
+	// CRLValidity is the time between CRL updates, as accepted by
+	// cert.ParseDuration
+	CRLValidity string `json:"crlValidity" yaml:"crlValidity"`
+	// OCSPServers, IssuingCertificateURLs and CRLDistributionPoints are
+	// added to every issued certificate that does not set its own
+	OCSPServers            []string `json:"ocspServers,omitempty" yaml:"ocspServers,omitempty"`
+	IssuingCertificateURLs []string `json:"issuingCertificateURLs,omitempty" yaml:"issuingCertificateURLs,omitempty"`
+	CRLDistributionPoints  []string `json:"crlDistributionPoints,omitempty" yaml:"crlDistributionPoints,omitempty"`
+}
+
+// DefaultConfig returns the settings for a new CA
+func DefaultConfig() *Config {
+	return &Config{
+		Profile:     "server",
+		CRLValidity: "7d",
+	}
+}
+
+// Validate checks the configuration values
+func (c *Config) Validate() error {
+	if c.Profile == "" {
+		return fmt.Errorf("default profile must be informed")
+	}
+	d, err := cert.ParseDuration(c.CRLValidity)
+	if err != nil {
+		return fmt.Errorf("invalid CRL validity: %s", err.Error())
+	}
+	if d <= 0 {
+		return fmt.Errorf("CRL validity must be positive")
+	}
+	for _, urls := range [][]string{c.OCSPServers, c.IssuingCertificateURLs, c.CRLDistributionPoints} {
+		for _, u := range urls {
+			if err := cert.ValidateURL(u); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// readConfig parses and validates a configuration file.
+// Unknown fields are rejected
+func readConfig(b []byte) (*Config, error) {
+	c := &Config{}
+	if err := yaml.UnmarshalStrict(b, c); err != nil {
+		return nil, fmt.Errorf("error parsing CA configuration: %s", err.Error())
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
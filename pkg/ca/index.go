@@ -0,0 +1,180 @@
+package ca
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/odacremolbap/xfon/pkg/cert"
+)
+
+// Status of an issued certificate
+type Status string
+
+const (
+	// StatusValid certificates are neither revoked nor expired
+	StatusValid Status = "valid"
+	// StatusRevoked certificates are listed at the CRL
+	StatusRevoked Status = "revoked"
+	// StatusExpired certificates are past their notAfter date. This
+	// status is never stored, it is computed when listing
+	StatusExpired Status = "expired"
+)
+
+// StatusChoices is the set of certificate statuses
+var StatusChoices = map[string]Status{
+	string(StatusValid):   StatusValid,
+	string(StatusRevoked): StatusRevoked,
+	string(StatusExpired): StatusExpired,
+}
+
+// indexVersion is the version of the index format
+const indexVersion = 1
+
+// Record is an issued certificate at the index
+type Record struct {
+	// Serial as colon separated hex
+	Serial  string `json:"serial" yaml:"serial"`
+	Subject string `json:"subject" yaml:"subject"`
+	// SANs prefixed by their type as in DNS:, IP:, URI:,
+	// email: and otherName:
+	SANs    []string `json:"sans,omitempty" yaml:"sans,omitempty"`
+	Profile string   `json:"profile,omitempty" yaml:"profile,omitempty"`
+	// Requester identifies who asked for the certificate when
+	// issued on behalf of someone, such as an ACME account URL
+	Requester string    `json:"requester,omitempty" yaml:"requester,omitempty"`
+	NotBefore time.Time `json:"notBefore" yaml:"notBefore"`
+	NotAfter  time.Time `json:"notAfter" yaml:"notAfter"`
+	// Status is either valid or revoked
+	Status    Status     `json:"status" yaml:"status"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty" yaml:"revokedAt,omitempty"`
+	// Reason name as at cert.RevocationReasonChoices
+	Reason string `json:"reason,omitempty" yaml:"reason,omitempty"`
+}
+
+// Index is the issuance database of a CA, stored as JSON as
+//
+//	{
+//	  "version": 1,
+//	  "certificates": [
+//	    {
+//	      "serial": "7A:3F:...",
+//	      "subject": "CN=www.example.com",
+//	      "sans": ["DNS:www.example.com", "IP:10.0.0.1"],
+//	      "profile": "server",
+//	      "notBefore": "2024-01-01T00:00:00Z",
+//	      "notAfter": "2025-02-01T00:00:00Z",
+//	      "status": "revoked",
+//	      "revokedAt": "2024-06-01T00:00:00Z",
+//	      "reason": "keyCompromise"
+//	    }
+//	  ]
+//	}
+//
+// Certificates are kept in issuance order
+type Index struct {
+	Version      int       `json:"version"`
+	Certificates []*Record `json:"certificates"`
+}
+
+// NewRecord describes an issued certificate
+func NewRecord(c *x509.Certificate, profile string) (*Record, error) {
+	r := &Record{
+		Serial:    cert.FormatHex(c.SerialNumber.Bytes()),
+		Subject:   c.Subject.String(),
+		Profile:   profile,
+		NotBefore: c.NotBefore.UTC(),
+		NotAfter:  c.NotAfter.UTC(),
+		Status:    StatusValid,
+	}
+
+	for _, d := range c.DNSNames {
+		r.SANs = append(r.SANs, "DNS:"+d)
+	}
+	for _, ip := range c.IPAddresses {
+		r.SANs = append(r.SANs, "IP:"+ip.String())
+	}
+	for _, u := range c.URIs {
+		r.SANs = append(r.SANs, "URI:"+u.String())
+	}
+	for _, e := range c.EmailAddresses {
+		r.SANs = append(r.SANs, "email:"+e)
+	}
+	otherNames, err := cert.ParseOtherNames(c.Extensions)
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range otherNames {
+		r.SANs = append(r.SANs, "otherName:"+o.String())
+	}
+
+	return r, nil
+}
+
+// SerialNumber returns the record serial as a number
+func (r *Record) SerialNumber() (*big.Int, error) {
+	n, ok := new(big.Int).SetString(strings.Replace(r.Serial, ":", "", -1), 16)
+	if !ok {
+		return nil, fmt.Errorf("invalid serial %q at index", r.Serial)
+	}
+	return n, nil
+}
+
+// CurrentStatus returns the record status at the informed time,
+// reporting valid certificates past their notAfter date as expired
+func (r *Record) CurrentStatus(now time.Time) Status {
+	if r.Status == StatusValid && now.After(r.NotAfter) {
+		return StatusExpired
+	}
+	return r.Status
+}
+
+// Find returns the record for the serial, nil if not found
+func (i *Index) Find(serial *big.Int) *Record {
+	s := cert.FormatHex(serial.Bytes())
+	for _, r := range i.Certificates {
+		if r.Serial == s {
+			return r
+		}
+	}
+	return nil
+}
+
+// Revoked returns the revoked certificates as CRL entries
+func (i *Index) Revoked() ([]cert.RevokedCertificate, error) {
+	revoked := []cert.RevokedCertificate{}
+	for _, r := range i.Certificates {
+		if r.Status != StatusRevoked {
+			continue
+		}
+		s, err := r.SerialNumber()
+		if err != nil {
+			return nil, err
+		}
+		reason, err := cert.ParseRevocationReason(r.Reason)
+		if err != nil {
+			return nil, err
+		}
+		rc := cert.RevokedCertificate{Serial: s, Reason: reason}
+		if r.RevokedAt != nil {
+			rc.RevokedAt = *r.RevokedAt
+		}
+		revoked = append(revoked, rc)
+	}
+	return revoked, nil
+}
+
+// readIndex parses an index file
+func readIndex(b []byte) (*Index, error) {
+	i := &Index{}
+	if err := json.Unmarshal(b, i); err != nil {
+		return nil, fmt.Errorf("error parsing CA index: %s", err.Error())
+	}
+	if i.Version != indexVersion {
+		return nil, fmt.Errorf("unsupported CA index version %d", i.Version)
+	}
+	return i, nil
+}
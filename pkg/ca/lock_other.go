@@ -0,0 +1,9 @@
+//go:build !unix
+
+package ca
+
+// lock is not supported on this platform, where a CA
+// home must not be used by concurrent processes
+func (ca *CA) lock() (func(), error) {
+	return func() {}, nil
+}
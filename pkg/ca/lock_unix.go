@@ -0,0 +1,26 @@
+//go:build unix
+
+package ca
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// lock takes an exclusive advisory lock on the CA home, waiting for
+// other processes holding it, and returns the function releasing it
+func (ca *CA) lock() (func(), error) {
+	f, err := os.OpenFile(ca.path(LockFile), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("error opening CA lock: %s", err.Error())
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("error locking CA: %s", err.Error())
+	}
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
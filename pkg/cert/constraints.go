@@ -0,0 +1,308 @@
+package cert
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// NameConstraints restrict the names a CA certificate can issue for,
+// as defined at RFC 5280 section 4.2.1.10. The extension is always
+// marked critical.
+//
+// Domains follow the crypto/x509 semantics: "example.com" matches
+// the domain and its subdomains, ".example.com" only its subdomains.
+// Email constraints are either a full mailbox or a domain
+type NameConstraints struct {
+	PermittedDNSDomains     []string
+	ExcludedDNSDomains      []string
+	PermittedIPRanges       []*net.IPNet
+	ExcludedIPRanges        []*net.IPNet
+	PermittedEmailAddresses []string
+	ExcludedEmailAddresses  []string
+	PermittedURIDomains     []string
+	ExcludedURIDomains      []string
+}
+
+// IsEmpty returns whether no constraint is set
+func (n *NameConstraints) IsEmpty() bool {
+	return n == nil ||
+		len(n.PermittedDNSDomains)+len(n.ExcludedDNSDomains)+
+			len(n.PermittedIPRanges)+len(n.ExcludedIPRanges)+
+			len(n.PermittedEmailAddresses)+len(n.ExcludedEmailAddresses)+
+			len(n.PermittedURIDomains)+len(n.ExcludedURIDomains) == 0
+}
+
+// StringToIPNetList transforms a comma separated list of CIDR ranges into an array
+func StringToIPNetList(ipNetList string) ([]*net.IPNet, error) {
+	temp := strings.Split(ipNetList, ",")
+	nets := []*net.IPNet{}
+	for _, t := range temp {
+		if t == "" {
+			continue
+		}
+		_, parsed, err := net.ParseCIDR(t)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse %s as an IP range", t)
+		}
+		nets = append(nets, parsed)
+	}
+	return nets, nil
+}
+
+// nameConstraintsFromCertificate returns the constraints set at a certificate
+func nameConstraintsFromCertificate(c *x509.Certificate) *NameConstraints {
+	return &NameConstraints{
+		PermittedDNSDomains:     c.PermittedDNSDomains,
+		ExcludedDNSDomains:      c.ExcludedDNSDomains,
+		PermittedIPRanges:       c.PermittedIPRanges,
+		ExcludedIPRanges:        c.ExcludedIPRanges,
+		PermittedEmailAddresses: c.PermittedEmailAddresses,
+		ExcludedEmailAddresses:  c.ExcludedEmailAddresses,
+		PermittedURIDomains:     c.PermittedURIDomains,
+		ExcludedURIDomains:      c.ExcludedURIDomains,
+	}
+}
+
+// ValidateConstraints checks that the path length and name constraints
+// of the certificate definition are well formed and consistent with the
+// parent, which is nil for self signed certificates:
+//
+//   - path length and name constraints are only allowed for CAs
+//   - a CA cannot be issued by a parent with path length zero, and its
+//     path length must be lower than the parent's
+//   - permitted subtrees must be inside the parent permitted subtrees,
+//     and outside its excluded subtrees
+//   - DNS names, IP addresses, emails and URIs must be allowed by the parent
+func ValidateConstraints(c *X509Simplified, parent *x509.Certificate) error {
+	if c.MaxPathLen < 0 {
+		return fmt.Errorf("path length must not be negative")
+	}
+	hasPathLen := c.MaxPathLen > 0 || c.MaxPathLenZero
+	nc := nameConstraintsOrEmpty(c)
+	if !c.IsCA && (hasPathLen || !nc.IsEmpty()) {
+		return fmt.Errorf("path length and name constraints are only allowed for CA certificates")
+	}
+	for _, r := range append(append([]*net.IPNet{}, nc.PermittedIPRanges...), nc.ExcludedIPRanges...) {
+		if !isCanonicalIPNet(r) {
+			return fmt.Errorf("IP range %s is not a network address", r)
+		}
+	}
+
+	if parent == nil {
+		return nil
+	}
+
+	if c.IsCA && (parent.MaxPathLen > 0 || parent.MaxPathLenZero) {
+		if parent.MaxPathLen == 0 {
+			return fmt.Errorf("parent path length does not allow issuing CA certificates")
+		}
+		if !hasPathLen {
+			return fmt.Errorf("parent path length is %d, the CA path length must be set lower", parent.MaxPathLen)
+		}
+		if c.MaxPathLen >= parent.MaxPathLen {
+			return fmt.Errorf("path length %d must be lower than the parent path length %d", c.MaxPathLen, parent.MaxPathLen)
+		}
+	}
+
+	p := nameConstraintsFromCertificate(parent)
+	if err := p.checkSubtrees(nc); err != nil {
+		return err
+	}
+
+	for _, d := range c.DNSNames {
+		if err := p.checkDNSName(d); err != nil {
+			return err
+		}
+	}
+	for _, ip := range c.IPAddresses {
+		if err := p.checkIP(ip); err != nil {
+			return err
+		}
+	}
+	for _, e := range c.EmailAddresses {
+		if err := p.checkEmail(e); err != nil {
+			return err
+		}
+	}
+	for _, u := range c.URIs {
+		if err := p.checkURI(u); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// nameConstraintsOrEmpty avoids nil checks on certificates without constraints
+func nameConstraintsOrEmpty(c *X509Simplified) *NameConstraints {
+	if c.NameConstraints == nil {
+		return &NameConstraints{}
+	}
+	return c.NameConstraints
+}
+
+// checkSubtrees fails when the child permitted subtrees are not inside
+// the receiver permitted subtrees, or are inside its excluded subtrees
+func (n *NameConstraints) checkSubtrees(child *NameConstraints) error {
+	for _, d := range child.PermittedDNSDomains {
+		if err := checkWithin("DNS domain", d, n.PermittedDNSDomains, n.ExcludedDNSDomains, domainSubtreeWithin); err != nil {
+			return err
+		}
+	}
+	for _, d := range child.PermittedURIDomains {
+		if err := checkWithin("URI domain", d, n.PermittedURIDomains, n.ExcludedURIDomains, domainSubtreeWithin); err != nil {
+			return err
+		}
+	}
+	for _, e := range child.PermittedEmailAddresses {
+		if err := checkWithin("email", e, n.PermittedEmailAddresses, n.ExcludedEmailAddresses, emailSubtreeWithin); err != nil {
+			return err
+		}
+	}
+	for _, r := range child.PermittedIPRanges {
+		if err := checkIPRangeWithin(r, n.PermittedIPRanges, n.ExcludedIPRanges); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkDNSName fails when the name is not allowed by the constraints
+func (n *NameConstraints) checkDNSName(name string) error {
+	return checkWithin("DNS name", name, n.PermittedDNSDomains, n.ExcludedDNSDomains, domainWithin)
+}
+
+// checkEmail fails when the mailbox is not allowed by the constraints
+func (n *NameConstraints) checkEmail(email string) error {
+	return checkWithin("email", email, n.PermittedEmailAddresses, n.ExcludedEmailAddresses, emailWithin)
+}
+
+// checkURI fails when the URI host is not allowed by the constraints
+func (n *NameConstraints) checkURI(u *url.URL) error {
+	host := u.Hostname()
+	if host == "" && len(n.PermittedURIDomains)+len(n.ExcludedURIDomains) != 0 {
+		return fmt.Errorf("URI %q has no host to check against the parent name constraints", u)
+	}
+	return checkWithin("URI host", host, n.PermittedURIDomains, n.ExcludedURIDomains, domainWithin)
+}
+
+// checkIP fails when the IP address is not allowed by the constraints
+func (n *NameConstraints) checkIP(ip net.IP) error {
+	permitted := len(n.PermittedIPRanges) == 0
+	for _, r := range n.PermittedIPRanges {
+		if r.Contains(ip) {
+			permitted = true
+			break
+		}
+	}
+	if !permitted {
+		return fmt.Errorf("IP address %s is not permitted by the parent name constraints", ip)
+	}
+	for _, r := range n.ExcludedIPRanges {
+		if r.Contains(ip) {
+			return fmt.Errorf("IP address %s is excluded by the parent name constraint %s", ip, r)
+		}
+	}
+	return nil
+}
+
+// checkWithin fails when value is not within any of the permitted
+// constraints, if any, or is within one of the excluded ones
+func checkWithin(kind, value string, permitted, excluded []string, within func(string, string) bool) error {
+	found := len(permitted) == 0
+	for _, p := range permitted {
+		if within(value, p) {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("%s %q is not permitted by the parent name constraints %v", kind, value, permitted)
+	}
+	for _, e := range excluded {
+		if within(value, e) {
+			return fmt.Errorf("%s %q is excluded by the parent name constraint %q", kind, value, e)
+		}
+	}
+	return nil
+}
+
+// checkIPRangeWithin fails when the range is not inside any of the
+// permitted ranges, if any, or is inside one of the excluded ones
+func checkIPRangeWithin(r *net.IPNet, permitted, excluded []*net.IPNet) error {
+	found := len(permitted) == 0
+	for _, p := range permitted {
+		if ipNetWithin(r, p) {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("IP range %s is not permitted by the parent name constraints", r)
+	}
+	for _, e := range excluded {
+		if ipNetWithin(r, e) {
+			return fmt.Errorf("IP range %s is excluded by the parent name constraint %s", r, e)
+		}
+	}
+	return nil
+}
+
+// domainWithin returns whether the domain name matches the constraint
+func domainWithin(name, constraint string) bool {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	constraint = strings.ToLower(constraint)
+	switch {
+	case constraint == "":
+		return true
+	case strings.HasPrefix(constraint, "."):
+		return strings.HasSuffix(name, constraint)
+	}
+	return name == constraint || strings.HasSuffix(name, "."+constraint)
+}
+
+// domainSubtreeWithin returns whether every name matching the child
+// domain constraint also matches the parent one
+func domainSubtreeWithin(child, parent string) bool {
+	if strings.HasPrefix(child, ".") && !strings.HasPrefix(parent, ".") {
+		return domainWithin(child[1:], parent)
+	}
+	return domainWithin(child, parent)
+}
+
+// emailWithin returns whether the mailbox matches the constraint, either
+// a full mailbox or a domain
+func emailWithin(email, constraint string) bool {
+	if strings.Contains(constraint, "@") {
+		return strings.EqualFold(email, constraint)
+	}
+	at := strings.LastIndex(email, "@")
+	return domainWithin(email[at+1:], constraint)
+}
+
+// emailSubtreeWithin returns whether every mailbox matching the child
+// email constraint also matches the parent one
+func emailSubtreeWithin(child, parent string) bool {
+	if strings.Contains(child, "@") {
+		return emailWithin(child, parent)
+	}
+	if strings.Contains(parent, "@") {
+		return false
+	}
+	return domainSubtreeWithin(child, parent)
+}
+
+// ipNetWithin returns whether the child range is inside the parent range
+func ipNetWithin(child, parent *net.IPNet) bool {
+	co, cb := child.Mask.Size()
+	po, pb := parent.Mask.Size()
+	return cb == pb && co >= po && parent.Contains(child.IP)
+}
+
+// isCanonicalIPNet returns whether the range has no host bits set
+func isCanonicalIPNet(r *net.IPNet) bool {
+	return r.IP.Mask(r.Mask).Equal(r.IP)
+}
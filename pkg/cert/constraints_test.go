@@ -0,0 +1,258 @@
+package cert
+
+import (
+	"crypto/x509"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/odacremolbap/xfon/pkg/key"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStringToIPNetList(t *testing.T) {
+	var testData = []struct {
+		testName string
+		ranges   string
+		expected []string
+		errorRet bool
+	}{
+		{testName: "empty", ranges: "", expected: []string{}},
+		{testName: "ipv4 and ipv6", ranges: "10.0.0.0/8,fd00::/8", expected: []string{"10.0.0.0/8", "fd00::/8"}},
+		{testName: "host bits are cleared", ranges: "10.1.2.3/16", expected: []string{"10.1.0.0/16"}},
+		{testName: "not a range", ranges: "10.0.0.1", errorRet: true},
+	}
+
+	for _, td := range testData {
+		r, err := StringToIPNetList(td.ranges)
+		if td.errorRet {
+			assert.Errorf(t, err, "test: %s", td.testName)
+			continue
+		}
+		assert.NoErrorf(t, err, "test: %s", td.testName)
+		s := []string{}
+		for _, n := range r {
+			s = append(s, n.String())
+		}
+		assert.Equal(t, td.expected, s, "test: %s", td.testName)
+	}
+}
+
+func TestValidateConstraints(t *testing.T) {
+	k, err := key.GenerateKey(&key.Options{Type: key.ECDSA, Curve: "P-256"})
+	assert.Nil(t, err)
+	newParent := func(x *X509Simplified) *x509.Certificate {
+		x.Subject = &Subject{CommonName: "parent"}
+		x.NotBefore = time.Now().Add(-time.Hour).UTC()
+		x.NotAfter = time.Now().AddDate(0, 0, 10).UTC()
+		x.IsCA = true
+		x.KeyUsage = x509.KeyUsageCertSign
+		b, err := GenerateX509SelfSignedCertificate(x, k)
+		assert.Nil(t, err)
+		c, err := x509.ParseCertificate(b)
+		assert.Nil(t, err)
+		return c
+	}
+	ipNet := func(s string) *net.IPNet {
+		_, n, _ := net.ParseCIDR(s)
+		return n
+	}
+
+	unlimited := newParent(&X509Simplified{})
+	pathLenZero := newParent(&X509Simplified{MaxPathLenZero: true})
+	pathLenTwo := newParent(&X509Simplified{MaxPathLen: 2})
+	constrained := newParent(&X509Simplified{NameConstraints: &NameConstraints{
+		PermittedDNSDomains:     []string{"team.example.com"},
+		ExcludedDNSDomains:      []string{"secret.team.example.com"},
+		PermittedIPRanges:       []*net.IPNet{ipNet("10.1.0.0/16")},
+		ExcludedIPRanges:        []*net.IPNet{ipNet("10.1.255.0/24")},
+		PermittedEmailAddresses: []string{"example.com"},
+		PermittedURIDomains:     []string{".example.com"},
+	}})
+
+	var testData = []struct {
+		testName string
+		x        *X509Simplified
+		parent   *x509.Certificate
+		errorRet bool
+	}{
+		{
+			testName: "self signed CA with path length",
+			x:        &X509Simplified{IsCA: true, MaxPathLen: 1},
+		},
+		{
+			testName: "self signed CA with name constraints",
+			x:        &X509Simplified{IsCA: true, NameConstraints: &NameConstraints{PermittedDNSDomains: []string{"example.com"}}},
+		},
+		{
+			testName: "path length on leaf",
+			x:        &X509Simplified{MaxPathLenZero: true},
+			errorRet: true,
+		},
+		{
+			testName: "name constraints on leaf",
+			x:        &X509Simplified{NameConstraints: &NameConstraints{ExcludedDNSDomains: []string{"example.com"}}},
+			errorRet: true,
+		},
+		{
+			testName: "negative path length",
+			x:        &X509Simplified{IsCA: true, MaxPathLen: -1},
+			errorRet: true,
+		},
+		{
+			testName: "non canonical IP range",
+			x:        &X509Simplified{IsCA: true, NameConstraints: &NameConstraints{PermittedIPRanges: []*net.IPNet{{IP: net.ParseIP("10.0.0.1").To4(), Mask: net.CIDRMask(8, 32)}}}},
+			errorRet: true,
+		},
+		{
+			testName: "CA under unlimited parent",
+			x:        &X509Simplified{IsCA: true},
+			parent:   unlimited,
+		},
+		{
+			testName: "leaf under path length zero parent",
+			x:        &X509Simplified{DNSNames: []string{"foo.example.com"}},
+			parent:   pathLenZero,
+		},
+		{
+			testName: "CA under path length zero parent",
+			x:        &X509Simplified{IsCA: true, MaxPathLenZero: true},
+			parent:   pathLenZero,
+			errorRet: true,
+		},
+		{
+			testName: "CA with lower path length",
+			x:        &X509Simplified{IsCA: true, MaxPathLen: 1},
+			parent:   pathLenTwo,
+		},
+		{
+			testName: "CA with same path length",
+			x:        &X509Simplified{IsCA: true, MaxPathLen: 2},
+			parent:   pathLenTwo,
+			errorRet: true,
+		},
+		{
+			testName: "CA without path length under limited parent",
+			x:        &X509Simplified{IsCA: true},
+			parent:   pathLenTwo,
+			errorRet: true,
+		},
+		{
+			testName: "subtrees inside parent",
+			x: &X509Simplified{IsCA: true, NameConstraints: &NameConstraints{
+				PermittedDNSDomains:     []string{"a.team.example.com", ".b.team.example.com"},
+				PermittedIPRanges:       []*net.IPNet{ipNet("10.1.2.0/24")},
+				PermittedEmailAddresses: []string{"ops@example.com", "sub.example.com"},
+				PermittedURIDomains:     []string{"svc.example.com"},
+			}},
+			parent: constrained,
+		},
+		{
+			testName: "DNS subtree outside parent",
+			x:        &X509Simplified{IsCA: true, NameConstraints: &NameConstraints{PermittedDNSDomains: []string{"example.com"}}},
+			parent:   constrained,
+			errorRet: true,
+		},
+		{
+			testName: "DNS subtree excluded by parent",
+			x:        &X509Simplified{IsCA: true, NameConstraints: &NameConstraints{PermittedDNSDomains: []string{"x.secret.team.example.com"}}},
+			parent:   constrained,
+			errorRet: true,
+		},
+		{
+			testName: "IP subtree outside parent",
+			x:        &X509Simplified{IsCA: true, NameConstraints: &NameConstraints{PermittedIPRanges: []*net.IPNet{ipNet("10.0.0.0/8")}}},
+			parent:   constrained,
+			errorRet: true,
+		},
+		{
+			testName: "IP subtree excluded by parent",
+			x:        &X509Simplified{IsCA: true, NameConstraints: &NameConstraints{PermittedIPRanges: []*net.IPNet{ipNet("10.1.255.128/25")}}},
+			parent:   constrained,
+			errorRet: true,
+		},
+		{
+			testName: "email subtree outside parent",
+			x:        &X509Simplified{IsCA: true, NameConstraints: &NameConstraints{PermittedEmailAddresses: []string{"ops@example.org"}}},
+			parent:   constrained,
+			errorRet: true,
+		},
+		{
+			testName: "URI subtree outside parent",
+			x:        &X509Simplified{IsCA: true, NameConstraints: &NameConstraints{PermittedURIDomains: []string{"example.com"}}},
+			parent:   constrained,
+			errorRet: true,
+		},
+		{
+			testName: "leaf names inside parent",
+			x:        &X509Simplified{DNSNames: []string{"team.example.com", "www.team.example.com"}, IPAddresses: []net.IP{net.ParseIP("10.1.0.1")}},
+			parent:   constrained,
+		},
+		{
+			testName: "leaf DNS name outside parent",
+			x:        &X509Simplified{DNSNames: []string{"www.example.com"}},
+			parent:   constrained,
+			errorRet: true,
+		},
+		{
+			testName: "leaf DNS name excluded by parent",
+			x:        &X509Simplified{DNSNames: []string{"secret.team.example.com"}},
+			parent:   constrained,
+			errorRet: true,
+		},
+		{
+			testName: "leaf IP outside parent",
+			x:        &X509Simplified{IPAddresses: []net.IP{net.ParseIP("10.2.0.1")}},
+			parent:   constrained,
+			errorRet: true,
+		},
+		{
+			testName: "leaf IP excluded by parent",
+			x:        &X509Simplified{IPAddresses: []net.IP{net.ParseIP("10.1.255.1")}},
+			parent:   constrained,
+			errorRet: true,
+		},
+	}
+
+	for _, td := range testData {
+		err := ValidateConstraints(td.x, td.parent)
+		if td.errorRet {
+			assert.Errorf(t, err, "test: %s", td.testName)
+		} else {
+			assert.NoErrorf(t, err, "test: %s", td.testName)
+		}
+	}
+}
+
+func TestConstrainedChainVerifies(t *testing.T) {
+	root, rootKey := newTestCA(t, "root")
+	team, teamKey := newTestLeaf(t, &X509Simplified{
+		Subject:        &Subject{CommonName: "team"},
+		NotBefore:      time.Now().Add(-time.Hour).UTC(),
+		NotAfter:       time.Now().AddDate(0, 0, 10).UTC(),
+		IsCA:           true,
+		KeyUsage:       x509.KeyUsageCertSign,
+		MaxPathLenZero: true,
+		NameConstraints: &NameConstraints{
+			PermittedDNSDomains: []string{"team.example.com"},
+		},
+	}, root, rootKey)
+	assert.True(t, team.MaxPathLenZero)
+	assert.True(t, team.PermittedDNSDomainsCritical)
+	assert.Equal(t, []string{"team.example.com"}, team.PermittedDNSDomains)
+
+	leaf, _ := newTestLeaf(t, &X509Simplified{
+		Subject:   &Subject{CommonName: "leaf"},
+		DNSNames:  []string{"www.team.example.com"},
+		NotBefore: time.Now().Add(-time.Hour).UTC(),
+		NotAfter:  time.Now().AddDate(0, 0, 10).UTC(),
+	}, team, teamKey)
+
+	_, err := Verify(leaf, &VerifyOptions{
+		Roots:         []*x509.Certificate{root},
+		Intermediates: []*x509.Certificate{team},
+		Name:          "www.team.example.com",
+	})
+	assert.Nil(t, err)
+}
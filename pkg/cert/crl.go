@@ -0,0 +1,270 @@
+package cert
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RevocationReasonChoices maps names to the CRL reason codes
+// defined at RFC 5280 section 5.3.1
+var RevocationReasonChoices = map[string]int{
+	"unspecified":          0,
+	"keyCompromise":        1,
+	"cACompromise":         2,
+	"affiliationChanged":   3,
+	"superseded":           4,
+	"cessationOfOperation": 5,
+	"certificateHold":      6,
+	"removeFromCRL":        8,
+	"privilegeWithdrawn":   9,
+	"aACompromise":         10,
+}
+
+// RevocationReasonToString returns the name of a CRL reason code
+func RevocationReasonToString(reason int) string {
+	for name, v := range RevocationReasonChoices {
+		if v == reason {
+			return name
+		}
+	}
+	return fmt.Sprintf("reason(%d)", reason)
+}
+
+// ValidRevocationReason returns whether the CRL reason code is defined
+func ValidRevocationReason(reason int) bool {
+	for _, v := range RevocationReasonChoices {
+		if v == reason {
+			return true
+		}
+	}
+	return false
+}
+
+// RevokedCertificate is an entry at a CRL
+type RevokedCertificate struct {
+	Serial    *big.Int
+	RevokedAt time.Time
+	Reason    int
+}
+
+// CRLSimplified simplified certificate revocation list
+type CRLSimplified struct {
+	Number     *big.Int
+	ThisUpdate time.Time
+	NextUpdate time.Time
+	Revoked    []RevokedCertificate
+}
+
+// GenerateCRL creates a v2 CRL signed by the issuer, including the CRL
+// number and authority key identifier extensions. The issuer must have
+// the KeyUsageCRLSign usage
+func GenerateCRL(c *CRLSimplified, issuer *x509.Certificate, signingKey crypto.Signer) ([]byte, error) {
+	if err := ValidateCRLIssuer(issuer, signingKey); err != nil {
+		return nil, err
+	}
+	if c.Number == nil || c.Number.Sign() < 0 {
+		return nil, fmt.Errorf("CRL number must be a non negative integer")
+	}
+
+	template := &x509.RevocationList{
+		Number:     c.Number,
+		ThisUpdate: c.ThisUpdate,
+		NextUpdate: c.NextUpdate,
+	}
+	for _, r := range c.Revoked {
+		template.RevokedCertificateEntries = append(template.RevokedCertificateEntries, x509.RevocationListEntry{
+			SerialNumber:   r.Serial,
+			RevocationTime: r.RevokedAt,
+			ReasonCode:     r.Reason,
+		})
+	}
+
+	return x509.CreateRevocationList(rand.Reader, template, issuer, signingKey)
+}
+
+// ValidateCRLIssuer checks that the issuer certificate can sign
+// certificates with the signing key, and is also allowed to sign CRLs
+func ValidateCRLIssuer(issuer *x509.Certificate, signingKey crypto.Signer) error {
+	if err := ValidateIssuer(issuer, signingKey); err != nil {
+		return err
+	}
+	if issuer.KeyUsage&x509.KeyUsageCRLSign == 0 {
+		return fmt.Errorf("issuer certificate does not have KeyUsageCRLSign usage")
+	}
+	return nil
+}
+
+// WriteCRLPEM serializes the CRL into a PEM string
+func WriteCRLPEM(crl []byte) (string, error) {
+	var p bytes.Buffer
+	err := pem.Encode(
+		&p,
+		&pem.Block{
+			Type:  "X509 CRL",
+			Bytes: crl,
+		})
+	if err != nil {
+		return "", fmt.Errorf("error PEM encoding CRL: %s", err.Error())
+	}
+
+	return p.String(), nil
+}
+
+// ReadCRL reads a CRL in PEM or DER format
+func ReadCRL(crl []byte) (*x509.RevocationList, error) {
+	der := crl
+	if b, _ := pem.Decode(crl); b != nil {
+		der = b.Bytes
+	}
+
+	c, err := x509.ParseRevocationList(der)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse CRL: %s", err.Error())
+	}
+
+	return c, nil
+}
+
+// VerifyCRL checks that the CRL was signed by the issuer
+func VerifyCRL(crl *x509.RevocationList, issuer *x509.Certificate) error {
+	if err := crl.CheckSignatureFrom(issuer); err != nil {
+		return fmt.Errorf("invalid CRL signature: %s", err.Error())
+	}
+	return nil
+}
+
+// ParseRevokedList reads revoked certificate entries, one per line as
+//
+//	<serial> [reason] [RFC3339 revocation time]
+//
+// where serial is written as accepted by ParseSerial and reason is a name
+// at RevocationReasonChoices or a number. Entries without time are
+// revoked at the informed default. Empty lines and lines starting with
+// # are ignored
+func ParseRevokedList(b []byte, defaultTime time.Time) ([]RevokedCertificate, error) {
+	revoked := []RevokedCertificate{}
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) > 3 {
+			return nil, fmt.Errorf("line %d: too many fields", n)
+		}
+
+		serial, err := ParseSerial(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", n, err.Error())
+		}
+		r := RevokedCertificate{
+			Serial:    serial,
+			RevokedAt: defaultTime,
+		}
+
+		if len(fields) > 1 {
+			if r.Reason, err = ParseRevocationReason(fields[1]); err != nil {
+				return nil, fmt.Errorf("line %d: %s", n, err.Error())
+			}
+		}
+		if len(fields) > 2 {
+			if r.RevokedAt, err = time.Parse(time.RFC3339, fields[2]); err != nil {
+				return nil, fmt.Errorf("line %d: %s", n, err.Error())
+			}
+		}
+
+		revoked = append(revoked, r)
+	}
+
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return revoked, nil
+}
+
+// ParseRevocationReason reads a reason by name or by number
+func ParseRevocationReason(reason string) (int, error) {
+	if v, ok := RevocationReasonChoices[reason]; ok {
+		return v, nil
+	}
+	if v, err := strconv.Atoi(reason); err == nil {
+		if ValidRevocationReason(v) {
+			return v, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown revocation reason: %s", reason)
+}
+
+// CRLInfo describes a CRL and the certificates it revokes
+type CRLInfo struct {
+	Issuer             string        `json:"issuer" yaml:"issuer"`
+	Number             string        `json:"number" yaml:"number"`
+	ThisUpdate         time.Time     `json:"thisUpdate" yaml:"thisUpdate"`
+	NextUpdate         time.Time     `json:"nextUpdate" yaml:"nextUpdate"`
+	AuthorityKeyID     string        `json:"authorityKeyId" yaml:"authorityKeyId"`
+	SignatureAlgorithm string        `json:"signatureAlgorithm" yaml:"signatureAlgorithm"`
+	Revoked            []RevokedInfo `json:"revoked" yaml:"revoked"`
+}
+
+// RevokedInfo is a revoked entry at CRLInfo
+type RevokedInfo struct {
+	Serial    string    `json:"serial" yaml:"serial"`
+	RevokedAt time.Time `json:"revokedAt" yaml:"revokedAt"`
+	Reason    string    `json:"reason" yaml:"reason"`
+}
+
+// NewCRLInfo returns the informational representation of a CRL,
+// revoked entries sorted by serial
+func NewCRLInfo(crl *x509.RevocationList) *CRLInfo {
+	i := &CRLInfo{
+		Issuer:             crl.Issuer.String(),
+		Number:             "",
+		ThisUpdate:         crl.ThisUpdate.UTC(),
+		NextUpdate:         crl.NextUpdate.UTC(),
+		AuthorityKeyID:     FormatHex(crl.AuthorityKeyId),
+		SignatureAlgorithm: crl.SignatureAlgorithm.String(),
+		Revoked:            []RevokedInfo{},
+	}
+	if crl.Number != nil {
+		i.Number = crl.Number.String()
+	}
+
+	entries := append([]x509.RevocationListEntry{}, crl.RevokedCertificateEntries...)
+	sort.Slice(entries, func(a, b int) bool {
+		return entries[a].SerialNumber.Cmp(entries[b].SerialNumber) < 0
+	})
+	for _, e := range entries {
+		i.Revoked = append(i.Revoked, RevokedInfo{
+			Serial:    FormatHex(e.SerialNumber.Bytes()),
+			RevokedAt: e.RevocationTime.UTC(),
+			Reason:    RevocationReasonToString(e.ReasonCode),
+		})
+	}
+
+	return i
+}
+
+// ParseDuration reads a duration as accepted by time.ParseDuration,
+// also accepting a number of days as in "30d"
+func ParseDuration(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
@@ -0,0 +1,224 @@
+package cert
+
+import (
+	"crypto"
+	"crypto/x509"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/odacremolbap/xfon/pkg/key"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateCRL(t *testing.T) {
+	ca, caKey := newTestCA(t, "ca")
+	other, otherKey := newTestCA(t, "other")
+	noCRLSign, noCRLSignKey := newTestLeaf(t, &X509Simplified{
+		Subject:   &Subject{CommonName: "no-crl-sign"},
+		NotBefore: time.Now().Add(-time.Hour).UTC(),
+		NotAfter:  time.Now().AddDate(0, 0, 10).UTC(),
+		IsCA:      true,
+		KeyUsage:  x509.KeyUsageCertSign,
+	}, ca, caKey)
+
+	rsaKey, err := key.GenerateKey(&key.Options{Type: key.RSA, Bits: 2048})
+	assert.Nil(t, err)
+	edKey, err := key.GenerateKey(&key.Options{Type: key.Ed25519})
+	assert.Nil(t, err)
+	caFor := func(k crypto.Signer) *x509.Certificate {
+		b, err := GenerateX509SelfSignedCertificate(&X509Simplified{
+			Subject:   &Subject{CommonName: "ca"},
+			NotBefore: time.Now().Add(-time.Hour).UTC(),
+			NotAfter:  time.Now().AddDate(0, 0, 100).UTC(),
+			IsCA:      true,
+			KeyUsage:  x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		}, k)
+		assert.Nil(t, err)
+		c, err := x509.ParseCertificate(b)
+		assert.Nil(t, err)
+		return c
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	revoked := []RevokedCertificate{
+		{Serial: big.NewInt(10), RevokedAt: now.Add(-time.Hour), Reason: RevocationReasonChoices["keyCompromise"]},
+		{Serial: big.NewInt(2), RevokedAt: now, Reason: RevocationReasonChoices["superseded"]},
+	}
+
+	var testData = []struct {
+		testName   string
+		issuer     *x509.Certificate
+		signingKey crypto.Signer
+		revoked    []RevokedCertificate
+		errorRet   bool
+	}{
+		{
+			testName:   "ecdsa issuer",
+			issuer:     ca,
+			signingKey: caKey,
+			revoked:    revoked,
+		},
+		{
+			testName:   "rsa issuer",
+			issuer:     caFor(rsaKey),
+			signingKey: rsaKey,
+			revoked:    revoked,
+		},
+		{
+			testName:   "ed25519 issuer",
+			issuer:     caFor(edKey),
+			signingKey: edKey,
+			revoked:    revoked,
+		},
+		{
+			testName:   "empty CRL",
+			issuer:     other,
+			signingKey: otherKey,
+		},
+		{
+			testName:   "key not matching issuer",
+			issuer:     ca,
+			signingKey: otherKey,
+			errorRet:   true,
+		},
+		{
+			testName:   "issuer without CRL sign usage",
+			issuer:     noCRLSign,
+			signingKey: noCRLSignKey,
+			errorRet:   true,
+		},
+	}
+
+	for _, td := range testData {
+		b, err := GenerateCRL(&CRLSimplified{
+			Number:     big.NewInt(42),
+			ThisUpdate: now,
+			NextUpdate: now.AddDate(0, 0, 7),
+			Revoked:    td.revoked,
+		}, td.issuer, td.signingKey)
+		if td.errorRet {
+			assert.Errorf(t, err, "test: %s", td.testName)
+			continue
+		}
+		assert.NoErrorf(t, err, "test: %s", td.testName)
+
+		p, err := WriteCRLPEM(b)
+		assert.NoErrorf(t, err, "test: %s", td.testName)
+		crl, err := ReadCRL([]byte(p))
+		assert.NoErrorf(t, err, "test: %s", td.testName)
+
+		assert.NoErrorf(t, VerifyCRL(crl, td.issuer), "test: %s", td.testName)
+		assert.Errorf(t, VerifyCRL(crl, noCRLSign), "test: %s", td.testName)
+		assert.Equal(t, int64(42), crl.Number.Int64(), "test: %s", td.testName)
+		assert.Equal(t, td.issuer.SubjectKeyId, crl.AuthorityKeyId, "test: %s", td.testName)
+		assert.Equal(t, len(td.revoked), len(crl.RevokedCertificateEntries), "test: %s", td.testName)
+
+		info := NewCRLInfo(crl)
+		assert.Equal(t, "42", info.Number, "test: %s", td.testName)
+		if len(td.revoked) != 0 {
+			assert.Equal(t, "02", info.Revoked[0].Serial, "test: %s", td.testName)
+			assert.Equal(t, "superseded", info.Revoked[0].Reason, "test: %s", td.testName)
+			assert.Equal(t, "0A", info.Revoked[1].Serial, "test: %s", td.testName)
+			assert.Equal(t, "keyCompromise", info.Revoked[1].Reason, "test: %s", td.testName)
+			assert.Equal(t, now.Add(-time.Hour), info.Revoked[1].RevokedAt, "test: %s", td.testName)
+		}
+	}
+}
+
+func TestParseRevokedList(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	at, _ := time.Parse(time.RFC3339, "2020-01-02T03:04:05Z")
+
+	var testData = []struct {
+		testName string
+		list     string
+		expected []RevokedCertificate
+		errorRet bool
+	}{
+		{
+			testName: "serial only",
+			list:     "12345\n",
+			expected: []RevokedCertificate{{Serial: big.NewInt(12345), RevokedAt: now}},
+		},
+		{
+			testName: "comments, reasons and times",
+			list: `# revoked certificates
+0x1f keyCompromise
+
+0a:0b superseded 2020-01-02T03:04:05Z
+7 5
+`,
+			expected: []RevokedCertificate{
+				{Serial: big.NewInt(0x1f), RevokedAt: now, Reason: 1},
+				{Serial: big.NewInt(0x0a0b), RevokedAt: at, Reason: 4},
+				{Serial: big.NewInt(7), RevokedAt: now, Reason: 5},
+			},
+		},
+		{
+			testName: "empty list",
+			list:     "",
+			expected: []RevokedCertificate{},
+		},
+		{
+			testName: "invalid serial",
+			list:     "abc\n",
+			errorRet: true,
+		},
+		{
+			testName: "unknown reason",
+			list:     "1 stolen\n",
+			errorRet: true,
+		},
+		{
+			testName: "unassigned reason code",
+			list:     "1 7\n",
+			errorRet: true,
+		},
+		{
+			testName: "invalid time",
+			list:     "1 superseded yesterday\n",
+			errorRet: true,
+		},
+		{
+			testName: "too many fields",
+			list:     "1 superseded 2020-01-02T03:04:05Z extra\n",
+			errorRet: true,
+		},
+	}
+
+	for _, td := range testData {
+		r, err := ParseRevokedList([]byte(td.list), now)
+		if td.errorRet {
+			assert.Errorf(t, err, "test: %s", td.testName)
+			continue
+		}
+		assert.NoErrorf(t, err, "test: %s", td.testName)
+		assert.Equal(t, td.expected, r, "test: %s", td.testName)
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	var testData = []struct {
+		testName string
+		duration string
+		expected time.Duration
+		errorRet bool
+	}{
+		{testName: "days", duration: "7d", expected: 7 * 24 * time.Hour},
+		{testName: "hours", duration: "12h", expected: 12 * time.Hour},
+		{testName: "invalid days", duration: "xd", errorRet: true},
+		{testName: "invalid", duration: "soon", errorRet: true},
+	}
+
+	for _, td := range testData {
+		d, err := ParseDuration(td.duration)
+		if td.errorRet {
+			assert.Errorf(t, err, "test: %s", td.testName)
+			continue
+		}
+		assert.NoErrorf(t, err, "test: %s", td.testName)
+		assert.Equal(t, td.expected, d, "test: %s", td.testName)
+	}
+}
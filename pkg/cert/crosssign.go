@@ -0,0 +1,27 @@
+package cert
+
+import (
+	"crypto/x509"
+)
+
+// CrossSignTemplate returns the definition of a certificate reproducing c
+// under a different issuer. The subject and subject key identifier are
+// kept byte by byte, so that certificates issued by c chain to either of
+// them, along with the validity, subject alternative names, usages,
+// constraints and extensions. The authority information access and CRL
+// distribution points refer to the issuer of c and are not kept. The
+// serial is left empty so that a new one is assigned
+func CrossSignTemplate(c *x509.Certificate) (*X509Simplified, error) {
+	x, err := RenewalTemplate(c, c.NotBefore, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	x.NotAfter = c.NotAfter.UTC()
+	x.RawSubject = append([]byte{}, c.RawSubject...)
+	x.SubjectKeyID = append([]byte{}, c.SubjectKeyId...)
+	x.OCSPServer = nil
+	x.IssuingCertificateURL = nil
+	x.CRLDistributionPoints = nil
+	return x, nil
+}
@@ -0,0 +1,124 @@
+package cert
+
+import (
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"testing"
+	"time"
+
+	"github.com/odacremolbap/xfon/pkg/key"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCrossSignTemplate(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	newCA := func(cn string, o *key.Options) (*x509.Certificate, crypto.Signer) {
+		k, err := key.GenerateKey(o)
+		assert.Nil(t, err)
+		b, err := GenerateX509SelfSignedCertificate(&X509Simplified{
+			Subject:   &Subject{CommonName: cn},
+			NotBefore: now.Add(-time.Hour),
+			NotAfter:  now.AddDate(10, 0, 0),
+			IsCA:      true,
+			KeyUsage:  x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		}, k)
+		assert.Nil(t, err)
+		c, err := x509.ParseCertificate(b)
+		assert.Nil(t, err)
+		return c, k
+	}
+	oldRoot, oldRootKey := newCA("old root", &key.Options{Type: key.ECDSA, Curve: "P-256"})
+	newRoot, newRootKey := newCA("new root", &key.Options{Type: key.RSA, Bits: 2048})
+
+	// a multi-valued RDN written as UTF8String, which the
+	// simplified subject would encode differently
+	rawSubject, err := asn1.Marshal(pkix.RDNSequence{{
+		{Type: oidOrganization, Value: asn1.RawValue{Tag: asn1.TagUTF8String, Bytes: []byte("Acme")}},
+		{Type: oidCommonName, Value: asn1.RawValue{Tag: asn1.TagUTF8String, Bytes: []byte("intermediate")}},
+	}})
+	assert.Nil(t, err)
+	policy := pkix.Extension{Id: asn1.ObjectIdentifier{2, 5, 29, 32}, Value: []byte{0x30, 0x06, 0x30, 0x04, 0x06, 0x02, 0x2a, 0x03}}
+
+	intermediateKey, err := key.GenerateKey(&key.Options{Type: key.ECDSA, Curve: "P-256"})
+	assert.Nil(t, err)
+	b, err := GenerateX509Certificate(&X509Simplified{
+		Subject:               &Subject{CommonName: "intermediate", Organization: []string{"Acme"}},
+		RawSubject:            rawSubject,
+		NotBefore:             now.AddDate(0, 0, -10),
+		NotAfter:              now.AddDate(5, 0, 0),
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		NameConstraints:       &NameConstraints{PermittedDNSDomains: []string{"example.com"}},
+		OCSPServer:            []string{"http://ocsp.example.com"},
+		CRLDistributionPoints: []string{"http://pki.example.com/old.crl"},
+		SubjectKeyIDMethod:    SKIRFC7093Method1,
+		ExtraExtensions:       []pkix.Extension{policy},
+	}, oldRoot, intermediateKey.Public(), oldRootKey)
+	assert.Nil(t, err)
+	intermediate, err := x509.ParseCertificate(b)
+	assert.Nil(t, err)
+
+	x, err := CrossSignTemplate(intermediate)
+	assert.Nil(t, err)
+	assert.Nil(t, x.Serial)
+	b, err = GenerateX509Certificate(x, newRoot, intermediate.PublicKey, newRootKey)
+	assert.Nil(t, err)
+	cross, err := x509.ParseCertificate(b)
+	assert.Nil(t, err)
+
+	assert.Equal(t, intermediate.RawSubject, cross.RawSubject)
+	assert.Equal(t, intermediate.RawSubjectPublicKeyInfo, cross.RawSubjectPublicKeyInfo)
+	assert.Equal(t, intermediate.SubjectKeyId, cross.SubjectKeyId)
+	assert.Equal(t, newRoot.SubjectKeyId, cross.AuthorityKeyId)
+	assert.Equal(t, newRoot.RawSubject, cross.RawIssuer)
+	assert.NotEqual(t, intermediate.SerialNumber, cross.SerialNumber)
+	assert.Equal(t, intermediate.NotBefore, cross.NotBefore)
+	assert.Equal(t, intermediate.NotAfter, cross.NotAfter)
+	assert.Equal(t, intermediate.MaxPathLenZero, cross.MaxPathLenZero)
+	assert.Equal(t, intermediate.PermittedDNSDomains, cross.PermittedDNSDomains)
+	assert.Equal(t, intermediate.KeyUsage, cross.KeyUsage)
+	assert.Empty(t, cross.OCSPServer)
+	assert.Empty(t, cross.CRLDistributionPoints)
+	hasPolicy := false
+	for _, e := range cross.Extensions {
+		hasPolicy = hasPolicy || e.Id.Equal(policy.Id)
+	}
+	assert.True(t, hasPolicy)
+
+	// a leaf issued by the intermediate chains to both roots
+	leafKey, err := key.GenerateKey(&key.Options{Type: key.ECDSA, Curve: "P-256"})
+	assert.Nil(t, err)
+	b, err = GenerateX509Certificate(&X509Simplified{
+		Subject:     &Subject{CommonName: "www.example.com"},
+		DNSNames:    []string{"www.example.com"},
+		NotBefore:   now.Add(-time.Hour),
+		NotAfter:    now.AddDate(0, 0, 90),
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, intermediate, leafKey.Public(), intermediateKey)
+	assert.Nil(t, err)
+	leaf, err := x509.ParseCertificate(b)
+	assert.Nil(t, err)
+
+	var testData = []struct {
+		testName     string
+		root         *x509.Certificate
+		intermediate *x509.Certificate
+	}{
+		{testName: "old root", root: oldRoot, intermediate: intermediate},
+		{testName: "new root", root: newRoot, intermediate: cross},
+	}
+
+	for _, td := range testData {
+		roots := x509.NewCertPool()
+		roots.AddCert(td.root)
+		intermediates := x509.NewCertPool()
+		intermediates.AddCert(td.intermediate)
+		_, err := leaf.Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates, DNSName: "www.example.com"})
+		assert.NoErrorf(t, err, "test: %s", td.testName)
+	}
+}
@@ -0,0 +1,199 @@
+package cert
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+)
+
+// ExtensionPolicy decides which extensions requested at a CSR
+// are copied into the issued certificate
+type ExtensionPolicy string
+
+const (
+	// CopyNone ignores every requested extension
+	CopyNone ExtensionPolicy = "none"
+	// CopySANs copies the requested subject alternative names
+	CopySANs ExtensionPolicy = "sans"
+	// CopyAll copies the requested subject alternative names and any
+	// other requested extension not already set by the issuer. Basic
+	// constraints, name constraints, key identifiers, authority
+	// information access and CRL distribution points are never copied
+	CopyAll ExtensionPolicy = "all"
+)
+
+var (
+	// ExtensionPolicyChoices is the set of supported extension copy policies
+	ExtensionPolicyChoices = map[string]ExtensionPolicy{
+		string(CopyNone): CopyNone,
+		string(CopySANs): CopySANs,
+		string(CopyAll):  CopyAll,
+	}
+
+	oidExtensionSubjectAltName   = asn1.ObjectIdentifier{2, 5, 29, 17}
+	oidExtensionKeyUsage         = asn1.ObjectIdentifier{2, 5, 29, 15}
+	oidExtensionExtendedKeyUsage = asn1.ObjectIdentifier{2, 5, 29, 37}
+	oidExtensionBasicConstraints = asn1.ObjectIdentifier{2, 5, 29, 19}
+
+	// csrSkippedExtensions are set by the issuer and never
+	// copied from a certificate request
+	csrSkippedExtensions = []asn1.ObjectIdentifier{
+		oidExtensionSubjectAltName,
+		oidExtensionBasicConstraints,
+		{2, 5, 29, 14},              // subject key identifier
+		{2, 5, 29, 35},              // authority key identifier
+		{2, 5, 29, 30},              // name constraints
+		{2, 5, 29, 31},              // CRL distribution points
+		{1, 3, 6, 1, 5, 5, 7, 1, 1}, // authority information access
+	}
+)
+
+// CSRSimplified simplified certificate signing request
+type CSRSimplified struct {
+	Subject        *Subject
+	DNSNames       []string
+	IPAddresses    []net.IP
+	URIs           []*url.URL
+	EmailAddresses []string
+	OtherNames     []OtherName
+}
+
+// GenerateCSR creates a PKCS#10 certificate signing request
+// signed with the subject's private key
+func GenerateCSR(r *CSRSimplified, key crypto.Signer) ([]byte, error) {
+	template := &x509.CertificateRequest{
+		Subject:        r.Subject.Name(),
+		DNSNames:       r.DNSNames,
+		IPAddresses:    r.IPAddresses,
+		URIs:           r.URIs,
+		EmailAddresses: r.EmailAddresses,
+	}
+	if len(r.OtherNames) != 0 {
+		san, err := marshalSANs(r.DNSNames, r.EmailAddresses, r.IPAddresses, r.URIs, r.OtherNames, false)
+		if err != nil {
+			return nil, err
+		}
+		template.ExtraExtensions = []pkix.Extension{san}
+	}
+
+	return x509.CreateCertificateRequest(rand.Reader, template, key)
+}
+
+// WriteCSRPEM serializes the certificate request into a PEM string
+func WriteCSRPEM(csr []byte) (string, error) {
+	var p bytes.Buffer
+	err := pem.Encode(
+		&p,
+		&pem.Block{
+			Type:  "CERTIFICATE REQUEST",
+			Bytes: csr,
+		})
+	if err != nil {
+		return "", fmt.Errorf("error PEM encoding certificate request: %s", err.Error())
+	}
+
+	return p.String(), nil
+}
+
+// ReadCSRPEM reads a certificate request from PEM format
+func ReadCSRPEM(csr []byte) (*x509.CertificateRequest, error) {
+	der, _ := pem.Decode(csr)
+	if der == nil {
+		return nil, errors.New("certificate request doesn't contain a PEM encoded request")
+	}
+
+	r, err := x509.ParseCertificateRequest(der.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse certificate request: %s", err.Error())
+	}
+
+	return r, nil
+}
+
+// VerifyCSR checks that the certificate request is signed
+// by the private key matching its public key
+func VerifyCSR(csr *x509.CertificateRequest) error {
+	if err := csr.CheckSignature(); err != nil {
+		return fmt.Errorf("invalid certificate request signature: %s", err.Error())
+	}
+	return nil
+}
+
+// SignCSR issues a certificate for the certificate request. The public key
+// is taken from the request, and so is the subject unless the simplified
+// definition informs one. Requested extensions are copied according to
+// the policy
+func SignCSR(c *X509Simplified, csr *x509.CertificateRequest, parent *x509.Certificate, signingKey crypto.Signer, policy ExtensionPolicy) ([]byte, error) {
+	if err := VerifyCSR(csr); err != nil {
+		return nil, err
+	}
+
+	if _, ok := ExtensionPolicyChoices[string(policy)]; !ok {
+		return nil, fmt.Errorf("unknown extension policy: %s", policy)
+	}
+
+	x := *c
+	if x.Subject == nil {
+		x.Subject = SubjectFromName(csr.Subject)
+	}
+
+	if policy == CopySANs || policy == CopyAll {
+		x.DNSNames = append(append([]string{}, c.DNSNames...), csr.DNSNames...)
+		x.IPAddresses = append(append([]net.IP{}, c.IPAddresses...), csr.IPAddresses...)
+		x.URIs = append(append([]*url.URL{}, c.URIs...), csr.URIs...)
+		x.EmailAddresses = append(append([]string{}, c.EmailAddresses...), csr.EmailAddresses...)
+
+		otherNames, err := ParseOtherNames(csr.Extensions)
+		if err != nil {
+			return nil, err
+		}
+		x.OtherNames = append(append([]OtherName{}, c.OtherNames...), otherNames...)
+	}
+
+	if policy == CopyAll {
+		x.ExtraExtensions = append([]pkix.Extension{}, c.ExtraExtensions...)
+		for _, e := range csr.Extensions {
+			switch {
+			case isCSRSkipped(e.Id):
+				continue
+			case e.Id.Equal(oidExtensionKeyUsage) && c.KeyUsage != 0:
+				continue
+			case e.Id.Equal(oidExtensionExtendedKeyUsage) && len(c.ExtKeyUsage) != 0:
+				continue
+			case hasExtension(x.ExtraExtensions, e.Id):
+				continue
+			}
+			x.ExtraExtensions = append(x.ExtraExtensions, e)
+		}
+	}
+
+	b, err := GenerateX509Certificate(&x, parent, csr.PublicKey, signingKey)
+	c.Serial = x.Serial
+	return b, err
+}
+
+func isCSRSkipped(id asn1.ObjectIdentifier) bool {
+	for _, s := range csrSkippedExtensions {
+		if id.Equal(s) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasExtension(exts []pkix.Extension, id asn1.ObjectIdentifier) bool {
+	for _, e := range exts {
+		if e.Id.Equal(id) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,183 @@
+package cert
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/odacremolbap/xfon/pkg/key"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCSRGeneration(t *testing.T) {
+	k, _ := key.GenerateKey(&key.Options{Type: key.ECDSA, Curve: "P-256"})
+
+	r := &CSRSimplified{
+		Subject: &Subject{
+			CommonName:   "csr1",
+			Organization: []string{"organization1"},
+		},
+		DNSNames:    []string{"csr1.example.com"},
+		IPAddresses: []net.IP{net.ParseIP("10.0.0.1")},
+	}
+
+	b, err := GenerateCSR(r, k)
+	assert.Nil(t, err)
+
+	p, err := WriteCSRPEM(b)
+	assert.Nil(t, err)
+
+	csr, err := ReadCSRPEM([]byte(p))
+	assert.Nil(t, err)
+	assert.Nil(t, VerifyCSR(csr))
+	assert.Equal(t, "csr1", csr.Subject.CommonName)
+	assert.Equal(t, []string{"organization1"}, csr.Subject.Organization)
+	assert.Equal(t, r.DNSNames, csr.DNSNames)
+	assert.True(t, r.IPAddresses[0].Equal(csr.IPAddresses[0]))
+
+	// tampering the request breaks the signature
+	csr.RawTBSCertificateRequest[len(csr.RawTBSCertificateRequest)-1] ^= 0xff
+	assert.Error(t, VerifyCSR(csr))
+}
+
+func TestSignCSR(t *testing.T) {
+	caKey, _ := key.GenerateKey(&key.Options{Type: key.ECDSA, Curve: "P-256"})
+	b, _ := GenerateX509SelfSignedCertificate(&X509Simplified{
+		Subject:   &Subject{CommonName: "ca"},
+		NotBefore: time.Now().UTC(),
+		NotAfter:  time.Now().AddDate(0, 0, 100).UTC(),
+		IsCA:      true,
+		KeyUsage:  x509.KeyUsageCertSign,
+	}, caKey)
+	parent, _ := x509.ParseCertificate(b)
+
+	oidCustom := asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 55555, 1}
+	bcValue, _ := asn1.Marshal(struct{ IsCA bool }{true})
+	leafKey, _ := key.GenerateKey(&key.Options{Type: key.Ed25519})
+
+	// extensions set by the issuer, requested with other values
+	eb, _ := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		SubjectKeyId:          []byte{1, 2, 3},
+		AuthorityKeyId:        []byte{4, 5, 6},
+		OCSPServer:            []string{"http://evil/ocsp"},
+		CRLDistributionPoints: []string{"http://evil/ca.crl"},
+		PermittedDNSDomains:   []string{"evil"},
+	}, &x509.Certificate{SerialNumber: big.NewInt(2)}, leafKey.Public(), leafKey)
+	evil, _ := x509.ParseCertificate(eb)
+	exts := []pkix.Extension{
+		{Id: oidCustom, Value: []byte{0x05, 0x00}},
+		{Id: oidExtensionBasicConstraints, Critical: true, Value: bcValue},
+	}
+	for _, e := range evil.Extensions {
+		if !e.Id.Equal(oidExtensionKeyUsage) {
+			exts = append(exts, e)
+		}
+	}
+
+	rb, _ := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:         pkix.Name{CommonName: "leaf"},
+		DNSNames:        []string{"leaf.example.com"},
+		ExtraExtensions: exts,
+	}, leafKey)
+	csr, _ := x509.ParseCertificateRequest(rb)
+
+	var testData = []struct {
+		testName  string
+		policy    ExtensionPolicy
+		dnsNames  []string
+		hasCustom bool
+		errorRet  bool
+	}{
+		{
+			testName: "copy none",
+			policy:   CopyNone,
+		},
+		{
+			testName: "copy sans",
+			policy:   CopySANs,
+			dnsNames: []string{"leaf.example.com"},
+		},
+		{
+			testName:  "copy all",
+			policy:    CopyAll,
+			dnsNames:  []string{"leaf.example.com"},
+			hasCustom: true,
+		},
+		{
+			testName: "unknown policy",
+			policy:   "some",
+			errorRet: true,
+		},
+	}
+
+	for _, td := range testData {
+		x := &X509Simplified{
+			NotBefore:             time.Now().UTC(),
+			NotAfter:              time.Now().AddDate(0, 0, 10).UTC(),
+			OCSPServer:            []string{"http://ocsp.example.com"},
+			CRLDistributionPoints: []string{"http://pki.example.com/ca.crl"},
+		}
+		b, err := SignCSR(x, csr, parent, caKey, td.policy)
+		if td.errorRet {
+			assert.Errorf(t, err, "test: %s", td.testName)
+			continue
+		}
+		assert.NoErrorf(t, err, "test: %s", td.testName)
+
+		c, err := x509.ParseCertificate(b)
+		assert.NoErrorf(t, err, "test: %s", td.testName)
+		assert.NoErrorf(t, c.CheckSignatureFrom(parent), "test: %s", td.testName)
+		assert.Equalf(t, "leaf", c.Subject.CommonName, "test: %s", td.testName)
+		assert.Equalf(t, td.dnsNames, c.DNSNames, "test: %s", td.testName)
+		assert.Equalf(t, td.hasCustom, hasExtension(c.Extensions, oidCustom), "test: %s", td.testName)
+		assert.Falsef(t, c.IsCA, "test: %s", td.testName)
+		assert.Equalf(t, x.OCSPServer, c.OCSPServer, "test: %s", td.testName)
+		assert.Equalf(t, x.CRLDistributionPoints, c.CRLDistributionPoints, "test: %s", td.testName)
+		assert.NotEqualf(t, evil.SubjectKeyId, c.SubjectKeyId, "test: %s", td.testName)
+		assert.Equalf(t, parent.SubjectKeyId, c.AuthorityKeyId, "test: %s", td.testName)
+		assert.Emptyf(t, c.PermittedDNSDomains, "test: %s", td.testName)
+	}
+}
+
+func TestSignCSRAlternativeNames(t *testing.T) {
+	parent, caKey := newTestCA(t, "ca")
+	leafKey, _ := key.GenerateKey(&key.Options{Type: key.ECDSA, Curve: "P-256"})
+	uri, _ := url.Parse("https://leaf.example.com/id")
+	upn := OtherName{TypeID: OtherNameTypeChoices["UPN"], Value: "leaf@example.com"}
+
+	rb, err := GenerateCSR(&CSRSimplified{
+		Subject:        &Subject{CommonName: "leaf"},
+		DNSNames:       []string{"leaf.example.com"},
+		URIs:           []*url.URL{uri},
+		EmailAddresses: []string{"leaf@example.com"},
+		OtherNames:     []OtherName{upn},
+	}, leafKey)
+	assert.Nil(t, err)
+	csr, err := x509.ParseCertificateRequest(rb)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"leaf@example.com"}, csr.EmailAddresses)
+
+	b, err := SignCSR(&X509Simplified{
+		NotBefore: time.Now().UTC(),
+		NotAfter:  time.Now().AddDate(0, 0, 10).UTC(),
+	}, csr, parent, caKey, CopySANs)
+	assert.Nil(t, err)
+	c, err := x509.ParseCertificate(b)
+	assert.Nil(t, err)
+
+	assert.Equal(t, []string{"leaf.example.com"}, c.DNSNames)
+	assert.Equal(t, []string{"leaf@example.com"}, c.EmailAddresses)
+	assert.Equal(t, 1, len(c.URIs))
+	assert.Equal(t, uri.String(), c.URIs[0].String())
+	otherNames, err := ParseOtherNames(c.Extensions)
+	assert.Nil(t, err)
+	assert.Equal(t, []OtherName{upn}, otherNames)
+}
@@ -0,0 +1,137 @@
+package cert
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Info is a stable representation of a certificate, meant
+// to be serialized for scripting purposes
+type Info struct {
+	Subject                string       `json:"subject" yaml:"subject"`
+	Issuer                 string       `json:"issuer" yaml:"issuer"`
+	Serial                 string       `json:"serial" yaml:"serial"`
+	NotBefore              time.Time    `json:"notBefore" yaml:"notBefore"`
+	NotAfter               time.Time    `json:"notAfter" yaml:"notAfter"`
+	IsCA                   bool         `json:"isCA" yaml:"isCA"`
+	DNSNames               []string     `json:"dnsNames" yaml:"dnsNames"`
+	IPAddresses            []string     `json:"ipAddresses" yaml:"ipAddresses"`
+	URIs                   []string     `json:"uris" yaml:"uris"`
+	EmailAddresses         []string     `json:"emailAddresses" yaml:"emailAddresses"`
+	OtherNames             []string     `json:"otherNames" yaml:"otherNames"`
+	KeyUsages              []string     `json:"keyUsages" yaml:"keyUsages"`
+	ExtKeyUsages           []string     `json:"extKeyUsages" yaml:"extKeyUsages"`
+	OCSPServers            []string     `json:"ocspServers" yaml:"ocspServers"`
+	IssuingCertificateURLs []string     `json:"issuingCertificateURLs" yaml:"issuingCertificateURLs"`
+	CRLDistributionPoints  []string     `json:"crlDistributionPoints" yaml:"crlDistributionPoints"`
+	PublicKeyAlgorithm     string       `json:"publicKeyAlgorithm" yaml:"publicKeyAlgorithm"`
+	SignatureAlgorithm     string       `json:"signatureAlgorithm" yaml:"signatureAlgorithm"`
+	Fingerprints           Fingerprints `json:"fingerprints" yaml:"fingerprints"`
+}
+
+// Fingerprints of the DER encoded certificate, as
+// colon separated uppercase hex
+type Fingerprints struct {
+	SHA1   string `json:"sha1" yaml:"sha1"`
+	SHA256 string `json:"sha256" yaml:"sha256"`
+}
+
+// NewInfo returns the informational representation of a certificate
+func NewInfo(c *x509.Certificate) *Info {
+	i := &Info{
+		Subject:                c.Subject.String(),
+		Issuer:                 c.Issuer.String(),
+		Serial:                 FormatHex(c.SerialNumber.Bytes()),
+		NotBefore:              c.NotBefore.UTC(),
+		NotAfter:               c.NotAfter.UTC(),
+		IsCA:                   c.IsCA,
+		DNSNames:               []string{},
+		IPAddresses:            []string{},
+		URIs:                   []string{},
+		EmailAddresses:         []string{},
+		OtherNames:             []string{},
+		KeyUsages:              KeyUsageToStrings(c.KeyUsage),
+		ExtKeyUsages:           ExtKeyUsageToStrings(c.ExtKeyUsage),
+		OCSPServers:            append([]string{}, c.OCSPServer...),
+		IssuingCertificateURLs: append([]string{}, c.IssuingCertificateURL...),
+		CRLDistributionPoints:  append([]string{}, c.CRLDistributionPoints...),
+		PublicKeyAlgorithm:     c.PublicKeyAlgorithm.String(),
+		SignatureAlgorithm:     c.SignatureAlgorithm.String(),
+	}
+
+	i.DNSNames = append(i.DNSNames, c.DNSNames...)
+	for _, ip := range c.IPAddresses {
+		i.IPAddresses = append(i.IPAddresses, ip.String())
+	}
+	for _, u := range c.URIs {
+		i.URIs = append(i.URIs, u.String())
+	}
+	i.EmailAddresses = append(i.EmailAddresses, c.EmailAddresses...)
+	// otherNames are not listed when any has an unsupported value
+	otherNames, _ := ParseOtherNames(c.Extensions)
+	for _, o := range otherNames {
+		i.OtherNames = append(i.OtherNames, o.String())
+	}
+	for _, oid := range c.UnknownExtKeyUsage {
+		i.ExtKeyUsages = append(i.ExtKeyUsages, oid.String())
+	}
+
+	s1 := sha1.Sum(c.Raw)
+	s256 := sha256.Sum256(c.Raw)
+	i.Fingerprints = Fingerprints{
+		SHA1:   FormatHex(s1[:]),
+		SHA256: FormatHex(s256[:]),
+	}
+
+	return i
+}
+
+// FormatHex renders bytes as colon separated uppercase hex
+func FormatHex(b []byte) string {
+	if len(b) == 0 {
+		return "00"
+	}
+	parts := make([]string, len(b))
+	for i, v := range b {
+		parts[i] = fmt.Sprintf("%02X", v)
+	}
+	return strings.Join(parts, ":")
+}
+
+// KeyUsageToStrings returns the names at KeyUsageChoices
+// for the key usage bits, sorted
+func KeyUsageToStrings(keyUsage x509.KeyUsage) []string {
+	u := []string{}
+	for name, v := range KeyUsageChoices {
+		if keyUsage&v != 0 {
+			u = append(u, name)
+		}
+	}
+	sort.Strings(u)
+	return u
+}
+
+// ExtKeyUsageToStrings returns the names at ExtKeyUsageChoices
+// for the extended key usages, in certificate order
+func ExtKeyUsageToStrings(extKeyUsage []x509.ExtKeyUsage) []string {
+	u := []string{}
+	for _, e := range extKeyUsage {
+		found := false
+		for name, v := range ExtKeyUsageChoices {
+			if e == v {
+				u = append(u, name)
+				found = true
+				break
+			}
+		}
+		if !found {
+			u = append(u, fmt.Sprintf("ExtKeyUsage(%d)", e))
+		}
+	}
+	return u
+}
@@ -0,0 +1,96 @@
+package cert
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/odacremolbap/xfon/pkg/key"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyUsageToStrings(t *testing.T) {
+	var testData = []struct {
+		testName string
+		keyUsage x509.KeyUsage
+		expected []string
+	}{
+		{
+			testName: "empty usage",
+			keyUsage: 0,
+			expected: []string{},
+		},
+		{
+			testName: "multi usage",
+			keyUsage: x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+			expected: []string{"KeyUsageCertSign", "KeyUsageDigitalSignature", "KeyUsageKeyEncipherment"},
+		},
+	}
+
+	for _, td := range testData {
+		assert.Equalf(t, td.expected, KeyUsageToStrings(td.keyUsage), "test: %s", td.testName)
+	}
+}
+
+func TestExtKeyUsageToStrings(t *testing.T) {
+	var testData = []struct {
+		testName    string
+		extKeyUsage []x509.ExtKeyUsage
+		expected    []string
+	}{
+		{
+			testName: "empty usage",
+			expected: []string{},
+		},
+		{
+			testName:    "multi usage",
+			extKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+			expected:    []string{"ExtKeyUsageServerAuth", "ExtKeyUsageClientAuth"},
+		},
+	}
+
+	for _, td := range testData {
+		assert.Equalf(t, td.expected, ExtKeyUsageToStrings(td.extKeyUsage), "test: %s", td.testName)
+	}
+}
+
+func TestNewInfo(t *testing.T) {
+	k, _ := key.GenerateKey(&key.Options{Type: key.ECDSA, Curve: "P-256"})
+	b, err := GenerateX509SelfSignedCertificate(&X509Simplified{
+		Subject:     &Subject{CommonName: "info", Organization: []string{"org"}},
+		Serial:      big.NewInt(0x0102),
+		NotBefore:   time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:    time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+		DNSNames:    []string{"info.example.com"},
+		IPAddresses: []net.IP{net.ParseIP("10.0.0.1")},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		OCSPServer:  []string{"http://ocsp.example.com"},
+	}, k)
+	assert.Nil(t, err)
+	c, _ := x509.ParseCertificate(b)
+
+	i := NewInfo(c)
+	assert.Equal(t, "CN=info,O=org", i.Subject)
+	assert.Equal(t, "CN=info,O=org", i.Issuer)
+	assert.Equal(t, "01:02", i.Serial)
+	assert.Equal(t, []string{"info.example.com"}, i.DNSNames)
+	assert.Equal(t, []string{"10.0.0.1"}, i.IPAddresses)
+	assert.Equal(t, []string{"KeyUsageDigitalSignature"}, i.KeyUsages)
+	assert.Equal(t, []string{"ExtKeyUsageServerAuth"}, i.ExtKeyUsages)
+	assert.Equal(t, "ECDSA", i.PublicKeyAlgorithm)
+	assert.Equal(t, []string{"http://ocsp.example.com"}, i.OCSPServers)
+	assert.Equal(t, []string{}, i.CRLDistributionPoints)
+
+	s := sha256.Sum256(b)
+	assert.Equal(t, FormatHex(s[:]), i.Fingerprints.SHA256)
+
+	j, err := json.Marshal(i)
+	assert.Nil(t, err)
+	assert.Contains(t, string(j), `"notAfter":"2030-01-01T00:00:00Z"`)
+}
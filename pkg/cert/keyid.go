@@ -0,0 +1,121 @@
+package cert
+
+import (
+	"crypto"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+)
+
+// SKIMethod is the method used to compute a subject key identifier
+type SKIMethod string
+
+const (
+	// SKIRFC5280Method1 is the SHA-1 of the subject public key,
+	// RFC 5280 section 4.2.1.2 method 1
+	SKIRFC5280Method1 SKIMethod = "rfc5280-1"
+	// SKIRFC5280Method2 is 0100 followed by the least significant 60 bits
+	// of the SHA-1 of the subject public key, RFC 5280 method 2
+	SKIRFC5280Method2 SKIMethod = "rfc5280-2"
+	// SKIRFC7093Method1 is the leftmost 160 bits of the SHA-256
+	// of the subject public key, RFC 7093 section 2 method 1
+	SKIRFC7093Method1 SKIMethod = "rfc7093-1"
+	// SKIRFC7093Method2 is the leftmost 160 bits of the SHA-384
+	// of the subject public key, RFC 7093 method 2
+	SKIRFC7093Method2 SKIMethod = "rfc7093-2"
+	// SKIRFC7093Method3 is the leftmost 160 bits of the SHA-512
+	// of the subject public key, RFC 7093 method 3
+	SKIRFC7093Method3 SKIMethod = "rfc7093-3"
+	// SKIRFC7093Method4 is the SHA-256 of the DER encoded
+	// subject public key info, RFC 7093 method 4
+	SKIRFC7093Method4 SKIMethod = "rfc7093-4"
+)
+
+var (
+	// SKIMethodChoices is the set of supported subject key identifier methods
+	SKIMethodChoices = map[string]SKIMethod{
+		string(SKIRFC5280Method1): SKIRFC5280Method1,
+		string(SKIRFC5280Method2): SKIRFC5280Method2,
+		string(SKIRFC7093Method1): SKIRFC7093Method1,
+		string(SKIRFC7093Method2): SKIRFC7093Method2,
+		string(SKIRFC7093Method3): SKIRFC7093Method3,
+		string(SKIRFC7093Method4): SKIRFC7093Method4,
+	}
+
+	// ErrIssuerKeyMismatch is returned when the signing key
+	// does not belong to the parent certificate
+	ErrIssuerKeyMismatch = errors.New("signing key does not match the parent certificate public key")
+
+	// ErrIssuerNotCA is returned when the parent certificate is not
+	// a CA allowed to sign certificates
+	ErrIssuerNotCA = errors.New("parent certificate is not a CA with KeyUsageCertSign usage")
+)
+
+// subjectPublicKeyInfo as defined at RFC 5280
+type subjectPublicKeyInfo struct {
+	Algorithm        pkix.AlgorithmIdentifier
+	SubjectPublicKey asn1.BitString
+}
+
+// SubjectKeyID computes the key identifier for the public key.
+// When method is empty RFC 5280 method 1 is used
+func SubjectKeyID(publicKey crypto.PublicKey, method SKIMethod) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling public key: %s", err.Error())
+	}
+
+	var spki subjectPublicKeyInfo
+	if _, err := asn1.Unmarshal(der, &spki); err != nil {
+		return nil, fmt.Errorf("error parsing public key: %s", err.Error())
+	}
+	pk := spki.SubjectPublicKey.Bytes
+
+	switch method {
+	case "", SKIRFC5280Method1:
+		h := sha1.Sum(pk)
+		return h[:], nil
+	case SKIRFC5280Method2:
+		h := sha1.Sum(pk)
+		id := h[len(h)-8:]
+		id[0] = 0x40 | (id[0] & 0x0f)
+		return id, nil
+	case SKIRFC7093Method1:
+		h := sha256.Sum256(pk)
+		return h[:20], nil
+	case SKIRFC7093Method2:
+		h := sha512.Sum384(pk)
+		return h[:20], nil
+	case SKIRFC7093Method3:
+		h := sha512.Sum512(pk)
+		return h[:20], nil
+	case SKIRFC7093Method4:
+		h := sha256.Sum256(der)
+		return h[:], nil
+	}
+
+	return nil, fmt.Errorf("unknown subject key identifier method: %s", method)
+}
+
+// ValidateIssuer checks that the signing key belongs to the parent
+// certificate and that the parent is a CA allowed to sign certificates
+func ValidateIssuer(parent *x509.Certificate, signingKey crypto.Signer) error {
+	pub, ok := signingKey.Public().(interface {
+		Equal(crypto.PublicKey) bool
+	})
+	if !ok || !pub.Equal(parent.PublicKey) {
+		return ErrIssuerKeyMismatch
+	}
+
+	if !parent.BasicConstraintsValid || !parent.IsCA ||
+		parent.KeyUsage&x509.KeyUsageCertSign == 0 {
+		return ErrIssuerNotCA
+	}
+
+	return nil
+}
@@ -0,0 +1,104 @@
+package cert
+
+import (
+	"crypto"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/asn1"
+	"testing"
+	"time"
+
+	"github.com/odacremolbap/xfon/pkg/key"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubjectKeyID(t *testing.T) {
+	k, _ := key.GenerateKey(&key.Options{Type: key.ECDSA, Curve: "P-256"})
+
+	var testData = []struct {
+		testName string
+		method   SKIMethod
+		length   int
+		errorRet bool
+	}{
+		{testName: "default", method: "", length: 20},
+		{testName: "rfc5280 method 1", method: SKIRFC5280Method1, length: 20},
+		{testName: "rfc5280 method 2", method: SKIRFC5280Method2, length: 8},
+		{testName: "rfc7093 method 1", method: SKIRFC7093Method1, length: 20},
+		{testName: "rfc7093 method 2", method: SKIRFC7093Method2, length: 20},
+		{testName: "rfc7093 method 3", method: SKIRFC7093Method3, length: 20},
+		{testName: "rfc7093 method 4", method: SKIRFC7093Method4, length: 32},
+		{testName: "unknown", method: "md5", errorRet: true},
+	}
+
+	for _, td := range testData {
+		id, err := SubjectKeyID(k.Public(), td.method)
+		if td.errorRet {
+			assert.Errorf(t, err, "test: %s", td.testName)
+			continue
+		}
+		assert.NoErrorf(t, err, "test: %s", td.testName)
+		assert.Lenf(t, id, td.length, "test: %s", td.testName)
+		if td.method == SKIRFC5280Method2 {
+			assert.Equalf(t, byte(0x40), id[0]&0xf0, "test: %s", td.testName)
+		}
+	}
+
+	// method 1 hashes the subject public key bit string
+	b, _ := GenerateX509SelfSignedCertificate(&X509Simplified{
+		Subject:   &Subject{CommonName: "ski"},
+		NotBefore: time.Now().UTC(),
+		NotAfter:  time.Now().AddDate(0, 0, 1).UTC(),
+	}, k)
+	c, _ := x509.ParseCertificate(b)
+	var spki subjectPublicKeyInfo
+	_, err := asn1.Unmarshal(c.RawSubjectPublicKeyInfo, &spki)
+	assert.Nil(t, err)
+	h := sha1.Sum(spki.SubjectPublicKey.Bytes)
+	assert.Equal(t, h[:], c.SubjectKeyId)
+}
+
+func TestIssuerChaining(t *testing.T) {
+	root, rootKey := newTestCA(t, "root")
+	other, otherKey := newTestCA(t, "other")
+
+	leaf, leafKey := newTestLeaf(t, &X509Simplified{
+		Subject:            &Subject{CommonName: "leaf"},
+		NotBefore:          time.Now().UTC(),
+		NotAfter:           time.Now().AddDate(0, 0, 10).UTC(),
+		SubjectKeyIDMethod: SKIRFC7093Method1,
+	}, root, rootKey)
+	assert.Equal(t, root.SubjectKeyId, leaf.AuthorityKeyId)
+	assert.Len(t, leaf.SubjectKeyId, 20)
+
+	noCertSign, noCertSignKey := newTestLeaf(t, &X509Simplified{
+		Subject:   &Subject{CommonName: "no-cert-sign"},
+		NotBefore: time.Now().UTC(),
+		NotAfter:  time.Now().AddDate(0, 0, 10).UTC(),
+		IsCA:      true,
+		KeyUsage:  x509.KeyUsageDigitalSignature,
+	}, root, rootKey)
+
+	var testData = []struct {
+		testName   string
+		parent     *x509.Certificate
+		signingKey crypto.Signer
+		err        error
+	}{
+		{testName: "key mismatch", parent: root, signingKey: otherKey, err: ErrIssuerKeyMismatch},
+		{testName: "not a CA", parent: leaf, signingKey: leafKey, err: ErrIssuerNotCA},
+		{testName: "no cert sign usage", parent: noCertSign, signingKey: noCertSignKey, err: ErrIssuerNotCA},
+		{testName: "valid", parent: other, signingKey: otherKey},
+	}
+
+	for _, td := range testData {
+		k, _ := key.GenerateKey(&key.Options{Type: key.Ed25519})
+		_, err := GenerateX509Certificate(&X509Simplified{
+			Subject:   &Subject{CommonName: "child"},
+			NotBefore: time.Now().UTC(),
+			NotAfter:  time.Now().AddDate(0, 0, 10).UTC(),
+		}, td.parent, k.Public(), td.signingKey)
+		assert.Equalf(t, td.err, err, "test: %s", td.testName)
+	}
+}
@@ -0,0 +1,191 @@
+package cert
+
+import (
+	"crypto/x509"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/odacremolbap/xfon/pkg/filesystem"
+	"gopkg.in/yaml.v2"
+)
+
+// Profile is a named set of issuance defaults
+type Profile struct {
+	// Days of validity for issued certificates
+	Days int `json:"days" yaml:"days"`
+	// KeyUsages names as at KeyUsageChoices
+	KeyUsages []string `json:"keyUsages" yaml:"keyUsages"`
+	// ExtKeyUsages names as at ExtKeyUsageChoices
+	ExtKeyUsages []string `json:"extKeyUsages" yaml:"extKeyUsages"`
+	// IsCA sets the basic constraints CA flag
+	IsCA bool `json:"isCA" yaml:"isCA"`
+	// MaxPathLen for CA certificates, unlimited when not informed
+	MaxPathLen *int `json:"maxPathLen,omitempty" yaml:"maxPathLen,omitempty"`
+	// Subject string as accepted by ParseSubject
+	Subject string `json:"subject,omitempty" yaml:"subject,omitempty"`
+}
+
+// ProfileConfig is the contents of a profiles file
+type ProfileConfig struct {
+	Profiles map[string]*Profile `json:"profiles" yaml:"profiles"`
+}
+
+// BuiltinProfiles are always available, and can be
+// replaced by profiles with the same name at a file
+var BuiltinProfiles = map[string]*Profile{
+	"server": {
+		Days:         397,
+		KeyUsages:    []string{"KeyUsageDigitalSignature"},
+		ExtKeyUsages: []string{"ExtKeyUsageServerAuth"},
+	},
+	"client": {
+		Days:         397,
+		KeyUsages:    []string{"KeyUsageDigitalSignature"},
+		ExtKeyUsages: []string{"ExtKeyUsageClientAuth"},
+	},
+	"ocsp-responder": {
+		Days:         90,
+		KeyUsages:    []string{"KeyUsageDigitalSignature"},
+		ExtKeyUsages: []string{"ExtKeyUsageOCSPSigning"},
+	},
+	"intermediate-ca": {
+		Days:       1825,
+		KeyUsages:  []string{"KeyUsageCertSign", "KeyUsageCRLSign", "KeyUsageDigitalSignature"},
+		IsCA:       true,
+		MaxPathLen: intPtr(0),
+	},
+	"root-ca": {
+		Days:      3650,
+		KeyUsages: []string{"KeyUsageCertSign", "KeyUsageCRLSign"},
+		IsCA:      true,
+	},
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+// ReadProfiles parses a profiles file. YAML is a superset of
+// JSON so both formats are accepted. Unknown fields are rejected
+// and every profile is validated
+func ReadProfiles(b []byte) (map[string]*Profile, error) {
+	c := &ProfileConfig{}
+	if err := yaml.UnmarshalStrict(b, c); err != nil {
+		return nil, fmt.Errorf("error parsing profiles: %s", err.Error())
+	}
+
+	for name, p := range c.Profiles {
+		if p == nil {
+			return nil, fmt.Errorf("profile %q is empty", name)
+		}
+		if err := p.Validate(); err != nil {
+			return nil, fmt.Errorf("profile %q: %s", name, err.Error())
+		}
+	}
+
+	return c.Profiles, nil
+}
+
+// LoadProfile returns the named profile from the file at path, falling
+// back to the built-in profiles. When path is empty only built-in
+// profiles are looked up
+func LoadProfile(name, path string) (*Profile, error) {
+	profiles := map[string]*Profile{}
+	for n, p := range BuiltinProfiles {
+		profiles[n] = p
+	}
+
+	if path != "" {
+		b, err := filesystem.ReadContentsFromFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading profiles file %q: %s", path, err.Error())
+		}
+		fp, err := ReadProfiles(b)
+		if err != nil {
+			return nil, err
+		}
+		for n, p := range fp {
+			profiles[n] = p
+		}
+	}
+
+	p, ok := profiles[name]
+	if !ok {
+		names := []string{}
+		for n := range profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown profile %q, available profiles are %s", name, strings.Join(names, ", "))
+	}
+
+	return p, nil
+}
+
+// Validate checks that the profile is consistent
+func (p *Profile) Validate() error {
+	if p.Days < 0 {
+		return fmt.Errorf("days must not be negative")
+	}
+	if _, err := p.KeyUsage(); err != nil {
+		return err
+	}
+	if _, err := p.ExtKeyUsage(); err != nil {
+		return err
+	}
+	if _, err := p.ParsedSubject(); err != nil {
+		return err
+	}
+	if p.MaxPathLen != nil {
+		if !p.IsCA {
+			return fmt.Errorf("maxPathLen is only allowed for CA profiles")
+		}
+		if *p.MaxPathLen < 0 {
+			return fmt.Errorf("maxPathLen must not be negative")
+		}
+	}
+	return nil
+}
+
+// KeyUsage returns the profile key usages
+func (p *Profile) KeyUsage() (x509.KeyUsage, error) {
+	return StringToKeyUsage(strings.Join(p.KeyUsages, ","))
+}
+
+// ExtKeyUsage returns the profile extended key usages
+func (p *Profile) ExtKeyUsage() ([]x509.ExtKeyUsage, error) {
+	return StringToExtKeyUsage(strings.Join(p.ExtKeyUsages, ","))
+}
+
+// ParsedSubject returns the profile subject, empty if not informed
+func (p *Profile) ParsedSubject() (*Subject, error) {
+	if p.Subject == "" {
+		return &Subject{}, nil
+	}
+	return ParseSubject(p.Subject)
+}
+
+// Template returns a certificate definition with the profile subject,
+// usages and CA settings, valid for the profile days from notBefore.
+// The profile must be valid
+func (p *Profile) Template(notBefore time.Time) *X509Simplified {
+	usage, _ := p.KeyUsage()
+	extUsage, _ := p.ExtKeyUsage()
+	subject, _ := p.ParsedSubject()
+
+	x := &X509Simplified{
+		Subject:     subject,
+		NotBefore:   notBefore.UTC(),
+		NotAfter:    notBefore.AddDate(0, 0, p.Days).UTC(),
+		IsCA:        p.IsCA,
+		KeyUsage:    usage,
+		ExtKeyUsage: extUsage,
+	}
+	if p.IsCA && p.MaxPathLen != nil {
+		x.MaxPathLen = *p.MaxPathLen
+		x.MaxPathLenZero = *p.MaxPathLen == 0
+	}
+	return x
+}
@@ -0,0 +1,161 @@
+package cert
+
+import (
+	"crypto/x509"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuiltinProfiles(t *testing.T) {
+	for name, p := range BuiltinProfiles {
+		assert.NoErrorf(t, p.Validate(), "test: %s", name)
+		assert.True(t, p.Days > 0, "test: %s", name)
+
+		u, _ := p.KeyUsage()
+		if p.IsCA {
+			assert.NotZero(t, u&x509.KeyUsageCertSign, "test: %s", name)
+			assert.Empty(t, p.ExtKeyUsages, "test: %s", name)
+		} else {
+			assert.Zero(t, u&x509.KeyUsageCertSign, "test: %s", name)
+			assert.NotEmpty(t, p.ExtKeyUsages, "test: %s", name)
+		}
+	}
+}
+
+func TestReadProfiles(t *testing.T) {
+	var testData = []struct {
+		testName string
+		config   string
+		expected map[string]*Profile
+		errorRet bool
+	}{
+		{
+			testName: "yaml profile",
+			config: `
+profiles:
+  web:
+    days: 90
+    keyUsages: [KeyUsageDigitalSignature, KeyUsageKeyEncipherment]
+    extKeyUsages: [ExtKeyUsageServerAuth]
+    subject: /C=ES/O=Acme
+`,
+			expected: map[string]*Profile{
+				"web": {
+					Days:         90,
+					KeyUsages:    []string{"KeyUsageDigitalSignature", "KeyUsageKeyEncipherment"},
+					ExtKeyUsages: []string{"ExtKeyUsageServerAuth"},
+					Subject:      "/C=ES/O=Acme",
+				},
+			},
+		},
+		{
+			testName: "json profile",
+			config:   `{"profiles": {"team-ca": {"days": 365, "isCA": true, "maxPathLen": 1, "keyUsages": ["KeyUsageCertSign"]}}}`,
+			expected: map[string]*Profile{
+				"team-ca": {
+					Days:       365,
+					IsCA:       true,
+					MaxPathLen: intPtr(1),
+					KeyUsages:  []string{"KeyUsageCertSign"},
+				},
+			},
+		},
+		{
+			testName: "misspelled field",
+			config:   "profiles:\n  web:\n    dayz: 90\n",
+			errorRet: true,
+		},
+		{
+			testName: "unknown key usage",
+			config:   "profiles:\n  web:\n    keyUsages: [KeyUsageDigitalSignatur]\n",
+			errorRet: true,
+		},
+		{
+			testName: "unknown extended key usage",
+			config:   "profiles:\n  web:\n    extKeyUsages: [ServerAuth]\n",
+			errorRet: true,
+		},
+		{
+			testName: "invalid subject",
+			config:   "profiles:\n  web:\n    subject: /FOO=bar\n",
+			errorRet: true,
+		},
+		{
+			testName: "path length for non CA",
+			config:   "profiles:\n  web:\n    maxPathLen: 0\n",
+			errorRet: true,
+		},
+		{
+			testName: "empty profile",
+			config:   "profiles:\n  web:\n",
+			errorRet: true,
+		},
+	}
+
+	for _, td := range testData {
+		p, err := ReadProfiles([]byte(td.config))
+		if td.errorRet {
+			assert.Errorf(t, err, "test: %s", td.testName)
+			continue
+		}
+		assert.NoErrorf(t, err, "test: %s", td.testName)
+		assert.Equal(t, td.expected, p, "test: %s", td.testName)
+	}
+}
+
+func TestLoadProfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xfon-profiles")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "profiles.yaml")
+	err = ioutil.WriteFile(path, []byte("profiles:\n  server:\n    days: 30\n  web:\n    days: 60\n"), 0600)
+	assert.Nil(t, err)
+
+	var testData = []struct {
+		testName string
+		name     string
+		path     string
+		days     int
+		errorRet bool
+	}{
+		{testName: "built-in", name: "root-ca", days: 3650},
+		{testName: "file profile", name: "web", path: path, days: 60},
+		{testName: "file replaces built-in", name: "server", path: path, days: 30},
+		{testName: "built-in with file", name: "client", path: path, days: 397},
+		{testName: "unknown profile", name: "web", errorRet: true},
+		{testName: "missing file", name: "web", path: filepath.Join(dir, "missing.yaml"), errorRet: true},
+	}
+
+	for _, td := range testData {
+		p, err := LoadProfile(td.name, td.path)
+		if td.errorRet {
+			assert.Errorf(t, err, "test: %s", td.testName)
+			continue
+		}
+		assert.NoErrorf(t, err, "test: %s", td.testName)
+		assert.Equal(t, td.days, p.Days, "test: %s", td.testName)
+	}
+}
+
+func TestProfileTemplate(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	x := BuiltinProfiles["intermediate-ca"].Template(now)
+	assert.True(t, x.IsCA)
+	assert.True(t, x.MaxPathLenZero)
+	assert.Equal(t, x509.KeyUsageCertSign|x509.KeyUsageCRLSign|x509.KeyUsageDigitalSignature, x.KeyUsage)
+	assert.Equal(t, now.AddDate(0, 0, 1825), x.NotAfter)
+
+	p := &Profile{Days: 30, ExtKeyUsages: []string{"ExtKeyUsageServerAuth"}, Subject: "/O=Acme"}
+	x = p.Template(now)
+	assert.False(t, x.IsCA)
+	assert.Equal(t, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}, x.ExtKeyUsage)
+	assert.Equal(t, []string{"Acme"}, x.Subject.Organization)
+	assert.Equal(t, now.AddDate(0, 0, 30), x.NotAfter)
+}
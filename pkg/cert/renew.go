@@ -0,0 +1,96 @@
+package cert
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"net"
+	"net/url"
+	"time"
+)
+
+// renewalSkippedExtensions are generated from the simplified definition,
+// or tied to the issuance of a certificate, and are not copied on renewal
+var renewalSkippedExtensions = []asn1.ObjectIdentifier{
+	oidExtensionSubjectAltName,
+	oidExtensionKeyUsage,
+	oidExtensionExtendedKeyUsage,
+	oidExtensionBasicConstraints,
+	{2, 5, 29, 14},                     // subject key identifier
+	{2, 5, 29, 35},                     // authority key identifier
+	{2, 5, 29, 30},                     // name constraints
+	{2, 5, 29, 31},                     // CRL distribution points
+	{1, 3, 6, 1, 5, 5, 7, 1, 1},        // authority information access
+	{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}, // embedded SCTs
+	{1, 3, 6, 1, 4, 1, 11129, 2, 4, 3}, // CT precertificate poison
+}
+
+// RenewalTemplate returns the definition of a certificate renewing c. The
+// subject is kept byte by byte, so that certificates issued by c chain to
+// the renewed one, along with the subject alternative names, usages,
+// constraints, distribution URLs and any other extension, except the ones
+// tied to the previous issuance such as key identifiers and embedded SCTs.
+// The serial is left empty so that a new one is assigned, and the validity
+// starts at notBefore lasting as the previous one, or the informed days if
+// positive
+func RenewalTemplate(c *x509.Certificate, notBefore time.Time, days int) (*X509Simplified, error) {
+	otherNames, err := ParseOtherNames(c.Extensions)
+	if err != nil {
+		return nil, err
+	}
+
+	notAfter := notBefore.Add(c.NotAfter.Sub(c.NotBefore))
+	if days > 0 {
+		notAfter = notBefore.AddDate(0, 0, days)
+	}
+
+	x := &X509Simplified{
+		Subject:               SubjectFromName(c.Subject),
+		RawSubject:            append([]byte{}, c.RawSubject...),
+		NotBefore:             notBefore.UTC(),
+		NotAfter:              notAfter.UTC(),
+		DNSNames:              append([]string{}, c.DNSNames...),
+		IPAddresses:           append([]net.IP{}, c.IPAddresses...),
+		URIs:                  append([]*url.URL{}, c.URIs...),
+		EmailAddresses:        append([]string{}, c.EmailAddresses...),
+		OtherNames:            otherNames,
+		IsCA:                  c.BasicConstraintsValid && c.IsCA,
+		KeyUsage:              c.KeyUsage,
+		ExtKeyUsage:           append([]x509.ExtKeyUsage{}, c.ExtKeyUsage...),
+		OCSPServer:            append([]string{}, c.OCSPServer...),
+		IssuingCertificateURL: append([]string{}, c.IssuingCertificateURL...),
+		CRLDistributionPoints: append([]string{}, c.CRLDistributionPoints...),
+	}
+	if x.IsCA {
+		if c.MaxPathLen > 0 || c.MaxPathLenZero {
+			x.MaxPathLen = c.MaxPathLen
+			x.MaxPathLenZero = c.MaxPathLenZero
+		}
+		if nc := nameConstraintsFromCertificate(c); !nc.IsEmpty() {
+			x.NameConstraints = nc
+		}
+	}
+
+	for _, e := range c.Extensions {
+		// extended key usages unknown to crypto/x509 are only kept
+		// when copying the extension as is
+		if e.Id.Equal(oidExtensionExtendedKeyUsage) && len(c.UnknownExtKeyUsage) != 0 {
+			x.ExtraExtensions = append(x.ExtraExtensions, e)
+			continue
+		}
+		if isRenewalSkipped(e.Id) {
+			continue
+		}
+		x.ExtraExtensions = append(x.ExtraExtensions, e)
+	}
+
+	return x, nil
+}
+
+func isRenewalSkipped(id asn1.ObjectIdentifier) bool {
+	for _, s := range renewalSkippedExtensions {
+		if id.Equal(s) {
+			return true
+		}
+	}
+	return false
+}
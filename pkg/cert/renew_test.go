@@ -0,0 +1,151 @@
+package cert
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/odacremolbap/xfon/pkg/key"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenewalTemplate(t *testing.T) {
+	caKey, err := key.GenerateKey(&key.Options{Type: key.ECDSA, Curve: "P-256"})
+	assert.Nil(t, err)
+	b, err := GenerateX509SelfSignedCertificate(&X509Simplified{
+		Subject:    &Subject{CommonName: "root"},
+		NotBefore:  time.Now().Add(-time.Hour).UTC(),
+		NotAfter:   time.Now().AddDate(1, 0, 0).UTC(),
+		IsCA:       true,
+		MaxPathLen: 2,
+		KeyUsage:   x509.KeyUsageCertSign,
+	}, caKey)
+	assert.Nil(t, err)
+	root, err := x509.ParseCertificate(b)
+	assert.Nil(t, err)
+
+	policy := pkix.Extension{Id: asn1.ObjectIdentifier{2, 5, 29, 32}, Value: []byte{0x30, 0x06, 0x30, 0x04, 0x06, 0x02, 0x2a, 0x03}}
+	sct := pkix.Extension{Id: asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}, Value: []byte{0x04, 0x00}}
+	spiffe, _ := url.Parse("spiffe://example.com/web")
+	upn := OtherName{TypeID: OtherNameTypeChoices["UPN"], Value: "web@example.com"}
+	// common name first and a multi-valued RDN, unlike the order xfon encodes
+	unordered, err := asn1.Marshal(pkix.RDNSequence{
+		{{Type: asn1.ObjectIdentifier{2, 5, 4, 3}, Value: "legacy"}},
+		{{Type: asn1.ObjectIdentifier{2, 5, 4, 10}, Value: "Acme"}, {Type: asn1.ObjectIdentifier{2, 5, 4, 11}, Value: "Ops"}},
+	})
+	assert.Nil(t, err)
+
+	var testData = []struct {
+		testName string
+		x509     *X509Simplified
+		days     int
+	}{
+		{
+			testName: "leaf keeps names usages and extensions",
+			x509: &X509Simplified{
+				Subject:               &Subject{CommonName: "web", Organization: []string{"Acme"}, EmailAddress: []string{"web@example.com"}},
+				DNSNames:              []string{"www.example.com"},
+				IPAddresses:           []net.IP{net.ParseIP("10.0.0.1").To4()},
+				URIs:                  []*url.URL{spiffe},
+				EmailAddresses:        []string{"web@example.com"},
+				OtherNames:            []OtherName{upn},
+				KeyUsage:              x509.KeyUsageDigitalSignature,
+				ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+				OCSPServer:            []string{"http://ocsp.example.com"},
+				CRLDistributionPoints: []string{"http://pki.example.com/ca.crl"},
+				ExtraExtensions:       []pkix.Extension{policy, sct},
+			},
+		},
+		{
+			testName: "intermediate keeps constraints",
+			x509: &X509Simplified{
+				Subject:         &Subject{CommonName: "intermediate"},
+				IsCA:            true,
+				MaxPathLenZero:  true,
+				KeyUsage:        x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+				NameConstraints: &NameConstraints{PermittedDNSDomains: []string{"example.com"}},
+			},
+			days: 30,
+		},
+		{
+			testName: "subject out of xfon order",
+			x509: &X509Simplified{
+				Subject:    &Subject{CommonName: "legacy", Organization: []string{"Acme"}, OrganizationalUnit: []string{"Ops"}},
+				RawSubject: unordered,
+				KeyUsage:   x509.KeyUsageDigitalSignature,
+			},
+		},
+	}
+
+	for _, td := range testData {
+		k, err := key.GenerateKey(&key.Options{Type: key.ECDSA, Curve: "P-256"})
+		assert.Nil(t, err)
+		td.x509.NotBefore = time.Now().AddDate(0, 0, -80).UTC().Truncate(time.Second)
+		td.x509.NotAfter = td.x509.NotBefore.AddDate(0, 0, 90)
+		b, err := GenerateX509Certificate(td.x509, root, k.Public(), caKey)
+		assert.NoErrorf(t, err, "test: %s", td.testName)
+		old, err := x509.ParseCertificate(b)
+		assert.NoErrorf(t, err, "test: %s", td.testName)
+
+		now := time.Now().UTC().Truncate(time.Second)
+		x, err := RenewalTemplate(old, now, td.days)
+		assert.NoErrorf(t, err, "test: %s", td.testName)
+		assert.Nil(t, x.Serial, "test: %s", td.testName)
+		b, err = GenerateX509Certificate(x, root, k.Public(), caKey)
+		assert.NoErrorf(t, err, "test: %s", td.testName)
+		c, err := x509.ParseCertificate(b)
+		assert.NoErrorf(t, err, "test: %s", td.testName)
+
+		assert.NotEqual(t, old.SerialNumber, c.SerialNumber, "test: %s", td.testName)
+		assert.Equal(t, now, c.NotBefore, "test: %s", td.testName)
+		if td.days > 0 {
+			assert.Equal(t, now.AddDate(0, 0, td.days), c.NotAfter, "test: %s", td.testName)
+		} else {
+			assert.Equal(t, old.NotAfter.Sub(old.NotBefore), c.NotAfter.Sub(c.NotBefore), "test: %s", td.testName)
+		}
+
+		assert.Equal(t, old.RawSubject, c.RawSubject, "test: %s", td.testName)
+		if td.x509.RawSubject != nil {
+			assert.Equal(t, td.x509.RawSubject, c.RawSubject, "test: %s", td.testName)
+		}
+		assert.Equal(t, old.DNSNames, c.DNSNames, "test: %s", td.testName)
+		assert.Equal(t, old.IPAddresses, c.IPAddresses, "test: %s", td.testName)
+		assert.Equal(t, old.URIs, c.URIs, "test: %s", td.testName)
+		assert.Equal(t, old.EmailAddresses, c.EmailAddresses, "test: %s", td.testName)
+		assert.Equal(t, old.IsCA, c.IsCA, "test: %s", td.testName)
+		assert.Equal(t, old.MaxPathLen, c.MaxPathLen, "test: %s", td.testName)
+		assert.Equal(t, old.MaxPathLenZero, c.MaxPathLenZero, "test: %s", td.testName)
+		assert.Equal(t, old.PermittedDNSDomains, c.PermittedDNSDomains, "test: %s", td.testName)
+		assert.Equal(t, old.KeyUsage, c.KeyUsage, "test: %s", td.testName)
+		assert.Equal(t, old.ExtKeyUsage, c.ExtKeyUsage, "test: %s", td.testName)
+		assert.Equal(t, old.OCSPServer, c.OCSPServer, "test: %s", td.testName)
+		assert.Equal(t, old.CRLDistributionPoints, c.CRLDistributionPoints, "test: %s", td.testName)
+		assert.Equal(t, old.SubjectKeyId, c.SubjectKeyId, "test: %s", td.testName)
+		assert.Equal(t, old.AuthorityKeyId, c.AuthorityKeyId, "test: %s", td.testName)
+
+		otherNames, err := ParseOtherNames(c.Extensions)
+		assert.NoErrorf(t, err, "test: %s", td.testName)
+		assert.Equal(t, td.x509.OtherNames, otherNames, "test: %s", td.testName)
+
+		// every extension but the SCTs is present once
+		ids := map[string]int{}
+		for _, e := range c.Extensions {
+			ids[e.Id.String()]++
+		}
+		kept := 0
+		for _, e := range old.Extensions {
+			if e.Id.Equal(sct.Id) {
+				assert.Equal(t, 0, ids[e.Id.String()], "test: %s", td.testName)
+				continue
+			}
+			assert.Equal(t, 1, ids[e.Id.String()], "test: %s %s", td.testName, e.Id)
+			kept++
+		}
+		assert.Equal(t, kept, len(c.Extensions), "test: %s", td.testName)
+	}
+}
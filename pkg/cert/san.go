@@ -0,0 +1,239 @@
+package cert
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+	"strings"
+)
+
+var (
+	// OtherNameTypeChoices maps short names to well known otherName types
+	OtherNameTypeChoices = map[string]asn1.ObjectIdentifier{
+		// UPN is the Microsoft user principal name
+		"UPN": {1, 3, 6, 1, 4, 1, 311, 20, 2, 3},
+	}
+
+	// ErrInvalidSPIFFEID is returned when a certificate carrying a
+	// SPIFFE ID does not conform to the X509-SVID specification
+	ErrInvalidSPIFFEID = errors.New("invalid SPIFFE X509-SVID")
+)
+
+// general name tags as defined at RFC 5280 section 4.2.1.6
+const (
+	generalNameOtherName = 0
+	generalNameEmail     = 1
+	generalNameDNS       = 2
+	generalNameURI       = 6
+	generalNameIP        = 7
+)
+
+// OtherName is an otherName subject alternative name with a string value
+type OtherName struct {
+	TypeID asn1.ObjectIdentifier
+	Value  string
+}
+
+// String renders the otherName as accepted by ParseOtherName
+func (o OtherName) String() string {
+	for name, oid := range OtherNameTypeChoices {
+		if oid.Equal(o.TypeID) {
+			return fmt.Sprintf("%s;UTF8:%s", name, o.Value)
+		}
+	}
+	return fmt.Sprintf("%s;UTF8:%s", o.TypeID, o.Value)
+}
+
+// ParseOtherName reads an otherName written openssl style as
+// "<type>;UTF8:<value>", where type is a dotted OID or a name at
+// OtherNameTypeChoices, as in "UPN;UTF8:user@example.com"
+func ParseOtherName(s string) (OtherName, error) {
+	parts := strings.SplitN(s, ";", 2)
+	if len(parts) != 2 || !strings.HasPrefix(parts[1], "UTF8:") {
+		return OtherName{}, fmt.Errorf("cannot parse %q as an otherName, expected <type>;UTF8:<value>", s)
+	}
+
+	oid, ok := OtherNameTypeChoices[strings.ToUpper(parts[0])]
+	if !ok {
+		var err error
+		if oid, err = parseOID(parts[0]); err != nil {
+			return OtherName{}, fmt.Errorf("unknown otherName type %q", parts[0])
+		}
+	}
+
+	return OtherName{TypeID: oid, Value: strings.TrimPrefix(parts[1], "UTF8:")}, nil
+}
+
+// StringToURIList transforms a comma separated list of absolute URIs into an array
+func StringToURIList(uriList string) ([]*url.URL, error) {
+	uris := []*url.URL{}
+	for _, t := range strings.Split(uriList, ",") {
+		if t == "" {
+			continue
+		}
+		u, err := url.Parse(t)
+		if err != nil || !u.IsAbs() {
+			return nil, fmt.Errorf("cannot parse %s as an absolute URI", t)
+		}
+		uris = append(uris, u)
+	}
+	return uris, nil
+}
+
+// StringToEmailList transforms a comma separated list of mailboxes into an array
+func StringToEmailList(emailList string) ([]string, error) {
+	emails := []string{}
+	for _, t := range strings.Split(emailList, ",") {
+		if t == "" {
+			continue
+		}
+		a, err := mail.ParseAddress(t)
+		if err != nil || a.Address != t {
+			return nil, fmt.Errorf("cannot parse %s as an email address", t)
+		}
+		emails = append(emails, t)
+	}
+	return emails, nil
+}
+
+// marshalSANs encodes the subject alternative name extension, needed
+// when otherNames are present since crypto/x509 cannot write them
+func marshalSANs(dnsNames, emails []string, ips []net.IP, uris []*url.URL, otherNames []OtherName, critical bool) (pkix.Extension, error) {
+	var names []asn1.RawValue
+	for _, o := range otherNames {
+		value, err := asn1.MarshalWithParams(o.Value, "utf8")
+		if err != nil {
+			return pkix.Extension{}, err
+		}
+		oid, err := asn1.Marshal(o.TypeID)
+		if err != nil {
+			return pkix.Extension{}, err
+		}
+		explicit, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: value})
+		if err != nil {
+			return pkix.Extension{}, err
+		}
+		names = append(names, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: generalNameOtherName, IsCompound: true, Bytes: append(oid, explicit...)})
+	}
+	for _, e := range emails {
+		names = append(names, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: generalNameEmail, Bytes: []byte(e)})
+	}
+	for _, d := range dnsNames {
+		names = append(names, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: generalNameDNS, Bytes: []byte(d)})
+	}
+	for _, u := range uris {
+		names = append(names, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: generalNameURI, Bytes: []byte(u.String())})
+	}
+	for _, ip := range ips {
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4
+		}
+		names = append(names, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: generalNameIP, Bytes: ip})
+	}
+
+	b, err := asn1.Marshal(names)
+	if err != nil {
+		return pkix.Extension{}, fmt.Errorf("error encoding subject alternative names: %s", err.Error())
+	}
+	return pkix.Extension{Id: oidExtensionSubjectAltName, Critical: critical, Value: b}, nil
+}
+
+// ParseOtherNames returns the otherName subject alternative names found at
+// the extensions of a certificate or certificate request. Only string
+// values are supported
+func ParseOtherNames(exts []pkix.Extension) ([]OtherName, error) {
+	var otherNames []OtherName
+	for _, e := range exts {
+		if !e.Id.Equal(oidExtensionSubjectAltName) {
+			continue
+		}
+
+		var names []asn1.RawValue
+		if _, err := asn1.Unmarshal(e.Value, &names); err != nil {
+			return nil, fmt.Errorf("error parsing subject alternative names: %s", err.Error())
+		}
+		for _, n := range names {
+			if n.Class != asn1.ClassContextSpecific || n.Tag != generalNameOtherName {
+				continue
+			}
+			var (
+				o        OtherName
+				explicit asn1.RawValue
+				value    asn1.RawValue
+			)
+			rest, err := asn1.Unmarshal(n.Bytes, &o.TypeID)
+			if err == nil {
+				_, err = asn1.Unmarshal(rest, &explicit)
+			}
+			if err == nil {
+				_, err = asn1.Unmarshal(explicit.Bytes, &value)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("error parsing otherName: %s", err.Error())
+			}
+			switch value.Tag {
+			case asn1.TagUTF8String, asn1.TagIA5String, asn1.TagPrintableString:
+				o.Value = string(value.Bytes)
+			default:
+				return nil, fmt.Errorf("otherName %s has an unsupported value type", o.TypeID)
+			}
+			otherNames = append(otherNames, o)
+		}
+	}
+	return otherNames, nil
+}
+
+// ValidateSPIFFE checks the X509-SVID requirements for certificates whose
+// URI subject alternative names include a SPIFFE ID: exactly one URI SAN,
+// a well formed SPIFFE ID with a path for leaf certificates, and key
+// usages matching leaf or CA certificates. A common name is not required
+func ValidateSPIFFE(c *X509Simplified) error {
+	spiffe := false
+	for _, u := range c.URIs {
+		if strings.EqualFold(u.Scheme, "spiffe") {
+			spiffe = true
+		}
+	}
+	if !spiffe {
+		return nil
+	}
+
+	if len(c.URIs) != 1 {
+		return fmt.Errorf("%w: exactly one URI SAN is allowed, found %d", ErrInvalidSPIFFEID, len(c.URIs))
+	}
+	u := c.URIs[0]
+	switch {
+	case u.Scheme != "spiffe":
+		return fmt.Errorf("%w: scheme must be lowercase spiffe", ErrInvalidSPIFFEID)
+	case u.Host == "" || u.Host != strings.ToLower(u.Host):
+		return fmt.Errorf("%w: trust domain must be informed in lowercase", ErrInvalidSPIFFEID)
+	case u.Port() != "" || u.User != nil:
+		return fmt.Errorf("%w: trust domain must not contain port or user info", ErrInvalidSPIFFEID)
+	case u.RawQuery != "" || u.Fragment != "" || u.Opaque != "":
+		return fmt.Errorf("%w: query and fragment are not allowed", ErrInvalidSPIFFEID)
+	case strings.HasSuffix(u.Path, "/") || strings.Contains(u.Path, "//"):
+		return fmt.Errorf("%w: path segments must not be empty", ErrInvalidSPIFFEID)
+	}
+
+	if c.IsCA {
+		if c.KeyUsage&x509.KeyUsageCertSign == 0 {
+			return fmt.Errorf("%w: CA certificates must have KeyUsageCertSign usage", ErrInvalidSPIFFEID)
+		}
+		return nil
+	}
+	if u.Path == "" {
+		return fmt.Errorf("%w: leaf SPIFFE IDs must have a path", ErrInvalidSPIFFEID)
+	}
+	if c.KeyUsage&x509.KeyUsageDigitalSignature == 0 {
+		return fmt.Errorf("%w: leaf certificates must have KeyUsageDigitalSignature usage", ErrInvalidSPIFFEID)
+	}
+	if c.KeyUsage&(x509.KeyUsageCertSign|x509.KeyUsageCRLSign) != 0 {
+		return fmt.Errorf("%w: leaf certificates must not have KeyUsageCertSign nor KeyUsageCRLSign usages", ErrInvalidSPIFFEID)
+	}
+	return nil
+}
@@ -0,0 +1,245 @@
+package cert
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/odacremolbap/xfon/pkg/key"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseOtherName(t *testing.T) {
+	var testData = []struct {
+		testName string
+		name     string
+		expected OtherName
+		errorRet bool
+	}{
+		{
+			testName: "UPN short name",
+			name:     "UPN;UTF8:user@example.com",
+			expected: OtherName{TypeID: OtherNameTypeChoices["UPN"], Value: "user@example.com"},
+		},
+		{
+			testName: "dotted OID",
+			name:     "1.2.3.4;UTF8:some;value",
+			expected: OtherName{TypeID: asn1.ObjectIdentifier{1, 2, 3, 4}, Value: "some;value"},
+		},
+		{
+			testName: "missing encoding",
+			name:     "UPN;user@example.com",
+			errorRet: true,
+		},
+		{
+			testName: "unknown type",
+			name:     "FOO;UTF8:bar",
+			errorRet: true,
+		},
+	}
+
+	for _, td := range testData {
+		o, err := ParseOtherName(td.name)
+		if td.errorRet {
+			assert.Errorf(t, err, "test: %s", td.testName)
+			continue
+		}
+		assert.NoErrorf(t, err, "test: %s", td.testName)
+		assert.Equal(t, td.expected, o, "test: %s", td.testName)
+	}
+}
+
+func TestStringToURIList(t *testing.T) {
+	u, err := StringToURIList("spiffe://example.org/ns/x/sa/y,https://example.com/a")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(u))
+	assert.Equal(t, "example.org", u[0].Host)
+
+	_, err = StringToURIList("not/absolute")
+	assert.NotNil(t, err)
+}
+
+func TestStringToEmailList(t *testing.T) {
+	e, err := StringToEmailList("a@example.com,b@example.org")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a@example.com", "b@example.org"}, e)
+
+	for _, invalid := range []string{"example.com", "A <a@example.com>"} {
+		_, err = StringToEmailList(invalid)
+		assert.NotNil(t, err, "test: %s", invalid)
+	}
+}
+
+func TestValidateSPIFFE(t *testing.T) {
+	uris := func(s ...string) []*url.URL {
+		var u []*url.URL
+		for _, v := range s {
+			p, _ := url.Parse(v)
+			u = append(u, p)
+		}
+		return u
+	}
+
+	var testData = []struct {
+		testName string
+		x        *X509Simplified
+		errorRet bool
+	}{
+		{
+			testName: "no SPIFFE ID",
+			x:        &X509Simplified{URIs: uris("https://a.example.com", "https://b.example.com")},
+		},
+		{
+			testName: "workload SVID",
+			x:        &X509Simplified{URIs: uris("spiffe://example.org/ns/x/sa/y"), KeyUsage: x509.KeyUsageDigitalSignature},
+		},
+		{
+			testName: "CA SVID",
+			x:        &X509Simplified{URIs: uris("spiffe://example.org"), IsCA: true, KeyUsage: x509.KeyUsageCertSign},
+		},
+		{
+			testName: "more than one URI",
+			x:        &X509Simplified{URIs: uris("spiffe://example.org/a", "https://example.com"), KeyUsage: x509.KeyUsageDigitalSignature},
+			errorRet: true,
+		},
+		{
+			testName: "leaf without path",
+			x:        &X509Simplified{URIs: uris("spiffe://example.org"), KeyUsage: x509.KeyUsageDigitalSignature},
+			errorRet: true,
+		},
+		{
+			testName: "uppercase trust domain",
+			x:        &X509Simplified{URIs: uris("spiffe://Example.org/a"), KeyUsage: x509.KeyUsageDigitalSignature},
+			errorRet: true,
+		},
+		{
+			testName: "port",
+			x:        &X509Simplified{URIs: uris("spiffe://example.org:443/a"), KeyUsage: x509.KeyUsageDigitalSignature},
+			errorRet: true,
+		},
+		{
+			testName: "query",
+			x:        &X509Simplified{URIs: uris("spiffe://example.org/a?b=c"), KeyUsage: x509.KeyUsageDigitalSignature},
+			errorRet: true,
+		},
+		{
+			testName: "empty path segment",
+			x:        &X509Simplified{URIs: uris("spiffe://example.org/a//b"), KeyUsage: x509.KeyUsageDigitalSignature},
+			errorRet: true,
+		},
+		{
+			testName: "leaf without digital signature",
+			x:        &X509Simplified{URIs: uris("spiffe://example.org/a"), KeyUsage: x509.KeyUsageKeyEncipherment},
+			errorRet: true,
+		},
+		{
+			testName: "leaf with cert sign",
+			x:        &X509Simplified{URIs: uris("spiffe://example.org/a"), KeyUsage: x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign},
+			errorRet: true,
+		},
+		{
+			testName: "CA without cert sign",
+			x:        &X509Simplified{URIs: uris("spiffe://example.org"), IsCA: true},
+			errorRet: true,
+		},
+	}
+
+	for _, td := range testData {
+		err := ValidateSPIFFE(td.x)
+		if td.errorRet {
+			assert.True(t, errors.Is(err, ErrInvalidSPIFFEID), "test: %s", td.testName)
+		} else {
+			assert.NoErrorf(t, err, "test: %s", td.testName)
+		}
+	}
+}
+
+func TestAlternativeNames(t *testing.T) {
+	k, err := key.GenerateKey(&key.Options{Type: key.ECDSA, Curve: "P-256"})
+	assert.Nil(t, err)
+	spiffeID, _ := url.Parse("spiffe://example.org/ns/x/sa/y")
+	upn := OtherName{TypeID: OtherNameTypeChoices["UPN"], Value: "user@example.com"}
+
+	var testData = []struct {
+		testName string
+		x        *X509Simplified
+		critical bool
+		errorRet bool
+	}{
+		{
+			testName: "SPIFFE ID without subject",
+			x: &X509Simplified{
+				Subject:  &Subject{},
+				URIs:     []*url.URL{spiffeID},
+				KeyUsage: x509.KeyUsageDigitalSignature,
+			},
+			critical: true,
+		},
+		{
+			testName: "every SAN type",
+			x: &X509Simplified{
+				Subject:        &Subject{CommonName: "user"},
+				DNSNames:       []string{"user.example.com"},
+				IPAddresses:    []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("fd00::1")},
+				URIs:           []*url.URL{spiffeID},
+				EmailAddresses: []string{"user@example.com"},
+				OtherNames:     []OtherName{upn},
+				KeyUsage:       x509.KeyUsageDigitalSignature,
+			},
+		},
+		{
+			testName: "otherName without subject",
+			x: &X509Simplified{
+				Subject:    &Subject{},
+				OtherNames: []OtherName{upn},
+			},
+			critical: true,
+		},
+		{
+			testName: "otherName with subject alternative name extension",
+			x: &X509Simplified{
+				Subject:         &Subject{CommonName: "user"},
+				OtherNames:      []OtherName{upn},
+				ExtraExtensions: []pkix.Extension{{Id: oidExtensionSubjectAltName, Value: []byte{0x30, 0x00}}},
+			},
+			errorRet: true,
+		},
+	}
+
+	for _, td := range testData {
+		td.x.NotBefore = time.Now().UTC()
+		td.x.NotAfter = time.Now().AddDate(0, 0, 1).UTC()
+		b, err := GenerateX509SelfSignedCertificate(td.x, k)
+		if td.errorRet {
+			assert.Errorf(t, err, "test: %s", td.testName)
+			continue
+		}
+		assert.NoErrorf(t, err, "test: %s", td.testName)
+		c, err := x509.ParseCertificate(b)
+		assert.NoErrorf(t, err, "test: %s", td.testName)
+
+		assert.Equal(t, len(td.x.DNSNames), len(c.DNSNames), "test: %s", td.testName)
+		assert.Equal(t, len(td.x.IPAddresses), len(c.IPAddresses), "test: %s", td.testName)
+		assert.Equal(t, len(td.x.URIs), len(c.URIs), "test: %s", td.testName)
+		assert.Equal(t, len(td.x.EmailAddresses), len(c.EmailAddresses), "test: %s", td.testName)
+		for i, ip := range td.x.IPAddresses {
+			assert.True(t, ip.Equal(c.IPAddresses[i]), "test: %s", td.testName)
+		}
+
+		otherNames, err := ParseOtherNames(c.Extensions)
+		assert.NoErrorf(t, err, "test: %s", td.testName)
+		assert.Equal(t, td.x.OtherNames, otherNames, "test: %s", td.testName)
+
+		for _, e := range c.Extensions {
+			if e.Id.Equal(oidExtensionSubjectAltName) {
+				assert.Equal(t, td.critical, e.Critical, "test: %s", td.testName)
+			}
+		}
+	}
+}
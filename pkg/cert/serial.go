@@ -0,0 +1,166 @@
+package cert
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/odacremolbap/xfon/pkg/filesystem"
+)
+
+// serialBits is the size of generated serial numbers
+const serialBits = 128
+
+// ErrDuplicateSerial is returned when registering a serial
+// already issued by the same CA
+var ErrDuplicateSerial = errors.New("serial number already issued by this CA")
+
+// GenerateSerial returns a random positive 128 bits serial number
+func GenerateSerial() (*big.Int, error) {
+	max := new(big.Int).Lsh(big.NewInt(1), serialBits)
+	for {
+		s, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return nil, fmt.Errorf("error generating serial number: %s", err.Error())
+		}
+		if s.Sign() > 0 {
+			return s, nil
+		}
+	}
+}
+
+// ParseSerial reads a serial number written in decimal, in hex
+// with 0x prefix, or as colon separated hex
+func ParseSerial(s string) (*big.Int, error) {
+	var (
+		n  = new(big.Int)
+		ok bool
+	)
+	switch {
+	case strings.HasPrefix(s, "0x"), strings.HasPrefix(s, "0X"):
+		_, ok = n.SetString(s[2:], 16)
+	case strings.Contains(s, ":"):
+		_, ok = n.SetString(strings.Replace(s, ":", "", -1), 16)
+	default:
+		_, ok = n.SetString(s, 10)
+	}
+	if !ok {
+		return nil, fmt.Errorf("cannot parse %q as a serial number", s)
+	}
+	if n.Sign() <= 0 {
+		return nil, fmt.Errorf("serial number %q must be positive", s)
+	}
+	if n.BitLen() > 159 {
+		return nil, fmt.Errorf("serial number %q is longer than 20 octets", s)
+	}
+	return n, nil
+}
+
+// SerialRegistry keeps track of the serial numbers issued by each CA,
+// identified by the SHA-256 of its public key. It is stored as JSON
+type SerialRegistry struct {
+	path string
+
+	// Issuers maps a CA key hash to the hex serials it issued
+	Issuers map[string][]string `json:"issuers"`
+}
+
+// OpenSerialRegistry reads the registry at path. The
+// registry is empty when the file does not exist
+func OpenSerialRegistry(path string) (*SerialRegistry, error) {
+	r := &SerialRegistry{
+		path:    path,
+		Issuers: map[string][]string{},
+	}
+
+	b, err := filesystem.ReadContentsFromFile(path)
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading serial registry: %s", err.Error())
+	}
+
+	if err := json.Unmarshal(b, r); err != nil {
+		return nil, fmt.Errorf("error parsing serial registry %q: %s", path, err.Error())
+	}
+	if r.Issuers == nil {
+		r.Issuers = map[string][]string{}
+	}
+
+	return r, nil
+}
+
+// Contains returns whether the issuer already issued the serial
+func (r *SerialRegistry) Contains(issuer crypto.PublicKey, serial *big.Int) (bool, error) {
+	id, err := issuerID(issuer)
+	if err != nil {
+		return false, err
+	}
+
+	s := serial.Text(16)
+	for _, v := range r.Issuers[id] {
+		if v == s {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Add registers the serial for the issuer, failing
+// with ErrDuplicateSerial if it was already issued
+func (r *SerialRegistry) Add(issuer crypto.PublicKey, serial *big.Int) error {
+	found, err := r.Contains(issuer, serial)
+	if err != nil {
+		return err
+	}
+	if found {
+		return ErrDuplicateSerial
+	}
+
+	id, _ := issuerID(issuer)
+	r.Issuers[id] = append(r.Issuers[id], serial.Text(16))
+	return nil
+}
+
+// Save writes the registry back to disk
+func (r *SerialRegistry) Save() error {
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return filesystem.WriteContentsToFile(r.path, string(b)+"\n")
+}
+
+// NewRegisteredSerial returns a random serial not yet
+// issued by the issuer, and adds it to the registry
+func (r *SerialRegistry) NewRegisteredSerial(issuer crypto.PublicKey) (*big.Int, error) {
+	for {
+		s, err := GenerateSerial()
+		if err != nil {
+			return nil, err
+		}
+		err = r.Add(issuer, s)
+		if err != ErrDuplicateSerial {
+			return s, err
+		}
+	}
+}
+
+// issuerID identifies a CA by the SHA-256 of its public key
+func issuerID(issuer crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(issuer)
+	if err != nil {
+		return "", fmt.Errorf("error marshaling issuer public key: %s", err.Error())
+	}
+	h := sha256.Sum256(der)
+	return hex.EncodeToString(h[:]), nil
+}
@@ -0,0 +1,96 @@
+package cert
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/odacremolbap/xfon/pkg/key"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateSerial(t *testing.T) {
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		s, err := GenerateSerial()
+		assert.Nil(t, err)
+		assert.Equal(t, 1, s.Sign())
+		assert.True(t, s.BitLen() <= 128)
+		assert.False(t, seen[s.String()])
+		seen[s.String()] = true
+	}
+}
+
+func TestDefaultSerial(t *testing.T) {
+	k, _ := key.GenerateKey(&key.Options{Type: key.Ed25519})
+	x := &X509Simplified{
+		Subject:   &Subject{CommonName: "serial"},
+		NotBefore: time.Now().UTC(),
+		NotAfter:  time.Now().AddDate(0, 0, 1).UTC(),
+	}
+	_, err := GenerateX509SelfSignedCertificate(x, k)
+	assert.Nil(t, err)
+	assert.NotNil(t, x.Serial)
+	assert.Equal(t, 1, x.Serial.Sign())
+}
+
+func TestParseSerial(t *testing.T) {
+	var testData = []struct {
+		testName string
+		serial   string
+		expected *big.Int
+		errorRet bool
+	}{
+		{testName: "decimal", serial: "4660", expected: big.NewInt(4660)},
+		{testName: "hex", serial: "0x1234", expected: big.NewInt(4660)},
+		{testName: "colon hex", serial: "12:34", expected: big.NewInt(4660)},
+		{testName: "zero", serial: "0", errorRet: true},
+		{testName: "negative", serial: "-1", errorRet: true},
+		{testName: "not a number", serial: "serial", errorRet: true},
+		{testName: "too long", serial: "0x" + "ff" + "00112233445566778899aabbccddeeff00112233", errorRet: true},
+	}
+
+	for _, td := range testData {
+		s, err := ParseSerial(td.serial)
+		if td.errorRet {
+			assert.Errorf(t, err, "test: %s", td.testName)
+			continue
+		}
+		assert.NoErrorf(t, err, "test: %s", td.testName)
+		assert.Equalf(t, td.expected, s, "test: %s", td.testName)
+	}
+}
+
+func TestSerialRegistry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "serial")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "registry.json")
+
+	ca1, _ := key.GenerateKey(&key.Options{Type: key.ECDSA, Curve: "P-256"})
+	ca2, _ := key.GenerateKey(&key.Options{Type: key.ECDSA, Curve: "P-256"})
+
+	r, err := OpenSerialRegistry(path)
+	assert.Nil(t, err)
+	assert.Nil(t, r.Add(ca1.Public(), big.NewInt(1)))
+	assert.Equal(t, ErrDuplicateSerial, r.Add(ca1.Public(), big.NewInt(1)))
+	// same serial from a different CA is fine
+	assert.Nil(t, r.Add(ca2.Public(), big.NewInt(1)))
+	s, err := r.NewRegisteredSerial(ca1.Public())
+	assert.Nil(t, err)
+	assert.Nil(t, r.Save())
+
+	r, err = OpenSerialRegistry(path)
+	assert.Nil(t, err)
+	for _, serial := range []*big.Int{big.NewInt(1), s} {
+		found, err := r.Contains(ca1.Public(), serial)
+		assert.Nil(t, err)
+		assert.True(t, found)
+	}
+	found, _ := r.Contains(ca2.Public(), s)
+	assert.False(t, found)
+}
@@ -0,0 +1,349 @@
+package cert
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	oidCountry            = asn1.ObjectIdentifier{2, 5, 4, 6}
+	oidOrganization       = asn1.ObjectIdentifier{2, 5, 4, 10}
+	oidOrganizationalUnit = asn1.ObjectIdentifier{2, 5, 4, 11}
+	oidCommonName         = asn1.ObjectIdentifier{2, 5, 4, 3}
+	oidSerialNumber       = asn1.ObjectIdentifier{2, 5, 4, 5}
+	oidLocality           = asn1.ObjectIdentifier{2, 5, 4, 7}
+	oidProvince           = asn1.ObjectIdentifier{2, 5, 4, 8}
+	oidStreetAddress      = asn1.ObjectIdentifier{2, 5, 4, 9}
+	oidPostalCode         = asn1.ObjectIdentifier{2, 5, 4, 17}
+	oidEmailAddress       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 1}
+
+	// SubjectAttributeChoices maps the attribute short names accepted
+	// by ParseSubject to their OIDs. Names are matched case insensitive
+	SubjectAttributeChoices = map[string]asn1.ObjectIdentifier{
+		"C":            oidCountry,
+		"ST":           oidProvince,
+		"L":            oidLocality,
+		"STREET":       oidStreetAddress,
+		"POSTALCODE":   oidPostalCode,
+		"O":            oidOrganization,
+		"OU":           oidOrganizationalUnit,
+		"CN":           oidCommonName,
+		"SERIALNUMBER": oidSerialNumber,
+		"EMAILADDRESS": oidEmailAddress,
+		"E":            oidEmailAddress,
+	}
+)
+
+// Subject for x509 certificate
+type Subject struct {
+	CommonName         string
+	Country            []string
+	Province           []string
+	Locality           []string
+	StreetAddress      []string
+	PostalCode         []string
+	Organization       []string
+	OrganizationalUnit []string
+	SerialNumber       string
+	EmailAddress       []string
+
+	// ExtraAttributes are added to the subject by OID
+	ExtraAttributes []pkix.AttributeTypeAndValue
+}
+
+// Name returns the pkix representation of the subject. Every value
+// is written as its own RDN, in C, ST, L, STREET, POSTALCODE, O, OU,
+// CN, SERIALNUMBER, emailAddress order followed by extra attributes
+func (s *Subject) Name() pkix.Name {
+	n := pkix.Name{
+		CommonName:         s.CommonName,
+		Country:            s.Country,
+		Province:           s.Province,
+		Locality:           s.Locality,
+		StreetAddress:      s.StreetAddress,
+		PostalCode:         s.PostalCode,
+		Organization:       s.Organization,
+		OrganizationalUnit: s.OrganizationalUnit,
+		SerialNumber:       s.SerialNumber,
+	}
+
+	// pkix.Name groups values of the same type into a single
+	// multi-valued RDN, ExtraNames are written one per RDN
+	add := func(oid asn1.ObjectIdentifier, values ...string) {
+		for _, v := range values {
+			if v == "" {
+				continue
+			}
+			n.ExtraNames = append(n.ExtraNames, pkix.AttributeTypeAndValue{Type: oid, Value: v})
+		}
+	}
+	add(oidCountry, s.Country...)
+	add(oidProvince, s.Province...)
+	add(oidLocality, s.Locality...)
+	add(oidStreetAddress, s.StreetAddress...)
+	add(oidPostalCode, s.PostalCode...)
+	add(oidOrganization, s.Organization...)
+	add(oidOrganizationalUnit, s.OrganizationalUnit...)
+	add(oidCommonName, s.CommonName)
+	add(oidSerialNumber, s.SerialNumber)
+	for _, e := range s.EmailAddress {
+		n.ExtraNames = append(n.ExtraNames, pkix.AttributeTypeAndValue{
+			Type:  oidEmailAddress,
+			Value: asn1.RawValue{Tag: asn1.TagIA5String, Bytes: []byte(e)},
+		})
+	}
+	n.ExtraNames = append(n.ExtraNames, s.ExtraAttributes...)
+
+	return n
+}
+
+// SubjectFromName returns the simplified subject for a pkix name
+func SubjectFromName(n pkix.Name) *Subject {
+	s := &Subject{
+		CommonName:         n.CommonName,
+		Country:            n.Country,
+		Province:           n.Province,
+		Locality:           n.Locality,
+		StreetAddress:      n.StreetAddress,
+		PostalCode:         n.PostalCode,
+		Organization:       n.Organization,
+		OrganizationalUnit: n.OrganizationalUnit,
+		SerialNumber:       n.SerialNumber,
+	}
+
+	for _, a := range n.Names {
+		if isKnownAttribute(a.Type) {
+			continue
+		}
+		if a.Type.Equal(oidEmailAddress) {
+			if v, ok := a.Value.(string); ok {
+				s.EmailAddress = append(s.EmailAddress, v)
+			}
+			continue
+		}
+		s.ExtraAttributes = append(s.ExtraAttributes, a)
+	}
+
+	return s
+}
+
+// Override replaces the subject fields with the ones informed at o
+func (s *Subject) Override(o *Subject) {
+	if o.CommonName != "" {
+		s.CommonName = o.CommonName
+	}
+	if o.SerialNumber != "" {
+		s.SerialNumber = o.SerialNumber
+	}
+	for _, f := range []struct {
+		dst *[]string
+		src []string
+	}{
+		{&s.Country, o.Country},
+		{&s.Province, o.Province},
+		{&s.Locality, o.Locality},
+		{&s.StreetAddress, o.StreetAddress},
+		{&s.PostalCode, o.PostalCode},
+		{&s.Organization, o.Organization},
+		{&s.OrganizationalUnit, o.OrganizationalUnit},
+		{&s.EmailAddress, o.EmailAddress},
+	} {
+		if len(f.src) != 0 {
+			*f.dst = f.src
+		}
+	}
+	if len(o.ExtraAttributes) != 0 {
+		s.ExtraAttributes = o.ExtraAttributes
+	}
+}
+
+// ParseSubject reads a subject written either openssl style,
+// as in "/C=ES/O=Acme/CN=foo", or as an RFC 4514 string,
+// as in "CN=foo,O=Acme,C=ES". Attributes can be informed by
+// short name or by dotted OID
+func ParseSubject(subject string) (*Subject, error) {
+	var (
+		parts []string
+		err   error
+	)
+	if strings.HasPrefix(subject, "/") {
+		parts, err = splitEscaped(subject[1:], "/+")
+	} else {
+		parts, err = splitEscaped(subject, ",+")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Subject{}
+	for _, p := range parts {
+		if strings.TrimSpace(p) == "" {
+			continue
+		}
+		if err := s.AddAttribute(p); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// AddAttribute parses a single "TYPE=value" attribute and adds
+// it to the subject. TYPE is a short name or a dotted OID
+func (s *Subject) AddAttribute(attribute string) error {
+	i := strings.Index(attribute, "=")
+	if i <= 0 {
+		return fmt.Errorf("attribute %q is not in TYPE=value form", attribute)
+	}
+	name := strings.TrimSpace(attribute[:i])
+	value, err := unescapeValue(strings.TrimSpace(attribute[i+1:]))
+	if err != nil {
+		return fmt.Errorf("attribute %q: %s", attribute, err.Error())
+	}
+
+	oid, ok := SubjectAttributeChoices[strings.ToUpper(name)]
+	if !ok {
+		oid, err = parseOID(name)
+		if err != nil {
+			return fmt.Errorf("unknown subject attribute %q", name)
+		}
+	}
+
+	switch {
+	case oid.Equal(oidCommonName):
+		s.CommonName = value
+	case oid.Equal(oidSerialNumber):
+		s.SerialNumber = value
+	case oid.Equal(oidCountry):
+		s.Country = append(s.Country, value)
+	case oid.Equal(oidProvince):
+		s.Province = append(s.Province, value)
+	case oid.Equal(oidLocality):
+		s.Locality = append(s.Locality, value)
+	case oid.Equal(oidStreetAddress):
+		s.StreetAddress = append(s.StreetAddress, value)
+	case oid.Equal(oidPostalCode):
+		s.PostalCode = append(s.PostalCode, value)
+	case oid.Equal(oidOrganization):
+		s.Organization = append(s.Organization, value)
+	case oid.Equal(oidOrganizationalUnit):
+		s.OrganizationalUnit = append(s.OrganizationalUnit, value)
+	case oid.Equal(oidEmailAddress):
+		s.EmailAddress = append(s.EmailAddress, value)
+	default:
+		s.ExtraAttributes = append(s.ExtraAttributes, pkix.AttributeTypeAndValue{Type: oid, Value: value})
+	}
+
+	return nil
+}
+
+// isKnownAttribute returns whether pkix.Name already
+// has a field for the attribute
+func isKnownAttribute(oid asn1.ObjectIdentifier) bool {
+	for _, known := range []asn1.ObjectIdentifier{
+		oidCountry, oidOrganization, oidOrganizationalUnit, oidCommonName,
+		oidSerialNumber, oidLocality, oidProvince, oidStreetAddress, oidPostalCode,
+	} {
+		if oid.Equal(known) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseOID reads a dotted OID
+func parseOID(s string) (asn1.ObjectIdentifier, error) {
+	parts := strings.Split(s, ".")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("invalid OID %q", s)
+	}
+	oid := make(asn1.ObjectIdentifier, len(parts))
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid OID %q", s)
+		}
+		oid[i] = n
+	}
+	return oid, nil
+}
+
+// splitEscaped splits s at any of the separators not escaped by a backslash
+func splitEscaped(s, separators string) ([]string, error) {
+	var (
+		parts   []string
+		current strings.Builder
+	)
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			if i+1 >= len(s) {
+				return nil, fmt.Errorf("subject %q ends with an escape character", s)
+			}
+			current.WriteByte(s[i])
+			current.WriteByte(s[i+1])
+			i++
+		case strings.IndexByte(separators, s[i]) >= 0:
+			parts = append(parts, current.String())
+			current.Reset()
+		default:
+			current.WriteByte(s[i])
+		}
+	}
+	return append(parts, current.String()), nil
+}
+
+// unescapeValue resolves backslash escaped characters and
+// RFC 4514 hex pairs
+func unescapeValue(s string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i+1 >= len(s) {
+			return "", fmt.Errorf("value %q ends with an escape character", s)
+		}
+		if i+2 < len(s) && isHex(s[i+1]) && isHex(s[i+2]) {
+			v, _ := hex.DecodeString(s[i+1 : i+3])
+			b.Write(v)
+			i += 2
+			continue
+		}
+		b.WriteByte(s[i+1])
+		i++
+	}
+	return b.String(), nil
+}
+
+func isHex(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+// BuildSubject composes a subject from a subject string as accepted by
+// ParseSubject, a list of "TYPE=value" attributes, and the fields informed
+// at fields, which take precedence
+func BuildSubject(subject string, attributes []string, fields *Subject) (*Subject, error) {
+	s := &Subject{}
+	if subject != "" {
+		var err error
+		s, err = ParseSubject(subject)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, a := range attributes {
+		if err := s.AddAttribute(a); err != nil {
+			return nil, err
+		}
+	}
+
+	s.Override(fields)
+	return s, nil
+}
@@ -0,0 +1,134 @@
+package cert
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"testing"
+	"time"
+
+	"github.com/odacremolbap/xfon/pkg/key"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSubject(t *testing.T) {
+	var testData = []struct {
+		testName string
+		subject  string
+		expected *Subject
+		errorRet bool
+	}{
+		{
+			testName: "openssl style",
+			subject:  "/C=ES/ST=Madrid/L=Madrid/O=Acme/OU=dev/OU=ops/CN=foo",
+			expected: &Subject{
+				CommonName:         "foo",
+				Country:            []string{"ES"},
+				Province:           []string{"Madrid"},
+				Locality:           []string{"Madrid"},
+				Organization:       []string{"Acme"},
+				OrganizationalUnit: []string{"dev", "ops"},
+			},
+		},
+		{
+			testName: "openssl escaped slash",
+			subject:  "/O=Acme\\/Inc/CN=foo",
+			expected: &Subject{
+				CommonName:   "foo",
+				Organization: []string{"Acme/Inc"},
+			},
+		},
+		{
+			testName: "rfc4514",
+			subject:  "CN=foo,O=Acme\\, Inc.,POSTALCODE=28001,STREET=Gran Via 1,serialNumber=1234,emailAddress=foo@acme.com",
+			expected: &Subject{
+				CommonName:    "foo",
+				Organization:  []string{"Acme, Inc."},
+				PostalCode:    []string{"28001"},
+				StreetAddress: []string{"Gran Via 1"},
+				SerialNumber:  "1234",
+				EmailAddress:  []string{"foo@acme.com"},
+			},
+		},
+		{
+			testName: "rfc4514 hex escape",
+			subject:  "CN=foo\\2Cbar",
+			expected: &Subject{
+				CommonName: "foo,bar",
+			},
+		},
+		{
+			testName: "by oid",
+			subject:  "CN=foo,1.3.6.1.4.1.55555.1=custom",
+			expected: &Subject{
+				CommonName: "foo",
+				ExtraAttributes: []pkix.AttributeTypeAndValue{
+					{Type: asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 55555, 1}, Value: "custom"},
+				},
+			},
+		},
+		{
+			testName: "unknown attribute",
+			subject:  "CN=foo,XX=bar",
+			errorRet: true,
+		},
+		{
+			testName: "no value",
+			subject:  "/CN",
+			errorRet: true,
+		},
+	}
+
+	for _, td := range testData {
+		s, err := ParseSubject(td.subject)
+		if td.errorRet {
+			assert.Errorf(t, err, "test: %s", td.testName)
+			continue
+		}
+		assert.NoErrorf(t, err, "test: %s", td.testName)
+		assert.Equalf(t, td.expected, s, "test: %s", td.testName)
+	}
+}
+
+func TestBuildSubject(t *testing.T) {
+	s, err := BuildSubject("/C=ES/O=Acme/CN=foo",
+		[]string{"L=Madrid"},
+		&Subject{CommonName: "bar", OrganizationalUnit: []string{"dev"}})
+	assert.Nil(t, err)
+	assert.Equal(t, &Subject{
+		CommonName:         "bar",
+		Country:            []string{"ES"},
+		Locality:           []string{"Madrid"},
+		Organization:       []string{"Acme"},
+		OrganizationalUnit: []string{"dev"},
+	}, s)
+}
+
+func TestSubjectRoundTrip(t *testing.T) {
+	s, err := ParseSubject("/C=ES/ST=Madrid/L=Madrid/street=Gran Via 1/postalCode=28001/O=Acme/O=Acme Labs/OU=dev/serialNumber=1234/emailAddress=foo@acme.com/1.3.6.1.4.1.55555.1=custom/CN=foo")
+	assert.Nil(t, err)
+
+	k, _ := key.GenerateKey(&key.Options{Type: key.Ed25519})
+	b, err := GenerateX509SelfSignedCertificate(&X509Simplified{
+		Subject:   s,
+		NotBefore: time.Now().UTC(),
+		NotAfter:  time.Now().AddDate(0, 0, 1).UTC(),
+	}, k)
+	assert.Nil(t, err)
+	c, _ := x509.ParseCertificate(b)
+
+	assert.Equal(t, []string{"Acme", "Acme Labs"}, c.Subject.Organization)
+	assert.Equal(t, []string{"Gran Via 1"}, c.Subject.StreetAddress)
+	assert.Equal(t, "1234", c.Subject.SerialNumber)
+	assert.Equal(t, s, SubjectFromName(c.Subject))
+
+	// every value is its own RDN
+	var rdns pkix.RDNSequence
+	_, err = asn1.Unmarshal(c.RawSubject, &rdns)
+	assert.Nil(t, err)
+	assert.Len(t, rdns, 12)
+	for _, rdn := range rdns {
+		assert.Len(t, rdn, 1)
+	}
+}
@@ -0,0 +1,209 @@
+package cert
+
+import (
+	"bytes"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// FailureReason classifies a chain verification failure
+type FailureReason int
+
+const (
+	// FailureOther is any failure not classified below
+	FailureOther FailureReason = iota + 1
+	// FailureExpired means a certificate at the chain is expired
+	// or not yet valid
+	FailureExpired
+	// FailureUnknownAuthority means the chain could not be built
+	// up to a trusted root
+	FailureUnknownAuthority
+	// FailureNameMismatch means the leaf is not valid for the
+	// requested hostname or IP address
+	FailureNameMismatch
+	// FailureIncompatibleUsage means the chain is not valid for
+	// the requested extended key usages
+	FailureIncompatibleUsage
+	// FailureNotAuthorized means an issuer at the chain is not
+	// allowed to sign certificates, or violates its constraints
+	FailureNotAuthorized
+)
+
+// String returns a short name for the failure reason
+func (r FailureReason) String() string {
+	switch r {
+	case FailureExpired:
+		return "expired"
+	case FailureUnknownAuthority:
+		return "unknown authority"
+	case FailureNameMismatch:
+		return "name mismatch"
+	case FailureIncompatibleUsage:
+		return "incompatible usage"
+	case FailureNotAuthorized:
+		return "issuer not authorized"
+	}
+	return "invalid"
+}
+
+// VerifyError is returned when a certificate chain is not valid
+type VerifyError struct {
+	Reason      FailureReason
+	Explanation string
+	Err         error
+}
+
+func (e *VerifyError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Reason, e.Explanation)
+}
+
+// Unwrap returns the underlying x509 error
+func (e *VerifyError) Unwrap() error {
+	return e.Err
+}
+
+// VerifyOptions for certificate chain verification
+type VerifyOptions struct {
+	// Roots are the trusted certificates. When empty the
+	// system roots are used
+	Roots []*x509.Certificate
+	// Intermediates are untrusted certificates that can be
+	// used to build the chain
+	Intermediates []*x509.Certificate
+	// Name is a hostname or IP address the leaf must be valid for
+	Name string
+	// ExtKeyUsages that the chain must allow. When empty
+	// any usage is accepted
+	ExtKeyUsages []x509.ExtKeyUsage
+	// At is the time used to check validity, now when zero
+	At time.Time
+}
+
+// Verify builds and verifies the certificate chains for the certificate.
+// Failures are returned as a *VerifyError
+func Verify(c *x509.Certificate, o *VerifyOptions) ([][]*x509.Certificate, error) {
+	opts := x509.VerifyOptions{
+		DNSName:       o.Name,
+		Intermediates: x509.NewCertPool(),
+		CurrentTime:   o.At,
+		KeyUsages:     o.ExtKeyUsages,
+	}
+	if len(opts.KeyUsages) == 0 {
+		opts.KeyUsages = []x509.ExtKeyUsage{x509.ExtKeyUsageAny}
+	}
+	if len(o.Roots) != 0 {
+		opts.Roots = x509.NewCertPool()
+		for _, r := range o.Roots {
+			opts.Roots.AddCert(r)
+		}
+	}
+	for _, i := range o.Intermediates {
+		opts.Intermediates.AddCert(i)
+	}
+
+	chains, err := c.Verify(opts)
+	if err != nil {
+		return nil, classifyVerifyError(err, o)
+	}
+
+	return chains, nil
+}
+
+// classifyVerifyError turns an x509 verification error into a VerifyError
+func classifyVerifyError(err error, o *VerifyOptions) *VerifyError {
+	var (
+		invalid   x509.CertificateInvalidError
+		unknown   x509.UnknownAuthorityError
+		hostname  x509.HostnameError
+		verifyErr = &VerifyError{Reason: FailureOther, Explanation: err.Error(), Err: err}
+	)
+
+	switch {
+	case errors.As(err, &hostname):
+		verifyErr.Reason = FailureNameMismatch
+		verifyErr.Explanation = fmt.Sprintf("certificate %q is not valid for %q, valid names are %v %v",
+			hostname.Certificate.Subject, hostname.Host, hostname.Certificate.DNSNames, hostname.Certificate.IPAddresses)
+
+	case errors.As(err, &unknown):
+		verifyErr.Reason = FailureUnknownAuthority
+		if unknown.Cert == nil {
+			break
+		}
+		verifyErr.Explanation = fmt.Sprintf("certificate %q is signed by %q, which is not a trusted root nor a known intermediate",
+			unknown.Cert.Subject, unknown.Cert.Issuer)
+
+		// the issuer might be known but rejected while building the chain
+		issuer := findIssuer(unknown.Cert, append(append([]*x509.Certificate{}, o.Roots...), o.Intermediates...))
+		if issuer == nil {
+			break
+		}
+		at := verifyTime(o)
+		switch {
+		case at.Before(issuer.NotBefore) || at.After(issuer.NotAfter):
+			verifyErr.Reason = FailureExpired
+			verifyErr.Explanation = fmt.Sprintf("issuer %q is not valid at %s, validity is %s to %s",
+				issuer.Subject, at.UTC().Format(time.RFC3339),
+				issuer.NotBefore.UTC().Format(time.RFC3339), issuer.NotAfter.UTC().Format(time.RFC3339))
+		case !issuer.BasicConstraintsValid || !issuer.IsCA:
+			verifyErr.Reason = FailureNotAuthorized
+			verifyErr.Explanation = fmt.Sprintf("issuer %q is not a CA allowed to sign certificates", issuer.Subject)
+		default:
+			verifyErr.Reason = FailureNotAuthorized
+			verifyErr.Explanation = fmt.Sprintf("issuer %q was rejected: %s", issuer.Subject, err.Error())
+		}
+
+	case errors.As(err, &invalid):
+		subject := invalid.Cert.Subject.String()
+		switch invalid.Reason {
+		case x509.Expired:
+			at := verifyTime(o)
+			verifyErr.Reason = FailureExpired
+			if at.Before(invalid.Cert.NotBefore) {
+				verifyErr.Explanation = fmt.Sprintf("certificate %q is not valid before %s",
+					subject, invalid.Cert.NotBefore.UTC().Format(time.RFC3339))
+			} else {
+				verifyErr.Explanation = fmt.Sprintf("certificate %q expired at %s",
+					subject, invalid.Cert.NotAfter.UTC().Format(time.RFC3339))
+			}
+		case x509.IncompatibleUsage, x509.CANotAuthorizedForExtKeyUsage:
+			verifyErr.Reason = FailureIncompatibleUsage
+			verifyErr.Explanation = fmt.Sprintf("certificate %q chain does not allow the requested usages %v",
+				subject, ExtKeyUsageToStrings(o.ExtKeyUsages))
+		case x509.NotAuthorizedToSign:
+			verifyErr.Reason = FailureNotAuthorized
+			verifyErr.Explanation = fmt.Sprintf("certificate %q is not a CA allowed to sign certificates", subject)
+		case x509.CANotAuthorizedForThisName,
+			x509.TooManyIntermediates,
+			x509.TooManyConstraints,
+			x509.NameConstraintsWithoutSANs,
+			x509.UnconstrainedName:
+			verifyErr.Reason = FailureNotAuthorized
+			verifyErr.Explanation = fmt.Sprintf("certificate %q violates its issuer constraints: %s", subject, err.Error())
+		}
+	}
+
+	return verifyErr
+}
+
+// verifyTime returns the time the verification is done at
+func verifyTime(o *VerifyOptions) time.Time {
+	if o.At.IsZero() {
+		return time.Now()
+	}
+	return o.At
+}
+
+// findIssuer looks for the certificate whose key signed c
+func findIssuer(c *x509.Certificate, candidates []*x509.Certificate) *x509.Certificate {
+	for _, i := range candidates {
+		if !bytes.Equal(i.RawSubject, c.RawIssuer) {
+			continue
+		}
+		if i.CheckSignature(c.SignatureAlgorithm, c.RawTBSCertificate, c.Signature) == nil {
+			return i
+		}
+	}
+	return nil
+}
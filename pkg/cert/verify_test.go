@@ -0,0 +1,168 @@
+package cert
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/odacremolbap/xfon/pkg/key"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestCA creates a self signed CA certificate and its key
+func newTestCA(t *testing.T, cn string) (*x509.Certificate, crypto.Signer) {
+	k, err := key.GenerateKey(&key.Options{Type: key.ECDSA, Curve: "P-256"})
+	assert.Nil(t, err)
+	b, err := GenerateX509SelfSignedCertificate(&X509Simplified{
+		Subject:   &Subject{CommonName: cn},
+		NotBefore: time.Now().Add(-time.Hour).UTC(),
+		NotAfter:  time.Now().AddDate(0, 0, 100).UTC(),
+		IsCA:      true,
+		KeyUsage:  x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}, k)
+	assert.Nil(t, err)
+	c, err := x509.ParseCertificate(b)
+	assert.Nil(t, err)
+	return c, k
+}
+
+// newTestLeaf issues a certificate from the parent
+func newTestLeaf(t *testing.T, x *X509Simplified, parent *x509.Certificate, parentKey crypto.Signer) (*x509.Certificate, crypto.Signer) {
+	k, err := key.GenerateKey(&key.Options{Type: key.ECDSA, Curve: "P-256"})
+	assert.Nil(t, err)
+	b, err := GenerateX509Certificate(x, parent, k.Public(), parentKey)
+	assert.Nil(t, err)
+	c, err := x509.ParseCertificate(b)
+	assert.Nil(t, err)
+	return c, k
+}
+
+func TestVerify(t *testing.T) {
+	root, rootKey := newTestCA(t, "root")
+	other, _ := newTestCA(t, "other")
+
+	leaf, _ := newTestLeaf(t, &X509Simplified{
+		Subject:     &Subject{CommonName: "leaf"},
+		DNSNames:    []string{"leaf.example.com"},
+		NotBefore:   time.Now().Add(-time.Hour).UTC(),
+		NotAfter:    time.Now().AddDate(0, 0, 10).UTC(),
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, root, rootKey)
+
+	notCA, notCAKey := newTestLeaf(t, &X509Simplified{
+		Subject:   &Subject{CommonName: "not-ca"},
+		NotBefore: time.Now().Add(-time.Hour).UTC(),
+		NotAfter:  time.Now().AddDate(0, 0, 10).UTC(),
+	}, root, rootKey)
+	// GenerateX509Certificate refuses to sign with a non CA parent
+	b, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		Subject:      pkix.Name{CommonName: "signed-by-not-ca"},
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour).UTC(),
+		NotAfter:     time.Now().AddDate(0, 0, 10).UTC(),
+	}, notCA, notCAKey.Public(), notCAKey)
+	assert.Nil(t, err)
+	signedByNotCA, _ := x509.ParseCertificate(b)
+
+	expiredCA, expiredCAKey := newTestLeaf(t, &X509Simplified{
+		Subject:   &Subject{CommonName: "expired-ca"},
+		NotBefore: time.Now().AddDate(0, 0, -10).UTC(),
+		NotAfter:  time.Now().AddDate(0, 0, -1).UTC(),
+		IsCA:      true,
+		KeyUsage:  x509.KeyUsageCertSign,
+	}, root, rootKey)
+	signedByExpired, _ := newTestLeaf(t, &X509Simplified{
+		Subject:   &Subject{CommonName: "signed-by-expired"},
+		NotBefore: time.Now().Add(-time.Hour).UTC(),
+		NotAfter:  time.Now().AddDate(0, 0, 10).UTC(),
+	}, expiredCA, expiredCAKey)
+
+	var testData = []struct {
+		testName string
+		cert     *x509.Certificate
+		options  *VerifyOptions
+		reason   FailureReason
+	}{
+		{
+			testName: "valid",
+			cert:     leaf,
+			options: &VerifyOptions{
+				Roots:        []*x509.Certificate{root},
+				Name:         "leaf.example.com",
+				ExtKeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+			},
+		},
+		{
+			testName: "expired",
+			cert:     leaf,
+			options: &VerifyOptions{
+				Roots: []*x509.Certificate{root},
+				At:    time.Now().AddDate(0, 0, 20),
+			},
+			reason: FailureExpired,
+		},
+		{
+			testName: "unknown authority",
+			cert:     leaf,
+			options: &VerifyOptions{
+				Roots: []*x509.Certificate{other},
+			},
+			reason: FailureUnknownAuthority,
+		},
+		{
+			testName: "name mismatch",
+			cert:     leaf,
+			options: &VerifyOptions{
+				Roots: []*x509.Certificate{root},
+				Name:  "other.example.com",
+			},
+			reason: FailureNameMismatch,
+		},
+		{
+			testName: "wrong usage",
+			cert:     leaf,
+			options: &VerifyOptions{
+				Roots:        []*x509.Certificate{root},
+				ExtKeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+			},
+			reason: FailureIncompatibleUsage,
+		},
+		{
+			testName: "issuer not a CA",
+			cert:     signedByNotCA,
+			options: &VerifyOptions{
+				Roots:         []*x509.Certificate{root},
+				Intermediates: []*x509.Certificate{notCA},
+			},
+			reason: FailureNotAuthorized,
+		},
+		{
+			testName: "expired intermediate",
+			cert:     signedByExpired,
+			options: &VerifyOptions{
+				Roots:         []*x509.Certificate{root},
+				Intermediates: []*x509.Certificate{expiredCA},
+			},
+			reason: FailureExpired,
+		},
+	}
+
+	for _, td := range testData {
+		chains, err := Verify(td.cert, td.options)
+		if td.reason == 0 {
+			assert.NoErrorf(t, err, "test: %s", td.testName)
+			assert.Lenf(t, chains, 1, "test: %s", td.testName)
+			continue
+		}
+		ve, ok := err.(*VerifyError)
+		if assert.Truef(t, ok, "test: %s, error %v", td.testName, err) {
+			assert.Equalf(t, td.reason, ve.Reason, "test: %s, error %v", td.testName, err)
+		}
+	}
+}
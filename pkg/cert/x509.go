@@ -2,20 +2,38 @@ package cert
 
 import (
 	"bytes"
+	"crypto"
 	"crypto/rand"
-	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/pem"
 	"errors"
 	"fmt"
 	"math/big"
 	"net"
+	"net/url"
 	"strings"
 	"time"
 )
 
+// Encoding of certificate files
+type Encoding string
+
+const (
+	// PEMEncoding writes certificates as PEM blocks
+	PEMEncoding Encoding = "pem"
+	// DEREncoding writes certificates as concatenated DER
+	DEREncoding Encoding = "der"
+)
+
 var (
+	// EncodingChoices is the set of supported certificate file encodings
+	EncodingChoices = map[string]Encoding{
+		string(PEMEncoding): PEMEncoding,
+		string(DEREncoding): DEREncoding,
+	}
+
 	// KeyUsageChoices is a set of string choices that map to the
 	// X509 key usage representation
 	KeyUsageChoices map[string]x509.KeyUsage
@@ -65,15 +83,48 @@ type X509Simplified struct {
 	DNSNames    []string
 	IPAddresses []net.IP
 	IsCA        bool
+
+	// URIs and EmailAddresses subject alternative names. SPIFFE IDs
+	// are checked against the X509-SVID specification
+	URIs           []*url.URL
+	EmailAddresses []string
+
+	// OtherNames subject alternative names, such as UPN
+	OtherNames []OtherName
+
 	KeyUsage    x509.KeyUsage
 	ExtKeyUsage []x509.ExtKeyUsage
-}
 
-// Subject for x509 certificate
-type Subject struct {
-	CommonName         string
-	Organization       string
-	OrganizationalUnit string
+	// MaxPathLen is the maximum number of intermediate CAs allowed
+	// under a CA certificate. Zero means unlimited unless
+	// MaxPathLenZero is set
+	MaxPathLen     int
+	MaxPathLenZero bool
+
+	// NameConstraints for CA certificates, none when nil
+	NameConstraints *NameConstraints
+
+	// OCSPServer and IssuingCertificateURL are written at the authority
+	// information access extension and CRLDistributionPoints at the CRL
+	// distribution points one, so that clients can find the issuer
+	// certificate and revocation information
+	OCSPServer            []string
+	IssuingCertificateURL []string
+	CRLDistributionPoints []string
+
+	// SubjectKeyIDMethod used to compute the subject key
+	// identifier, RFC 5280 method 1 when empty
+	SubjectKeyIDMethod SKIMethod
+
+	// RawSubject and SubjectKeyID, when informed, are written as is
+	// instead of the encoded Subject and the computed identifier, so
+	// that an existing certificate identity is reproduced byte by byte
+	RawSubject   []byte
+	SubjectKeyID []byte
+
+	// ExtraExtensions are added verbatim to the certificate, overriding
+	// any extension with the same OID
+	ExtraExtensions []pkix.Extension
 }
 
 // StringToKeyUsage converts a string array into a key usage type
@@ -140,49 +191,145 @@ func StringToIPAddressList(ipList string) ([]net.IP, error) {
 	return ips, nil
 }
 
-// GenerateX509SelfSignedCertificate takes a simplified x509 definition and an RSA key,
-// and generates a certificate
-func GenerateX509SelfSignedCertificate(c *X509Simplified, key *rsa.PrivateKey) ([]byte, error) {
-	if c.Serial == nil {
-		c.Serial = new(big.Int).SetInt64(0)
+// StringToURLList transforms a comma separated list of http, https
+// or ldap URLs, as used for certificate distribution, into an array
+func StringToURLList(urlList string) ([]string, error) {
+	urls := []string{}
+	for _, t := range strings.Split(urlList, ",") {
+		if t == "" {
+			continue
+		}
+		if err := ValidateURL(t); err != nil {
+			return nil, err
+		}
+		urls = append(urls, t)
+	}
+	return urls, nil
+}
+
+// ValidateURL checks that an OCSP, issuer or CRL location is
+// an absolute http, https or ldap URL
+func ValidateURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("cannot parse %s as an absolute URL", s)
 	}
-	return GenerateX509Certificate(c, nil, key, key)
+	switch u.Scheme {
+	case "http", "https", "ldap":
+		return nil
+	}
+	return fmt.Errorf("unsupported URL scheme %q at %s", u.Scheme, s)
 }
 
-// GenerateX509Certificate using the passed parameters
-func GenerateX509Certificate(c *X509Simplified, parent *x509.Certificate, publicKey *rsa.PrivateKey, signingKey *rsa.PrivateKey) ([]byte, error) {
+// GenerateX509SelfSignedCertificate takes a simplified x509 definition and a private key,
+// and generates a certificate
+func GenerateX509SelfSignedCertificate(c *X509Simplified, key crypto.Signer) ([]byte, error) {
+	return GenerateX509Certificate(c, nil, key.Public(), key)
+}
 
-	subject := pkix.Name{
-		CommonName: c.Subject.CommonName,
+// GenerateX509Certificate using the passed parameters.
+// publicKey is the subject's public key, signingKey the issuer's private key.
+// When no serial is informed a random one is generated and set at c.
+// The signing key must belong to the parent, which must be a CA whose
+// constraints allow the certificate
+func GenerateX509Certificate(c *X509Simplified, parent *x509.Certificate, publicKey crypto.PublicKey, signingKey crypto.Signer) ([]byte, error) {
+	if parent != nil {
+		if err := ValidateIssuer(parent, signingKey); err != nil {
+			return nil, err
+		}
+	}
+	if err := ValidateConstraints(c, parent); err != nil {
+		return nil, err
 	}
-	if c.Subject.Organization != "" {
-		subject.Organization = []string{c.Subject.Organization}
+	if err := ValidateSPIFFE(c); err != nil {
+		return nil, err
+	}
+
+	if c.Serial == nil {
+		s, err := GenerateSerial()
+		if err != nil {
+			return nil, err
+		}
+		c.Serial = s
 	}
-	if c.Subject.OrganizationalUnit != "" {
-		subject.OrganizationalUnit = []string{c.Subject.OrganizationalUnit}
+
+	var err error
+	ski := c.SubjectKeyID
+	if len(ski) == 0 {
+		ski, err = SubjectKeyID(publicKey, c.SubjectKeyIDMethod)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	x509cert := &x509.Certificate{
-		Subject:               subject,
+		Subject:               c.Subject.Name(),
+		RawSubject:            c.RawSubject,
 		SerialNumber:          c.Serial,
 		DNSNames:              c.DNSNames,
 		IPAddresses:           c.IPAddresses,
+		URIs:                  c.URIs,
+		EmailAddresses:        c.EmailAddresses,
 		NotBefore:             c.NotBefore,
 		NotAfter:              c.NotAfter,
 		BasicConstraintsValid: c.IsCA,
 		IsCA:                  c.IsCA,
+		MaxPathLen:            c.MaxPathLen,
+		MaxPathLenZero:        c.MaxPathLenZero,
 		KeyUsage:              c.KeyUsage,
 		ExtKeyUsage:           c.ExtKeyUsage,
+		OCSPServer:            c.OCSPServer,
+		IssuingCertificateURL: c.IssuingCertificateURL,
+		CRLDistributionPoints: c.CRLDistributionPoints,
+		ExtraExtensions:       c.ExtraExtensions,
+		SubjectKeyId:          ski,
+	}
+	if len(c.OtherNames) != 0 {
+		if hasExtension(c.ExtraExtensions, oidExtensionSubjectAltName) {
+			return nil, fmt.Errorf("other names cannot be added to an existing subject alternative name extension")
+		}
+		// subject alternative names must be critical for empty subjects
+		subject := c.RawSubject
+		if len(subject) == 0 {
+			if subject, err = asn1.Marshal(x509cert.Subject.ToRDNSequence()); err != nil {
+				return nil, err
+			}
+		}
+		san, err := marshalSANs(c.DNSNames, c.EmailAddresses, c.IPAddresses, c.URIs, c.OtherNames, len(subject) == 2)
+		if err != nil {
+			return nil, err
+		}
+		x509cert.ExtraExtensions = append([]pkix.Extension{san}, c.ExtraExtensions...)
+	}
+	if nc := c.NameConstraints; !nc.IsEmpty() {
+		x509cert.PermittedDNSDomainsCritical = true
+		x509cert.PermittedDNSDomains = nc.PermittedDNSDomains
+		x509cert.ExcludedDNSDomains = nc.ExcludedDNSDomains
+		x509cert.PermittedIPRanges = nc.PermittedIPRanges
+		x509cert.ExcludedIPRanges = nc.ExcludedIPRanges
+		x509cert.PermittedEmailAddresses = nc.PermittedEmailAddresses
+		x509cert.ExcludedEmailAddresses = nc.ExcludedEmailAddresses
+		x509cert.PermittedURIDomains = nc.PermittedURIDomains
+		x509cert.ExcludedURIDomains = nc.ExcludedURIDomains
 	}
 	if parent == nil {
 		parent = x509cert
+	} else if len(parent.SubjectKeyId) == 0 {
+		// parents issued without subject key identifier get
+		// the authority key identifier computed
+		x509cert.AuthorityKeyId, err = SubjectKeyID(parent.PublicKey, SKIRFC5280Method1)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		x509cert.AuthorityKeyId = parent.SubjectKeyId
 	}
 
 	b, err := x509.CreateCertificate(
 		rand.Reader,
 		x509cert,
 		parent,
-		&publicKey.PublicKey,
+		publicKey,
 		signingKey)
 	if err != nil {
 		return nil, err
@@ -221,3 +368,78 @@ func ReadPEM(cert []byte) (*x509.Certificate, error) {
 
 	return c, nil
 }
+
+// WritePEMBundle serializes the certificates as concatenated PEM
+// blocks, in order, as used for certificate chains
+func WritePEMBundle(certs []*x509.Certificate) (string, error) {
+	var b strings.Builder
+	for _, c := range certs {
+		p, err := WritePEM(c.Raw)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(p)
+	}
+	return b.String(), nil
+}
+
+// WriteCertificates serializes the certificates using the encoding
+func WriteCertificates(certs []*x509.Certificate, e Encoding) ([]byte, error) {
+	switch e {
+	case PEMEncoding:
+		p, err := WritePEMBundle(certs)
+		return []byte(p), err
+	case DEREncoding:
+		var b []byte
+		for _, c := range certs {
+			b = append(b, c.Raw...)
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("unknown certificate encoding: %s", e)
+}
+
+// ReadCertificate reads the first certificate from PEM or DER
+// encoded content, skipping PEM blocks that are not certificates
+func ReadCertificate(b []byte) (*x509.Certificate, error) {
+	certs, err := ReadCertificates(b)
+	if err != nil {
+		return nil, err
+	}
+	return certs[0], nil
+}
+
+// ReadCertificates reads every certificate from PEM encoded content,
+// skipping other block types such as keys, or from DER encoded content
+// with one or more concatenated certificates when it is not PEM
+func ReadCertificates(b []byte) ([]*x509.Certificate, error) {
+	certs := []*x509.Certificate{}
+	rest, isPEM := b, false
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		isPEM = true
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		c, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse certificate: %s", err.Error())
+		}
+		certs = append(certs, c)
+	}
+
+	if !isPEM {
+		var err error
+		if certs, err = x509.ParseCertificates(b); err != nil {
+			return nil, fmt.Errorf("content is neither PEM nor DER encoded certificates: %s", err.Error())
+		}
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("no certificate found")
+	}
+	return certs, nil
+}
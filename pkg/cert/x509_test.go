@@ -5,6 +5,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/odacremolbap/xfon/pkg/key"
 	"github.com/odacremolbap/xfon/pkg/rsa"
 
 	"github.com/stretchr/testify/assert"
@@ -104,6 +105,17 @@ func TestStringToExtKeyUsage(t *testing.T) {
 	}
 }
 
+func TestStringToURLList(t *testing.T) {
+	u, err := StringToURLList("http://ocsp.example.com,,ldap://ldap.example.com/cn=CA")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"http://ocsp.example.com", "ldap://ldap.example.com/cn=CA"}, u)
+
+	for _, invalid := range []string{"ocsp.example.com", "ftp://example.com/ca.crl", "http://"} {
+		_, err = StringToURLList(invalid)
+		assert.NotNil(t, err, "test: %s", invalid)
+	}
+}
+
 func TestX509Generation(t *testing.T) {
 
 	var testData = []struct {
@@ -129,7 +141,7 @@ func TestX509Generation(t *testing.T) {
 			x509: &X509Simplified{
 				Subject: &Subject{
 					CommonName:   "simple2",
-					Organization: "organization2",
+					Organization: []string{"organization2"},
 				},
 				NotBefore: time.Now().UTC(),
 				NotAfter:  time.Now().AddDate(0, 0, 100).UTC(),
@@ -145,14 +157,164 @@ func TestX509Generation(t *testing.T) {
 		c, err := x509.ParseCertificate(b)
 		assert.Nil(t, err)
 		assert.Equal(t, td.x509.Subject.CommonName, c.Subject.CommonName)
-		if td.x509.Subject.Organization != "" {
-			assert.Equal(t, td.x509.Subject.Organization, c.Subject.Organization[0])
+		if len(td.x509.Subject.Organization) != 0 {
+			assert.Equal(t, td.x509.Subject.Organization, c.Subject.Organization)
 		}
-		if td.x509.Subject.OrganizationalUnit != "" {
-			assert.Equal(t, td.x509.Subject.OrganizationalUnit, c.Subject.OrganizationalUnit[0])
+		if len(td.x509.Subject.OrganizationalUnit) != 0 {
+			assert.Equal(t, td.x509.Subject.OrganizationalUnit, c.Subject.OrganizationalUnit)
 		}
 
 		assert.Equal(t, td.x509.IsCA, c.IsCA)
 	}
 
 }
+
+func TestX509GenerationKeyTypes(t *testing.T) {
+
+	var testData = []struct {
+		testName   string
+		options    *key.Options
+		pubKeyAlgo x509.PublicKeyAlgorithm
+	}{
+		{
+			testName:   "rsa",
+			options:    &key.Options{Type: key.RSA, Bits: 2048},
+			pubKeyAlgo: x509.RSA,
+		},
+		{
+			testName:   "ecdsa",
+			options:    &key.Options{Type: key.ECDSA, Curve: "P-256"},
+			pubKeyAlgo: x509.ECDSA,
+		},
+		{
+			testName:   "ed25519",
+			options:    &key.Options{Type: key.Ed25519},
+			pubKeyAlgo: x509.Ed25519,
+		},
+	}
+
+	for _, td := range testData {
+		caKey, err := key.GenerateKey(td.options)
+		assert.NoErrorf(t, err, "test: %s", td.testName)
+
+		ca := &X509Simplified{
+			Subject:   &Subject{CommonName: "ca-" + td.testName},
+			NotBefore: time.Now().UTC(),
+			NotAfter:  time.Now().AddDate(0, 0, 100).UTC(),
+			IsCA:      true,
+			KeyUsage:  x509.KeyUsageCertSign,
+		}
+		b, err := GenerateX509SelfSignedCertificate(ca, caKey)
+		assert.NoErrorf(t, err, "test: %s", td.testName)
+		parent, err := x509.ParseCertificate(b)
+		assert.NoErrorf(t, err, "test: %s", td.testName)
+		assert.Equalf(t, td.pubKeyAlgo, parent.PublicKeyAlgorithm, "test: %s", td.testName)
+
+		leafKey, _ := key.GenerateKey(td.options)
+		leaf := &X509Simplified{
+			Subject:   &Subject{CommonName: "leaf-" + td.testName},
+			NotBefore: time.Now().UTC(),
+			NotAfter:  time.Now().AddDate(0, 0, 10).UTC(),
+		}
+		b, err = GenerateX509Certificate(leaf, parent, leafKey.Public(), caKey)
+		assert.NoErrorf(t, err, "test: %s", td.testName)
+		c, err := x509.ParseCertificate(b)
+		assert.NoErrorf(t, err, "test: %s", td.testName)
+		assert.NoErrorf(t, c.CheckSignatureFrom(parent), "test: %s", td.testName)
+	}
+}
+
+func TestReadCertificates(t *testing.T) {
+	k, err := key.GenerateKey(&key.Options{Type: key.ECDSA, Curve: "P-256"})
+	assert.Nil(t, err)
+	newCert := func(cn string) []byte {
+		b, err := GenerateX509SelfSignedCertificate(&X509Simplified{
+			Subject:   &Subject{CommonName: cn},
+			NotBefore: time.Now().UTC(),
+			NotAfter:  time.Now().AddDate(0, 0, 10).UTC(),
+		}, k)
+		assert.Nil(t, err)
+		return b
+	}
+	first, second := newCert("first"), newCert("second")
+	firstPEM, err := WritePEM(first)
+	assert.Nil(t, err)
+	secondPEM, err := WritePEM(second)
+	assert.Nil(t, err)
+	keyPEM, err := key.WritePEM(k)
+	assert.Nil(t, err)
+
+	var testData = []struct {
+		testName string
+		content  []byte
+		expected []string
+		errorRet bool
+	}{
+		{testName: "single PEM", content: []byte(firstPEM), expected: []string{"first"}},
+		{testName: "PEM bundle", content: []byte(firstPEM + secondPEM), expected: []string{"first", "second"}},
+		{testName: "PEM bundle with key", content: []byte(keyPEM + "comment\n" + secondPEM), expected: []string{"second"}},
+		{testName: "single DER", content: first, expected: []string{"first"}},
+		{testName: "concatenated DER", content: append(append([]byte{}, first...), second...), expected: []string{"first", "second"}},
+		{testName: "only key", content: []byte(keyPEM), errorRet: true},
+		{testName: "empty", content: []byte{}, errorRet: true},
+		{testName: "garbage", content: []byte("not a certificate"), errorRet: true},
+	}
+
+	for _, td := range testData {
+		certs, err := ReadCertificates(td.content)
+		if td.errorRet {
+			assert.Errorf(t, err, "test: %s", td.testName)
+			continue
+		}
+		assert.NoErrorf(t, err, "test: %s", td.testName)
+		names := []string{}
+		for _, c := range certs {
+			names = append(names, c.Subject.CommonName)
+		}
+		assert.Equal(t, td.expected, names, "test: %s", td.testName)
+	}
+}
+
+func TestWriteCertificates(t *testing.T) {
+	k, err := key.GenerateKey(&key.Options{Type: key.ECDSA, Curve: "P-256"})
+	assert.Nil(t, err)
+	certs := []*x509.Certificate{}
+	for _, cn := range []string{"leaf", "intermediate"} {
+		b, err := GenerateX509SelfSignedCertificate(&X509Simplified{
+			Subject:   &Subject{CommonName: cn},
+			NotBefore: time.Now().UTC(),
+			NotAfter:  time.Now().AddDate(0, 0, 10).UTC(),
+		}, k)
+		assert.Nil(t, err)
+		c, err := x509.ParseCertificate(b)
+		assert.Nil(t, err)
+		certs = append(certs, c)
+	}
+
+	var testData = []struct {
+		testName string
+		encoding Encoding
+		errorRet bool
+	}{
+		{testName: "pem", encoding: PEMEncoding},
+		{testName: "der", encoding: DEREncoding},
+		{testName: "unknown", encoding: "p7b", errorRet: true},
+	}
+
+	for _, td := range testData {
+		b, err := WriteCertificates(certs, td.encoding)
+		if td.errorRet {
+			assert.Errorf(t, err, "test: %s", td.testName)
+			continue
+		}
+		assert.NoErrorf(t, err, "test: %s", td.testName)
+
+		read, err := ReadCertificates(b)
+		assert.NoErrorf(t, err, "test: %s", td.testName)
+		assert.Equal(t, certs, read, "test: %s", td.testName)
+
+		first, err := ReadCertificate(b)
+		assert.NoErrorf(t, err, "test: %s", td.testName)
+		assert.Equal(t, certs[0], first, "test: %s", td.testName)
+	}
+}
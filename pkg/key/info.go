@@ -0,0 +1,120 @@
+package key
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Info describes the public part of a key
+type Info struct {
+	// Algorithm is either RSA, ECDSA or Ed25519
+	Algorithm string `json:"algorithm" yaml:"algorithm"`
+	// Size of the key in bits
+	Size int `json:"size" yaml:"size"`
+	// Curve name for ECDSA keys
+	Curve string `json:"curve,omitempty" yaml:"curve,omitempty"`
+	// Exponent for RSA keys
+	Exponent int `json:"exponent,omitempty" yaml:"exponent,omitempty"`
+	// Fingerprint is the SHA-256 of the DER encoded subject public
+	// key info, as colon separated uppercase hex
+	Fingerprint string `json:"fingerprint" yaml:"fingerprint"`
+	// SPKIPin is the base64 SHA-256 of the DER encoded subject public
+	// key info, as used by pin-sha256 and curl --pinnedpubkey
+	SPKIPin string `json:"spkiPin" yaml:"spkiPin"`
+}
+
+// NewInfo returns the informational representation of a public key
+func NewInfo(pub crypto.PublicKey) (*Info, error) {
+	i := &Info{}
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		i.Algorithm = "RSA"
+		i.Size = k.N.BitLen()
+		i.Exponent = k.E
+	case *ecdsa.PublicKey:
+		i.Algorithm = "ECDSA"
+		i.Size = k.Curve.Params().BitSize
+		i.Curve = k.Curve.Params().Name
+	case ed25519.PublicKey:
+		i.Algorithm = "Ed25519"
+		i.Size = 256
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", pub)
+	}
+
+	h, err := spkiHash(pub)
+	if err != nil {
+		return nil, err
+	}
+	parts := make([]string, len(h))
+	for n, v := range h {
+		parts[n] = fmt.Sprintf("%02X", v)
+	}
+	i.Fingerprint = strings.Join(parts, ":")
+	i.SPKIPin = base64.StdEncoding.EncodeToString(h)
+
+	return i, nil
+}
+
+// SPKIPin returns the base64 SHA-256 of the DER encoded subject
+// public key info, which identifies a key regardless of the
+// certificates issued for it
+func SPKIPin(pub crypto.PublicKey) (string, error) {
+	h, err := spkiHash(pub)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(h), nil
+}
+
+func spkiHash(pub crypto.PublicKey) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling public key: %s", err.Error())
+	}
+	h := sha256.Sum256(der)
+	return h[:], nil
+}
+
+// Matches returns whether both public keys are the same
+func Matches(a, b crypto.PublicKey) bool {
+	k, ok := a.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && k.Equal(b)
+}
+
+// WritePublicPEM serializes the public key into a PKIX PEM string
+func WritePublicPEM(pub crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", fmt.Errorf("error marshaling public key: %s", err.Error())
+	}
+	return encodePEM(&pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: der,
+	})
+}
+
+// ReadPublicPEM looks for a PKIX public key into a PEM file
+func ReadPublicPEM(b []byte) (crypto.PublicKey, error) {
+	for {
+		block, rest := pem.Decode(b)
+		if block == nil {
+			return nil, errors.New("file doesn't contain a PEM encoded public key")
+		}
+		b = rest
+
+		if block.Type != "PUBLIC KEY" {
+			continue
+		}
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	}
+}
@@ -0,0 +1,65 @@
+package key
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// public key with the pin computed by openssl
+const testPublicPEM = `-----BEGIN PUBLIC KEY-----
+MFkwEwYHKoZIzj0CAQYIKoZIzj0DAQcDQgAERMUx5Htu+jvblrG72cRdj3oQ6fOS
+y7e8wlt5Y5UPmW3uIp+6PNQkatBtyJFnoxQO6sYsza8xdmMXHBvq+/nYvg==
+-----END PUBLIC KEY-----
+`
+
+func TestNewInfo(t *testing.T) {
+	var testData = []struct {
+		testName  string
+		options   *Options
+		algorithm string
+		size      int
+		curve     string
+		exponent  int
+	}{
+		{testName: "rsa2048", options: &Options{Type: RSA, Bits: 2048}, algorithm: "RSA", size: 2048, exponent: 65537},
+		{testName: "ecdsaP384", options: &Options{Type: ECDSA, Curve: "P-384"}, algorithm: "ECDSA", size: 384, curve: "P-384"},
+		{testName: "ed25519", options: &Options{Type: Ed25519}, algorithm: "Ed25519", size: 256},
+	}
+	for _, td := range testData {
+		k, err := GenerateKey(td.options)
+		assert.Nil(t, err, "test: %s", td.testName)
+
+		i, err := NewInfo(k.Public())
+		assert.Nil(t, err, "test: %s", td.testName)
+		assert.Equal(t, td.algorithm, i.Algorithm, "test: %s", td.testName)
+		assert.Equal(t, td.size, i.Size, "test: %s", td.testName)
+		assert.Equal(t, td.curve, i.Curve, "test: %s", td.testName)
+		assert.Equal(t, td.exponent, i.Exponent, "test: %s", td.testName)
+		assert.Len(t, i.Fingerprint, 32*3-1, "test: %s", td.testName)
+
+		// the exported public key is the same key
+		p, err := WritePublicPEM(k.Public())
+		assert.Nil(t, err, "test: %s", td.testName)
+		pub, err := ReadPublicPEM([]byte(p))
+		assert.Nil(t, err, "test: %s", td.testName)
+		assert.True(t, Matches(k.Public(), pub), "test: %s", td.testName)
+
+		other, err := GenerateKey(td.options)
+		assert.Nil(t, err, "test: %s", td.testName)
+		assert.False(t, Matches(other.Public(), pub), "test: %s", td.testName)
+	}
+
+	pub, err := ReadPublicPEM([]byte(testPublicPEM))
+	assert.Nil(t, err)
+	pin, err := SPKIPin(pub)
+	assert.Nil(t, err)
+	assert.Equal(t, "EPMPE2oNbITT6iwJRyzhtbyzdtvm/hOrPQXerseMWjE=", pin)
+	i, err := NewInfo(pub)
+	assert.Nil(t, err)
+	assert.Equal(t, pin, i.SPKIPin)
+	assert.Equal(t, "10:F3:0F:13", i.Fingerprint[:11])
+
+	_, err = ReadPublicPEM([]byte("no key"))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,298 @@
+package key
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/odacremolbap/xfon/pkg/filesystem"
+	"github.com/odacremolbap/xfon/pkg/passphrase"
+)
+
+// Type is the family of a private key
+type Type string
+
+const (
+	// RSA key type
+	RSA Type = "rsa"
+	// ECDSA key type
+	ECDSA Type = "ecdsa"
+	// Ed25519 key type
+	Ed25519 Type = "ed25519"
+)
+
+var (
+	// TypeChoices is the set of supported key families
+	TypeChoices map[string]Type
+
+	// FormatChoices is the set of supported key encodings
+	FormatChoices map[string]Format
+
+	// CurveChoices is a set of string choices that map to the
+	// elliptic curves supported for ECDSA keys
+	CurveChoices map[string]elliptic.Curve
+)
+
+func init() {
+	TypeChoices = map[string]Type{
+		string(RSA):     RSA,
+		string(ECDSA):   ECDSA,
+		string(Ed25519): Ed25519,
+	}
+
+	FormatChoices = map[string]Format{
+		string(PKCS1): PKCS1,
+		string(SEC1):  SEC1,
+		string(PKCS8): PKCS8,
+	}
+
+	CurveChoices = map[string]elliptic.Curve{
+		"P-256": elliptic.P256(),
+		"P-384": elliptic.P384(),
+		"P-521": elliptic.P521(),
+	}
+}
+
+// Format is the encoding of a private key
+type Format string
+
+const (
+	// PKCS1 encoding, only for RSA keys
+	PKCS1 Format = "pkcs1"
+	// SEC1 encoding, only for ECDSA keys
+	SEC1 Format = "sec1"
+	// PKCS8 encoding, for any key type
+	PKCS8 Format = "pkcs8"
+)
+
+// Options used when generating a key.
+// Bits is only used for RSA keys, Curve only for ECDSA keys
+type Options struct {
+	Type  Type
+	Bits  int
+	Curve string
+}
+
+// OptionsFromPublicKey returns the options that generate
+// keys of the same type and size as the public key
+func OptionsFromPublicKey(pub crypto.PublicKey) (*Options, error) {
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		return &Options{Type: RSA, Bits: k.N.BitLen()}, nil
+	case *ecdsa.PublicKey:
+		curve := k.Curve.Params().Name
+		if _, ok := CurveChoices[curve]; !ok {
+			return nil, fmt.Errorf("unknown curve: %s", curve)
+		}
+		return &Options{Type: ECDSA, Curve: curve}, nil
+	case ed25519.PublicKey:
+		return &Options{Type: Ed25519}, nil
+	}
+	return nil, fmt.Errorf("unsupported public key type %T", pub)
+}
+
+// GenerateKey creates a private key of the informed type
+func GenerateKey(o *Options) (crypto.Signer, error) {
+	switch o.Type {
+	case RSA:
+		return GenerateRSAKey(o.Bits)
+	case ECDSA:
+		return GenerateECDSAKey(o.Curve)
+	case Ed25519:
+		return GenerateEd25519Key()
+	}
+	return nil, fmt.Errorf("unknown key type: %s", o.Type)
+}
+
+// GenerateRSAKey using the informed size
+func GenerateRSAKey(bits int) (*rsa.PrivateKey, error) {
+	return rsa.GenerateKey(rand.Reader, bits)
+}
+
+// GenerateECDSAKey using the informed curve name
+func GenerateECDSAKey(curve string) (*ecdsa.PrivateKey, error) {
+	c, ok := CurveChoices[curve]
+	if !ok {
+		return nil, fmt.Errorf("unknown curve: %s", curve)
+	}
+	return ecdsa.GenerateKey(c, rand.Reader)
+}
+
+// GenerateEd25519Key creates a new Ed25519 key
+func GenerateEd25519Key() (ed25519.PrivateKey, error) {
+	_, k, err := ed25519.GenerateKey(rand.Reader)
+	return k, err
+}
+
+// WritePEM serializes the private key into PEM format.
+// RSA keys are written as PKCS#1, ECDSA keys as SEC1 and
+// Ed25519 keys as PKCS#8
+func WritePEM(key crypto.Signer) (string, error) {
+	switch key.(type) {
+	case *rsa.PrivateKey:
+		return WritePEMFormat(key, PKCS1)
+	case *ecdsa.PrivateKey:
+		return WritePEMFormat(key, SEC1)
+	}
+	return WritePEMFormat(key, PKCS8)
+}
+
+// WritePEMFormat serializes the private key into PEM format
+// using the informed encoding
+func WritePEMFormat(key crypto.Signer, format Format) (string, error) {
+	block := &pem.Block{}
+
+	switch format {
+	case PKCS1:
+		k, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return "", fmt.Errorf("PKCS#1 format only supports RSA keys, got %T", key)
+		}
+		block.Type = "RSA PRIVATE KEY"
+		block.Bytes = x509.MarshalPKCS1PrivateKey(k)
+	case SEC1:
+		k, ok := key.(*ecdsa.PrivateKey)
+		if !ok {
+			return "", fmt.Errorf("SEC1 format only supports ECDSA keys, got %T", key)
+		}
+		der, err := x509.MarshalECPrivateKey(k)
+		if err != nil {
+			return "", fmt.Errorf("error marshaling EC key: %s", err.Error())
+		}
+		block.Type = "EC PRIVATE KEY"
+		block.Bytes = der
+	case PKCS8:
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return "", fmt.Errorf("error marshaling PKCS#8 key: %s", err.Error())
+		}
+		block.Type = "PRIVATE KEY"
+		block.Bytes = der
+	default:
+		return "", fmt.Errorf("unknown key format: %s", format)
+	}
+
+	return encodePEM(block)
+}
+
+// WriteEncryptedPEM serializes the private key into a passphrase
+// protected PKCS#8 PEM, using PBES2 with AES-256-CBC
+func WriteEncryptedPEM(key crypto.Signer, passphrase []byte, kdf KDF) (string, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", fmt.Errorf("error marshaling PKCS#8 key: %s", err.Error())
+	}
+
+	enc, err := encryptPKCS8(der, passphrase, kdf)
+	if err != nil {
+		return "", fmt.Errorf("error encrypting key: %s", err.Error())
+	}
+
+	return encodePEM(&pem.Block{
+		Type:  "ENCRYPTED PRIVATE KEY",
+		Bytes: enc,
+	})
+}
+
+func encodePEM(block *pem.Block) (string, error) {
+	var b bytes.Buffer
+	if err := pem.Encode(&b, block); err != nil {
+		return "", fmt.Errorf("error PEM encoding key: %s", err.Error())
+	}
+
+	return b.String(), nil
+}
+
+// ReadPEM looks for a private key into a PEM file.
+// PKCS#1, PKCS#8 and SEC1 encodings are detected. When the key is
+// encrypted ErrEncryptedKey is returned
+func ReadPEM(b []byte) (crypto.Signer, error) {
+	return ReadEncryptedPEM(b, nil)
+}
+
+// ReadEncryptedPEM looks for a private key into a PEM file, using
+// the passphrase if the key is an encrypted PKCS#8 key
+func ReadEncryptedPEM(b []byte, passphrase []byte) (crypto.Signer, error) {
+	for {
+		block, rest := pem.Decode(b)
+		if block == nil {
+			return nil, errors.New("private key file doesn't contain a PEM encoded key")
+		}
+		b = rest
+
+		// skip blocks that might come along with the key,
+		// like EC PARAMETERS or CERTIFICATE
+		if !strings.HasSuffix(block.Type, "PRIVATE KEY") {
+			continue
+		}
+
+		if _, ok := block.Headers["DEK-Info"]; ok {
+			return nil, errors.New("legacy PEM encryption is not supported, convert the key to encrypted PKCS#8")
+		}
+
+		der := block.Bytes
+		if block.Type == "ENCRYPTED PRIVATE KEY" {
+			if passphrase == nil {
+				return nil, ErrEncryptedKey
+			}
+			var err error
+			der, err = decryptPKCS8(der, passphrase)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return ParseDER(der)
+	}
+}
+
+// ParseDER parses a DER private key detecting
+// PKCS#1, PKCS#8 and SEC1 encodings
+func ParseDER(der []byte) (crypto.Signer, error) {
+	if k, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		signer, ok := k.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported key type %T", k)
+		}
+		return signer, nil
+	}
+
+	if k, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return k, nil
+	}
+
+	if k, err := x509.ParseECPrivateKey(der); err == nil {
+		return k, nil
+	}
+
+	return nil, errors.New("cannot parse signing key file: not a PKCS#1, PKCS#8 or SEC1 private key")
+}
+
+// ReadPEMFile reads a private key from a PEM file. When the key is
+// encrypted the passphrase is obtained from the informed source
+func ReadPEMFile(path string, src *passphrase.Source) (crypto.Signer, error) {
+	b, err := filesystem.ReadContentsFromFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	k, err := ReadPEM(b)
+	if err != ErrEncryptedKey {
+		return k, err
+	}
+
+	p, err := src.Read(fmt.Sprintf("passphrase for %s: ", path), false)
+	if err != nil {
+		return nil, err
+	}
+	return ReadEncryptedPEM(b, p)
+}
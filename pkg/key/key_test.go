@@ -0,0 +1,116 @@
+package key
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateKey(t *testing.T) {
+	var testData = []struct {
+		testName string
+		options  *Options
+		errorRet bool
+	}{
+		{testName: "rsa2048",
+			options: &Options{Type: RSA, Bits: 2048},
+		},
+		{testName: "ecdsaP256",
+			options: &Options{Type: ECDSA, Curve: "P-256"},
+		},
+		{testName: "ecdsaP384",
+			options: &Options{Type: ECDSA, Curve: "P-384"},
+		},
+		{testName: "ed25519",
+			options: &Options{Type: Ed25519},
+		},
+		{testName: "wrong curve",
+			options:  &Options{Type: ECDSA, Curve: "P-111"},
+			errorRet: true,
+		},
+		{testName: "wrong type",
+			options:  &Options{Type: "dsa"},
+			errorRet: true,
+		},
+	}
+	for _, td := range testData {
+		k, err := GenerateKey(td.options)
+		if td.errorRet {
+			assert.Errorf(t, err, "test: %s", td.testName)
+			continue
+		}
+		assert.NoErrorf(t, err, "test: %s", td.testName)
+
+		switch td.options.Type {
+		case RSA:
+			assert.IsTypef(t, &rsa.PrivateKey{}, k, "test: %s", td.testName)
+			assert.Equalf(t, td.options.Bits, k.(*rsa.PrivateKey).N.BitLen(), "test: %s", td.testName)
+		case ECDSA:
+			assert.IsTypef(t, &ecdsa.PrivateKey{}, k, "test: %s", td.testName)
+			assert.Equalf(t, td.options.Curve, k.(*ecdsa.PrivateKey).Curve.Params().Name, "test: %s", td.testName)
+		case Ed25519:
+			assert.IsTypef(t, ed25519.PrivateKey{}, k, "test: %s", td.testName)
+		}
+	}
+}
+
+func TestOptionsFromPublicKey(t *testing.T) {
+	var testData = []struct {
+		testName string
+		options  *Options
+	}{
+		{testName: "rsa2048",
+			options: &Options{Type: RSA, Bits: 2048},
+		},
+		{testName: "ecdsaP384",
+			options: &Options{Type: ECDSA, Curve: "P-384"},
+		},
+		{testName: "ed25519",
+			options: &Options{Type: Ed25519},
+		},
+	}
+	for _, td := range testData {
+		k, err := GenerateKey(td.options)
+		assert.NoErrorf(t, err, "test: %s", td.testName)
+
+		o, err := OptionsFromPublicKey(k.Public())
+		assert.NoErrorf(t, err, "test: %s", td.testName)
+		assert.Equalf(t, td.options, o, "test: %s", td.testName)
+	}
+
+	_, err := OptionsFromPublicKey("not a key")
+	assert.Error(t, err)
+}
+
+func TestPEMEncode(t *testing.T) {
+	var testData = []struct {
+		testName  string
+		options   *Options
+		blockType string
+	}{
+		{testName: "rsa",
+			options:   &Options{Type: RSA, Bits: 1024},
+			blockType: "RSA PRIVATE KEY",
+		},
+		{testName: "ecdsa",
+			options:   &Options{Type: ECDSA, Curve: "P-384"},
+			blockType: "EC PRIVATE KEY",
+		},
+		{testName: "ed25519",
+			options:   &Options{Type: Ed25519},
+			blockType: "PRIVATE KEY",
+		},
+	}
+	for _, td := range testData {
+		k, _ := GenerateKey(td.options)
+		pem, err := WritePEM(k)
+		assert.Nil(t, err, "test writePEM: %s", td.testName)
+		assert.Containsf(t, pem, "-----BEGIN "+td.blockType+"-----", "test: %s", td.testName)
+		retKey, err := ReadPEM([]byte(pem))
+		assert.Nil(t, err, "test readPEM: %s", td.testName)
+		assert.Equalf(t, k, retKey, "test: %s", td.testName)
+	}
+}
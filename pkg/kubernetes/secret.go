@@ -0,0 +1,164 @@
+package kubernetes
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// SecretTypeTLS is the Kubernetes secret type for TLS key pairs
+	SecretTypeTLS = "kubernetes.io/tls"
+	// SecretTypeOpaque is the Kubernetes secret type for arbitrary data
+	SecretTypeOpaque = "Opaque"
+
+	// TLSCertKey is the secret data key for the certificate chain
+	TLSCertKey = "tls.crt"
+	// TLSPrivateKeyKey is the secret data key for the private key
+	TLSPrivateKeyKey = "tls.key"
+	// CACertKey is the secret data key for the issuing CA, as set by cert-manager
+	CACertKey = "ca.crt"
+)
+
+// Format of a Kubernetes manifest
+type Format string
+
+const (
+	// YAML manifest
+	YAML Format = "yaml"
+	// JSON manifest
+	JSON Format = "json"
+)
+
+var (
+	// FormatChoices is the set of supported manifest formats
+	FormatChoices = map[string]Format{
+		string(YAML): YAML,
+		string(JSON): JSON,
+	}
+
+	dns1123Label     = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+	dns1123Subdomain = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`)
+	labelName        = regexp.MustCompile(`^([A-Za-z0-9][-A-Za-z0-9_.]*)?[A-Za-z0-9]$`)
+)
+
+// ObjectMeta is the subset of Kubernetes object metadata set at manifests
+type ObjectMeta struct {
+	Name      string            `json:"name" yaml:"name"`
+	Namespace string            `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+}
+
+// Secret is a Kubernetes secret manifest. Data values are base64 encoded
+type Secret struct {
+	APIVersion string            `json:"apiVersion" yaml:"apiVersion"`
+	Kind       string            `json:"kind" yaml:"kind"`
+	Metadata   ObjectMeta        `json:"metadata" yaml:"metadata"`
+	Type       string            `json:"type" yaml:"type"`
+	Data       map[string]string `json:"data" yaml:"data"`
+}
+
+// NewTLSSecret returns a kubernetes.io/tls secret containing the PEM
+// certificate chain and key, both required. The CA certificate is only
+// added when informed
+func NewTLSSecret(meta ObjectMeta, certPEM, keyPEM, caPEM []byte) (*Secret, error) {
+	if len(certPEM) == 0 || len(keyPEM) == 0 {
+		return nil, fmt.Errorf("TLS secrets must contain both a certificate and a key")
+	}
+	data := map[string][]byte{
+		TLSCertKey:       certPEM,
+		TLSPrivateKeyKey: keyPEM,
+	}
+	if len(caPEM) != 0 {
+		data[CACertKey] = caPEM
+	}
+	return newSecret(meta, SecretTypeTLS, data)
+}
+
+// NewOpaqueSecret returns an Opaque secret containing the data
+func NewOpaqueSecret(meta ObjectMeta, data map[string][]byte) (*Secret, error) {
+	return newSecret(meta, SecretTypeOpaque, data)
+}
+
+// newSecret validates the metadata and returns a secret
+// of the type with base64 encoded data values
+func newSecret(meta ObjectMeta, t string, data map[string][]byte) (*Secret, error) {
+	if err := meta.Validate(); err != nil {
+		return nil, err
+	}
+
+	s := &Secret{
+		APIVersion: "v1",
+		Kind:       "Secret",
+		Metadata:   meta,
+		Type:       t,
+		Data:       make(map[string]string, len(data)),
+	}
+	for k, v := range data {
+		s.Data[k] = base64.StdEncoding.EncodeToString(v)
+	}
+	return s, nil
+}
+
+// Marshal serializes the secret manifest using the format
+func (s *Secret) Marshal(f Format) ([]byte, error) {
+	switch f {
+	case YAML:
+		return yaml.Marshal(s)
+	case JSON:
+		b, err := json.MarshalIndent(s, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(b, '\n'), nil
+	}
+	return nil, fmt.Errorf("unknown manifest format: %s", f)
+}
+
+// Validate checks the name, namespace and labels against
+// the rules enforced by the Kubernetes API server
+func (m *ObjectMeta) Validate() error {
+	if len(m.Name) > 253 || !dns1123Subdomain.MatchString(m.Name) {
+		return fmt.Errorf("invalid name %q, it must be a lowercase RFC 1123 subdomain", m.Name)
+	}
+	if m.Namespace != "" && (len(m.Namespace) > 63 || !dns1123Label.MatchString(m.Namespace)) {
+		return fmt.Errorf("invalid namespace %q, it must be a lowercase RFC 1123 label", m.Namespace)
+	}
+
+	keys := make([]string, 0, len(m.Labels))
+	for k := range m.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if err := validateLabel(k, m.Labels[k]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateLabel checks a label key, made of an optional DNS
+// subdomain prefix and a name, and its value
+func validateLabel(k, v string) error {
+	name := k
+	if i := strings.LastIndex(k, "/"); i >= 0 {
+		prefix := k[:i]
+		name = k[i+1:]
+		if len(prefix) > 253 || !dns1123Subdomain.MatchString(prefix) {
+			return fmt.Errorf("invalid label key %q, the prefix must be a lowercase RFC 1123 subdomain", k)
+		}
+	}
+	if len(name) > 63 || !labelName.MatchString(name) {
+		return fmt.Errorf("invalid label key %q", k)
+	}
+	if v != "" && (len(v) > 63 || !labelName.MatchString(v)) {
+		return fmt.Errorf("invalid value %q for label %q", v, k)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package kubernetes
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewTLSSecret(t *testing.T) {
+	var testData = []struct {
+		testName string
+		meta     ObjectMeta
+		ca       []byte
+		errorRet bool
+	}{
+		{testName: "name only", meta: ObjectMeta{Name: "web-tls"}},
+		{testName: "namespace and labels", meta: ObjectMeta{Name: "web.tls", Namespace: "prod", Labels: map[string]string{"app.kubernetes.io/name": "web", "tier": ""}}, ca: []byte("ca")},
+		{testName: "empty name", meta: ObjectMeta{}, errorRet: true},
+		{testName: "uppercase name", meta: ObjectMeta{Name: "Web"}, errorRet: true},
+		{testName: "namespace with dots", meta: ObjectMeta{Name: "web", Namespace: "a.b"}, errorRet: true},
+		{testName: "invalid label key", meta: ObjectMeta{Name: "web", Labels: map[string]string{"-app": "web"}}, errorRet: true},
+		{testName: "invalid label prefix", meta: ObjectMeta{Name: "web", Labels: map[string]string{"Example.com/app": "web"}}, errorRet: true},
+		{testName: "invalid label value", meta: ObjectMeta{Name: "web", Labels: map[string]string{"app": "a b"}}, errorRet: true},
+	}
+
+	for _, td := range testData {
+		s, err := NewTLSSecret(td.meta, []byte("cert"), []byte("key"), td.ca)
+		if td.errorRet {
+			assert.Errorf(t, err, "test: %s", td.testName)
+			continue
+		}
+		assert.NoErrorf(t, err, "test: %s", td.testName)
+
+		for _, f := range []Format{YAML, JSON} {
+			b, err := s.Marshal(f)
+			assert.NoErrorf(t, err, "test: %s", td.testName)
+
+			read := &Secret{}
+			if f == YAML {
+				err = yaml.Unmarshal(b, read)
+			} else {
+				err = json.Unmarshal(b, read)
+			}
+			assert.NoErrorf(t, err, "test: %s", td.testName)
+			assert.Equal(t, s, read, "test: %s", td.testName)
+		}
+
+		assert.Equal(t, "v1", s.APIVersion, "test: %s", td.testName)
+		assert.Equal(t, "Secret", s.Kind, "test: %s", td.testName)
+		assert.Equal(t, SecretTypeTLS, s.Type, "test: %s", td.testName)
+		assert.Equal(t, base64.StdEncoding.EncodeToString([]byte("cert")), s.Data[TLSCertKey], "test: %s", td.testName)
+		assert.Equal(t, base64.StdEncoding.EncodeToString([]byte("key")), s.Data[TLSPrivateKeyKey], "test: %s", td.testName)
+		_, hasCA := s.Data[CACertKey]
+		assert.Equal(t, td.ca != nil, hasCA, "test: %s", td.testName)
+	}
+
+	_, err := NewTLSSecret(ObjectMeta{Name: "web"}, nil, []byte("key"), nil)
+	assert.NotNil(t, err)
+	_, err = NewTLSSecret(ObjectMeta{Name: "web"}, []byte("cert"), nil, nil)
+	assert.NotNil(t, err)
+
+	s, err := NewTLSSecret(ObjectMeta{Name: "web"}, []byte("cert"), []byte("key"), nil)
+	assert.Nil(t, err)
+	b, err := s.Marshal(YAML)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(string(b), "apiVersion: v1\nkind: Secret\n"))
+	_, err = s.Marshal("xml")
+	assert.NotNil(t, err)
+}
+
+func TestNewOpaqueSecret(t *testing.T) {
+	s, err := NewOpaqueSecret(ObjectMeta{Name: "web-key"}, map[string][]byte{TLSPrivateKeyKey: []byte("key")})
+	assert.Nil(t, err)
+	assert.Equal(t, SecretTypeOpaque, s.Type)
+	assert.Equal(t, map[string]string{TLSPrivateKeyKey: base64.StdEncoding.EncodeToString([]byte("key"))}, s.Data)
+
+	_, err = NewOpaqueSecret(ObjectMeta{Name: "Web"}, nil)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,316 @@
+package ocsp
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/odacremolbap/xfon/pkg/ca"
+	"github.com/odacremolbap/xfon/pkg/cert"
+	xocsp "golang.org/x/crypto/ocsp"
+)
+
+// maxRequestSize limits the size of OCSP requests
+const maxRequestSize = 10 * 1024
+
+// StatusChoices maps OCSP certificate statuses to their names
+var StatusChoices = map[int]string{
+	xocsp.Good:    "good",
+	xocsp.Revoked: "revoked",
+	xocsp.Unknown: "unknown",
+}
+
+// HashChoices are the hash algorithms accepted for request certificate IDs
+var HashChoices = map[string]crypto.Hash{
+	"sha1":   crypto.SHA1,
+	"sha256": crypto.SHA256,
+	"sha384": crypto.SHA384,
+	"sha512": crypto.SHA512,
+}
+
+// Responder answers RFC 6960 requests for certificates issued by
+// a CA, using its index for the status of each serial
+type Responder struct {
+	ca *ca.CA
+	// certificate signing responses, nil when signed by the CA
+	delegated *x509.Certificate
+	signer    crypto.Signer
+	validity  time.Duration
+
+	// mu serializes index reloads
+	mu sync.Mutex
+}
+
+// NewResponder creates a responder for the CA. Responses are signed with
+// the CA key when the responder certificate is nil, otherwise the
+// certificate must be issued by the CA for OCSP signing and is embedded
+// at responses. Responses are valid for the informed duration
+func NewResponder(authority *ca.CA, responder *x509.Certificate, signer crypto.Signer, validity time.Duration) (*Responder, error) {
+	if validity <= 0 {
+		return nil, fmt.Errorf("response validity must be positive")
+	}
+	r := &Responder{ca: authority, signer: signer, validity: validity}
+
+	if responder == nil {
+		if err := cert.ValidateIssuer(authority.Certificate, signer); err != nil {
+			return nil, err
+		}
+		return r, nil
+	}
+
+	if err := validateDelegated(responder, authority.Certificate); err != nil {
+		return nil, err
+	}
+	pub, ok := signer.Public().(interface {
+		Equal(crypto.PublicKey) bool
+	})
+	if !ok || !pub.Equal(responder.PublicKey) {
+		return nil, fmt.Errorf("signing key does not match the responder certificate")
+	}
+	r.delegated = responder
+	return r, nil
+}
+
+// ServeHTTP answers GET requests with the base64 encoded request at
+// the path, and POST requests with the DER request as body
+func (r *Responder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var (
+		der []byte
+		err error
+	)
+	switch req.Method {
+	case http.MethodGet:
+		der, err = base64.StdEncoding.DecodeString(strings.TrimPrefix(req.URL.Path, "/"))
+	case http.MethodPost:
+		if ct := req.Header.Get("Content-Type"); ct != "application/ocsp-request" {
+			http.Error(w, fmt.Sprintf("unsupported content type %q", ct), http.StatusUnsupportedMediaType)
+			return
+		}
+		der, err = io.ReadAll(io.LimitReader(req.Body, maxRequestSize+1))
+		if err == nil && len(der) > maxRequestSize {
+			err = fmt.Errorf("request too large")
+		}
+	default:
+		http.Error(w, fmt.Sprintf("method %s not allowed", req.Method), http.StatusMethodNotAllowed)
+		return
+	}
+
+	now := time.Now()
+	res := xocsp.MalformedRequestErrorResponse
+	if err == nil {
+		res, err = r.Respond(der, now)
+		if err != nil {
+			log.Printf("error answering OCSP request: %v", err.Error())
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/ocsp-response")
+	if req.Method == http.MethodGet && err == nil {
+		w.Header().Set("Last-Modified", now.UTC().Format(http.TimeFormat))
+		w.Header().Set("Expires", now.Add(r.validity).UTC().Format(http.TimeFormat))
+		w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d, public, no-transform, must-revalidate", int(r.validity.Seconds())))
+	}
+	w.Write(res)
+}
+
+// Respond returns the signed response for a DER encoded request. Requests
+// for other issuers get an unauthorized response, and serials not at the
+// index are reported as unknown. On failure the returned bytes contain
+// the OCSP error response to send
+func (r *Responder) Respond(der []byte, now time.Time) ([]byte, error) {
+	req, err := xocsp.ParseRequest(der)
+	if err != nil {
+		return xocsp.MalformedRequestErrorResponse, fmt.Errorf("error parsing request: %s", err.Error())
+	}
+
+	nameHash, keyHash, err := issuerHashes(r.ca.Certificate, req.HashAlgorithm)
+	if err != nil {
+		return xocsp.MalformedRequestErrorResponse, err
+	}
+	if !bytes.Equal(nameHash, req.IssuerNameHash) || !bytes.Equal(keyHash, req.IssuerKeyHash) {
+		return xocsp.UnauthorizedErrorResponse, nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.ca.ReloadIndex(); err != nil {
+		return xocsp.InternalErrorErrorResponse, err
+	}
+
+	now = now.UTC().Truncate(time.Second)
+	t := xocsp.Response{
+		Status:       xocsp.Unknown,
+		SerialNumber: req.SerialNumber,
+		ThisUpdate:   now,
+		NextUpdate:   now.Add(r.validity),
+		IssuerHash:   req.HashAlgorithm,
+		Certificate:  r.delegated,
+	}
+	if rec := r.ca.Index.Find(req.SerialNumber); rec != nil {
+		t.Status = xocsp.Good
+		if rec.Status == ca.StatusRevoked {
+			t.Status = xocsp.Revoked
+			if rec.RevokedAt != nil {
+				t.RevokedAt = *rec.RevokedAt
+			}
+			if t.RevocationReason, err = cert.ParseRevocationReason(rec.Reason); err != nil {
+				return xocsp.InternalErrorErrorResponse, err
+			}
+		}
+	}
+
+	responder := r.delegated
+	if responder == nil {
+		responder = r.ca.Certificate
+	}
+	res, err := xocsp.CreateResponse(r.ca.Certificate, responder, t, r.signer)
+	if err != nil {
+		return xocsp.InternalErrorErrorResponse, fmt.Errorf("error signing response: %s", err.Error())
+	}
+	return res, nil
+}
+
+// QueryOptions customize OCSP queries
+type QueryOptions struct {
+	// HTTPClient used for requests, http.DefaultClient if nil
+	HTTPClient *http.Client
+	// Get sends the request base64 encoded at the URL, instead of POST
+	Get bool
+	// Hash for the certificate ID, SHA-1 if zero
+	Hash crypto.Hash
+}
+
+// Query requests the status of the certificate to the responder
+// at the URL. The response signature is verified, and delegated
+// responders must be authorized for OCSP signing by the issuer
+func Query(ctx context.Context, responderURL string, c, issuer *x509.Certificate, o *QueryOptions) (*xocsp.Response, error) {
+	if o == nil {
+		o = &QueryOptions{}
+	}
+	der, err := xocsp.CreateRequest(c, issuer, &xocsp.RequestOptions{Hash: o.Hash})
+	if err != nil {
+		return nil, fmt.Errorf("error creating OCSP request: %s", err.Error())
+	}
+
+	var req *http.Request
+	if o.Get {
+		u := strings.TrimSuffix(responderURL, "/") + "/" + url.QueryEscape(base64.StdEncoding.EncodeToString(der))
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	} else {
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, responderURL, bytes.NewReader(der))
+		if err == nil {
+			req.Header.Set("Content-Type", "application/ocsp-request")
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/ocsp-response")
+
+	client := o.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error querying %s: %s", responderURL, err.Error())
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned status %d", responderURL, res.StatusCode)
+	}
+	b, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("error reading response: %s", err.Error())
+	}
+
+	r, err := xocsp.ParseResponseForCert(b, c, issuer)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OCSP response: %s", err.Error())
+	}
+	if r.Certificate != nil && !r.Certificate.Equal(issuer) {
+		if err := validateDelegated(r.Certificate, issuer); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// ResponseInfo is the certificate status reported by an OCSP response
+type ResponseInfo struct {
+	Status     string     `json:"status" yaml:"status"`
+	Serial     string     `json:"serial" yaml:"serial"`
+	ThisUpdate time.Time  `json:"thisUpdate" yaml:"thisUpdate"`
+	NextUpdate time.Time  `json:"nextUpdate" yaml:"nextUpdate"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty" yaml:"revokedAt,omitempty"`
+	Reason     string     `json:"reason,omitempty" yaml:"reason,omitempty"`
+	// Responder is the delegated responder subject, empty
+	// when the response is signed by the issuer
+	Responder string `json:"responder,omitempty" yaml:"responder,omitempty"`
+}
+
+// NewResponseInfo returns the informational representation of a response
+func NewResponseInfo(r *xocsp.Response) *ResponseInfo {
+	i := &ResponseInfo{
+		Status:     StatusChoices[r.Status],
+		Serial:     cert.FormatHex(r.SerialNumber.Bytes()),
+		ThisUpdate: r.ThisUpdate.UTC(),
+		NextUpdate: r.NextUpdate.UTC(),
+	}
+	if r.Status == xocsp.Revoked {
+		at := r.RevokedAt.UTC()
+		i.RevokedAt = &at
+		i.Reason = cert.RevocationReasonToString(r.RevocationReason)
+	}
+	if r.Certificate != nil {
+		i.Responder = r.Certificate.Subject.String()
+	}
+	return i
+}
+
+// validateDelegated checks that a responder certificate
+// is issued by the CA and authorized for OCSP signing
+func validateDelegated(responder, issuer *x509.Certificate) error {
+	if err := responder.CheckSignatureFrom(issuer); err != nil {
+		return fmt.Errorf("responder certificate is not issued by the CA: %s", err.Error())
+	}
+	for _, u := range responder.ExtKeyUsage {
+		if u == x509.ExtKeyUsageOCSPSigning {
+			return nil
+		}
+	}
+	return fmt.Errorf("responder certificate is not authorized for OCSP signing")
+}
+
+// issuerHashes returns the hashes of the issuer name and
+// public key that identify it at OCSP requests
+func issuerHashes(issuer *x509.Certificate, h crypto.Hash) ([]byte, []byte, error) {
+	if !h.Available() {
+		return nil, nil, fmt.Errorf("unsupported hash algorithm")
+	}
+	spki := struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}{}
+	if _, err := asn1.Unmarshal(issuer.RawSubjectPublicKeyInfo, &spki); err != nil {
+		return nil, nil, fmt.Errorf("error parsing issuer public key: %s", err.Error())
+	}
+
+	nh := h.New()
+	nh.Write(issuer.RawSubject)
+	kh := h.New()
+	kh.Write(spki.PublicKey.RightAlign())
+	return nh.Sum(nil), kh.Sum(nil), nil
+}
@@ -0,0 +1,163 @@
+package ocsp
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"math/big"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/odacremolbap/xfon/internal/testutil"
+	"github.com/odacremolbap/xfon/pkg/ca"
+	"github.com/odacremolbap/xfon/pkg/cert"
+	"github.com/odacremolbap/xfon/pkg/key"
+	xocsp "golang.org/x/crypto/ocsp"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestCA creates a CA home at a temporary directory
+func newTestCA(t *testing.T, cn string) (*ca.CA, crypto.Signer) {
+	c, k := testutil.NewCA(t, &cert.Subject{CommonName: cn})
+	authority, err := ca.Init(filepath.Join(t.TempDir(), "ca"), ca.DefaultConfig(), c, k, nil)
+	assert.Nil(t, err)
+	return authority, k
+}
+
+// issue signs a certificate with the profile, returning it with its key
+func issue(t *testing.T, authority *ca.CA, signer crypto.Signer, cn, profile string) (*x509.Certificate, crypto.Signer) {
+	k, err := key.GenerateKey(&key.Options{Type: key.ECDSA, Curve: "P-256"})
+	assert.Nil(t, err)
+	p, err := authority.Profile(profile)
+	assert.Nil(t, err)
+	x := p.Template(time.Now().Add(-time.Minute))
+	x.Subject = &cert.Subject{CommonName: cn}
+	c, err := authority.Issue(x, k.Public(), signer, profile)
+	assert.Nil(t, err)
+	return c, k
+}
+
+func TestResponder(t *testing.T) {
+	authority, signer := newTestCA(t, "test CA")
+	good, _ := issue(t, authority, signer, "good", "server")
+	revoked, _ := issue(t, authority, signer, "revoked", "server")
+	responderCert, responderKey := issue(t, authority, signer, "responder", "ocsp-responder")
+	assert.Nil(t, authority.Revoke(revoked.SerialNumber, 1, time.Now()))
+
+	// certificates signed by the CA key that are not at the index
+	x := cert.BuiltinProfiles["server"].Template(time.Now())
+	x.Subject = &cert.Subject{CommonName: "unknown"}
+	x.Serial = big.NewInt(42)
+	b, err := cert.GenerateX509Certificate(x, authority.Certificate, signer.Public(), signer)
+	assert.Nil(t, err)
+	unknown, err := x509.ParseCertificate(b)
+	assert.Nil(t, err)
+
+	other, otherSigner := newTestCA(t, "other CA")
+	foreign, _ := issue(t, other, otherSigner, "foreign", "server")
+
+	direct, err := NewResponder(authority, nil, signer, time.Hour)
+	assert.Nil(t, err)
+	delegated, err := NewResponder(authority, responderCert, responderKey, time.Hour)
+	assert.Nil(t, err)
+
+	var testData = []struct {
+		testName  string
+		responder *Responder
+		options   *QueryOptions
+		cert      *x509.Certificate
+		issuer    *x509.Certificate
+		status    int
+		reason    string
+		errorRet  bool
+	}{
+		{"good", direct, nil, good, authority.Certificate, xocsp.Good, "", false},
+		{"good using GET", direct, &QueryOptions{Get: true}, good, authority.Certificate, xocsp.Good, "", false},
+		{"good with SHA-256 ID", direct, &QueryOptions{Hash: crypto.SHA256}, good, authority.Certificate, xocsp.Good, "", false},
+		{"revoked", direct, nil, revoked, authority.Certificate, xocsp.Revoked, "keyCompromise", false},
+		{"revoked from delegated responder", delegated, &QueryOptions{Get: true}, revoked, authority.Certificate, xocsp.Revoked, "keyCompromise", false},
+		{"unknown serial", direct, nil, unknown, authority.Certificate, xocsp.Unknown, "", false},
+		{"other issuer", direct, nil, foreign, other.Certificate, 0, "", true},
+	}
+
+	for _, td := range testData {
+		ts := httptest.NewServer(td.responder)
+		r, err := Query(context.Background(), ts.URL, td.cert, td.issuer, td.options)
+		ts.Close()
+		if td.errorRet {
+			assert.Errorf(t, err, "test: %s", td.testName)
+			continue
+		}
+		if !assert.NoErrorf(t, err, "test: %s", td.testName) {
+			continue
+		}
+
+		i := NewResponseInfo(r)
+		assert.Equal(t, td.status, r.Status, "test: %s", td.testName)
+		assert.Equal(t, td.reason, i.Reason, "test: %s", td.testName)
+		assert.Equal(t, cert.FormatHex(td.cert.SerialNumber.Bytes()), i.Serial, "test: %s", td.testName)
+		assert.Equal(t, time.Hour, r.NextUpdate.Sub(r.ThisUpdate), "test: %s", td.testName)
+		if td.responder == delegated {
+			assert.Equal(t, "CN=responder", i.Responder, "test: %s", td.testName)
+		} else {
+			assert.Equal(t, "", i.Responder, "test: %s", td.testName)
+		}
+	}
+
+	// revocations made by other processes after the responder started are reported
+	reopened, err := ca.Open(authority.Dir)
+	assert.Nil(t, err)
+	assert.Nil(t, reopened.Revoke(good.SerialNumber, 4, time.Now()))
+	ts := httptest.NewServer(direct)
+	defer ts.Close()
+	r, err := Query(context.Background(), ts.URL, good, authority.Certificate, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, xocsp.Revoked, r.Status)
+
+	// the other CA's responses are unauthorized
+	der, err := xocsp.CreateRequest(foreign, other.Certificate, nil)
+	assert.Nil(t, err)
+	res, err := direct.Respond(der, time.Now())
+	assert.Nil(t, err)
+	_, err = xocsp.ParseResponse(res, nil)
+	re := xocsp.ResponseError{}
+	assert.True(t, errors.As(err, &re))
+	assert.Equal(t, xocsp.Unauthorized, re.Status)
+}
+
+func TestNewResponder(t *testing.T) {
+	authority, signer := newTestCA(t, "test CA")
+	responderCert, responderKey := issue(t, authority, signer, "responder", "ocsp-responder")
+	serverCert, serverKey := issue(t, authority, signer, "server", "server")
+	other, otherSigner := newTestCA(t, "other CA")
+	foreignCert, foreignKey := issue(t, other, otherSigner, "responder", "ocsp-responder")
+
+	var testData = []struct {
+		testName  string
+		responder *x509.Certificate
+		signer    crypto.Signer
+		validity  time.Duration
+		errorRet  bool
+	}{
+		{"CA key", nil, signer, time.Hour, false},
+		{"delegated responder", responderCert, responderKey, time.Hour, false},
+		{"wrong CA key", nil, responderKey, time.Hour, true},
+		{"wrong responder key", responderCert, signer, time.Hour, true},
+		{"responder without OCSP signing", serverCert, serverKey, time.Hour, true},
+		{"responder from other CA", foreignCert, foreignKey, time.Hour, true},
+		{"no validity", nil, signer, 0, true},
+	}
+
+	for _, td := range testData {
+		_, err := NewResponder(authority, td.responder, td.signer, td.validity)
+		if td.errorRet {
+			assert.Errorf(t, err, "test: %s", td.testName)
+		} else {
+			assert.NoErrorf(t, err, "test: %s", td.testName)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package passphrase
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/odacremolbap/xfon/pkg/filesystem"
+	"golang.org/x/term"
+)
+
+// Source of a passphrase. The environment variable is checked first,
+// then the file. When none of them are informed the passphrase is
+// prompted at the terminal
+type Source struct {
+	// Env is the name of an environment variable holding the passphrase
+	Env string
+	// File is the path to a file whose first line is the passphrase
+	File string
+}
+
+// Read returns the passphrase from the configured source. When prompting,
+// confirm asks the user to type the passphrase twice
+func (s *Source) Read(prompt string, confirm bool) ([]byte, error) {
+	if s != nil && s.Env != "" {
+		p, ok := os.LookupEnv(s.Env)
+		if !ok {
+			return nil, fmt.Errorf("environment variable %q is not set", s.Env)
+		}
+		return []byte(p), nil
+	}
+
+	if s != nil && s.File != "" {
+		b, err := filesystem.ReadContentsFromFile(s.File)
+		if err != nil {
+			return nil, fmt.Errorf("error reading passphrase file: %s", err.Error())
+		}
+		if i := bytes.IndexAny(b, "\r\n"); i >= 0 {
+			b = b[:i]
+		}
+		return b, nil
+	}
+
+	return FromPrompt(prompt, confirm)
+}
+
+// FromPrompt reads a passphrase from the terminal without echoing it
+func FromPrompt(prompt string, confirm bool) ([]byte, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return nil, errors.New("a passphrase is needed but stdin is not a terminal, use a passphrase env var or file")
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	p, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, fmt.Errorf("error reading passphrase: %s", err.Error())
+	}
+
+	if confirm {
+		fmt.Fprint(os.Stderr, "confirm "+prompt)
+		c, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return nil, fmt.Errorf("error reading passphrase: %s", err.Error())
+		}
+		if !bytes.Equal(p, c) {
+			return nil, errors.New("passphrases don't match")
+		}
+	}
+
+	return p, nil
+}
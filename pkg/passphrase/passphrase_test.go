@@ -0,0 +1,58 @@
+package passphrase
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSourceRead(t *testing.T) {
+	dir, err := ioutil.TempDir("", "passphrase")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "pass")
+	assert.Nil(t, ioutil.WriteFile(file, []byte("from-file\nsecond line\n"), 0600))
+	os.Setenv("XFON_TEST_PASSPHRASE", "from-env")
+	defer os.Unsetenv("XFON_TEST_PASSPHRASE")
+
+	var testData = []struct {
+		testName string
+		source   *Source
+		expected string
+		errorRet bool
+	}{
+		{testName: "env",
+			source:   &Source{Env: "XFON_TEST_PASSPHRASE"},
+			expected: "from-env",
+		},
+		{testName: "env over file",
+			source:   &Source{Env: "XFON_TEST_PASSPHRASE", File: file},
+			expected: "from-env",
+		},
+		{testName: "file first line",
+			source:   &Source{File: file},
+			expected: "from-file",
+		},
+		{testName: "missing env",
+			source:   &Source{Env: "XFON_TEST_PASSPHRASE_MISSING"},
+			errorRet: true,
+		},
+		{testName: "missing file",
+			source:   &Source{File: filepath.Join(dir, "missing")},
+			errorRet: true,
+		},
+	}
+	for _, td := range testData {
+		p, err := td.source.Read("", false)
+		if td.errorRet {
+			assert.Errorf(t, err, "test: %s", td.testName)
+			continue
+		}
+		assert.NoErrorf(t, err, "test: %s", td.testName)
+		assert.Equalf(t, td.expected, string(p), "test: %s", td.testName)
+	}
+}
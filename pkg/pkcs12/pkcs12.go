@@ -0,0 +1,127 @@
+package pkcs12
+
+import (
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"fmt"
+
+	gopkcs12 "software.sslmate.com/src/go-pkcs12"
+)
+
+// Encryption is the set of algorithms used to protect a PKCS#12 bundle
+type Encryption string
+
+const (
+	// Modern uses AES-256-CBC with PBKDF2 and a SHA-256 MAC. It is
+	// supported by OpenSSL 1.1.1, Java 12 and Windows Server 2019 onwards
+	Modern Encryption = "modern"
+	// Legacy uses RC2 for certificates, 3DES for keys and a SHA-1 MAC,
+	// for older Java and Windows releases
+	Legacy Encryption = "legacy"
+	// LegacyDES uses 3DES for certificates and keys and a SHA-1 MAC,
+	// for systems without RC2 support
+	LegacyDES Encryption = "legacy-des"
+)
+
+var (
+	// EncryptionChoices is the set of supported PKCS#12 encryptions
+	EncryptionChoices = map[string]Encryption{
+		string(Modern):    Modern,
+		string(Legacy):    Legacy,
+		string(LegacyDES): LegacyDES,
+	}
+
+	// ErrNoCertificate is returned when a bundle has no certificate
+	// matching its private key
+	ErrNoCertificate = errors.New("PKCS#12 bundle does not contain a certificate")
+)
+
+// encoder returns the go-pkcs12 encoder for the encryption
+func encoder(e Encryption) (*gopkcs12.Encoder, error) {
+	switch e {
+	case "", Modern:
+		return gopkcs12.Modern, nil
+	case Legacy:
+		return gopkcs12.LegacyRC2, nil
+	case LegacyDES:
+		return gopkcs12.LegacyDES, nil
+	}
+	return nil, fmt.Errorf("unknown PKCS#12 encryption: %s", e)
+}
+
+// Encode creates a password protected PKCS#12 bundle containing the private
+// key, its certificate and the CA chain. Modern encryption is used when
+// none is informed
+func Encode(key crypto.Signer, cert *x509.Certificate, chain []*x509.Certificate, password string, e Encryption) ([]byte, error) {
+	enc, err := encoder(e)
+	if err != nil {
+		return nil, err
+	}
+
+	pub, ok := key.Public().(interface {
+		Equal(crypto.PublicKey) bool
+	})
+	if !ok || !pub.Equal(cert.PublicKey) {
+		return nil, errors.New("private key does not match the certificate public key")
+	}
+
+	b, err := enc.Encode(key, cert, chain, password)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding PKCS#12 bundle: %s", err.Error())
+	}
+	return b, nil
+}
+
+// Decode reads a password protected PKCS#12 bundle, returning the
+// private key, its certificate and the CA chain
+func Decode(b []byte, password string) (crypto.Signer, *x509.Certificate, []*x509.Certificate, error) {
+	k, cert, chain, err := gopkcs12.DecodeChain(b, password)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("error decoding PKCS#12 bundle: %s", err.Error())
+	}
+	if cert == nil {
+		return nil, nil, nil, ErrNoCertificate
+	}
+
+	signer, ok := k.(crypto.Signer)
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("unsupported PKCS#12 private key type %T", k)
+	}
+
+	return signer, cert, chain, nil
+}
+
+// EncodeTrustStore creates a password protected PKCS#12 truststore, with
+// the certificates marked as trusted for Java 8 onwards. Aliases are set as
+// the certificates friendly names, and must match the certificates in number
+func EncodeTrustStore(certs []*x509.Certificate, aliases []string, password string, e Encryption) ([]byte, error) {
+	enc, err := encoder(e)
+	if err != nil {
+		return nil, err
+	}
+	if len(certs) != len(aliases) {
+		return nil, fmt.Errorf("got %d aliases for %d certificates", len(aliases), len(certs))
+	}
+
+	entries := make([]gopkcs12.TrustStoreEntry, len(certs))
+	for i := range certs {
+		entries[i] = gopkcs12.TrustStoreEntry{Cert: certs[i], FriendlyName: aliases[i]}
+	}
+
+	b, err := enc.EncodeTrustStoreEntries(entries, password)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding PKCS#12 truststore: %s", err.Error())
+	}
+	return b, nil
+}
+
+// DecodeTrustStore reads the certificates from a password protected
+// PKCS#12 truststore. Friendly names are not reported
+func DecodeTrustStore(b []byte, password string) ([]*x509.Certificate, error) {
+	certs, err := gopkcs12.DecodeTrustStore(b, password)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding PKCS#12 truststore: %s", err.Error())
+	}
+	return certs, nil
+}
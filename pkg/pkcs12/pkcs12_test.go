@@ -0,0 +1,58 @@
+package pkcs12
+
+import (
+	"crypto"
+	"crypto/x509"
+	"testing"
+
+	"github.com/odacremolbap/xfon/internal/testutil"
+	"github.com/odacremolbap/xfon/pkg/cert"
+	"github.com/odacremolbap/xfon/pkg/key"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	ca, caKey := testutil.NewCA(t, &cert.Subject{CommonName: "ca"})
+	rsaCert, rsaKey := testutil.NewCertificate(t, &key.Options{Type: key.RSA, Bits: 2048}, "rsa", ca, caKey)
+	ecCert, ecKey := testutil.NewCertificate(t, &key.Options{Type: key.ECDSA, Curve: "P-384"}, "ecdsa", ca, caKey)
+	edCert, edKey := testutil.NewCertificate(t, &key.Options{Type: key.Ed25519}, "ed25519", ca, caKey)
+
+	var testData = []struct {
+		testName   string
+		key        crypto.Signer
+		cert       *x509.Certificate
+		chain      []*x509.Certificate
+		encryption Encryption
+		errorRet   bool
+	}{
+		{testName: "rsa modern", key: rsaKey, cert: rsaCert, chain: []*x509.Certificate{ca}, encryption: Modern},
+		{testName: "rsa legacy", key: rsaKey, cert: rsaCert, chain: []*x509.Certificate{ca}, encryption: Legacy},
+		{testName: "rsa legacy des", key: rsaKey, cert: rsaCert, chain: []*x509.Certificate{ca}, encryption: LegacyDES},
+		{testName: "ecdsa default encryption", key: ecKey, cert: ecCert, chain: []*x509.Certificate{ca}},
+		{testName: "ed25519 without chain", key: edKey, cert: edCert, encryption: Modern},
+		{testName: "key not matching certificate", key: ecKey, cert: rsaCert, errorRet: true},
+		{testName: "unknown encryption", key: rsaKey, cert: rsaCert, encryption: "rot13", errorRet: true},
+	}
+
+	for _, td := range testData {
+		b, err := Encode(td.key, td.cert, td.chain, "s3cret", td.encryption)
+		if td.errorRet {
+			assert.Errorf(t, err, "test: %s", td.testName)
+			continue
+		}
+		assert.NoErrorf(t, err, "test: %s", td.testName)
+
+		_, _, _, err = Decode(b, "wrong")
+		assert.Errorf(t, err, "test: %s", td.testName)
+
+		k, c, chain, err := Decode(b, "s3cret")
+		assert.NoErrorf(t, err, "test: %s", td.testName)
+		assert.Equal(t, td.cert.Raw, c.Raw, "test: %s", td.testName)
+		assert.Equal(t, len(td.chain), len(chain), "test: %s", td.testName)
+		for i := range td.chain {
+			assert.Equal(t, td.chain[i].Raw, chain[i].Raw, "test: %s", td.testName)
+		}
+		assert.True(t, k.Public().(interface{ Equal(crypto.PublicKey) bool }).Equal(td.key.Public()), "test: %s", td.testName)
+	}
+}
@@ -0,0 +1,271 @@
+package pki
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/odacremolbap/xfon/pkg/cert"
+	"github.com/odacremolbap/xfon/pkg/filesystem"
+	"github.com/odacremolbap/xfon/pkg/key"
+)
+
+// Action taken for a key or certificate
+type Action string
+
+const (
+	// ActionCreated when the file did not exist
+	ActionCreated Action = "created"
+	// ActionUnchanged when the file matches the spec
+	ActionUnchanged Action = "unchanged"
+	// ActionReplaced when the file was regenerated, see the result reason
+	ActionReplaced Action = "replaced"
+)
+
+// Result of applying the spec to a key or certificate
+type Result struct {
+	// Kind is either key or certificate
+	Kind   string `json:"kind" yaml:"kind"`
+	Name   string `json:"name" yaml:"name"`
+	Path   string `json:"path" yaml:"path"`
+	Action Action `json:"action" yaml:"action"`
+	// Reason the file was replaced
+	Reason string `json:"reason,omitempty" yaml:"reason,omitempty"`
+}
+
+// Apply creates the keys and certificates of the spec at dir, as
+// <name>.key and <name>.crt files, issuing certificates after their
+// issuers. Existing keys are kept unless their type or size differ from
+// the spec. Existing certificates are kept unless they drifted from the
+// spec, are no longer signed by their issuer, or expire within the spec
+// renewal window from now. Results are returned even on error, listing
+// the files written until then
+func Apply(s *Spec, dir string, now time.Time) ([]*Result, error) {
+	results := []*Result{}
+	if err := s.Validate(); err != nil {
+		return results, err
+	}
+	renewBefore, _ := s.renewBefore()
+	order, _ := s.issuanceOrder()
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return results, fmt.Errorf("error creating directory %q: %s", dir, err.Error())
+	}
+
+	keys := map[string]crypto.Signer{}
+	applyKey := func(k *KeySpec) error {
+		if _, ok := keys[k.Name]; ok {
+			return nil
+		}
+		signer, r, err := applyKeySpec(k, filepath.Join(dir, k.Name+".key"))
+		if err != nil {
+			return fmt.Errorf("key %q: %s", k.Name, err.Error())
+		}
+		keys[k.Name] = signer
+		results = append(results, r)
+		return nil
+	}
+	for _, k := range s.Keys {
+		if err := applyKey(k); err != nil {
+			return results, err
+		}
+	}
+
+	certs := map[string]*x509.Certificate{}
+	for _, c := range order {
+		if err := applyKey(s.keySpec(c.keyName())); err != nil {
+			return results, err
+		}
+
+		x, err := s.template(c, now)
+		if err != nil {
+			return results, fmt.Errorf("certificate %q: %s", c.Name, err.Error())
+		}
+		signer := keys[c.keyName()]
+		var parent *x509.Certificate
+		if !c.selfSigned() {
+			parent = certs[c.Issuer]
+			signer = keys[s.certificateSpec(c.Issuer).keyName()]
+		}
+
+		path := filepath.Join(dir, c.Name+".crt")
+		r := &Result{Kind: "certificate", Name: c.Name, Path: path, Action: ActionCreated}
+		b, err := readIfExists(path)
+		if err != nil {
+			return results, fmt.Errorf("certificate %q: %s", c.Name, err.Error())
+		}
+		if b != nil {
+			existing, err := cert.ReadCertificate(b)
+			if err != nil {
+				return results, fmt.Errorf("certificate %q: error parsing %q: %s", c.Name, path, err.Error())
+			}
+			r.Reason = drift(existing, x, keys[c.keyName()].Public(), parent, now, renewBefore)
+			if r.Reason == "" {
+				certs[c.Name] = existing
+				r.Action = ActionUnchanged
+				results = append(results, r)
+				continue
+			}
+			r.Action = ActionReplaced
+		}
+
+		der, err := cert.GenerateX509Certificate(x, parent, keys[c.keyName()].Public(), signer)
+		if err != nil {
+			return results, fmt.Errorf("certificate %q: error generating certificate: %s", c.Name, err.Error())
+		}
+		if certs[c.Name], err = x509.ParseCertificate(der); err != nil {
+			return results, fmt.Errorf("certificate %q: error parsing generated certificate: %s", c.Name, err.Error())
+		}
+		p, err := cert.WritePEM(der)
+		if err != nil {
+			return results, fmt.Errorf("certificate %q: error serializing certificate into PEM: %s", c.Name, err.Error())
+		}
+		if err = filesystem.WriteContentsToFile(path, p); err != nil {
+			return results, fmt.Errorf("certificate %q: error writing certificate to file: %s", c.Name, err.Error())
+		}
+		results = append(results, r)
+	}
+
+	return results, nil
+}
+
+// applyKeySpec reads the key at path, generating it when it does not
+// exist or its type and size do not match the spec
+func applyKeySpec(k *KeySpec, path string) (crypto.Signer, *Result, error) {
+	o, err := k.Options()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	r := &Result{Kind: "key", Name: k.Name, Path: path, Action: ActionCreated}
+	b, err := readIfExists(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if b != nil {
+		existing, err := key.ReadPEM(b)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error parsing %q: %s", path, err.Error())
+		}
+		eo, err := key.OptionsFromPublicKey(existing.Public())
+		if err == nil && *eo == *o {
+			r.Action = ActionUnchanged
+			return existing, r, nil
+		}
+		r.Action = ActionReplaced
+		r.Reason = "key type or size changed"
+	}
+
+	signer, err := key.GenerateKey(o)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error generating key: %s", err.Error())
+	}
+	p, err := key.WritePEM(signer)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error serializing key into PEM: %s", err.Error())
+	}
+	if err = filesystem.WriteContentsToFile(path, p); err != nil {
+		return nil, nil, fmt.Errorf("error writing key to file: %s", err.Error())
+	}
+	return signer, r, nil
+}
+
+// readIfExists returns the contents of the file, nil when it does not
+// exist. Files that cannot be parsed are reported by the callers instead
+// of being overwritten, since they might be encrypted or foreign
+func readIfExists(path string) ([]byte, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil, nil
+	}
+	b, err := filesystem.ReadContentsFromFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %q: %s", path, err.Error())
+	}
+	return b, nil
+}
+
+// drift returns why the existing certificate must be reissued to match
+// the definition, or an empty string when it can be kept. parent is nil
+// for self signed certificates
+func drift(c *x509.Certificate, x *cert.X509Simplified, pub crypto.PublicKey, parent *x509.Certificate, now time.Time, renewBefore time.Duration) string {
+	if k, ok := pub.(interface{ Equal(crypto.PublicKey) bool }); !ok || !k.Equal(c.PublicKey) {
+		return "public key changed"
+	}
+
+	issuer := parent
+	if issuer == nil {
+		issuer = c
+	}
+	if !bytes.Equal(c.RawIssuer, issuer.RawSubject) ||
+		issuer.CheckSignature(c.SignatureAlgorithm, c.RawTBSCertificate, c.Signature) != nil {
+		return "issuer changed"
+	}
+
+	subject, err := asn1.Marshal(x.Subject.Name().ToRDNSequence())
+	if err != nil || !bytes.Equal(c.RawSubject, subject) {
+		return "subject changed"
+	}
+
+	if !sameStrings(c.DNSNames, x.DNSNames) ||
+		!sameStrings(c.EmailAddresses, x.EmailAddresses) ||
+		!sameStrings(ipStrings(c), ipStrings(&x509.Certificate{IPAddresses: x.IPAddresses})) ||
+		!sameStrings(uriStrings(c), uriStrings(&x509.Certificate{URIs: x.URIs})) {
+		return "subject alternative names changed"
+	}
+
+	if (c.BasicConstraintsValid && c.IsCA) != x.IsCA || pathLen(c.MaxPathLen, c.MaxPathLenZero) != pathLen(x.MaxPathLen, x.MaxPathLenZero) {
+		return "basic constraints changed"
+	}
+	if c.KeyUsage != x.KeyUsage || !sameStrings(cert.ExtKeyUsageToStrings(c.ExtKeyUsage), cert.ExtKeyUsageToStrings(x.ExtKeyUsage)) {
+		return "key usages changed"
+	}
+
+	if c.NotAfter.Sub(c.NotBefore) != x.NotAfter.Sub(x.NotBefore) {
+		return "validity changed"
+	}
+	if c.NotAfter.Sub(now) < renewBefore {
+		return fmt.Sprintf("expires at %s", c.NotAfter.UTC().Format(time.RFC3339))
+	}
+
+	return ""
+}
+
+// pathLen normalizes the maximum path length, -1 when unlimited
+func pathLen(maxPathLen int, zero bool) int {
+	if maxPathLen <= 0 && !zero {
+		return -1
+	}
+	return maxPathLen
+}
+
+func ipStrings(c *x509.Certificate) []string {
+	l := []string{}
+	for _, ip := range c.IPAddresses {
+		l = append(l, ip.String())
+	}
+	return l
+}
+
+func uriStrings(c *x509.Certificate) []string {
+	l := []string{}
+	for _, u := range c.URIs {
+		l = append(l, u.String())
+	}
+	return l
+}
+
+// sameStrings compares two lists regardless of their order
+func sameStrings(a, b []string) bool {
+	a = append([]string{}, a...)
+	b = append([]string{}, b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,194 @@
+package pki
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/odacremolbap/xfon/pkg/cert"
+	"github.com/odacremolbap/xfon/pkg/filesystem"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testSpec = `
+renewBefore: 10d
+keys:
+- name: root
+  type: ecdsa
+- name: intermediate
+  type: ecdsa
+  curve: P-384
+- name: shared
+  type: ed25519
+certificates:
+- name: web
+  issuer: intermediate
+  key: shared
+  profile: server
+  subject: CN=www.example.com
+  dnsNames: [www.example.com, example.com]
+  ipAddresses: [10.0.0.1]
+  days: 90
+- name: intermediate
+  issuer: root
+  profile: intermediate-ca
+  subject: CN=Intermediate,O=Acme
+- name: root
+  profile: root-ca
+  subject: CN=Root,O=Acme
+- name: api
+  issuer: intermediate
+  key: shared
+  profile: client
+  subject: CN=api
+`
+
+func TestReadSpec(t *testing.T) {
+	var testData = []struct {
+		testName string
+		spec     string
+		errorRet bool
+	}{
+		{testName: "valid spec", spec: testSpec},
+		{testName: "unknown field", spec: "certificates:\n- name: a\n  subject: CN=a\n  color: red\n", errorRet: true},
+		{testName: "no certificates", spec: "keys:\n- name: a\n", errorRet: true},
+		{testName: "duplicated certificate", spec: "certificates:\n- name: a\n  subject: CN=a\n- name: a\n  subject: CN=b\n", errorRet: true},
+		{testName: "unknown issuer", spec: "certificates:\n- name: a\n  subject: CN=a\n  issuer: b\n", errorRet: true},
+		{testName: "unknown key", spec: "certificates:\n- name: a\n  subject: CN=a\n  key: b\n", errorRet: true},
+		{testName: "unknown profile", spec: "certificates:\n- name: a\n  subject: CN=a\n  profile: b\n", errorRet: true},
+		{testName: "issuer not a CA", spec: "certificates:\n- name: a\n  subject: CN=a\n- name: b\n  subject: CN=b\n  issuer: a\n", errorRet: true},
+		{testName: "issuer cycle", spec: "certificates:\n- name: a\n  subject: CN=a\n  issuer: b\n  isCA: true\n- name: b\n  subject: CN=b\n  issuer: a\n  isCA: true\n", errorRet: true},
+		{testName: "no names", spec: "certificates:\n- name: a\n", errorRet: true},
+		{testName: "bits for ECDSA key", spec: "keys:\n- name: a\n  type: ecdsa\n  bits: 2048\ncertificates:\n- name: a\n  subject: CN=a\n", errorRet: true},
+		{testName: "invalid renewBefore", spec: "renewBefore: soon\ncertificates:\n- name: a\n  subject: CN=a\n", errorRet: true},
+		{testName: "spec profile", spec: "profiles:\n  tls:\n    days: 7\n    extKeyUsages: [ExtKeyUsageServerAuth]\ncertificates:\n- name: a\n  profile: tls\n  dnsNames: [a.example.com]\n"},
+	}
+
+	for _, td := range testData {
+		_, err := ReadSpec([]byte(td.spec))
+		if td.errorRet {
+			assert.Errorf(t, err, "test: %s", td.testName)
+			continue
+		}
+		assert.NoErrorf(t, err, "test: %s", td.testName)
+	}
+}
+
+func TestApply(t *testing.T) {
+	s, err := ReadSpec([]byte(testSpec))
+	assert.Nil(t, err)
+	dir := filepath.Join(t.TempDir(), "pki")
+	now := time.Now()
+
+	actions := func(results []*Result) map[string]Action {
+		m := map[string]Action{}
+		for _, r := range results {
+			m[r.Kind+"/"+r.Name] = r.Action
+		}
+		return m
+	}
+	readCert := func(name string) []byte {
+		b, err := filesystem.ReadContentsFromFile(filepath.Join(dir, name+".crt"))
+		assert.Nil(t, err)
+		return b
+	}
+
+	results, err := Apply(s, dir, now)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]Action{
+		"key/root": ActionCreated, "key/intermediate": ActionCreated, "key/shared": ActionCreated,
+		"certificate/root": ActionCreated, "certificate/intermediate": ActionCreated,
+		"certificate/web": ActionCreated, "certificate/api": ActionCreated,
+	}, actions(results))
+	// issuers come first
+	assert.Equal(t, "root", results[3].Name)
+	assert.Equal(t, "intermediate", results[4].Name)
+
+	web, err := cert.ReadCertificate(readCert("web"))
+	assert.Nil(t, err)
+	assert.Equal(t, "CN=Intermediate,O=Acme", web.Issuer.String())
+	assert.Equal(t, []string{"www.example.com", "example.com"}, web.DNSNames)
+	assert.Equal(t, 90*24*time.Hour, web.NotAfter.Sub(web.NotBefore))
+
+	// a second run leaves everything in place
+	before := readCert("web")
+	results, err = Apply(s, dir, now.Add(time.Hour))
+	assert.Nil(t, err)
+	for _, r := range results {
+		assert.Equal(t, ActionUnchanged, r.Action, "test: %s", r.Name)
+	}
+	assert.Equal(t, before, readCert("web"))
+
+	// drift and expiry
+	s.Certificates[0].DNSNames = []string{"www.example.com"}
+	results, err = Apply(s, dir, now.Add(85*24*time.Hour))
+	assert.Nil(t, err)
+	for _, r := range results {
+		switch r.Name {
+		case "web":
+			assert.Equal(t, ActionReplaced, r.Action)
+			assert.Equal(t, "subject alternative names changed", r.Reason)
+		case "api":
+			assert.Equal(t, ActionUnchanged, r.Action)
+		}
+	}
+
+	// api expires in 397 days, within the 10 days renewal window
+	results, err = Apply(s, dir, now.Add(390*24*time.Hour))
+	assert.Nil(t, err)
+	for _, r := range results {
+		switch r.Name {
+		case "api":
+			assert.Equal(t, ActionReplaced, r.Action)
+			assert.Contains(t, r.Reason, "expires at ")
+		case "intermediate", "root":
+			assert.Equal(t, ActionUnchanged, r.Action)
+		}
+	}
+
+	// a new intermediate key reissues the intermediate certificate
+	// and the ones it signs, while the root is kept
+	assert.Nil(t, os.Remove(filepath.Join(dir, "intermediate.key")))
+	results, err = Apply(s, dir, now.Add(390*24*time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]Action{
+		"key/root": ActionUnchanged, "key/intermediate": ActionCreated, "key/shared": ActionUnchanged,
+		"certificate/root": ActionUnchanged, "certificate/intermediate": ActionReplaced,
+		"certificate/web": ActionReplaced, "certificate/api": ActionReplaced,
+	}, actions(results))
+	web, err = cert.ReadCertificate(readCert("web"))
+	assert.Nil(t, err)
+	intermediate, err := cert.ReadCertificate(readCert("intermediate"))
+	assert.Nil(t, err)
+	assert.Nil(t, web.CheckSignatureFrom(intermediate))
+
+	// a different key type replaces the key
+	s.Keys[2].Type = "ecdsa"
+	results, err = Apply(s, dir, now.Add(390*24*time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, ActionReplaced, actions(results)["key/shared"])
+	assert.Equal(t, ActionReplaced, actions(results)["certificate/web"])
+
+	// files that cannot be parsed are not overwritten
+	assert.Nil(t, filesystem.WriteContentsToFile(filepath.Join(dir, "api.crt"), "garbage"))
+	_, err = Apply(s, dir, now)
+	assert.NotNil(t, err)
+}
+
+func TestIssuanceOrder(t *testing.T) {
+	s := &Spec{Certificates: []*CertificateSpec{
+		{Name: "leaf", Issuer: "sub"},
+		{Name: "sub", Issuer: "root"},
+		{Name: "other"},
+		{Name: "root", Issuer: "root"},
+	}}
+	order, err := s.issuanceOrder()
+	assert.Nil(t, err)
+	names := []string{}
+	for _, c := range order {
+		names = append(names, c.Name)
+	}
+	assert.Equal(t, []string{"other", "root", "sub", "leaf"}, names)
+}
@@ -0,0 +1,360 @@
+package pki
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/odacremolbap/xfon/pkg/cert"
+	"github.com/odacremolbap/xfon/pkg/key"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// DefaultRenewBefore is the time before expiry when certificates are reissued
+	DefaultRenewBefore = "30d"
+	// DefaultDays of validity for certificates without profile or days
+	DefaultDays = 365
+)
+
+// Spec describes a set of keys and the certificates issued for them
+type Spec struct {
+	// Dir where keys and certificates are written, relative to the spec file
+	Dir string `json:"dir,omitempty" yaml:"dir,omitempty"`
+	// RenewBefore reissues certificates expiring within it, as in 30d or 12h
+	RenewBefore string `json:"renewBefore,omitempty" yaml:"renewBefore,omitempty"`
+	// Profiles available to certificates, replacing built-in ones with the same name
+	Profiles map[string]*cert.Profile `json:"profiles,omitempty" yaml:"profiles,omitempty"`
+	// Keys generation options
+	Keys []*KeySpec `json:"keys,omitempty" yaml:"keys,omitempty"`
+	// Certificates to issue, in any order
+	Certificates []*CertificateSpec `json:"certificates" yaml:"certificates"`
+}
+
+// KeySpec describes a private key, written at <name>.key
+type KeySpec struct {
+	Name string `json:"name" yaml:"name"`
+	// Type as at key.TypeChoices, rsa if not informed
+	Type string `json:"type,omitempty" yaml:"type,omitempty"`
+	// Bits for RSA keys, 4096 if not informed
+	Bits int `json:"bits,omitempty" yaml:"bits,omitempty"`
+	// Curve for ECDSA keys, P-256 if not informed
+	Curve string `json:"curve,omitempty" yaml:"curve,omitempty"`
+}
+
+// CertificateSpec describes a certificate, written at <name>.crt.
+// Informed fields replace the ones at the profile
+type CertificateSpec struct {
+	Name string `json:"name" yaml:"name"`
+	// Key name, defaults to the certificate name. Keys that
+	// are not declared are generated with default options
+	Key string `json:"key,omitempty" yaml:"key,omitempty"`
+	// Issuer certificate name, self signed if not informed
+	Issuer string `json:"issuer,omitempty" yaml:"issuer,omitempty"`
+	// Profile name as at the spec profiles or the built-in ones
+	Profile string `json:"profile,omitempty" yaml:"profile,omitempty"`
+	// Subject string as accepted by cert.ParseSubject
+	Subject        string   `json:"subject,omitempty" yaml:"subject,omitempty"`
+	Days           int      `json:"days,omitempty" yaml:"days,omitempty"`
+	KeyUsages      []string `json:"keyUsages,omitempty" yaml:"keyUsages,omitempty"`
+	ExtKeyUsages   []string `json:"extKeyUsages,omitempty" yaml:"extKeyUsages,omitempty"`
+	IsCA           *bool    `json:"isCA,omitempty" yaml:"isCA,omitempty"`
+	MaxPathLen     *int     `json:"maxPathLen,omitempty" yaml:"maxPathLen,omitempty"`
+	DNSNames       []string `json:"dnsNames,omitempty" yaml:"dnsNames,omitempty"`
+	IPAddresses    []string `json:"ipAddresses,omitempty" yaml:"ipAddresses,omitempty"`
+	EmailAddresses []string `json:"emailAddresses,omitempty" yaml:"emailAddresses,omitempty"`
+	URIs           []string `json:"uris,omitempty" yaml:"uris,omitempty"`
+}
+
+// ReadSpec parses a spec file. YAML is a superset of JSON so both
+// formats are accepted. Unknown fields are rejected and the spec
+// is validated
+func ReadSpec(b []byte) (*Spec, error) {
+	s := &Spec{}
+	if err := yaml.UnmarshalStrict(b, s); err != nil {
+		return nil, fmt.Errorf("error parsing spec: %s", err.Error())
+	}
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Validate checks that names are unique, that every referenced key,
+// issuer and profile exists, that issuers do not form cycles, and
+// that every certificate definition can be built
+func (s *Spec) Validate() error {
+	if _, err := s.renewBefore(); err != nil {
+		return err
+	}
+	for name, p := range s.Profiles {
+		if p == nil {
+			return fmt.Errorf("profile %q is empty", name)
+		}
+		if err := p.Validate(); err != nil {
+			return fmt.Errorf("profile %q: %s", name, err.Error())
+		}
+	}
+
+	keys := map[string]bool{}
+	for _, k := range s.Keys {
+		if k == nil || k.Name == "" {
+			return fmt.Errorf("every key must have a name")
+		}
+		if keys[k.Name] {
+			return fmt.Errorf("duplicated key %q", k.Name)
+		}
+		keys[k.Name] = true
+		if _, err := k.Options(); err != nil {
+			return fmt.Errorf("key %q: %s", k.Name, err.Error())
+		}
+	}
+
+	if len(s.Certificates) == 0 {
+		return fmt.Errorf("at least one certificate must be informed")
+	}
+	certs := map[string]bool{}
+	for _, c := range s.Certificates {
+		if c == nil || c.Name == "" {
+			return fmt.Errorf("every certificate must have a name")
+		}
+		if certs[c.Name] {
+			return fmt.Errorf("duplicated certificate %q", c.Name)
+		}
+		certs[c.Name] = true
+	}
+	for _, c := range s.Certificates {
+		if c.Key != "" && !keys[c.Key] {
+			return fmt.Errorf("certificate %q: unknown key %q", c.Name, c.Key)
+		}
+		if c.Issuer != "" && !certs[c.Issuer] {
+			return fmt.Errorf("certificate %q: unknown issuer %q", c.Name, c.Issuer)
+		}
+		if _, err := s.template(c, time.Now()); err != nil {
+			return fmt.Errorf("certificate %q: %s", c.Name, err.Error())
+		}
+	}
+	for _, c := range s.Certificates {
+		if c.selfSigned() {
+			continue
+		}
+		p, _ := s.profile(s.certificateSpec(c.Issuer))
+		if !p.IsCA {
+			return fmt.Errorf("certificate %q: issuer %q is not a CA", c.Name, c.Issuer)
+		}
+	}
+
+	_, err := s.issuanceOrder()
+	return err
+}
+
+// Options returns the key generation options
+func (k *KeySpec) Options() (*key.Options, error) {
+	o := &key.Options{Type: key.RSA, Bits: 4096, Curve: "P-256"}
+	if k.Type != "" {
+		t, ok := key.TypeChoices[k.Type]
+		if !ok {
+			return nil, fmt.Errorf("unknown key type: %s", k.Type)
+		}
+		o.Type = t
+	}
+	if k.Bits != 0 {
+		if o.Type != key.RSA {
+			return nil, fmt.Errorf("bits is only allowed for RSA keys")
+		}
+		if k.Bits < 2048 {
+			return nil, fmt.Errorf("RSA keys must be at least 2048 bits")
+		}
+		o.Bits = k.Bits
+	}
+	if k.Curve != "" {
+		if o.Type != key.ECDSA {
+			return nil, fmt.Errorf("curve is only allowed for ECDSA keys")
+		}
+		if _, ok := key.CurveChoices[k.Curve]; !ok {
+			return nil, fmt.Errorf("unknown curve: %s", k.Curve)
+		}
+		o.Curve = k.Curve
+	}
+
+	// keep only the options that apply to the type, so that
+	// they can be compared with the ones of existing keys
+	switch o.Type {
+	case key.RSA:
+		o.Curve = ""
+	case key.ECDSA:
+		o.Bits = 0
+	default:
+		o.Bits, o.Curve = 0, ""
+	}
+	return o, nil
+}
+
+// keyName returns the name of the key used by the certificate
+func (c *CertificateSpec) keyName() string {
+	if c.Key != "" {
+		return c.Key
+	}
+	return c.Name
+}
+
+// keySpec returns the declared key, or one with default options
+func (s *Spec) keySpec(name string) *KeySpec {
+	for _, k := range s.Keys {
+		if k.Name == name {
+			return k
+		}
+	}
+	return &KeySpec{Name: name}
+}
+
+// certificateSpec returns the certificate with the name
+func (s *Spec) certificateSpec(name string) *CertificateSpec {
+	for _, c := range s.Certificates {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// selfSigned returns whether the certificate is its own issuer
+func (c *CertificateSpec) selfSigned() bool {
+	return c.Issuer == "" || c.Issuer == c.Name
+}
+
+// renewBefore returns the parsed renewal window
+func (s *Spec) renewBefore() (time.Duration, error) {
+	rb := s.RenewBefore
+	if rb == "" {
+		rb = DefaultRenewBefore
+	}
+	d, err := cert.ParseDuration(rb)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid renewBefore %q", s.RenewBefore)
+	}
+	return d, nil
+}
+
+// profile returns the certificate profile merged with the fields
+// informed at the certificate
+func (s *Spec) profile(c *CertificateSpec) (*cert.Profile, error) {
+	p := &cert.Profile{Days: DefaultDays}
+	if c.Profile != "" {
+		base, ok := s.Profiles[c.Profile]
+		if !ok {
+			if base, ok = cert.BuiltinProfiles[c.Profile]; !ok {
+				return nil, fmt.Errorf("unknown profile %q", c.Profile)
+			}
+		}
+		cp := *base
+		p = &cp
+		if p.Days == 0 {
+			p.Days = DefaultDays
+		}
+	}
+
+	if c.Days != 0 {
+		p.Days = c.Days
+	}
+	if c.KeyUsages != nil {
+		p.KeyUsages = c.KeyUsages
+	}
+	if c.ExtKeyUsages != nil {
+		p.ExtKeyUsages = c.ExtKeyUsages
+	}
+	if c.IsCA != nil {
+		p.IsCA = *c.IsCA
+		if !p.IsCA {
+			p.MaxPathLen = nil
+		}
+	}
+	if c.MaxPathLen != nil {
+		p.MaxPathLen = c.MaxPathLen
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	if p.Days <= 0 {
+		return nil, fmt.Errorf("days must be positive")
+	}
+	return p, nil
+}
+
+// template returns the certificate definition valid from notBefore
+func (s *Spec) template(c *CertificateSpec, notBefore time.Time) (*cert.X509Simplified, error) {
+	p, err := s.profile(c)
+	if err != nil {
+		return nil, err
+	}
+	subject, err := cert.ParseSubject(c.Subject)
+	if c.Subject == "" {
+		subject, err = &cert.Subject{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	x := p.Template(notBefore)
+	x.Subject.Override(subject)
+	x.DNSNames = cert.StringToDNSAddressList(strings.Join(c.DNSNames, ","))
+	if x.IPAddresses, err = cert.StringToIPAddressList(strings.Join(c.IPAddresses, ",")); err != nil {
+		return nil, err
+	}
+	if x.EmailAddresses, err = cert.StringToEmailList(strings.Join(c.EmailAddresses, ",")); err != nil {
+		return nil, err
+	}
+	if x.URIs, err = cert.StringToURIList(strings.Join(c.URIs, ",")); err != nil {
+		return nil, err
+	}
+
+	if x.Subject.CommonName == "" && len(x.DNSNames)+len(x.IPAddresses)+len(x.EmailAddresses)+len(x.URIs) == 0 {
+		return nil, fmt.Errorf("either a common name or a subject alternative name must be informed")
+	}
+	return x, nil
+}
+
+// issuanceOrder returns the certificates sorted so that every issuer
+// comes before the certificates it signs. Certificates at the same
+// depth keep the spec order
+func (s *Spec) issuanceOrder() ([]*CertificateSpec, error) {
+	byName := map[string]*CertificateSpec{}
+	for _, c := range s.Certificates {
+		byName[c.Name] = c
+	}
+
+	depth := map[string]int{}
+	var walk func(c *CertificateSpec, path []string) (int, error)
+	walk = func(c *CertificateSpec, path []string) (int, error) {
+		if d, ok := depth[c.Name]; ok {
+			return d, nil
+		}
+		for _, p := range path {
+			if p == c.Name {
+				return 0, fmt.Errorf("issuer cycle: %s -> %s", strings.Join(path, " -> "), c.Name)
+			}
+		}
+		d := 0
+		if !c.selfSigned() {
+			pd, err := walk(byName[c.Issuer], append(path, c.Name))
+			if err != nil {
+				return 0, err
+			}
+			d = pd + 1
+		}
+		depth[c.Name] = d
+		return d, nil
+	}
+
+	ordered := append([]*CertificateSpec{}, s.Certificates...)
+	for _, c := range ordered {
+		if _, err := walk(c, nil); err != nil {
+			return nil, err
+		}
+	}
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return depth[ordered[i].Name] < depth[ordered[j].Name]
+	})
+	return ordered, nil
+}
@@ -1,13 +1,11 @@
 package rsa
 
 import (
-	"bytes"
 	"crypto/rand"
 	"crypto/rsa"
-	"crypto/x509"
-	"encoding/pem"
-	"errors"
 	"fmt"
+
+	"github.com/odacremolbap/xfon/pkg/key"
 )
 
 // GenerateKey using the informed size
@@ -16,33 +14,22 @@ func GenerateKey(bits int) (*rsa.PrivateKey, error) {
 }
 
 // WritePEM serializes the RSA key into PEM format
-func WritePEM(key *rsa.PrivateKey) (string, error) {
-	var b bytes.Buffer
-	err := pem.Encode(
-		&b,
-		&pem.Block{
-			Type:  "RSA PRIVATE KEY",
-			Bytes: x509.MarshalPKCS1PrivateKey(key),
-		})
-	if err != nil {
-		return "", fmt.Errorf("error PEM encoding RSA key: %s", err.Error())
-	}
-
-	return b.String(), nil
+func WritePEM(k *rsa.PrivateKey) (string, error) {
+	return key.WritePEMFormat(k, key.PKCS1)
 }
 
-// ReadPEM looks for an RSA private key into a PEM certificate
+// ReadPEM looks for an RSA private key into a PEM certificate.
+// Both PKCS#1 and PKCS#8 encodings are accepted
 func ReadPEM(b []byte) (*rsa.PrivateKey, error) {
-
-	der, _ := pem.Decode(b)
-	if der == nil {
-		return nil, errors.New("private key file doesn't contain a PEM encoded key")
+	k, err := key.ReadPEM(b)
+	if err != nil {
+		return nil, err
 	}
 
-	key, err := x509.ParsePKCS1PrivateKey(der.Bytes)
-	if err != nil {
-		return nil, fmt.Errorf("cannot parse signing key file: %s", err.Error())
+	r, ok := k.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("expected an RSA key, found %T", k)
 	}
 
-	return key, nil
+	return r, nil
 }
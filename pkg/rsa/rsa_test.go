@@ -1,6 +1,8 @@
 package rsa
 
 import (
+	"crypto/x509"
+	"encoding/pem"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -47,3 +49,14 @@ func TestPEMEncode(t *testing.T) {
 		assert.Equalf(t, key, retKey, "test: %s", td.testName)
 	}
 }
+
+func TestReadPKCS8PEM(t *testing.T) {
+	key, _ := GenerateKey(1024)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.Nil(t, err)
+
+	p := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	retKey, err := ReadPEM(p)
+	assert.Nil(t, err)
+	assert.Equal(t, key, retKey)
+}
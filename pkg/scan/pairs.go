@@ -0,0 +1,129 @@
+package scan
+
+import (
+	"crypto"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/odacremolbap/xfon/pkg/key"
+)
+
+// Pair is a certificate found along with the private key for its public key
+type Pair struct {
+	Certificate string `json:"certificate" yaml:"certificate"`
+	// Position of the certificate at the file, starting at 1
+	Position int    `json:"position" yaml:"position"`
+	Subject  string `json:"subject" yaml:"subject"`
+	Key      string `json:"key" yaml:"key"`
+	// SPKIPin identifies the public key shared by both
+	SPKIPin string `json:"spkiPin" yaml:"spkiPin"`
+}
+
+// PairReport is the outcome of a key pair scan
+type PairReport struct {
+	// Pairs sorted by certificate path and position
+	Pairs []*Pair `json:"pairs" yaml:"pairs"`
+	// UnmatchedKeys are keys without any certificate
+	UnmatchedKeys []string `json:"unmatchedKeys" yaml:"unmatchedKeys"`
+	// Errors reading files or directories, and encrypted
+	// keys, which do not stop the scan
+	Errors []string `json:"errors,omitempty" yaml:"errors,omitempty"`
+}
+
+// FindPairs walks the paths, which can be files or directories, matching
+// every PEM or DER certificate found with the unencrypted PEM private keys
+// found. A file containing both a certificate and its key matches itself
+func FindPairs(paths []string) *PairReport {
+	type found struct {
+		path     string
+		position int
+		cert     *x509.Certificate
+	}
+	type foundKey struct {
+		path string
+		pub  crypto.PublicKey
+	}
+	certs := []found{}
+	keys := []foundKey{}
+
+	r := &PairReport{Pairs: []*Pair{}, UnmatchedKeys: []string{}}
+	for _, root := range paths {
+		errs := walkFiles(root, func(path string) error {
+			cs, err := readFile(path)
+			if err != nil {
+				return err
+			}
+			for i, c := range cs {
+				certs = append(certs, found{path, i + 1, c})
+			}
+
+			k, err := readKeyFile(path)
+			if err != nil {
+				return fmt.Errorf("%s: %s", path, err.Error())
+			}
+			if k != nil {
+				keys = append(keys, foundKey{path, k.Public()})
+			}
+			return nil
+		})
+		r.Errors = append(r.Errors, errs...)
+	}
+
+	for _, k := range keys {
+		matched := false
+		for _, c := range certs {
+			if !key.Matches(k.pub, c.cert.PublicKey) {
+				continue
+			}
+			pin, err := key.SPKIPin(k.pub)
+			if err != nil {
+				r.Errors = append(r.Errors, k.path+": "+err.Error())
+				break
+			}
+			r.Pairs = append(r.Pairs, &Pair{
+				Certificate: c.path,
+				Position:    c.position,
+				Subject:     c.cert.Subject.String(),
+				Key:         k.path,
+				SPKIPin:     pin,
+			})
+			matched = true
+		}
+		if !matched {
+			r.UnmatchedKeys = append(r.UnmatchedKeys, k.path)
+		}
+	}
+
+	sort.SliceStable(r.Pairs, func(i, j int) bool {
+		a, b := r.Pairs[i], r.Pairs[j]
+		if a.Certificate != b.Certificate {
+			return a.Certificate < b.Certificate
+		}
+		return a.Position < b.Position
+	})
+	return r
+}
+
+// readKeyFile returns the private key at a PEM file, nil if it
+// does not contain a private key or is too large. Encrypted keys
+// are reported as errors since they cannot be matched
+func readKeyFile(path string) (crypto.Signer, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.Mode().IsRegular() || fi.Size() > maxFileSize {
+		return nil, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.Contains(string(b), "PRIVATE KEY-----") {
+		return nil, nil
+	}
+	return key.ReadPEM(b)
+}
@@ -0,0 +1,249 @@
+package scan
+
+import (
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/odacremolbap/xfon/pkg/cert"
+)
+
+// maxFileSize skips files too large to be certificates
+const maxFileSize = 1 << 20
+
+// certificateExtensions are expected to hold certificates, and
+// reported as errors when they cannot be read
+var certificateExtensions = map[string]bool{
+	".crt": true,
+	".cer": true,
+	".der": true,
+}
+
+// Status of a certificate expiry
+type Status string
+
+const (
+	// StatusOK certificates expire after the warning threshold
+	StatusOK Status = "ok"
+	// StatusWarning certificates expire within the warning threshold
+	StatusWarning Status = "warning"
+	// StatusCritical certificates expire within the critical threshold
+	StatusCritical Status = "critical"
+	// StatusExpired certificates are past their notAfter date
+	StatusExpired Status = "expired"
+)
+
+// severity orders statuses, also used as the Prometheus metric value
+var severity = map[Status]int{
+	StatusOK:       0,
+	StatusWarning:  1,
+	StatusCritical: 2,
+	StatusExpired:  3,
+}
+
+// Options for scans
+type Options struct {
+	// Warn and Crit are the thresholds before expiry
+	// for warning and critical statuses
+	Warn time.Duration
+	Crit time.Duration
+	// Now is the time expiry is computed at, current time if zero
+	Now time.Time
+}
+
+// Result is a certificate found by a scan along with its expiry status
+type Result struct {
+	Path string `json:"path" yaml:"path"`
+	// Position of the certificate at the file, starting at 1
+	Position  int       `json:"position" yaml:"position"`
+	Subject   string    `json:"subject" yaml:"subject"`
+	Issuer    string    `json:"issuer" yaml:"issuer"`
+	Serial    string    `json:"serial" yaml:"serial"`
+	NotBefore time.Time `json:"notBefore" yaml:"notBefore"`
+	NotAfter  time.Time `json:"notAfter" yaml:"notAfter"`
+	// DaysLeft until expiry, negative when expired
+	DaysLeft int    `json:"daysLeft" yaml:"daysLeft"`
+	Status   Status `json:"status" yaml:"status"`
+}
+
+// Report is the outcome of a scan
+type Report struct {
+	// Certificates sorted by expiry
+	Certificates []*Result `json:"certificates" yaml:"certificates"`
+	// Errors reading files or directories, which do not stop the scan
+	Errors []string `json:"errors,omitempty" yaml:"errors,omitempty"`
+}
+
+// Scan walks the paths, which can be files or directories, reporting the
+// expiry status of every PEM or DER certificate found. Files that do not
+// contain certificates are skipped
+func Scan(paths []string, o *Options) *Report {
+	now := o.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	r := &Report{Certificates: []*Result{}}
+	for _, root := range paths {
+		errs := walkFiles(root, func(path string) error {
+			certs, err := readFile(path)
+			if err != nil {
+				return err
+			}
+			for i, c := range certs {
+				r.Certificates = append(r.Certificates, newResult(path, i+1, c, now, o))
+			}
+			return nil
+		})
+		r.Errors = append(r.Errors, errs...)
+	}
+
+	sort.SliceStable(r.Certificates, func(i, j int) bool {
+		return r.Certificates[i].NotAfter.Before(r.Certificates[j].NotAfter)
+	})
+	return r
+}
+
+// Status returns the most severe status found, ok if none
+func (r *Report) Status() Status {
+	s := StatusOK
+	for _, c := range r.Certificates {
+		if severity[c.Status] > severity[s] {
+			s = c.Status
+		}
+	}
+	return s
+}
+
+// WritePrometheus writes the report in the Prometheus text exposition
+// format, as read by the node exporter textfile collector
+func (r *Report) WritePrometheus(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("# HELP xfon_certificate_not_after_timestamp_seconds Certificate expiry as a Unix timestamp.\n")
+	b.WriteString("# TYPE xfon_certificate_not_after_timestamp_seconds gauge\n")
+	for _, c := range r.Certificates {
+		fmt.Fprintf(&b, "xfon_certificate_not_after_timestamp_seconds{%s} %d\n", labels(c), c.NotAfter.Unix())
+	}
+	b.WriteString("# HELP xfon_certificate_expiry_status Certificate expiry status: 0 ok, 1 warning, 2 critical, 3 expired.\n")
+	b.WriteString("# TYPE xfon_certificate_expiry_status gauge\n")
+	for _, c := range r.Certificates {
+		fmt.Fprintf(&b, "xfon_certificate_expiry_status{%s} %d\n", labels(c), severity[c.Status])
+	}
+	b.WriteString("# HELP xfon_scan_errors Files or directories that could not be read.\n")
+	b.WriteString("# TYPE xfon_scan_errors gauge\n")
+	fmt.Fprintf(&b, "xfon_scan_errors %d\n", len(r.Errors))
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// walkFiles calls visit for every file under root, returning the errors
+// found, which do not stop the walk. A root that is a symbolic link to a
+// directory is followed, reporting paths under the root, while symbolic
+// links to directories below it are not
+func walkFiles(root string, visit func(path string) error) []string {
+	errs := []string{}
+	dir := root
+	if fi, err := os.Lstat(root); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+		if fi, err := os.Stat(root); err == nil && fi.IsDir() {
+			if dir, err = filepath.EvalSymlinks(root); err != nil {
+				return append(errs, err.Error())
+			}
+		}
+	}
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			errs = append(errs, err.Error())
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if dir != root {
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				errs = append(errs, err.Error())
+				return nil
+			}
+			path = filepath.Join(root, rel)
+		}
+		if err := visit(path); err != nil {
+			errs = append(errs, err.Error())
+		}
+		return nil
+	})
+	if err != nil {
+		errs = append(errs, err.Error())
+	}
+	return errs
+}
+
+// readFile returns the certificates at a file, none if it does not
+// contain certificates or is too large. Files with PEM certificates or
+// a certificate extension that cannot be parsed are reported as errors
+func readFile(path string) ([]*x509.Certificate, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.Mode().IsRegular() || fi.Size() > maxFileSize {
+		return nil, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	certs, err := cert.ReadCertificates(b)
+	if err != nil {
+		if strings.Contains(string(b), "-----BEGIN CERTIFICATE-----") || certificateExtensions[strings.ToLower(filepath.Ext(path))] {
+			return nil, fmt.Errorf("%s: %s", path, err.Error())
+		}
+		return nil, nil
+	}
+	return certs, nil
+}
+
+// newResult computes the expiry status of a certificate
+func newResult(path string, position int, c *x509.Certificate, now time.Time, o *Options) *Result {
+	left := c.NotAfter.Sub(now)
+	s := StatusOK
+	switch {
+	case left <= 0:
+		s = StatusExpired
+	case left <= o.Crit:
+		s = StatusCritical
+	case left <= o.Warn:
+		s = StatusWarning
+	}
+
+	days := int(left / (24 * time.Hour))
+	if left < 0 && left%(24*time.Hour) != 0 {
+		days--
+	}
+
+	return &Result{
+		Path:      path,
+		Position:  position,
+		Subject:   c.Subject.String(),
+		Issuer:    c.Issuer.String(),
+		Serial:    cert.FormatHex(c.SerialNumber.Bytes()),
+		NotBefore: c.NotBefore.UTC(),
+		NotAfter:  c.NotAfter.UTC(),
+		DaysLeft:  days,
+		Status:    s,
+	}
+}
+
+// labels renders the Prometheus labels identifying a certificate
+func labels(c *Result) string {
+	escape := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return fmt.Sprintf(`path="%s",position="%d",subject="%s",issuer="%s",serial="%s"`,
+		escape.Replace(c.Path), c.Position, escape.Replace(c.Subject), escape.Replace(c.Issuer), c.Serial)
+}
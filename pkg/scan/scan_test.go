@@ -0,0 +1,281 @@
+package scan
+
+import (
+	"crypto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/odacremolbap/xfon/pkg/cert"
+	"github.com/odacremolbap/xfon/pkg/key"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestCertificate returns a DER self signed certificate for the key
+func newTestCertificate(t *testing.T, k crypto.Signer, cn string, notBefore, notAfter time.Time) []byte {
+	b, err := cert.GenerateX509SelfSignedCertificate(&cert.X509Simplified{
+		Subject:   &cert.Subject{CommonName: cn},
+		NotBefore: notBefore,
+		NotAfter:  notAfter,
+	}, k)
+	assert.Nil(t, err)
+	return b
+}
+
+// newTestKey returns an ECDSA key and its PEM encoding
+func newTestKey(t *testing.T) (crypto.Signer, string) {
+	k, err := key.GenerateKey(&key.Options{Type: key.ECDSA, Curve: "P-256"})
+	assert.Nil(t, err)
+	p, err := key.WritePEM(k)
+	assert.Nil(t, err)
+	return k, p
+}
+
+// toPEM encodes a DER certificate as PEM
+func toPEM(t *testing.T, b []byte) string {
+	p, err := cert.WritePEM(b)
+	assert.Nil(t, err)
+	return p
+}
+
+// writeTestFiles writes the contents to their paths
+// relative to dir, creating the parent directories
+func writeTestFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		assert.Nil(t, os.MkdirAll(filepath.Dir(path), 0700))
+		assert.Nil(t, os.WriteFile(path, []byte(content), 0600))
+	}
+}
+
+func TestScan(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	k, keyPEM := newTestKey(t)
+	newCert := func(cn string, left time.Duration) []byte {
+		return newTestCertificate(t, k, cn, now.AddDate(-1, 0, 0), now.Add(left))
+	}
+
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"bundle/fullchain.pem":    toPEM(t, newCert("leaf", 3*day)) + toPEM(t, newCert("intermediate", 20*day)),
+		"der/expired.cer":         string(newCert("expired", -36*time.Hour)),
+		"der/root.der":            string(newCert("root", 400*day)),
+		"thresholds/ok.crt":       toPEM(t, newCert("ok", 40*day)),
+		"thresholds/warning.crt":  toPEM(t, newCert("warning", 20*day)),
+		"thresholds/critical.crt": toPEM(t, newCert("critical", 3*day)),
+		"mixed/combined.pem":      keyPEM + toPEM(t, newCert("combined", 40*day)),
+		"mixed/server.key":        keyPEM,
+		"mixed/notes.txt":         "nothing to see",
+		"errors/broken.pem":       "-----BEGIN CERTIFICATE-----\nAAAA\n-----END CERTIFICATE-----\n",
+		"errors/garbage.crt":      "nothing to see",
+		"errors/notes.txt":        "nothing to see",
+	})
+	link := filepath.Join(t.TempDir(), "link")
+	assert.Nil(t, os.Symlink(filepath.Join(dir, "bundle"), link))
+
+	type expectedResult struct {
+		subject  string
+		path     string
+		position int
+		daysLeft int
+		status   Status
+	}
+	var testData = []struct {
+		testName string
+		paths    []string
+		results  []expectedResult
+		errors   []string
+		status   Status
+		metrics  []string
+	}{
+		{
+			testName: "bundle positions",
+			paths:    []string{filepath.Join(dir, "bundle")},
+			results: []expectedResult{
+				{"CN=leaf", filepath.Join(dir, "bundle", "fullchain.pem"), 1, 3, StatusCritical},
+				{"CN=intermediate", filepath.Join(dir, "bundle", "fullchain.pem"), 2, 20, StatusWarning},
+			},
+			status: StatusCritical,
+		},
+		{
+			testName: "DER by extension",
+			paths:    []string{filepath.Join(dir, "der")},
+			results: []expectedResult{
+				{"CN=expired", filepath.Join(dir, "der", "expired.cer"), 1, -2, StatusExpired},
+				{"CN=root", filepath.Join(dir, "der", "root.der"), 1, 400, StatusOK},
+			},
+			status: StatusExpired,
+		},
+		{
+			testName: "thresholds",
+			paths:    []string{filepath.Join(dir, "thresholds")},
+			results: []expectedResult{
+				{"CN=critical", filepath.Join(dir, "thresholds", "critical.crt"), 1, 3, StatusCritical},
+				{"CN=warning", filepath.Join(dir, "thresholds", "warning.crt"), 1, 20, StatusWarning},
+				{"CN=ok", filepath.Join(dir, "thresholds", "ok.crt"), 1, 40, StatusOK},
+			},
+			status: StatusCritical,
+		},
+		{
+			testName: "keys and other files skipped",
+			paths:    []string{filepath.Join(dir, "mixed")},
+			results: []expectedResult{
+				{"CN=combined", filepath.Join(dir, "mixed", "combined.pem"), 1, 40, StatusOK},
+			},
+			status: StatusOK,
+		},
+		{
+			testName: "errors",
+			paths:    []string{filepath.Join(dir, "errors"), filepath.Join(dir, "missing")},
+			errors:   []string{filepath.Join(dir, "errors", "broken.pem"), filepath.Join(dir, "errors", "garbage.crt"), filepath.Join(dir, "missing")},
+			status:   StatusOK,
+			metrics:  []string{"xfon_scan_errors 3\n"},
+		},
+		{
+			testName: "symbolic link root",
+			paths:    []string{link},
+			results: []expectedResult{
+				{"CN=leaf", filepath.Join(link, "fullchain.pem"), 1, 3, StatusCritical},
+				{"CN=intermediate", filepath.Join(link, "fullchain.pem"), 2, 20, StatusWarning},
+			},
+			status: StatusCritical,
+		},
+		{
+			testName: "prometheus labels",
+			paths:    []string{filepath.Join(dir, "der", "root.der")},
+			results: []expectedResult{
+				{"CN=root", filepath.Join(dir, "der", "root.der"), 1, 400, StatusOK},
+			},
+			status: StatusOK,
+			metrics: []string{
+				`xfon_certificate_not_after_timestamp_seconds{path="` + filepath.Join(dir, "der", "root.der") + `",position="1",subject="CN=root",issuer="CN=root",serial="`,
+				`xfon_certificate_expiry_status{path="` + filepath.Join(dir, "der", "root.der") + `",position="1",`,
+				"# TYPE xfon_certificate_expiry_status gauge\n",
+				"xfon_scan_errors 0\n",
+			},
+		},
+	}
+
+	o := &Options{Warn: 30 * day, Crit: 7 * day, Now: now}
+	for _, td := range testData {
+		r := Scan(td.paths, o)
+		if assert.Equalf(t, len(td.results), len(r.Certificates), "test: %s", td.testName) {
+			for i, e := range td.results {
+				c := r.Certificates[i]
+				assert.Equalf(t, e.subject, c.Subject, "test: %s", td.testName)
+				assert.Equalf(t, e.path, c.Path, "test: %s", td.testName)
+				assert.Equalf(t, e.position, c.Position, "test: %s", td.testName)
+				assert.Equalf(t, e.daysLeft, c.DaysLeft, "test: %s", td.testName)
+				assert.Equalf(t, e.status, c.Status, "test: %s", td.testName)
+			}
+		}
+		if assert.Equalf(t, len(td.errors), len(r.Errors), "test: %s", td.testName) {
+			for i, e := range td.errors {
+				assert.Containsf(t, r.Errors[i], e, "test: %s", td.testName)
+			}
+		}
+		assert.Equalf(t, td.status, r.Status(), "test: %s", td.testName)
+
+		var b strings.Builder
+		assert.NoErrorf(t, r.WritePrometheus(&b), "test: %s", td.testName)
+		for _, m := range td.metrics {
+			assert.Containsf(t, b.String(), m, "test: %s", td.testName)
+		}
+	}
+}
+
+func TestLabels(t *testing.T) {
+	r := &Result{Path: `C:\certs\a.pem`, Position: 2, Subject: `CN=say "hi"`, Issuer: "CN=a\nb", Serial: "01"}
+	assert.Equal(t, `path="C:\\certs\\a.pem",position="2",subject="CN=say \"hi\"",issuer="CN=a\nb",serial="01"`, labels(r))
+}
+
+func TestFindPairs(t *testing.T) {
+	now := time.Now()
+	newPair := func(cn string) (string, string) {
+		k, keyPEM := newTestKey(t)
+		return toPEM(t, newTestCertificate(t, k, cn, now, now.AddDate(0, 0, 1))), keyPEM
+	}
+	webCert, webKey := newPair("web")
+	apiCert, apiKey := newPair("api")
+	otherCert, _ := newPair("other")
+	_, orphanKey := newPair("orphan")
+	k, _ := newTestKey(t)
+	encryptedKey, err := key.WriteEncryptedPEM(k, []byte("secret"), key.PBKDF2)
+	assert.Nil(t, err)
+
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"combined/api.pem":       apiKey + apiCert,
+		"bundle/web.crt":         otherCert + webCert,
+		"bundle/keys/web.key":    webKey,
+		"orphan/orphan.key":      orphanKey,
+		"orphan/notes.txt":       "nothing to see",
+		"encrypted/api.pem":      apiCert,
+		"encrypted/internal.key": encryptedKey,
+	})
+	link := filepath.Join(t.TempDir(), "link")
+	assert.Nil(t, os.Symlink(filepath.Join(dir, "bundle"), link))
+
+	type expectedPair struct {
+		certificate string
+		position    int
+		subject     string
+		key         string
+	}
+	var testData = []struct {
+		testName  string
+		paths     []string
+		pairs     []expectedPair
+		unmatched []string
+		errors    int
+	}{
+		{
+			testName: "certificate and key in one file",
+			paths:    []string{filepath.Join(dir, "combined")},
+			pairs:    []expectedPair{{filepath.Join(dir, "combined", "api.pem"), 1, "CN=api", filepath.Join(dir, "combined", "api.pem")}},
+		},
+		{
+			testName: "certificate second in a bundle",
+			paths:    []string{filepath.Join(dir, "bundle")},
+			pairs:    []expectedPair{{filepath.Join(dir, "bundle", "web.crt"), 2, "CN=web", filepath.Join(dir, "bundle", "keys", "web.key")}},
+		},
+		{
+			testName:  "orphan key",
+			paths:     []string{filepath.Join(dir, "orphan")},
+			unmatched: []string{filepath.Join(dir, "orphan", "orphan.key")},
+		},
+		{
+			testName: "encrypted key",
+			paths:    []string{filepath.Join(dir, "encrypted")},
+			errors:   1,
+		},
+		{
+			testName: "symbolic link root",
+			paths:    []string{link},
+			pairs:    []expectedPair{{filepath.Join(link, "web.crt"), 2, "CN=web", filepath.Join(link, "keys", "web.key")}},
+		},
+	}
+
+	for _, td := range testData {
+		r := FindPairs(td.paths)
+		if assert.Equalf(t, len(td.pairs), len(r.Pairs), "test: %s", td.testName) {
+			for i, e := range td.pairs {
+				p := r.Pairs[i]
+				assert.Equalf(t, e.certificate, p.Certificate, "test: %s", td.testName)
+				assert.Equalf(t, e.position, p.Position, "test: %s", td.testName)
+				assert.Equalf(t, e.subject, p.Subject, "test: %s", td.testName)
+				assert.Equalf(t, e.key, p.Key, "test: %s", td.testName)
+				assert.NotEmptyf(t, p.SPKIPin, "test: %s", td.testName)
+			}
+		}
+		if td.unmatched == nil {
+			td.unmatched = []string{}
+		}
+		assert.Equalf(t, td.unmatched, r.UnmatchedKeys, "test: %s", td.testName)
+		assert.Equalf(t, td.errors, len(r.Errors), "test: %s", td.testName)
+	}
+}
@@ -0,0 +1,265 @@
+package truststore
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/odacremolbap/xfon/pkg/cert"
+	"github.com/odacremolbap/xfon/pkg/pkcs12"
+	"github.com/pavlo-v-chernykh/keystore-go/v4"
+)
+
+// Format of a truststore
+type Format string
+
+const (
+	// JKS is the Java KeyStore format
+	JKS Format = "jks"
+	// PKCS12 is a PKCS#12 truststore, supported by Java 8 onwards
+	PKCS12 Format = "pkcs12"
+	// PEMBundle is a concatenation of PEM certificates, each one
+	// preceded by a comment line with its alias
+	PEMBundle Format = "pem-bundle"
+)
+
+// jksMinPasswordLen is the minimum password length keytool accepts
+const jksMinPasswordLen = 6
+
+// FormatChoices is the set of supported truststore formats
+var FormatChoices = map[string]Format{
+	string(JKS):       JKS,
+	string(PKCS12):    PKCS12,
+	string(PEMBundle): PEMBundle,
+}
+
+// Entry is a trusted certificate and its alias
+type Entry struct {
+	Alias       string
+	Certificate *x509.Certificate
+}
+
+// NewEntries pairs certificates with their aliases. Missing aliases are
+// derived from the certificate subject. Aliases are case insensitive,
+// as Java treats them, and must be unique
+func NewEntries(certs []*x509.Certificate, aliases []string) ([]Entry, error) {
+	if len(aliases) > len(certs) {
+		return nil, fmt.Errorf("got %d aliases for %d certificates", len(aliases), len(certs))
+	}
+
+	used := map[string]bool{}
+	for _, a := range aliases {
+		a = strings.ToLower(a)
+		if a == "" {
+			return nil, fmt.Errorf("aliases must not be empty")
+		}
+		if used[a] {
+			return nil, fmt.Errorf("duplicated alias %q", a)
+		}
+		used[a] = true
+	}
+
+	entries := make([]Entry, len(certs))
+	for i, c := range certs {
+		entries[i].Certificate = c
+		if i < len(aliases) {
+			entries[i].Alias = strings.ToLower(aliases[i])
+			continue
+		}
+
+		entries[i].Alias = uniqueAlias(DefaultAlias(c), used)
+	}
+
+	return entries, nil
+}
+
+// uniqueAlias returns the base alias, adding a numeric suffix
+// when already used, and marks the result as used
+func uniqueAlias(base string, used map[string]bool) string {
+	alias := base
+	for n := 2; used[alias]; n++ {
+		alias = fmt.Sprintf("%s-%d", base, n)
+	}
+	used[alias] = true
+	return alias
+}
+
+// DefaultAlias derives an alias from the certificate common name, or the
+// full subject when it has none, keeping lowercase letters, digits, dots
+// and underscores and replacing anything else with dashes
+func DefaultAlias(c *x509.Certificate) string {
+	name := c.Subject.CommonName
+	if name == "" {
+		name = c.Subject.String()
+	}
+
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '.', r == '_':
+			b.WriteRune(r)
+			dash = false
+		case !dash && b.Len() != 0:
+			b.WriteRune('-')
+			dash = true
+		}
+	}
+
+	alias := strings.TrimSuffix(b.String(), "-")
+	if alias == "" {
+		alias = "cert"
+	}
+	return alias
+}
+
+// Encode writes the entries as a truststore. The password is ignored for
+// PEM bundles, and for JKS it must be at least 6 characters long. Encryption
+// only applies to PKCS#12 truststores
+func Encode(entries []Entry, f Format, password string, e pkcs12.Encryption) ([]byte, error) {
+	switch f {
+	case JKS:
+		if len(password) < jksMinPasswordLen {
+			return nil, fmt.Errorf("JKS password must be at least %d characters", jksMinPasswordLen)
+		}
+		ks := keystore.New(keystore.WithOrderedAliases())
+		for _, entry := range entries {
+			err := ks.SetTrustedCertificateEntry(entry.Alias, keystore.TrustedCertificateEntry{
+				CreationTime: time.Now(),
+				Certificate: keystore.Certificate{
+					Type:    "X.509",
+					Content: entry.Certificate.Raw,
+				},
+			})
+			if err != nil {
+				return nil, fmt.Errorf("error adding %q to JKS truststore: %s", entry.Alias, err.Error())
+			}
+		}
+		var b bytes.Buffer
+		if err := ks.Store(&b, []byte(password)); err != nil {
+			return nil, fmt.Errorf("error encoding JKS truststore: %s", err.Error())
+		}
+		return b.Bytes(), nil
+
+	case PKCS12:
+		certs := make([]*x509.Certificate, len(entries))
+		aliases := make([]string, len(entries))
+		for i, entry := range entries {
+			certs[i], aliases[i] = entry.Certificate, entry.Alias
+		}
+		return pkcs12.EncodeTrustStore(certs, aliases, password, e)
+
+	case PEMBundle:
+		var b strings.Builder
+		for _, entry := range entries {
+			p, err := cert.WritePEM(entry.Certificate.Raw)
+			if err != nil {
+				return nil, err
+			}
+			fmt.Fprintf(&b, "# %s\n%s", entry.Alias, p)
+		}
+		return []byte(b.String()), nil
+	}
+
+	return nil, fmt.Errorf("unknown truststore format: %s", f)
+}
+
+// Decode reads the entries of a truststore. PKCS#12 truststores do not
+// report their aliases, which are derived from the certificates instead
+func Decode(b []byte, f Format, password string) ([]Entry, error) {
+	switch f {
+	case JKS:
+		ks := keystore.New(keystore.WithOrderedAliases())
+		if err := ks.Load(bytes.NewReader(b), []byte(password)); err != nil {
+			return nil, fmt.Errorf("error decoding JKS truststore: %s", err.Error())
+		}
+		entries := []Entry{}
+		for _, alias := range ks.Aliases() {
+			e, err := ks.GetTrustedCertificateEntry(alias)
+			if err != nil {
+				return nil, fmt.Errorf("error reading JKS entry %q: %s", alias, err.Error())
+			}
+			c, err := x509.ParseCertificate(e.Certificate.Content)
+			if err != nil {
+				return nil, fmt.Errorf("cannot parse JKS entry %q: %s", alias, err.Error())
+			}
+			entries = append(entries, Entry{Alias: alias, Certificate: c})
+		}
+		return entries, nil
+
+	case PKCS12:
+		certs, err := pkcs12.DecodeTrustStore(b, password)
+		if err != nil {
+			return nil, err
+		}
+		return NewEntries(certs, nil)
+
+	case PEMBundle:
+		return decodePEMBundle(b)
+	}
+
+	return nil, fmt.Errorf("unknown truststore format: %s", f)
+}
+
+// decodePEMBundle reads the certificates at a PEM bundle, taking
+// aliases from the comment lines preceding each one
+func decodePEMBundle(b []byte) ([]Entry, error) {
+	var (
+		certs   []*x509.Certificate
+		aliases []string
+		alias   string
+	)
+
+	rest := b
+	for {
+		block, next := pem.Decode(rest)
+		if block == nil {
+			break
+		}
+
+		// the alias is the last comment before the block
+		s := bufio.NewScanner(bytes.NewReader(rest[:len(rest)-len(next)]))
+		alias = ""
+		for s.Scan() {
+			line := strings.TrimSpace(s.Text())
+			if strings.HasPrefix(line, "-----BEGIN") {
+				break
+			}
+			if strings.HasPrefix(line, "#") {
+				alias = strings.TrimSpace(strings.TrimPrefix(line, "#"))
+			}
+		}
+		rest = next
+
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		c, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse certificate: %s", err.Error())
+		}
+		certs = append(certs, c)
+		aliases = append(aliases, alias)
+	}
+
+	// comment aliases come first, and repeated ones get a suffix.
+	// Certificates without comment get an alias derived from them
+	used := map[string]bool{}
+	entries := make([]Entry, len(certs))
+	for i, c := range certs {
+		entries[i].Certificate = c
+		if aliases[i] != "" {
+			entries[i].Alias = uniqueAlias(strings.ToLower(aliases[i]), used)
+		}
+	}
+	for i, c := range certs {
+		if entries[i].Alias == "" {
+			entries[i].Alias = uniqueAlias(DefaultAlias(c), used)
+		}
+	}
+	return entries, nil
+}
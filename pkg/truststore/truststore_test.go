@@ -0,0 +1,170 @@
+package truststore
+
+import (
+	"crypto/x509"
+	"testing"
+
+	"github.com/odacremolbap/xfon/internal/testutil"
+	"github.com/odacremolbap/xfon/pkg/cert"
+	"github.com/odacremolbap/xfon/pkg/pkcs12"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewEntries(t *testing.T) {
+	root, _ := testutil.NewCA(t, &cert.Subject{CommonName: "Example Root CA"})
+	other, _ := testutil.NewCA(t, &cert.Subject{CommonName: "Example Root CA"})
+	noCN, _ := testutil.NewCA(t, &cert.Subject{Organization: []string{"ACME"}})
+
+	var testData = []struct {
+		testName string
+		certs    []*x509.Certificate
+		aliases  []string
+		expected []string
+		errorRet bool
+	}{
+		{
+			testName: "default aliases",
+			certs:    []*x509.Certificate{root, noCN},
+			expected: []string{"example-root-ca", "o-acme"},
+		},
+		{
+			testName: "repeated default aliases",
+			certs:    []*x509.Certificate{root, other, root},
+			expected: []string{"example-root-ca", "example-root-ca-2", "example-root-ca-3"},
+		},
+		{
+			testName: "explicit aliases are lowercased",
+			certs:    []*x509.Certificate{root, other},
+			aliases:  []string{"Root"},
+			expected: []string{"root", "example-root-ca"},
+		},
+		{
+			testName: "default alias avoids explicit ones",
+			certs:    []*x509.Certificate{root, other},
+			aliases:  []string{"example-root-ca"},
+			expected: []string{"example-root-ca", "example-root-ca-2"},
+		},
+		{
+			testName: "duplicated aliases",
+			certs:    []*x509.Certificate{root, other},
+			aliases:  []string{"root", "ROOT"},
+			errorRet: true,
+		},
+		{
+			testName: "empty alias",
+			certs:    []*x509.Certificate{root},
+			aliases:  []string{""},
+			errorRet: true,
+		},
+		{
+			testName: "more aliases than certificates",
+			certs:    []*x509.Certificate{root},
+			aliases:  []string{"a", "b"},
+			errorRet: true,
+		},
+	}
+
+	for _, td := range testData {
+		entries, err := NewEntries(td.certs, td.aliases)
+		if td.errorRet {
+			assert.Errorf(t, err, "test: %s", td.testName)
+			continue
+		}
+		assert.NoErrorf(t, err, "test: %s", td.testName)
+		aliases := []string{}
+		for _, e := range entries {
+			aliases = append(aliases, e.Alias)
+		}
+		assert.Equal(t, td.expected, aliases, "test: %s", td.testName)
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	rootA, _ := testutil.NewCA(t, &cert.Subject{CommonName: "root a"})
+	rootB, _ := testutil.NewCA(t, &cert.Subject{CommonName: "root b"})
+	entries, err := NewEntries([]*x509.Certificate{rootA, rootB}, []string{"a", "b"})
+	assert.Nil(t, err)
+
+	var testData = []struct {
+		testName    string
+		format      Format
+		password    string
+		withAliases bool
+		errorRet    bool
+	}{
+		{testName: "JKS", format: JKS, password: "changeit", withAliases: true},
+		{testName: "JKS short password", format: JKS, password: "pw", errorRet: true},
+		{testName: "PKCS#12", format: PKCS12, password: "changeit"},
+		{testName: "PEM bundle", format: PEMBundle, withAliases: true},
+		{testName: "unknown format", format: Format("bks"), errorRet: true},
+	}
+
+	for _, td := range testData {
+		b, err := Encode(entries, td.format, td.password, pkcs12.Modern)
+		if td.errorRet {
+			assert.Errorf(t, err, "test: %s", td.testName)
+			continue
+		}
+		assert.NoErrorf(t, err, "test: %s", td.testName)
+
+		decoded, err := Decode(b, td.format, td.password)
+		assert.NoErrorf(t, err, "test: %s", td.testName)
+		if !assert.Equal(t, len(entries), len(decoded), "test: %s", td.testName) {
+			continue
+		}
+		for i := range entries {
+			assert.True(t, entries[i].Certificate.Equal(decoded[i].Certificate), "test: %s", td.testName)
+			if td.withAliases {
+				assert.Equal(t, entries[i].Alias, decoded[i].Alias, "test: %s", td.testName)
+			}
+		}
+	}
+
+	if b, err := Encode(entries, JKS, "changeit", pkcs12.Modern); assert.Nil(t, err) {
+		_, err = Decode(b, JKS, "wrong password")
+		assert.NotNil(t, err)
+	}
+}
+
+func TestDecodePEMBundle(t *testing.T) {
+	root, _ := testutil.NewCA(t, &cert.Subject{CommonName: "Example Root CA"})
+	other, _ := testutil.NewCA(t, &cert.Subject{CommonName: "Other Root CA"})
+	toPEM := func(c *x509.Certificate) string {
+		p, err := cert.WritePEM(c.Raw)
+		assert.Nil(t, err)
+		return p
+	}
+
+	var testData = []struct {
+		testName string
+		bundle   string
+		expected []string
+	}{
+		{
+			testName: "comment aliases",
+			bundle:   "# Root\n" + toPEM(root) + "# Other\n" + toPEM(other),
+			expected: []string{"root", "other"},
+		},
+		{
+			testName: "repeated comment aliases",
+			bundle:   "# root\n" + toPEM(root) + "# ROOT\n" + toPEM(other),
+			expected: []string{"root", "root-2"},
+		},
+		{
+			testName: "derived alias avoids comment aliases",
+			bundle:   toPEM(root) + "# example-root-ca\n" + toPEM(other),
+			expected: []string{"example-root-ca-2", "example-root-ca"},
+		},
+	}
+
+	for _, td := range testData {
+		entries, err := Decode([]byte(td.bundle), PEMBundle, "")
+		assert.NoErrorf(t, err, "test: %s", td.testName)
+		aliases := []string{}
+		for _, e := range entries {
+			aliases = append(aliases, e.Alias)
+		}
+		assert.Equal(t, td.expected, aliases, "test: %s", td.testName)
+	}
+}